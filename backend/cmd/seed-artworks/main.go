@@ -0,0 +1,103 @@
+// Command seed-artworks creates or updates the Galeri catalog from a JSON
+// file, copying each entry's image into the artwork image store. Entries
+// are matched by name, so running it again only applies what changed.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"catetin/backend/internal/config"
+	"catetin/backend/internal/db"
+	"catetin/backend/internal/services"
+)
+
+// seedArtwork is one catalog entry of the seed file
+type seedArtwork struct {
+	Name           string     `json:"name"`
+	DisplayName    string     `json:"display_name"`
+	Description    string     `json:"description"`
+	Image          string     `json:"image"` // PNG or JPEG, relative to the seed file
+	UnlockCost     int32      `json:"unlock_cost"`
+	RevealCost     int32      `json:"reveal_cost"`
+	SortOrder      int32      `json:"sort_order"`
+	AvailableFrom  *time.Time `json:"available_from"`
+	AvailableUntil *time.Time `json:"available_until"`
+	Retired        bool       `json:"retired"`
+}
+
+func main() {
+	file := flag.String("file", "sql/seeds/artworks.json", "JSON array of catalog entries")
+	flag.Parse()
+
+	cfg := config.Load()
+	ctx := context.Background()
+
+	content, err := os.ReadFile(*file)
+	if err != nil {
+		log.Fatalf("Failed to read seed file: %v", err)
+	}
+	var entries []seedArtwork
+	if err := json.Unmarshal(content, &entries); err != nil {
+		log.Fatalf("Failed to parse seed file: %v", err)
+	}
+
+	pool, err := db.NewPool(ctx, cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer pool.Close()
+
+	catalog := services.NewArtworkCatalogService(db.New(pool.Pool), pool, cfg.ArtworkImageDir)
+
+	failed := 0
+	for _, entry := range entries {
+		input := services.ArtworkInput{
+			Name:           entry.Name,
+			DisplayName:    entry.DisplayName,
+			Description:    entry.Description,
+			UnlockCost:     entry.UnlockCost,
+			RevealCost:     entry.RevealCost,
+			SortOrder:      entry.SortOrder,
+			AvailableFrom:  entry.AvailableFrom,
+			AvailableUntil: entry.AvailableUntil,
+			Retired:        entry.Retired,
+		}
+
+		if entry.Image != "" {
+			data, err := os.ReadFile(filepath.Join(filepath.Dir(*file), entry.Image))
+			if err != nil {
+				log.Printf("Skipping %s: failed to read image: %v", entry.Name, err)
+				failed++
+				continue
+			}
+			if input.ImageURL, err = catalog.StoreImage(entry.Name, data); err != nil {
+				log.Printf("Skipping %s: %v", entry.Name, err)
+				failed++
+				continue
+			}
+		}
+
+		artwork, created, err := catalog.Seed(ctx, input)
+		if err != nil {
+			log.Printf("Failed to seed %s: %v", entry.Name, err)
+			failed++
+			continue
+		}
+		if created {
+			log.Printf("Created %s", artwork.Name)
+		} else {
+			log.Printf("Updated %s (version %d)", artwork.Name, artwork.Version)
+		}
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d of %d artworks failed to seed", failed, len(entries))
+	}
+	log.Printf("Seeded %d artworks", len(entries))
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"catetin/backend/internal/ai"
@@ -48,35 +49,129 @@ func main() {
 		queries = db.New(pool.Pool)
 	}
 
+	// Initialize usage service before the AI client so every call is accounted for
+	var usageService *services.UsageService
+	var usageRecorder ai.UsageRecorder
+	if queries != nil {
+		usageService = services.NewUsageService(queries)
+		usageRecorder = usageService
+		log.Println("Usage service initialized")
+	}
+
+	// Initialize token budgets, debited through the usage service
+	var budgetService *services.BudgetService
+	var budgetGuard ai.BudgetGuard
+	if queries != nil {
+		budgetService = services.NewBudgetService(queries, map[string]services.TokenBudget{
+			"free": {Daily: int64(cfg.AIBudgetFreeDaily), Monthly: int64(cfg.AIBudgetFreeMonthly)},
+			"paid": {Daily: int64(cfg.AIBudgetPaidDaily), Monthly: int64(cfg.AIBudgetPaidMonthly)},
+		})
+		budgetGuard = budgetService
+		log.Println("Budget service initialized")
+	}
+
+	// Load prompt templates, falling back to the embedded defaults if overrides don't parse
+	prompts, err := ai.NewPromptRegistry(cfg.AIPromptDir)
+	if err != nil {
+		log.Printf("WARNING: Failed to load prompt overrides, using embedded prompts: %v", err)
+		if prompts, err = ai.NewPromptRegistry(""); err != nil {
+			log.Fatalf("Failed to load embedded prompts: %v", err)
+		}
+	}
+
+	// Initialize experiments; variants may only reference prompt versions that exist
+	var experimentService *services.ExperimentService
+	if queries != nil && cfg.ExperimentsFile != "" {
+		experiments, err := services.LoadExperiments(cfg.ExperimentsFile)
+		if err != nil {
+			log.Fatalf("Failed to load experiments: %v", err)
+		}
+		for _, exp := range experiments {
+			for _, variant := range exp.Variants {
+				for name, version := range variant.Prompts {
+					if !prompts.HasVersion(name, version) {
+						log.Fatalf("Experiment %s variant %s uses unknown prompt %s.%s", exp.ID, variant.Name, name, version)
+					}
+				}
+			}
+		}
+		experimentService = services.NewExperimentService(queries, experiments)
+		log.Printf("Experiment service initialized (%d experiments)", len(experiments))
+	}
+
 	// Initialize AI client
 	var aiClient *ai.Client
 	var pujanggaService *ai.PujanggaService
-	if cfg.OpenRouterAPIKey != "" {
-		var err error
+	aiProviderConfig := ai.ProviderConfig{
+		Kind:       cfg.AIProvider,
+		APIKey:     cfg.AIAPIKey,
+		BaseURL:    cfg.AIBaseURL,
+		ScriptFile: cfg.AIScriptFile,
+	}
+	if cfg.AIProvider == ai.ProviderOpenRouter {
+		aiProviderConfig.APIKey = cfg.OpenRouterAPIKey
+	}
+	if cfg.AICassetteMode != "" {
+		cassette, err := ai.NewCassette(cfg.AICassetteDir, cfg.AICassetteMode, nil)
+		if err != nil {
+			// Never fall back to live traffic when recordings were asked for
+			log.Fatalf("Failed to open AI cassette: %v", err)
+		}
+		aiProviderConfig.Transport = cassette
+		if cfg.AICassetteMode == ai.CassetteReplay && aiProviderConfig.APIKey == "" {
+			// Recordings are matched without headers, so replay needs no real key
+			aiProviderConfig.APIKey = "cassette"
+		}
+		log.Printf("AI cassette enabled (mode: %s, dir: %s)", cfg.AICassetteMode, cfg.AICassetteDir)
+	}
+	if cfg.AIProvider == ai.ProviderOpenRouter && aiProviderConfig.APIKey == "" {
+		log.Println("WARNING: OPENROUTER_API_KEY not set, AI features will not work")
+	} else if provider, err := ai.NewProvider(aiProviderConfig); err != nil {
+		log.Printf("WARNING: Failed to initialize AI provider: %v", err)
+	} else {
 		aiClient, err = ai.NewClient(ctx, ai.ClientConfig{
-			APIKey: cfg.OpenRouterAPIKey,
+			Provider:      provider,
+			Model:         cfg.AIModel,
+			FallbackModel: cfg.AIFallbackModel,
+			Models:        cfg.AIModels,
+			Retry: &ai.RetryConfig{
+				MaxAttempts: cfg.AIMaxAttempts,
+				BaseDelay:   ai.DefaultRetryConfig().BaseDelay,
+				MaxDelay:    ai.DefaultRetryConfig().MaxDelay,
+			},
+			Breaker: &ai.BreakerConfig{
+				FailureThreshold: cfg.AIBreakerThreshold,
+				Cooldown:         time.Duration(cfg.AIBreakerCooldown) * time.Second,
+			},
+			Usage:  usageRecorder,
+			Budget: budgetGuard,
 		})
 		if err != nil {
 			log.Printf("WARNING: Failed to initialize AI client: %v", err)
 		} else {
-			pujanggaService = ai.NewPujanggaService(aiClient)
-			log.Println("AI client initialized successfully")
+			pujanggaService = ai.NewPujanggaService(aiClient, prompts, ai.DefaultGuardrails())
+			log.Printf("AI client initialized successfully (provider: %s, models: %s)", aiClient.Provider(), strings.Join(aiClient.Models(), ", "))
 		}
-	} else {
-		log.Println("WARNING: OPENROUTER_API_KEY not set, AI features will not work")
+	}
+
+	// Initialize the currency ledger; every balance change is recorded through it
+	var ledgerService *services.LedgerService
+	if queries != nil {
+		ledgerService = services.NewLedgerService(queries, pool)
+		log.Println("Ledger service initialized")
 	}
 
 	// Initialize gamification service
 	var gamificationService *services.GamificationService
 	if queries != nil {
-		gamificationService = services.NewGamificationService(queries, nil)
+		gamificationService = services.NewGamificationService(queries, ledgerService, nil)
 		log.Println("Gamification service initialized")
 	}
 
 	// Initialize leveling service
 	var levelingService *services.LevelingService
 	if queries != nil {
-		levelingService = services.NewLevelingService(queries, nil)
+		levelingService = services.NewLevelingService(queries, ledgerService, nil)
 		log.Println("Leveling service initialized")
 	}
 
@@ -94,8 +189,118 @@ func main() {
 		log.Println("Weekly summary service initialized")
 	}
 
+	// Initialize safety screening; the model check needs the AI client
+	var safetyService *services.SafetyService
+	if queries != nil {
+		safetyService = services.NewSafetyService(queries, ai.NewSafetyClassifier(), pujanggaService, cfg.AISafetyModelCheck)
+		log.Printf("Safety service initialized (model check: %t)", cfg.AISafetyModelCheck && pujanggaService != nil)
+	}
+
+	// Initialize emotion service for the mood timeline
+	var emotionService *services.EmotionService
+	if queries != nil {
+		emotionService = services.NewEmotionService(queries)
+		log.Println("Emotion service initialized")
+	}
+
+	// Initialize memory service; recall and the memories API work without AI
+	var memoryService *services.MemoryService
+	if queries != nil {
+		memoryService = services.NewMemoryService(queries, pujanggaService)
+		log.Println("Memory service initialized")
+	}
+
+	// Initialize running session summaries for long sessions
+	var sessionSummaryService *services.SessionSummaryService
+	if queries != nil && pujanggaService != nil {
+		sessionSummaryService = services.NewSessionSummaryService(queries, pujanggaService)
+		log.Println("Session summary service initialized")
+	}
+
+	// Initialize opening service for openings personalized with recent history
+	var openingService *services.OpeningService
+	if queries != nil {
+		openingService = services.NewOpeningService(queries, memoryService)
+		log.Println("Opening service initialized")
+	}
+
+	// Initialize companion personas and the user preferences that pick them
+	var personaService *services.PersonaService
+	if queries != nil {
+		personaService = services.NewPersonaService(queries)
+		log.Printf("Persona service initialized (%d personas)", len(ai.Personas))
+	}
+
+	// Initialize the closing ritual of completed sessions
+	var closingService *services.ClosingService
+	if queries != nil && pujanggaService != nil {
+		closingService = services.NewClosingService(queries, pujanggaService, personaService)
+		log.Println("Closing service initialized")
+	}
+
+	// Initialize the depth engine; the model check needs the AI client
+	var depthService *services.DepthService
+	if queries != nil {
+		depthService = services.NewDepthService(queries, ai.NewDepthEngine(), pujanggaService, cfg.AIDepthModelCheck)
+		log.Printf("Depth service initialized (model check: %t)", cfg.AIDepthModelCheck && pujanggaService != nil)
+	}
+
+	// Initialize topic tracking for topic switches and stats
+	var topicService *services.TopicService
+	if queries != nil {
+		topicService = services.NewTopicService(queries, ai.NewTopicClassifier())
+		log.Println("Topic service initialized")
+	}
+
+	// Initialize guided journaling templates; the structured output needs the AI client
+	var journalTemplateService *services.JournalTemplateService
+	if queries != nil {
+		journalTemplateService = services.NewJournalTemplateService(queries, pujanggaService)
+		log.Printf("Journal template service initialized (%d templates)", len(ai.JournalTemplates))
+	}
+
+	// Initialize the Perpustakaan quote library
+	var quoteService *services.QuoteService
+	if queries != nil {
+		quoteService = services.NewQuoteService(queries, pool, ledgerService)
+		log.Println("Quote service initialized")
+	}
+
+	// Initialize the Galeri; purchases run in transactions on the pool
+	var galleryService *services.GalleryService
+	var artworkCatalogService *services.ArtworkCatalogService
+	if queries != nil {
+		revealRenderer := services.NewRevealRenderer(cfg.ArtworkImageDir, cfg.ArtworkCacheDir)
+		galleryService = services.NewGalleryService(queries, pool, revealRenderer)
+		artworkCatalogService = services.NewArtworkCatalogService(queries, pool, cfg.ArtworkImageDir)
+		log.Println("Gallery service initialized")
+	}
+
 	// Create handler with dependencies
-	h := handlers.New(queries, pujanggaService, gamificationService, levelingService, weeklySummaryService, cfg.SupportEmail)
+	h := handlers.New(handlers.Deps{
+		Queries:       queries,
+		Pool:          pool,
+		Pujangga:      pujanggaService,
+		Gamification:  gamificationService,
+		Leveling:      levelingService,
+		WeeklySummary: weeklySummaryService,
+		Budget:        budgetService,
+		Experiments:   experimentService,
+		Safety:        safetyService,
+		Emotions:      emotionService,
+		Memories:      memoryService,
+		Summaries:     sessionSummaryService,
+		Openings:      openingService,
+		Closings:      closingService,
+		Depth:         depthService,
+		Topics:        topicService,
+		Templates:     journalTemplateService,
+		Personas:      personaService,
+		Quotes:        quoteService,
+		Gallery:       galleryService,
+		Ledger:        ledgerService,
+		SupportEmail:  cfg.SupportEmail,
+	})
 
 	// Create webhook handler
 	var wh *handlers.WebhookHandler
@@ -107,6 +312,20 @@ func main() {
 		wh = handlers.NewWebhookHandler(webhookProcessor, "") // Will reject all requests
 	}
 
+	// Create internal operations handler
+	ih := handlers.NewInternalHandler(handlers.InternalDeps{
+		AIClient:     aiClient,
+		UsageService: usageService,
+		Prompts:      prompts,
+		Experiments:  experimentService,
+		Safety:       safetyService,
+		Catalog:      artworkCatalogService,
+		Ledger:       ledgerService,
+	})
+	if cfg.InternalAPIToken == "" {
+		log.Println("WARNING: INTERNAL_API_TOKEN not set, internal endpoints will reject all requests")
+	}
+
 	e := echo.New()
 
 	// Middleware
@@ -119,7 +338,7 @@ func main() {
 	}))
 
 	// Register routes
-	routes.Register(e, h, wh)
+	routes.Register(e, h, wh, ih, cfg.InternalAPIToken)
 
 	// Get port from configuration
 	port := cfg.BackendPort
@@ -0,0 +1,41 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Budget periods reported by BudgetExceededError
+const (
+	BudgetPeriodDaily   = "daily"
+	BudgetPeriodMonthly = "monthly"
+)
+
+// ErrBudgetExceeded is returned instead of calling the provider when the
+// caller has used up their token budget
+var ErrBudgetExceeded = errors.New("token budget exceeded")
+
+// BudgetExceededError describes which budget ran out
+type BudgetExceededError struct {
+	Period string // BudgetPeriodDaily or BudgetPeriodMonthly
+	Used   int64
+	Limit  int64
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("%s token budget exceeded (%d/%d)", e.Period, e.Used, e.Limit)
+}
+
+// Is makes errors.Is(err, ErrBudgetExceeded) match
+func (e *BudgetExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// BudgetGuard decides whether an AI call may be made. Spending is debited
+// through the UsageRecorder, so the guard only has to compare recorded usage
+// against the caller's budget.
+type BudgetGuard interface {
+	CheckBudget(ctx context.Context, info CallInfo) error
+}
@@ -0,0 +1,264 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Cassette modes selectable through NewCassette
+const (
+	// CassetteRecord forwards every request and saves the exchange, replacing
+	// whatever was recorded for the same request before
+	CassetteRecord = "record"
+	// CassetteReplay serves recorded exchanges only, never touches the
+	// network and fails on requests it has no recording for
+	CassetteReplay = "replay"
+)
+
+// ErrCassetteMiss is returned in replay mode for a request with no recording
+var ErrCassetteMiss = errors.New("no recorded exchange for request")
+
+// cassetteHeaders are the response headers kept in recordings; everything
+// else (cookies, request IDs, rate limit counters) is dropped
+var cassetteHeaders = []string{"Content-Type", "Retry-After"}
+
+// recordedExchange is one request/response pair as stored on disk
+type recordedExchange struct {
+	Request struct {
+		Method string          `json:"method"`
+		URL    string          `json:"url"`
+		Body   json.RawMessage `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		StatusCode int               `json:"status_code"`
+		Headers    map[string]string `json:"headers,omitempty"`
+		Body       string            `json:"body"`
+	} `json:"response"`
+}
+
+// Cassette is an http.RoundTripper that records provider exchanges to disk
+// and replays them, so the AI layer can run deterministically without network.
+//
+// Requests are matched on a fingerprint of method, URL and JSON body; headers
+// are ignored, so API keys never end up in recordings. Each fingerprint is
+// stored as a JSON file holding its exchanges in order. Repeated requests are
+// replayed in recorded order and the last exchange is reused once exhausted,
+// which lets a cassette script a 503 followed by a success.
+type Cassette struct {
+	dir       string
+	mode      string
+	transport http.RoundTripper
+
+	mu       sync.Mutex
+	tapes    map[string][]recordedExchange
+	cursors  map[string]int
+	recorded map[string]bool // Fingerprints overwritten during this record run
+}
+
+// NewCassette creates a cassette stored in dir. transport performs the real
+// requests of record mode and defaults to http.DefaultTransport.
+func NewCassette(dir, mode string, transport http.RoundTripper) (*Cassette, error) {
+	switch mode {
+	case CassetteRecord, CassetteReplay:
+	default:
+		return nil, fmt.Errorf("unknown cassette mode: %q", mode)
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("cassette directory is required")
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	c := &Cassette{
+		dir:       dir,
+		mode:      mode,
+		transport: transport,
+		tapes:     map[string][]recordedExchange{},
+		cursors:   map[string]int{},
+		recorded:  map[string]bool{},
+	}
+
+	if mode != CassetteRecord {
+		if err := c.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// load reads every recording in the cassette directory
+func (c *Cassette) load() error {
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("failed to list cassette: %w", err)
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read cassette file: %w", err)
+		}
+
+		var exchanges []recordedExchange
+		if err := json.Unmarshal(data, &exchanges); err != nil {
+			return fmt.Errorf("failed to parse cassette file %s: %w", filepath.Base(path), err)
+		}
+
+		fingerprint := strings.TrimSuffix(filepath.Base(path), ".json")
+		c.tapes[fingerprint] = exchanges
+	}
+
+	return nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	fingerprint := requestFingerprint(req.Method, req.URL.String(), body)
+
+	if c.mode == CassetteReplay {
+		if exchange, ok := c.next(fingerprint); ok {
+			return exchange.toResponse(req), nil
+		}
+		return nil, fmt.Errorf("%w: %s %s (fingerprint %s)", ErrCassetteMiss, req.Method, req.URL, fingerprint)
+	}
+
+	resp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	if err := c.record(fingerprint, req, body, resp, respBody); err != nil {
+		log.Printf("[Cassette] failed to record %s: %v", fingerprint, err)
+	}
+
+	return resp, nil
+}
+
+// next returns the next recorded exchange for fingerprint
+func (c *Cassette) next(fingerprint string) (recordedExchange, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	exchanges := c.tapes[fingerprint]
+	if len(exchanges) == 0 {
+		return recordedExchange{}, false
+	}
+
+	cursor := c.cursors[fingerprint]
+	if cursor >= len(exchanges) {
+		cursor = len(exchanges) - 1
+	}
+	c.cursors[fingerprint] = cursor + 1
+
+	return exchanges[cursor], true
+}
+
+// record appends an exchange to fingerprint's tape and writes it to disk
+func (c *Cassette) record(fingerprint string, req *http.Request, body []byte, resp *http.Response, respBody []byte) error {
+	var exchange recordedExchange
+	exchange.Request.Method = req.Method
+	exchange.Request.URL = req.URL.String()
+	if json.Valid(body) {
+		exchange.Request.Body = body
+	}
+	exchange.Response.StatusCode = resp.StatusCode
+	exchange.Response.Body = string(respBody)
+	exchange.Response.Headers = map[string]string{}
+	for _, key := range cassetteHeaders {
+		if value := resp.Header.Get(key); value != "" {
+			exchange.Response.Headers[key] = value
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A record run replaces earlier recordings instead of appending to them
+	if !c.recorded[fingerprint] {
+		c.tapes[fingerprint] = nil
+		c.recorded[fingerprint] = true
+	}
+	c.tapes[fingerprint] = append(c.tapes[fingerprint], exchange)
+
+	data, err := json.MarshalIndent(c.tapes[fingerprint], "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal exchange: %w", err)
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(c.dir, fingerprint+".json"), data, 0o644)
+}
+
+// toResponse builds an http.Response from a recorded exchange
+func (e recordedExchange) toResponse(req *http.Request) *http.Response {
+	header := http.Header{}
+	for key, value := range e.Response.Headers {
+		header.Set(key, value)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Response.StatusCode, http.StatusText(e.Response.StatusCode)),
+		StatusCode:    e.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(e.Response.Body)),
+		ContentLength: int64(len(e.Response.Body)),
+		Request:       req,
+	}
+}
+
+// requestFingerprint identifies a request by method, URL and body.
+// JSON bodies are re-encoded so key order and whitespace don't matter.
+func requestFingerprint(method, url string, body []byte) string {
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		if canonical, err := json.Marshal(decoded); err == nil {
+			body = canonical
+		}
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(url))
+	hash.Write([]byte{0})
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
@@ -0,0 +1,123 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// recordCassettes re-records the flow cassettes against OpenRouter:
+// OPENROUTER_API_KEY=... go test ./internal/ai -run Flow -record
+var recordCassettes = flag.Bool("record", false, "record cassettes against OpenRouter instead of replaying them")
+
+// cassetteDir holds the recordings of the flow tests, the default AI_CASSETTE_DIR of the server
+const cassetteDir = "../../testdata/cassettes"
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newCassettePujangga returns a Pujangga on OpenRouter whose traffic is
+// replayed from cassetteDir, or recorded to it with -record
+func newCassettePujangga(t *testing.T) *PujanggaService {
+	t.Helper()
+
+	mode, apiKey := CassetteReplay, "cassette"
+	if *recordCassettes {
+		mode, apiKey = CassetteRecord, os.Getenv("OPENROUTER_API_KEY")
+		if apiKey == "" {
+			t.Fatal("OPENROUTER_API_KEY is required to record cassettes")
+		}
+	}
+
+	cassette, err := NewCassette(cassetteDir, mode, nil)
+	if err != nil {
+		t.Fatalf("NewCassette: %v", err)
+	}
+	client, err := NewClient(context.Background(), ClientConfig{
+		Provider: NewOpenRouterProvider(apiKey).WithTransport(cassette),
+		Retry:    &RetryConfig{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	prompts, err := NewPromptRegistry("")
+	if err != nil {
+		t.Fatalf("NewPromptRegistry: %v", err)
+	}
+	return NewPujanggaService(client, prompts, DefaultGuardrails())
+}
+
+func TestCassetteReplayMissNeverTouchesNetwork(t *testing.T) {
+	network := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		t.Fatalf("replay sent %s %s to the network", req.Method, req.URL)
+		return nil, nil
+	})
+
+	cassette, err := NewCassette(t.TempDir(), CassetteReplay, network)
+	if err != nil {
+		t.Fatalf("NewCassette: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/chat", strings.NewReader(`{"model":"m"}`))
+	if _, err := cassette.RoundTrip(req); !errors.Is(err, ErrCassetteMiss) {
+		t.Fatalf("RoundTrip error = %v, want ErrCassetteMiss", err)
+	}
+}
+
+func TestCassetteRecordThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+	network := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}, "Set-Cookie": {"secret"}},
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	})
+
+	recorder, err := NewCassette(dir, CassetteRecord, network)
+	if err != nil {
+		t.Fatalf("NewCassette: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/chat", strings.NewReader(`{"b":1,"a":2}`))
+	if _, err := recorder.RoundTrip(req); err != nil {
+		t.Fatalf("record RoundTrip: %v", err)
+	}
+
+	player, err := NewCassette(dir, CassetteReplay, network)
+	if err != nil {
+		t.Fatalf("NewCassette: %v", err)
+	}
+	// Key order and whitespace don't change the fingerprint
+	req, _ = http.NewRequest(http.MethodPost, "https://example.com/chat", strings.NewReader(`{"a": 2, "b": 1}`))
+	resp, err := player.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("replay RoundTrip: %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("network calls = %d, want 1", calls)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if got := resp.Header.Get("Set-Cookie"); got != "" {
+		t.Errorf("Set-Cookie = %q, want it dropped from the recording", got)
+	}
+}
+
+func TestClassifyCassetteMissIsFatal(t *testing.T) {
+	if got := ClassifyError(ErrCassetteMiss); got != ErrorFatal {
+		t.Errorf("ClassifyError(ErrCassetteMiss) = %s, want fatal", got)
+	}
+}
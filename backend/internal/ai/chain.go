@@ -0,0 +1,320 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RetryConfig controls how often and how long the client waits before retrying a model
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts per model for retryable errors
+	MaxAttempts int
+
+	// BaseDelay is the first backoff delay, doubled on each further attempt
+	BaseDelay time.Duration
+
+	// MaxDelay caps the backoff delay. A Retry-After longer than this moves
+	// on to the next model instead of waiting.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryConfig returns the default retry configuration
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts: 2,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    8 * time.Second,
+	}
+}
+
+// BreakerConfig controls the per-model circuit breaker
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed requests that opens the breaker
+	FailureThreshold int
+
+	// Cooldown is how long a model is skipped once its breaker opens
+	Cooldown time.Duration
+}
+
+// DefaultBreakerConfig returns the default circuit breaker configuration
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		FailureThreshold: 5,
+		Cooldown:         60 * time.Second,
+	}
+}
+
+// ModelMetrics is a snapshot of request outcomes for one model
+type ModelMetrics struct {
+	Model          string     `json:"model"`
+	Answered       int64      `json:"answered"`                // Requests this model produced the final answer for
+	Attempts       int64      `json:"attempts"`                // Individual provider calls, including retries
+	Failures       int64      `json:"failures"`                // Failed provider calls
+	Skipped        int64      `json:"skipped"`                 // Requests that skipped this model due to an open breaker
+	AvgLatencyMs   int64      `json:"avg_latency_ms"`          // Average latency of successful calls
+	BreakerOpen    bool       `json:"breaker_open"`            // Whether the model is currently being skipped
+	BreakerUntil   *time.Time `json:"breaker_until,omitempty"` // When the breaker allows a trial request again
+	LastError      string     `json:"last_error"`              // Most recent failure message
+	LastErrorClass string     `json:"last_error_class"`        // Most recent failure class
+}
+
+// modelState tracks breaker state and counters for one model
+type modelState struct {
+	consecutiveFailures int
+	openUntil           time.Time
+	halfOpenInFlight    bool
+
+	answered       int64
+	attempts       int64
+	failures       int64
+	skipped        int64
+	totalLatency   time.Duration
+	lastError      string
+	lastErrorClass string
+}
+
+// modelChain is an ordered list of models with retries, backoff and circuit breaking
+type modelChain struct {
+	models  []string
+	retry   RetryConfig
+	breaker BreakerConfig
+
+	mu     sync.Mutex
+	states map[string]*modelState
+	now    func() time.Time
+}
+
+// newModelChain creates a chain over the given models in priority order
+func newModelChain(models []string, retry RetryConfig, breaker BreakerConfig) *modelChain {
+	states := make(map[string]*modelState, len(models))
+	for _, model := range models {
+		states[model] = &modelState{}
+	}
+	return &modelChain{
+		models:  models,
+		retry:   retry,
+		breaker: breaker,
+		states:  states,
+		now:     time.Now,
+	}
+}
+
+// run calls attempt with each model in order until one succeeds.
+// models overrides the chain's own models when not empty.
+// Retryable errors are retried on the same model with exponential backoff,
+// model-specific errors move on to the next model and fatal errors stop the chain.
+// It returns the model that answered.
+func (m *modelChain) run(ctx context.Context, models []string, attempt func(model string) error) (string, error) {
+	if len(models) == 0 {
+		models = m.models
+	}
+
+	var lastErr error
+
+	for _, model := range models {
+		if !m.allow(model) {
+			continue
+		}
+
+		for try := 1; ; try++ {
+			start := m.now()
+			err := attempt(model)
+			if err == nil {
+				m.recordSuccess(model, m.now().Sub(start))
+				if model != models[0] || try > 1 {
+					log.Printf("[AI] %s answered after %d attempt(s) (primary: %s)", model, try, models[0])
+				}
+				return model, nil
+			}
+
+			class := ClassifyError(err)
+			if ctx.Err() != nil {
+				// The caller gave up; this says nothing about the model's health
+				m.release(model)
+				return "", err
+			}
+
+			m.recordFailure(model, err, class)
+			lastErr = fmt.Errorf("%s: %w", model, err)
+			log.Printf("[AI] %s attempt %d failed (%s): %v", model, try, class, err)
+
+			if class == ErrorFatal {
+				return "", lastErr
+			}
+			if class == ErrorNextModel || try >= m.retry.MaxAttempts || m.isOpen(model) {
+				break
+			}
+
+			delay, ok := m.backoff(try, err)
+			if !ok {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+	}
+
+	if lastErr == nil {
+		return "", ErrNoModelAvailable
+	}
+	return "", lastErr
+}
+
+// backoff returns the delay before retry number try+1, honoring Retry-After.
+// It reports false when the provider asks to wait longer than MaxDelay.
+func (m *modelChain) backoff(try int, err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if apiErr.RetryAfter > m.retry.MaxDelay {
+			return 0, false
+		}
+		return apiErr.RetryAfter, true
+	}
+
+	delay := m.retry.BaseDelay << (try - 1)
+	if delay <= 0 || delay > m.retry.MaxDelay {
+		delay = m.retry.MaxDelay
+	}
+	// Add up to 20% jitter so concurrent requests don't retry in lockstep
+	if jitter := int64(delay) / 5; jitter > 0 {
+		delay += time.Duration(rand.Int63n(jitter))
+	}
+	return delay, true
+}
+
+// state returns model's state, creating it for models outside the configured chain.
+// The caller must hold m.mu.
+func (m *modelChain) state(model string) *modelState {
+	state, ok := m.states[model]
+	if !ok {
+		state = &modelState{}
+		m.states[model] = state
+	}
+	return state
+}
+
+// allow reports whether model may be called, letting a single trial request
+// through once the breaker cooldown has passed
+func (m *modelChain) allow(model string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := m.state(model)
+	if state.openUntil.IsZero() {
+		return true
+	}
+	if m.now().Before(state.openUntil) || state.halfOpenInFlight {
+		state.skipped++
+		return false
+	}
+	state.halfOpenInFlight = true
+	return true
+}
+
+// isOpen reports whether model's breaker is currently open
+func (m *modelChain) isOpen(model string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now().Before(m.state(model).openUntil)
+}
+
+// release clears a trial request without counting it as success or failure
+func (m *modelChain) release(model string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state(model).halfOpenInFlight = false
+}
+
+// recordSuccess closes the model's breaker and counts the answer
+func (m *modelChain) recordSuccess(model string, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := m.state(model)
+	state.consecutiveFailures = 0
+	state.openUntil = time.Time{}
+	state.halfOpenInFlight = false
+	state.answered++
+	state.attempts++
+	state.totalLatency += latency
+}
+
+// recordFailure counts a failed attempt and opens the breaker past the threshold
+func (m *modelChain) recordFailure(model string, err error, class ErrorClass) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := m.state(model)
+	state.attempts++
+	state.failures++
+	state.lastError = err.Error()
+	state.lastErrorClass = class.String()
+
+	if class == ErrorFatal {
+		state.halfOpenInFlight = false
+		return
+	}
+
+	state.consecutiveFailures++
+	if state.halfOpenInFlight || state.consecutiveFailures >= m.breaker.FailureThreshold {
+		state.openUntil = m.now().Add(m.breaker.Cooldown)
+		state.halfOpenInFlight = false
+		log.Printf("[AI] circuit breaker opened for %s until %s", model, state.openUntil.Format(time.RFC3339))
+	}
+}
+
+// metrics returns a snapshot of every model's counters in chain order,
+// followed by models only used through treatments
+func (m *modelChain) metrics() []ModelMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	models := append([]string{}, m.models...)
+	var extra []string
+	for model := range m.states {
+		if !slices.Contains(m.models, model) {
+			extra = append(extra, model)
+		}
+	}
+	sort.Strings(extra)
+	models = append(models, extra...)
+
+	now := m.now()
+	result := make([]ModelMetrics, 0, len(models))
+	for _, model := range models {
+		state := m.states[model]
+		var breakerUntil *time.Time
+		if !state.openUntil.IsZero() {
+			until := state.openUntil
+			breakerUntil = &until
+		}
+		var avgLatency int64
+		if state.answered > 0 {
+			avgLatency = state.totalLatency.Milliseconds() / state.answered
+		}
+		result = append(result, ModelMetrics{
+			Model:          model,
+			Answered:       state.answered,
+			Attempts:       state.attempts,
+			Failures:       state.failures,
+			Skipped:        state.skipped,
+			AvgLatencyMs:   avgLatency,
+			BreakerOpen:    now.Before(state.openUntil),
+			BreakerUntil:   breakerUntil,
+			LastError:      state.lastError,
+			LastErrorClass: state.lastErrorClass,
+		})
+	}
+	return result
+}
@@ -0,0 +1,147 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestChainBackoff(t *testing.T) {
+	retry := RetryConfig{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		name    string
+		try     int
+		err     error
+		wantMin time.Duration
+		wantMax time.Duration // Exclusive, to allow for jitter
+		wantOK  bool
+	}{
+		{"first retry", 1, errors.New("boom"), 100 * time.Millisecond, 120 * time.Millisecond, true},
+		{"doubles per try", 3, errors.New("boom"), 400 * time.Millisecond, 480 * time.Millisecond, true},
+		{"capped at max delay", 5, errors.New("boom"), time.Second, 1200 * time.Millisecond, true},
+		{"shift overflow capped", 70, errors.New("boom"), time.Second, 1200 * time.Millisecond, true},
+		{
+			name:    "retry-after honored exactly",
+			try:     1,
+			err:     &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 700 * time.Millisecond},
+			wantMin: 700 * time.Millisecond,
+			wantMax: 700*time.Millisecond + 1,
+			wantOK:  true,
+		},
+		{
+			name:    "retry-after at max delay",
+			try:     1,
+			err:     &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Second},
+			wantMin: time.Second,
+			wantMax: time.Second + 1,
+			wantOK:  true,
+		},
+		{
+			name:   "retry-after past max delay gives up",
+			try:    1,
+			err:    &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Minute},
+			wantOK: false,
+		},
+	}
+
+	m := newModelChain([]string{"a"}, retry, DefaultBreakerConfig())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := m.backoff(tt.try, tt.err)
+			if ok != tt.wantOK {
+				t.Fatalf("backoff() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (delay < tt.wantMin || delay >= tt.wantMax) {
+				t.Errorf("backoff() = %v, want in [%v, %v)", delay, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestChainRetryAfterPastMaxDelayMovesOn(t *testing.T) {
+	m := newModelChain([]string{"a", "b"}, RetryConfig{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Second}, DefaultBreakerConfig())
+
+	calls := map[string]int{}
+	model, err := m.run(context.Background(), nil, func(model string) error {
+		calls[model]++
+		if model == "a" {
+			return &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if model != "b" || calls["a"] != 1 || calls["b"] != 1 {
+		t.Errorf("run() answered by %q with calls %v, want b after a single try of a", model, calls)
+	}
+}
+
+func TestChainHalfOpenBreaker(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := newModelChain([]string{"a"}, RetryConfig{MaxAttempts: 1}, BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute})
+	m.now = func() time.Time { return now }
+
+	unavailable := &APIError{StatusCode: http.StatusServiceUnavailable}
+
+	steps := []struct {
+		name       string
+		advance    time.Duration
+		err        error // Returned by the model when called
+		wantCalled bool
+		wantOpen   bool
+	}{
+		{"first failure", 0, unavailable, true, false},
+		{"threshold opens the breaker", 0, unavailable, true, true},
+		{"open breaker skips the model", 0, nil, false, true},
+		{"still cooling down", 30 * time.Second, nil, false, true},
+		{"failed trial reopens", 31 * time.Second, unavailable, true, true},
+		{"reopened breaker skips the model", 0, nil, false, true},
+		{"successful trial closes", time.Minute + time.Second, nil, true, false},
+		{"closed breaker counts from zero", 0, unavailable, true, false},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+
+		called := false
+		_, err := m.run(context.Background(), nil, func(string) error {
+			called = true
+			return step.err
+		})
+		if called != step.wantCalled {
+			t.Fatalf("%s: model called = %v, want %v", step.name, called, step.wantCalled)
+		}
+		if !called && !errors.Is(err, ErrNoModelAvailable) {
+			t.Fatalf("%s: run() error = %v, want ErrNoModelAvailable", step.name, err)
+		}
+		if open := m.isOpen("a"); open != step.wantOpen {
+			t.Fatalf("%s: breaker open = %v, want %v", step.name, open, step.wantOpen)
+		}
+	}
+}
+
+func TestChainHalfOpenAllowsOneTrial(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := newModelChain([]string{"a"}, RetryConfig{MaxAttempts: 1}, BreakerConfig{FailureThreshold: 1, Cooldown: time.Minute})
+	m.now = func() time.Time { return now }
+
+	m.recordFailure("a", errors.New("boom"), ErrorRetryable)
+	now = now.Add(2 * time.Minute)
+
+	if !m.allow("a") {
+		t.Fatal("allow() = false after the cooldown, want a trial request")
+	}
+	if m.allow("a") {
+		t.Fatal("allow() = true while the trial is in flight, want false")
+	}
+
+	// A cancelled trial says nothing about the model, so the next request may try again
+	m.release("a")
+	if !m.allow("a") {
+		t.Fatal("allow() = false after the trial was released, want true")
+	}
+}
@@ -2,56 +2,132 @@
 package ai
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"strings"
 	"time"
 )
 
 const (
-	openRouterBaseURL = "https://openrouter.ai/api/v1/chat/completions"
-	defaultModel      = "google/gemini-2.5-flash-lite"
-	fallbackModel     = "google/gemini-2.5-flash"
-	appReferer        = "https://catetin.aidityas.me"
-	appTitle          = "Catetin Aidityas"
+	defaultModel  = "google/gemini-2.5-flash-lite"
+	fallbackModel = "google/gemini-2.5-flash"
 )
 
-// Client wraps the OpenRouter client for AI interactions
+// Client generates content through a Provider, walking an ordered chain of
+// models with retries, backoff and per-model circuit breaking
 type Client struct {
-	apiKey     string
-	model      string
-	httpClient *http.Client
+	provider Provider
+	chain    *modelChain
+	usage    UsageRecorder
+	budget   BudgetGuard
 }
 
 // ClientConfig holds configuration for the AI client
 type ClientConfig struct {
 	APIKey string
-	Model  string // defaults to "google/gemini-2.5-flash-lite"
+	Model  string // defaults to "google/gemini-2.5-flash-lite" on OpenRouter, required for other servers
+
+	// FallbackModel is tried when Model fails. Defaults to "google/gemini-2.5-flash"
+	// when Model is also left at its default, and to no fallback otherwise.
+	FallbackModel string
+
+	// Models is the ordered model chain. When set it takes precedence over
+	// Model and FallbackModel.
+	Models []string
+
+	// Retry and Breaker default to DefaultRetryConfig and DefaultBreakerConfig when nil
+	Retry   *RetryConfig
+	Breaker *BreakerConfig
+
+	// Provider is the LLM backend to use. Defaults to OpenRouter with APIKey.
+	Provider Provider
+
+	// Usage receives token usage for every provider call. Optional.
+	Usage UsageRecorder
+
+	// Budget is consulted before every call made on behalf of a user. Optional.
+	Budget BudgetGuard
 }
 
 // NewClient creates a new AI client with the given configuration
 func NewClient(ctx context.Context, cfg ClientConfig) (*Client, error) {
-	if cfg.APIKey == "" {
-		return nil, fmt.Errorf("API key is required")
+	provider := cfg.Provider
+	if provider == nil {
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("API key is required")
+		}
+		provider = NewOpenRouterProvider(cfg.APIKey)
 	}
 
-	model := cfg.Model
-	if model == "" {
-		model = defaultModel
+	models, err := resolveModels(provider, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := DefaultRetryConfig()
+	if cfg.Retry != nil {
+		retry = *cfg.Retry
+	}
+	if retry.MaxAttempts < 1 {
+		retry.MaxAttempts = 1
+	}
+
+	breaker := DefaultBreakerConfig()
+	if cfg.Breaker != nil {
+		breaker = *cfg.Breaker
+	}
+	if breaker.FailureThreshold < 1 {
+		breaker.FailureThreshold = 1
 	}
 
 	return &Client{
-		apiKey: cfg.APIKey,
-		model:  model,
-		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
-		},
+		provider: provider,
+		chain:    newModelChain(models, retry, breaker),
+		usage:    cfg.Usage,
+		budget:   cfg.Budget,
 	}, nil
 }
 
+// resolveModels builds the ordered, de-duplicated model chain from cfg
+func resolveModels(provider Provider, cfg ClientConfig) ([]string, error) {
+	candidates := cfg.Models
+	if len(candidates) == 0 {
+		model := cfg.Model
+		fallback := cfg.FallbackModel
+		if model == "" {
+			switch provider.Name() {
+			case ProviderOpenRouter:
+				model = defaultModel
+				if fallback == "" {
+					fallback = fallbackModel
+				}
+			case ProviderScripted:
+				model = ProviderScripted
+			default:
+				return nil, fmt.Errorf("model is required for the %s provider", provider.Name())
+			}
+		}
+		candidates = []string{model, fallback}
+	}
+
+	models := make([]string, 0, len(candidates))
+	seen := make(map[string]bool, len(candidates))
+	for _, model := range candidates {
+		model = strings.TrimSpace(model)
+		if model == "" || seen[model] {
+			continue
+		}
+		seen[model] = true
+		models = append(models, model)
+	}
+	if len(models) == 0 {
+		return nil, fmt.Errorf("at least one model is required")
+	}
+
+	return models, nil
+}
+
 // ChatMessage represents a message in the chat completion request
 type ChatMessage struct {
 	Role    string `json:"role"`
@@ -71,12 +147,19 @@ type ResponseFormat struct {
 	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
 }
 
-// ChatCompletionRequest represents the request to OpenRouter API
+// ChatCompletionRequest represents an OpenAI-compatible chat completion request
 type ChatCompletionRequest struct {
 	Model          string          `json:"model"`
 	Messages       []ChatMessage   `json:"messages"`
 	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
 	Route          string          `json:"route,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+	StreamOptions  *StreamOptions  `json:"stream_options,omitempty"`
+}
+
+// StreamOptions configures streaming responses
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"` // Ask for a final chunk carrying token usage
 }
 
 // ChatCompletionChoice represents a choice in the response
@@ -89,94 +172,143 @@ type ChatCompletionChoice struct {
 	FinishReason string `json:"finish_reason"`
 }
 
-// ChatCompletionResponse represents the response from OpenRouter API
+// TokenUsage reports the tokens consumed by a chat completion
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ChatCompletionResponse represents an OpenAI-compatible chat completion response
 type ChatCompletionResponse struct {
 	ID      string                 `json:"id"`
 	Object  string                 `json:"object"`
 	Created int64                  `json:"created"`
 	Model   string                 `json:"model"`
 	Choices []ChatCompletionChoice `json:"choices"`
-	Usage   struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage   TokenUsage             `json:"usage"`
+	Error   *struct {
+		Message string      `json:"message"`
+		Type    string      `json:"type"`
+		Code    interface{} `json:"code"` // string or numeric status depending on provider
+	} `json:"error,omitempty"`
+}
+
+// ChatCompletionChunk represents a single streamed chunk of a chat completion
+type ChatCompletionChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *TokenUsage `json:"usage,omitempty"` // Only present on the final chunk
 	Error *struct {
-		Message string `json:"message"`
-		Type    string `json:"type"`
-		Code    string `json:"code"`
+		Message string      `json:"message"`
+		Code    interface{} `json:"code"`
 	} `json:"error,omitempty"`
 }
 
-// doRequest performs an HTTP request to OpenRouter API
-func (c *Client) doRequest(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
-	body, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+// complete sends req through the model chain and returns the first valid response
+func (c *Client) complete(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	if err := c.checkBudget(ctx); err != nil {
+		return nil, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", openRouterBaseURL, bytes.NewReader(body))
+	var resp *ChatCompletionResponse
+	model, err := c.chain.run(ctx, TreatmentFromContext(ctx).Models, func(model string) error {
+		req.Model = model
+		start := time.Now()
+		result, err := c.provider.ChatCompletion(ctx, req)
+		if err != nil {
+			return err
+		}
+		c.recordUsage(ctx, req, model, result, time.Since(start))
+		if err := validateResponse(req, result); err != nil {
+			return err
+		}
+		resp = result
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
-	httpReq.Header.Set("HTTP-Referer", appReferer)
-	httpReq.Header.Set("X-Title", appTitle)
-
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	if resp.Model == "" {
+		resp.Model = model
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
+	return resp, nil
+}
 
-	var result ChatCompletionResponse
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w (body: %s)", err, string(respBody))
+// checkBudget asks the budget guard whether the caller in ctx may make a call.
+// Calls without a known user (e.g. background jobs) are not budgeted.
+func (c *Client) checkBudget(ctx context.Context) error {
+	info := CallInfoFromContext(ctx)
+	if c.budget == nil || info.UserID == "" {
+		return nil
 	}
+	return c.budget.CheckBudget(ctx, info)
+}
 
-	if result.Error != nil {
-		return nil, fmt.Errorf("API error: %s (type: %s, code: %s)", result.Error.Message, result.Error.Type, result.Error.Code)
+// recordUsage reports the usage of a provider call to the usage recorder.
+// Token counts are estimated when the provider doesn't report them.
+func (c *Client) recordUsage(ctx context.Context, req *ChatCompletionRequest, model string, resp *ChatCompletionResponse, latency time.Duration) {
+	if c.usage == nil || resp == nil {
+		return
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d (body: %s)", resp.StatusCode, string(respBody))
+	promptTokens := resp.Usage.PromptTokens
+	completionTokens := resp.Usage.CompletionTokens
+	if promptTokens == 0 && completionTokens == 0 {
+		promptTokens = estimateTokens(requestText(req))
+		if len(resp.Choices) > 0 {
+			completionTokens = estimateTokens(resp.Choices[0].Message.Content)
+		}
 	}
 
-	return &result, nil
+	c.usage.RecordUsage(ctx, Usage{
+		CallInfo:         CallInfoFromContext(ctx),
+		Model:            model,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Latency:          latency,
+		CostMicros:       EstimateCostMicros(model, promptTokens, completionTokens),
+	})
+}
+
+// validateResponse rejects empty responses and malformed structured output so
+// the chain can move on to another model
+func validateResponse(req *ChatCompletionRequest, resp *ChatCompletionResponse) error {
+	if len(resp.Choices) == 0 {
+		return fmt.Errorf("%w: no choices in response", ErrInvalidOutput)
+	}
+	if req.ResponseFormat != nil && req.ResponseFormat.Type == "json_schema" &&
+		!json.Valid([]byte(resp.Choices[0].Message.Content)) {
+		return fmt.Errorf("%w: %s", ErrInvalidOutput, resp.Choices[0].Message.Content)
+	}
+	return nil
 }
 
 // GenerateContent generates content using the AI model
 func (c *Client) GenerateContent(ctx context.Context, prompt string) (string, error) {
 	req := &ChatCompletionRequest{
-		Model: c.model,
 		Messages: []ChatMessage{
 			{Role: "user", Content: prompt},
 		},
 		Route: "fallback",
 	}
 
-	// Try primary model first, then fallback
-	resp, err := c.doRequest(ctx, req)
-	if err != nil && c.model == defaultModel {
-		// Try fallback model
-		req.Model = fallbackModel
-		resp, err = c.doRequest(ctx, req)
-	}
+	// Walk the model chain until one answers
+	resp, err := c.complete(ctx, req)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate content: %w", err)
 	}
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no choices in response")
-	}
-
 	return resp.Choices[0].Message.Content, nil
 }
 
@@ -190,7 +322,6 @@ func (c *Client) GenerateContentWithSchema(ctx context.Context, prompt string, s
 	schemaWithStrict["additionalProperties"] = false
 
 	req := &ChatCompletionRequest{
-		Model: c.model,
 		Messages: []ChatMessage{
 			{Role: "user", Content: prompt},
 		},
@@ -205,21 +336,12 @@ func (c *Client) GenerateContentWithSchema(ctx context.Context, prompt string, s
 		Route: "fallback",
 	}
 
-	// Try primary model first, then fallback
-	resp, err := c.doRequest(ctx, req)
-	if err != nil && c.model == defaultModel {
-		// Try fallback model
-		req.Model = fallbackModel
-		resp, err = c.doRequest(ctx, req)
-	}
+	// Walk the model chain until one answers
+	resp, err := c.complete(ctx, req)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate content with schema: %w", err)
 	}
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no choices in response")
-	}
-
 	return resp.Choices[0].Message.Content, nil
 }
 
@@ -244,31 +366,68 @@ func (c *Client) GenerateContentWithMessages(ctx context.Context, messages []Cha
 	}
 
 	req := &ChatCompletionRequest{
-		Model:          c.model,
 		Messages:       messages,
 		ResponseFormat: responseFormat,
 		Route:          "fallback",
 	}
 
-	// Try primary model first, then fallback
-	resp, err := c.doRequest(ctx, req)
-	if err != nil && c.model == defaultModel {
-		// Try fallback model
-		req.Model = fallbackModel
-		resp, err = c.doRequest(ctx, req)
-	}
+	// Walk the model chain until one answers
+	resp, err := c.complete(ctx, req)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate content: %w", err)
 	}
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no choices in response")
+	return resp.Choices[0].Message.Content, nil
+}
+
+// StreamContentWithMessages streams a plain-text completion for the given messages.
+// onDelta receives each content delta as it arrives. Other models in the chain
+// are only tried when a model fails before producing any output.
+func (c *Client) StreamContentWithMessages(ctx context.Context, messages []ChatMessage, onDelta func(string) error) (string, error) {
+	if err := c.checkBudget(ctx); err != nil {
+		return "", err
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	req := &ChatCompletionRequest{
+		Messages: messages,
+		Route:    "fallback",
+	}
+
+	var content string
+	_, err := c.chain.run(ctx, TreatmentFromContext(ctx).Models, func(model string) error {
+		req.Model = model
+		start := time.Now()
+		resp, err := c.provider.ChatCompletionStream(ctx, req, onDelta)
+		// Partial streams still consumed tokens, so usage is recorded either way
+		c.recordUsage(ctx, req, model, resp, time.Since(start))
+		if resp != nil && len(resp.Choices) > 0 {
+			content = resp.Choices[0].Message.Content
+		}
+		return err
+	})
+	if err != nil {
+		return content, fmt.Errorf("failed to stream content: %w", err)
+	}
+
+	return content, nil
 }
 
-// Model returns the model name being used
+// Model returns the primary model name being used
 func (c *Client) Model() string {
-	return c.model
+	return c.chain.models[0]
+}
+
+// Models returns the ordered model chain
+func (c *Client) Models() []string {
+	return append([]string(nil), c.chain.models...)
+}
+
+// Metrics returns per-model request outcomes, including which model answered
+func (c *Client) Metrics() []ModelMetrics {
+	return c.chain.metrics()
+}
+
+// Provider returns the name of the provider being used
+func (c *Client) Provider() string {
+	return c.provider.Name()
 }
@@ -0,0 +1,100 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// OfflineClosingMessage closes a session when the generated reflection can't be used
+const OfflineClosingMessage = "Terima kasih sudah menulis hari ini. Sampai jumpa di halaman berikutnya."
+
+// maxSessionTitleLength truncates generated session titles, in characters
+const maxSessionTitleLength = 60
+
+// SessionClosing is the closing ritual of a completed session
+type SessionClosing struct {
+	Message       string `json:"message"` // Closing reflection shown to the user
+	Title         string `json:"title"`
+	Summary       string `json:"summary"` // 2-3 sentences for the session list
+	PromptVersion string `json:"-"`       // Prompt templates that produced the closing
+}
+
+// GenerateClosing writes the closing reflection, title and summary of a
+// completed session from its running summary and its remaining messages,
+// in the voice of the persona attached to ctx
+func (p *PujanggaService) GenerateClosing(ctx context.Context, summary string, messages []Message) (*SessionClosing, error) {
+	ctx = withFeature(ctx, FeatureClosing)
+
+	prompt, version, err := p.prompts.Render(ctx, PromptClosing, map[string]interface{}{
+		"Persona": PersonaFromContext(ctx),
+		"Summary": summary,
+		"History": messages,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"message": map[string]interface{}{
+				"type":        "string",
+				"description": "A 1-2 sentence closing reflection in Indonesian, without a question",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "A 2-6 word session title in Indonesian",
+			},
+			"summary": map[string]interface{}{
+				"type":        "string",
+				"description": "A 2-3 sentence session summary in Indonesian",
+			},
+		},
+		"required": []string{"message", "title", "summary"},
+	}
+
+	responseText, err := p.client.GenerateContentWithSchema(ctx, prompt, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate closing: %w", err)
+	}
+
+	var closing SessionClosing
+	if err := json.Unmarshal([]byte(responseText), &closing); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	closing.PromptVersion = version
+
+	closing.Title = strings.TrimRight(strings.Trim(strings.TrimSpace(closing.Title), `"`), ".")
+	if title := []rune(closing.Title); len(title) > maxSessionTitleLength {
+		closing.Title = strings.TrimSpace(string(title[:maxSessionTitleLength]))
+	}
+	closing.Summary = strings.TrimSpace(closing.Summary)
+	closing.Message = strings.TrimSpace(closing.Message)
+
+	// The reflection ends the session, so it is held to the reply guardrails
+	// except the question rule
+	if p.guardrails != nil {
+		var violations []Violation
+		for _, v := range p.guardrails.Check(closing.Message) {
+			if v.Check != CheckQuestion {
+				violations = append(violations, v)
+			}
+		}
+		if len(violations) > 0 {
+			p.logViolations(ctx, version, violations)
+			log.Printf("[Guardrails] falling back to the offline closing (%s)", version)
+			closing.Message = OfflineClosingMessage
+			closing.PromptVersion = GuardrailsFallbackVersion
+		}
+	}
+
+	if closing.Title == "" || closing.Summary == "" {
+		return nil, fmt.Errorf("%w: closing without title or summary", ErrInvalidOutput)
+	}
+
+	return &closing, nil
+}
@@ -0,0 +1,163 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+//go:embed lexicon/emotion_words.txt
+var emotionWordsLexicon string
+
+//go:embed lexicon/reflection_markers.txt
+var reflectionMarkersLexicon string
+
+// DepthScore is how much a user turn deepens the conversation, from 0 to 1
+type DepthScore struct {
+	Words      float64  `json:"words"`           // From the message length
+	Emotion    float64  `json:"emotion"`         // From emotional vocabulary
+	Reflection float64  `json:"reflection"`      // From first-person reflection markers
+	Model      *float64 `json:"model,omitempty"` // The model's judgment, when enabled
+	Total      float64  `json:"total"`
+}
+
+// DepthEngine scores user turns and advances conversation depth once enough
+// substance has accumulated, so six "ok"s no longer count as a deep talk
+type DepthEngine struct {
+	FullWords        int     // Word count that maxes out the length score
+	FullMatches      int     // Distinct matches that max out the emotion and reflection scores
+	WordsWeight      float64 // Weights of the local components, summing to 1
+	EmotionWeight    float64
+	ReflectionWeight float64
+	ModelWeight      float64 // Share of the total taken by the model judgment, when present
+	LightAt          float64 // Accumulated score that advances Surface to Light
+	DeepAt           float64 // Accumulated score that advances Light to Deep
+
+	emotionWords      []string
+	reflectionMarkers []string
+}
+
+// NewDepthEngine creates a depth engine with the embedded lexicons. A typical
+// engaged message (about 15 words, one feeling, one reflection) scores about
+// 0.45, so depth advances after roughly two such messages per level.
+func NewDepthEngine() *DepthEngine {
+	return &DepthEngine{
+		FullWords:         40,
+		FullMatches:       2,
+		WordsWeight:       0.4,
+		EmotionWeight:     0.3,
+		ReflectionWeight:  0.3,
+		ModelWeight:       0.5,
+		LightAt:           0.8,
+		DeepAt:            1.2,
+		emotionWords:      parseLexicon(emotionWordsLexicon),
+		reflectionMarkers: parseLexicon(reflectionMarkersLexicon),
+	}
+}
+
+// Score scores a user message locally, without a model call
+func (e *DepthEngine) Score(content string) DepthScore {
+	normalized := normalizeForSafety(content)
+	words := len(strings.Fields(normalized))
+
+	score := DepthScore{
+		Words:      math.Min(float64(words)/float64(e.FullWords), 1),
+		Emotion:    math.Min(float64(countPhrases(normalized, e.emotionWords))/float64(e.FullMatches), 1),
+		Reflection: math.Min(float64(countPhrases(normalized, e.reflectionMarkers))/float64(e.FullMatches), 1),
+	}
+	score.Total = e.WordsWeight*score.Words + e.EmotionWeight*score.Emotion + e.ReflectionWeight*score.Reflection
+	return score
+}
+
+// WithModel blends the model's judgment, from 0 to 1, into a local score
+func (e *DepthEngine) WithModel(score DepthScore, judgment float64) DepthScore {
+	judgment = math.Min(math.Max(judgment, 0), 1)
+	score.Model = &judgment
+	score.Total = (1-e.ModelWeight)*score.Total + e.ModelWeight*judgment
+	return score
+}
+
+// Advance adds a turn's score to the progress at the current depth. Depth
+// advances one level when progress reaches the level's threshold, starting
+// the next level from zero; otherwise it holds. Depth never goes back.
+func (e *DepthEngine) Advance(depth DepthLevel, progress float64, score DepthScore) (DepthLevel, float64) {
+	if depth >= DepthDeep {
+		return DepthDeep, 0
+	}
+
+	progress += score.Total
+	if threshold := e.threshold(depth); progress >= threshold {
+		return depth + 1, 0
+	}
+	return max(depth, DepthSurface), progress
+}
+
+// Progress returns how far progress is toward the next level, from 0 to 1
+func (e *DepthEngine) Progress(depth DepthLevel, progress float64) float64 {
+	if depth >= DepthDeep {
+		return 1
+	}
+	return math.Min(progress/e.threshold(depth), 1)
+}
+
+// threshold returns the accumulated score that advances past depth
+func (e *DepthEngine) threshold(depth DepthLevel) float64 {
+	if depth == DepthLight {
+		return e.DeepAt
+	}
+	return e.LightAt
+}
+
+// countPhrases counts the distinct phrases found in normalized text
+func countPhrases(normalized string, phrases []string) int {
+	padded := " " + normalized + " "
+	count := 0
+	for _, phrase := range phrases {
+		if strings.Contains(padded, " "+phrase+" ") {
+			count++
+		}
+	}
+	return count
+}
+
+// JudgeDepth asks the model how reflective the user's latest message is in
+// the context of the conversation. Returns a judgment from 0 to 1.
+func (p *PujanggaService) JudgeDepth(ctx context.Context, recentMessages []Message) (float64, error) {
+	ctx = withFeature(ctx, FeatureDepth)
+
+	prompt, _, err := p.prompts.Render(ctx, PromptDepth, map[string]interface{}{
+		"History": recentMessages,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"reflection": map[string]interface{}{
+				"type":        "integer",
+				"description": "0 (no substance) to 4 (deep self-reflection)",
+			},
+		},
+		"required": []string{"reflection"},
+	}
+
+	responseText, err := p.client.GenerateContentWithSchema(ctx, prompt, schema)
+	if err != nil {
+		return 0, fmt.Errorf("failed to judge depth: %w", err)
+	}
+
+	var result struct {
+		Reflection int `json:"reflection"`
+	}
+	if err := json.Unmarshal([]byte(responseText), &result); err != nil {
+		return 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return float64(min(max(result.Reflection, 0), 4)) / 4, nil
+}
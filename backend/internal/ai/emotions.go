@@ -0,0 +1,72 @@
+// Package ai provides AI integration for the application
+package ai
+
+import "strings"
+
+// EmotionLabels is the vocabulary the model picks detected emotions from
+var EmotionLabels = []string{"senang", "sedih", "cemas", "marah", "kelelahan", "harapan", "cinta", "ambisi", "kesepian", "syukur"}
+
+// emotionAliases maps common model deviations from the vocabulary, such as
+// English names and Indonesian synonyms, to an emotion label
+var emotionAliases = map[string]string{
+	"bahagia":    "senang",
+	"gembira":    "senang",
+	"happy":      "senang",
+	"joy":        "senang",
+	"sad":        "sedih",
+	"sadness":    "sedih",
+	"khawatir":   "cemas",
+	"gelisah":    "cemas",
+	"anxious":    "cemas",
+	"anxiety":    "cemas",
+	"kesal":      "marah",
+	"frustrasi":  "marah",
+	"angry":      "marah",
+	"anger":      "marah",
+	"lelah":      "kelelahan",
+	"capek":      "kelelahan",
+	"tired":      "kelelahan",
+	"exhausted":  "kelelahan",
+	"berharap":   "harapan",
+	"hope":       "harapan",
+	"hopeful":    "harapan",
+	"sayang":     "cinta",
+	"love":       "cinta",
+	"semangat":   "ambisi",
+	"ambition":   "ambisi",
+	"sepi":       "kesepian",
+	"lonely":     "kesepian",
+	"loneliness": "kesepian",
+	"bersyukur":  "syukur",
+	"grateful":   "syukur",
+	"gratitude":  "syukur",
+}
+
+// NormalizeEmotion maps a detected emotion onto EmotionLabels. It returns
+// false for emotions outside the vocabulary.
+func NormalizeEmotion(emotion string) (string, bool) {
+	emotion = strings.ToLower(strings.TrimSpace(emotion))
+	for _, label := range EmotionLabels {
+		if emotion == label {
+			return label, true
+		}
+	}
+	label, ok := emotionAliases[emotion]
+	return label, ok
+}
+
+// NormalizeEmotions maps detected emotions onto EmotionLabels, dropping
+// unknown emotions and duplicates while keeping the model's order
+func NormalizeEmotions(emotions []string) []string {
+	normalized := make([]string, 0, len(emotions))
+	seen := map[string]bool{}
+	for _, emotion := range emotions {
+		label, ok := NormalizeEmotion(emotion)
+		if !ok || seen[label] {
+			continue
+		}
+		seen[label] = true
+		normalized = append(normalized, label)
+	}
+	return normalized
+}
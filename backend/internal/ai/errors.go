@@ -0,0 +1,108 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidOutput is returned when a model answers a structured request with
+// content that is not valid JSON
+var ErrInvalidOutput = errors.New("model returned invalid structured output")
+
+// ErrNoModelAvailable is returned when every model in the chain is skipped
+// because its circuit breaker is open
+var ErrNoModelAvailable = errors.New("no AI model available")
+
+// APIError is a non-successful response from a provider
+type APIError struct {
+	StatusCode int
+	Message    string
+	// RetryAfter is the delay requested by the provider, zero if none was given
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+// ErrorClass describes how the model chain reacts to a failed attempt
+type ErrorClass int
+
+const (
+	// ErrorRetryable is a transient failure; the same model is retried after a backoff
+	ErrorRetryable ErrorClass = iota
+	// ErrorNextModel is specific to the model; the chain moves on to the next model
+	ErrorNextModel
+	// ErrorFatal will not be fixed by retrying any model; the chain stops
+	ErrorFatal
+)
+
+// String returns the class name for logs and metrics
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorRetryable:
+		return "retryable"
+	case ErrorNextModel:
+		return "next_model"
+	default:
+		return "fatal"
+	}
+}
+
+// ClassifyError determines how a failed attempt should be handled
+func ClassifyError(err error) ErrorClass {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrorFatal
+	}
+	if errors.Is(err, ErrStreamStarted) {
+		return ErrorFatal
+	}
+	if errors.Is(err, ErrCassetteMiss) {
+		// A missing recording means the request changed; playing back another
+		// model's recording would hide that
+		return ErrorFatal
+	}
+	if errors.Is(err, ErrInvalidOutput) {
+		return ErrorNextModel
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests,
+			apiErr.StatusCode == http.StatusRequestTimeout,
+			apiErr.StatusCode >= 500:
+			return ErrorRetryable
+		case apiErr.StatusCode == http.StatusUnauthorized,
+			apiErr.StatusCode == http.StatusForbidden,
+			apiErr.StatusCode == http.StatusPaymentRequired:
+			// Credentials or credit problems affect every model alike
+			return ErrorFatal
+		default:
+			// Bad request, unknown model, unsupported response format...
+			return ErrorNextModel
+		}
+	}
+
+	// Network errors and unreadable responses are treated as transient
+	return ErrorRetryable
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,201 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Guardrail check names reported in violations
+const (
+	CheckEmpty        = "empty"
+	CheckSentences    = "sentences"
+	CheckQuestion     = "question"
+	CheckEnglish      = "english"
+	CheckBannedPhrase = "banned_phrase"
+	CheckLength       = "length"
+)
+
+//go:embed lexicon/english.txt
+var englishLexiconFile string
+
+var (
+	// sentenceEnd matches sentence-ending punctuation followed by whitespace or the end of text
+	sentenceEnd = regexp.MustCompile(`[.!?…]+(\s+|$)`)
+	// wordPattern matches words, keeping hyphenated Indonesian forms like "journey-mu" together
+	wordPattern = regexp.MustCompile(`[\p{L}]+(?:-[\p{L}]+)*`)
+)
+
+// Violation is a broken output rule
+type Violation struct {
+	Check  string `json:"check"`
+	Detail string `json:"detail"` // Indonesian description, also sent to the model when repairing
+}
+
+// Guardrails validates Pujangga replies against the output rules of the system prompt
+type Guardrails struct {
+	MaxSentences    int      // Maximum number of sentences
+	RequireQuestion bool     // Whether the reply must end with a question
+	MaxEnglishRatio float64  // Maximum share of English words, checked from MinEnglishWords words on
+	MinEnglishWords int      // Replies shorter than this skip the English check
+	MaxLength       int      // Maximum length in characters
+	BannedPhrases   []string // Slang and corporate speak, matched case-insensitively on word boundaries
+	MaxRepairs      int      // Corrective retries before falling back to a safe prompt
+
+	english map[string]bool
+	banned  []*regexp.Regexp
+}
+
+// DefaultBannedPhrases lists the slang and corporate speak the PRD rules out
+var DefaultBannedPhrases = []string{
+	// Gen-Z slang
+	"kuy", "goks", "jujurly", "slay", "gaskeun", "anjay", "bestie", "sabi", "literally", "which is",
+	// Corporate speak
+	"mari kita explore", "journey-mu", "journey kamu", "leverage", "insight-mu", "deep dive",
+	// Overly poetic
+	"di tengah riuh rendah",
+}
+
+// DefaultGuardrails returns guardrails matching the system prompt rules
+func DefaultGuardrails() *Guardrails {
+	return NewGuardrails(Guardrails{
+		MaxSentences:    2,
+		RequireQuestion: true,
+		MaxEnglishRatio: 0.3,
+		MinEnglishWords: 4,
+		MaxLength:       280,
+		BannedPhrases:   DefaultBannedPhrases,
+		MaxRepairs:      1,
+	})
+}
+
+// NewGuardrails prepares guardrails from a configuration
+func NewGuardrails(cfg Guardrails) *Guardrails {
+	g := cfg
+	g.english = map[string]bool{}
+	for _, word := range parseLexicon(englishLexiconFile) {
+		g.english[word] = true
+	}
+
+	g.banned = make([]*regexp.Regexp, 0, len(cfg.BannedPhrases))
+	for _, phrase := range cfg.BannedPhrases {
+		g.banned = append(g.banned, regexp.MustCompile(`(?i)(^|[^\p{L}])`+regexp.QuoteMeta(phrase)+`($|[^\p{L}])`))
+	}
+
+	return &g
+}
+
+// Check returns every rule the message breaks
+func (g *Guardrails) Check(message string) []Violation {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return []Violation{{Check: CheckEmpty, Detail: "Balasan kosong."}}
+	}
+
+	var violations []Violation
+
+	if g.MaxLength > 0 && utf8.RuneCountInString(message) > g.MaxLength {
+		violations = append(violations, Violation{
+			Check:  CheckLength,
+			Detail: fmt.Sprintf("Balasan terlalu panjang (%d karakter, maksimal %d).", utf8.RuneCountInString(message), g.MaxLength),
+		})
+	}
+
+	if sentences := countSentences(message); g.MaxSentences > 0 && sentences > g.MaxSentences {
+		violations = append(violations, Violation{
+			Check:  CheckSentences,
+			Detail: fmt.Sprintf("Balasan terdiri dari %d kalimat, maksimal %d.", sentences, g.MaxSentences),
+		})
+	}
+
+	if g.RequireQuestion && !strings.HasSuffix(message, "?") {
+		violations = append(violations, Violation{
+			Check:  CheckQuestion,
+			Detail: "Balasan harus diakhiri dengan pertanyaan.",
+		})
+	}
+
+	words := wordPattern.FindAllString(strings.ToLower(message), -1)
+	if len(words) >= g.MinEnglishWords && len(words) > 0 {
+		english := 0
+		for _, word := range words {
+			if g.english[word] {
+				english++
+			}
+		}
+		if ratio := float64(english) / float64(len(words)); ratio > g.MaxEnglishRatio {
+			violations = append(violations, Violation{
+				Check:  CheckEnglish,
+				Detail: fmt.Sprintf("Balasan mengandung terlalu banyak bahasa Inggris (%.0f%% kata).", ratio*100),
+			})
+		}
+	}
+
+	for i, pattern := range g.banned {
+		if pattern.MatchString(message) {
+			violations = append(violations, Violation{
+				Check:  CheckBannedPhrase,
+				Detail: fmt.Sprintf("Jangan gunakan frasa \"%s\".", g.BannedPhrases[i]),
+			})
+		}
+	}
+
+	return violations
+}
+
+// countSentences counts sentences by their ending punctuation; trailing text
+// without punctuation counts as a sentence too
+func countSentences(message string) int {
+	count := 0
+	rest := message
+	for {
+		loc := sentenceEnd.FindStringIndex(rest)
+		if loc == nil {
+			break
+		}
+		if strings.TrimSpace(rest[:loc[0]]) != "" {
+			count++
+		}
+		rest = rest[loc[1]:]
+	}
+	if strings.TrimSpace(rest) != "" {
+		count++
+	}
+	return count
+}
+
+// GuardrailsFallbackVersion is the prompt version recorded for replies
+// replaced by a safe prompt
+const GuardrailsFallbackVersion = "guardrails.fallback"
+
+// safePrompts are curated replies used when a generated reply can't be repaired
+var safePrompts = map[DepthLevel][]string{
+	DepthSurface: {
+		"Oke. Apa satu hal yang paling kamu ingat hari ini?",
+		"Aku dengar. Apa yang paling banyak menyita pikiranmu hari ini?",
+	},
+	DepthLight: {
+		"Paham. Kenapa hal itu bikin kamu merasa begitu?",
+		"Aku dengar. Apa yang kamu rasakan waktu itu terjadi?",
+	},
+	DepthDeep: {
+		"Menarik. Kalau dipikir lagi, apa yang situasi ini ajarkan ke kamu?",
+		"Aku dengar. Apa arti hal ini buat kamu?",
+	},
+}
+
+// SafePrompt returns a curated reply for a depth level. seed varies the pick
+// deterministically, e.g. with the user's message count.
+func SafePrompt(depth DepthLevel, seed int) string {
+	prompts, ok := safePrompts[depth]
+	if !ok {
+		prompts = safePrompts[DepthSurface]
+	}
+	if seed < 0 {
+		seed = -seed
+	}
+	return prompts[seed%len(prompts)]
+}
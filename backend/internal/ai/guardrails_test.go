@@ -0,0 +1,151 @@
+package ai
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCountSentences(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    int
+	}{
+		{"empty", "", 0},
+		{"no punctuation", "Aku dengar", 1},
+		{"acknowledgment and question", "Oke. Apa kabar?", 2},
+		{"three sentences", "Satu. Dua. Tiga?", 3},
+		{"repeated punctuation", "Wah!! Kenapa?", 2},
+		{"ellipsis", "Hmm... apa yang terjadi?", 2},
+		{"unicode ellipsis", "Hmm… apa yang terjadi?", 2},
+		{"decimal point", "Versi 2.5 lebih baik?", 1},
+		{"trailing text", "Oke. Lalu", 2},
+		{"punctuation only", "?!", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countSentences(tt.message); got != tt.want {
+				t.Errorf("countSentences(%q) = %d, want %d", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuardrailsCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []string
+	}{
+		{"valid", "Aku dengar. Apa yang paling kamu rasakan hari ini?", nil},
+		{"empty", "   ", []string{CheckEmpty}},
+		{"too many sentences", "Oke. Aku dengar. Apa yang kamu rasakan?", []string{CheckSentences}},
+		{"no question", "Aku dengar ceritamu hari ini.", []string{CheckQuestion}},
+		{"too long", strings.Repeat("a", 281) + "?", []string{CheckLength}},
+		{"mostly english", "I really feel you so much?", []string{CheckEnglish}},
+		{"short english skipped", "Feel so?", nil},
+		{"some english allowed", "Aku dengar, kamu merasa so tired hari ini?", nil},
+		{"banned phrase", "Kuy, apa yang kamu rasakan?", []string{CheckBannedPhrase}},
+		{"banned phrase inside a word", "Apa itu kuyang?", nil},
+		{"hyphenated banned phrase", "Gimana journey-mu hari ini?", []string{CheckBannedPhrase}},
+		{"several rules", "Literally slay", []string{CheckQuestion, CheckBannedPhrase, CheckBannedPhrase}},
+	}
+
+	g := DefaultGuardrails()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range g.Check(tt.message) {
+				got = append(got, v.Check)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Check(%q) = %v, want %v", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuardRepairsThenFallsBack(t *testing.T) {
+	const (
+		version  = "respond.v1"
+		fallback = "Aku dengar. Apa arti hal ini buat kamu?"
+	)
+
+	tests := []struct {
+		name        string
+		message     string
+		repaired    string // What the model answers to the repair prompt
+		want        string
+		wantVersion string
+	}{
+		{
+			name:        "valid reply kept",
+			message:     "Aku dengar. Apa yang kamu rasakan?",
+			repaired:    "Tidak dipakai?",
+			want:        "Aku dengar. Apa yang kamu rasakan?",
+			wantVersion: version,
+		},
+		{
+			name:        "repaired reply used",
+			message:     "Kuy cerita lagi.",
+			repaired:    `"Aku dengar. Apa yang terjadi setelah itu?"`,
+			want:        "Aku dengar. Apa yang terjadi setelah itu?",
+			wantVersion: version + "+repair.v1",
+		},
+		{
+			name:        "unrepairable reply replaced",
+			message:     "Kuy cerita lagi.",
+			repaired:    "Gaskeun cerita lagi.",
+			want:        fallback,
+			wantVersion: GuardrailsFallbackVersion,
+		},
+	}
+
+	prompts, err := NewPromptRegistry("")
+	if err != nil {
+		t.Fatalf("NewPromptRegistry: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(context.Background(), ClientConfig{
+				Provider: NewScriptedProvider([]ScriptRule{{Response: tt.repaired}}),
+			})
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+			p := NewPujanggaService(client, prompts, DefaultGuardrails())
+
+			got, gotVersion := p.guard(context.Background(), "prompt", tt.message, version, fallback)
+			if got != tt.want || gotVersion != tt.wantVersion {
+				t.Errorf("guard() = %q (%s), want %q (%s)", got, gotVersion, tt.want, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestSafePrompt(t *testing.T) {
+	tests := []struct {
+		name  string
+		depth DepthLevel
+		seed  int
+		want  string
+	}{
+		{"surface", DepthSurface, 0, safePrompts[DepthSurface][0]},
+		{"seed varies the pick", DepthLight, 1, safePrompts[DepthLight][1]},
+		{"seed wraps around", DepthDeep, 2, safePrompts[DepthDeep][0]},
+		{"negative seed", DepthDeep, -1, safePrompts[DepthDeep][1]},
+		{"unknown depth", DepthLevel(99), 0, safePrompts[DepthSurface][0]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SafePrompt(tt.depth, tt.seed); got != tt.want {
+				t.Errorf("SafePrompt(%v, %d) = %q, want %q", tt.depth, tt.seed, got, tt.want)
+			}
+		})
+	}
+}
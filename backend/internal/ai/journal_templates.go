@@ -0,0 +1,268 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// JournalTemplate is a guided journaling mode with its own step sequence,
+// replacing the free-form depth ladder until its steps are completed
+type JournalTemplate struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Opening     string                 `json:"opening"` // First message, asking the first step
+	Steps       []TemplateStep         `json:"steps"`
+	Output      map[string]interface{} `json:"-"` // JSON schema of the structured output, nil for none
+}
+
+// TemplateStep is one step of a journal template. A step is complete once the
+// user has written at least MinMessages messages and MinWords words in it.
+type TemplateStep struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Instruction string `json:"-"` // What the Pujangga asks for in this step
+	MinMessages int    `json:"min_messages"`
+	MinWords    int    `json:"min_words"`
+}
+
+// HasOutput reports whether the template produces a structured output
+func (t *JournalTemplate) HasOutput() bool {
+	return t.Output != nil
+}
+
+// TemplatePromptVersion is recorded on template openings, which are not generated
+func TemplatePromptVersion(templateID string) string {
+	return "template." + templateID
+}
+
+// stringList is a JSON schema for a list of strings
+func stringList(description string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "array",
+		"items":       map[string]interface{}{"type": "string"},
+		"description": description,
+	}
+}
+
+// stringField is a JSON schema for a string
+func stringField(description string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "string",
+		"description": description,
+	}
+}
+
+// outputSchema is a JSON schema for an object whose fields are all required
+func outputSchema(properties map[string]interface{}) map[string]interface{} {
+	required := make([]string, 0, len(properties))
+	for name := range properties {
+		required = append(required, name)
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// JournalTemplates lists the guided journaling modes, in display order
+var JournalTemplates = []*JournalTemplate{
+	{
+		ID:          "gratitude",
+		Name:        "Daftar Syukur",
+		Description: "Tulis tiga hal yang kamu syukuri hari ini dan kenapa hal itu berarti.",
+		Opening:     "Yuk mulai Daftar Syukur. Tiga hal apa yang kamu syukuri hari ini?",
+		Steps: []TemplateStep{
+			{Key: "list", Name: "Tiga hal", MinMessages: 1, MinWords: 6,
+				Instruction: "Minta user menuliskan tiga hal yang ia syukuri hari ini, sekecil apa pun. Jika belum tiga, minta sisanya."},
+			{Key: "why", Name: "Kenapa berarti", MinMessages: 1, MinWords: 5,
+				Instruction: "Pilih satu hal dari daftar user dan tanyakan kenapa hal itu berarti baginya."},
+		},
+		Output: outputSchema(map[string]interface{}{
+			"items":     stringList("The things the user is grateful for"),
+			"highlight": stringField("Why the most meaningful item matters to the user, one sentence"),
+		}),
+	},
+	{
+		ID:          "thought_record",
+		Name:        "Catatan Pikiran (CBT)",
+		Description: "Urai pikiran yang mengganggu: situasi, pikiran otomatis, perasaan, bukti, dan pikiran yang lebih seimbang.",
+		Opening:     "Kita coba catatan pikiran, ya. Situasi apa yang lagi mengganggu pikiranmu?",
+		Steps: []TemplateStep{
+			{Key: "situation", Name: "Situasi", MinMessages: 1, MinWords: 5,
+				Instruction: "Minta user menjelaskan situasinya secara faktual: apa, kapan, di mana, dengan siapa."},
+			{Key: "thought", Name: "Pikiran otomatis", MinMessages: 1, MinWords: 3,
+				Instruction: "Tanyakan pikiran apa yang otomatis muncul di kepala user saat situasi itu terjadi."},
+			{Key: "emotion", Name: "Perasaan", MinMessages: 1, MinWords: 1,
+				Instruction: "Tanyakan perasaan yang muncul dan seberapa kuat, dari 0 sampai 100."},
+			{Key: "evidence_for", Name: "Bukti yang mendukung", MinMessages: 1, MinWords: 3,
+				Instruction: "Tanyakan fakta apa yang mendukung pikiran otomatis itu."},
+			{Key: "evidence_against", Name: "Bukti yang tidak mendukung", MinMessages: 1, MinWords: 3,
+				Instruction: "Tanyakan fakta apa yang tidak cocok dengan pikiran otomatis itu."},
+			{Key: "balanced", Name: "Pikiran seimbang", MinMessages: 1, MinWords: 3,
+				Instruction: "Ajak user merumuskan pikiran yang lebih seimbang setelah melihat kedua sisi buktinya."},
+		},
+		Output: outputSchema(map[string]interface{}{
+			"situation":         stringField("The situation, factually"),
+			"automatic_thought": stringField("The automatic thought"),
+			"emotions":          stringList("Emotions felt, with intensity when given, e.g. \"cemas (80)\""),
+			"evidence_for":      stringList("Facts supporting the thought"),
+			"evidence_against":  stringList("Facts not supporting the thought"),
+			"balanced_thought":  stringField("The balanced alternative thought"),
+		}),
+	},
+	{
+		ID:          "morning_pages",
+		Name:        "Halaman Pagi",
+		Description: "Menulis bebas tanpa menyunting, sampai sekitar 300 kata, untuk menjernihkan kepala di pagi hari.",
+		Opening:     "Halaman Pagi dimulai. Tulis apa saja yang ada di kepalamu sekarang, tanpa disunting.",
+		Steps: []TemplateStep{
+			{Key: "write", Name: "Menulis bebas", MinMessages: 1, MinWords: 300,
+				Instruction: "Jangan mengarahkan topik. Balas sangat singkat dan dorong user terus menulis apa saja yang terlintas, tanpa menyunting."},
+		},
+	},
+	{
+		ID:          "evening_review",
+		Name:        "Tinjauan Malam",
+		Description: "Tinjau harimu: yang berjalan baik, yang menantang, pelajarannya, dan satu niat untuk besok.",
+		Opening:     "Waktunya tinjauan malam. Apa yang berjalan baik hari ini?",
+		Steps: []TemplateStep{
+			{Key: "wins", Name: "Yang berjalan baik", MinMessages: 1, MinWords: 3,
+				Instruction: "Tanyakan hal-hal yang berjalan baik hari ini."},
+			{Key: "challenges", Name: "Yang menantang", MinMessages: 1, MinWords: 3,
+				Instruction: "Tanyakan hal yang terasa menantang atau tidak sesuai harapan hari ini."},
+			{Key: "lesson", Name: "Pelajaran", MinMessages: 1, MinWords: 3,
+				Instruction: "Tanyakan pelajaran apa yang bisa user ambil dari hari ini."},
+			{Key: "tomorrow", Name: "Niat untuk besok", MinMessages: 1, MinWords: 3,
+				Instruction: "Tanyakan satu niat kecil yang ingin user bawa ke hari esok."},
+		},
+		Output: outputSchema(map[string]interface{}{
+			"wins":       stringList("What went well"),
+			"challenges": stringList("What was challenging"),
+			"lesson":     stringField("The lesson of the day"),
+			"tomorrow":   stringField("The intention for tomorrow"),
+		}),
+	},
+	{
+		ID:          "dream",
+		Name:        "Jurnal Mimpi",
+		Description: "Catat mimpimu selagi masih ingat, perasaannya, dan hal yang menonjol di dalamnya.",
+		Opening:     "Semalam mimpi apa? Ceritakan selagi masih ingat.",
+		Steps: []TemplateStep{
+			{Key: "recall", Name: "Isi mimpi", MinMessages: 1, MinWords: 10,
+				Instruction: "Minta user menceritakan mimpinya sedetail yang ia ingat."},
+			{Key: "feelings", Name: "Perasaan", MinMessages: 1, MinWords: 1,
+				Instruction: "Tanyakan apa yang user rasakan di dalam mimpi dan setelah bangun."},
+			{Key: "symbols", Name: "Yang menonjol", MinMessages: 1, MinWords: 3,
+				Instruction: "Tanyakan bagian mimpi yang paling menonjol dan apakah itu mengingatkan user pada sesuatu di hidupnya. Jangan menafsirkan arti mimpi."},
+		},
+		Output: outputSchema(map[string]interface{}{
+			"summary":  stringField("The dream in one or two sentences"),
+			"feelings": stringList("Feelings in and after the dream"),
+			"symbols":  stringList("Notable people, places or objects in the dream"),
+		}),
+	},
+	{
+		ID:          "decision",
+		Name:        "Pertimbangan Keputusan",
+		Description: "Timbang sebuah keputusan: untung-ruginya, apa yang paling penting bagimu, dan ke mana kamu condong.",
+		Opening:     "Lagi menimbang keputusan apa?",
+		Steps: []TemplateStep{
+			{Key: "decision", Name: "Keputusan", MinMessages: 1, MinWords: 3,
+				Instruction: "Minta user menjelaskan keputusan yang sedang ia timbang dan pilihan-pilihannya."},
+			{Key: "pros", Name: "Keuntungan", MinMessages: 1, MinWords: 3,
+				Instruction: "Tanyakan keuntungan dari pilihan yang sedang user pertimbangkan."},
+			{Key: "cons", Name: "Kerugian", MinMessages: 1, MinWords: 3,
+				Instruction: "Tanyakan kerugian atau risiko dari pilihan itu."},
+			{Key: "values", Name: "Yang paling penting", MinMessages: 1, MinWords: 3,
+				Instruction: "Tanyakan apa yang paling penting bagi user dalam keputusan ini."},
+			{Key: "leaning", Name: "Kecondongan", MinMessages: 1, MinWords: 1,
+				Instruction: "Tanyakan user sekarang condong ke pilihan mana, tanpa mendorong ke pilihan tertentu."},
+		},
+		Output: outputSchema(map[string]interface{}{
+			"decision": stringField("The decision and its options"),
+			"pros":     stringList("Advantages"),
+			"cons":     stringList("Disadvantages and risks"),
+			"values":   stringList("What matters most to the user"),
+			"leaning":  stringField("Which option the user leans toward, or \"belum yakin\""),
+		}),
+	},
+}
+
+// JournalTemplateByID returns the journal template with the given ID
+func JournalTemplateByID(id string) (*JournalTemplate, bool) {
+	for _, t := range JournalTemplates {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// GuideTurn is where a guided session stands for the reply being generated
+type GuideTurn struct {
+	Template  *JournalTemplate
+	Step      int  // Index of the step the reply asks for
+	Completed bool // Whether every step is done, so the reply wraps the guide up
+}
+
+// guidePrompt is the template data for a guided turn
+type guidePrompt struct {
+	Name        string
+	StepNumber  int
+	StepCount   int
+	StepName    string
+	Instruction string
+	Completed   bool
+}
+
+// newGuidePrompt builds the template data for a guided turn, nil outside guided sessions
+func newGuidePrompt(guide *GuideTurn) *guidePrompt {
+	if guide == nil || guide.Template == nil {
+		return nil
+	}
+
+	data := &guidePrompt{
+		Name:      guide.Template.Name,
+		StepCount: len(guide.Template.Steps),
+		Completed: guide.Completed,
+	}
+	if !guide.Completed {
+		step := guide.Template.Steps[guide.Step]
+		data.StepNumber = guide.Step + 1
+		data.StepName = step.Name
+		data.Instruction = step.Instruction
+	}
+	return data
+}
+
+// ExtractTemplateOutput extracts a completed guided session's structured
+// output using the template's schema
+func (p *PujanggaService) ExtractTemplateOutput(ctx context.Context, template *JournalTemplate, sessionMessages []Message) (json.RawMessage, error) {
+	ctx = withFeature(ctx, FeatureTemplate)
+
+	if !template.HasOutput() {
+		return nil, nil
+	}
+
+	prompt, _, err := p.prompts.Render(ctx, PromptTemplateOutput, map[string]interface{}{
+		"Name":     template.Name,
+		"Messages": sessionMessages,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	responseText, err := p.client.GenerateContentWithSchema(ctx, prompt, template.Output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract template output: %w", err)
+	}
+
+	if !json.Valid([]byte(responseText)) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidOutput, responseText)
+	}
+	return json.RawMessage(responseText), nil
+}
@@ -0,0 +1,131 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Memory kinds
+const (
+	MemoryPerson    = "person"    // People in the user's life
+	MemorySituation = "situation" // Ongoing situations
+	MemoryGoal      = "goal"      // Goals and plans
+	MemoryWorry     = "worry"     // Recurring worries
+)
+
+// MemoryKinds lists every memory kind
+var MemoryKinds = []string{MemoryPerson, MemorySituation, MemoryGoal, MemoryWorry}
+
+// ValidMemoryKind reports whether kind is a known memory kind
+func ValidMemoryKind(kind string) bool {
+	for _, k := range MemoryKinds {
+		if kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+// Memory is a durable fact about the user from earlier sessions
+type Memory struct {
+	Kind    string `json:"kind"`
+	Content string `json:"content"`
+}
+
+// ExtractedMemory is a fact extracted from a finished session
+type ExtractedMemory struct {
+	Kind       string `json:"kind"`
+	Content    string `json:"content"`
+	Importance int    `json:"importance"` // 1 (minor detail) to 5 (central to the user's life)
+	SameAs     int    `json:"same_as"`    // 1-based index into the known memories, 0 for a new fact
+}
+
+// knownMemory is a numbered memory in the extraction prompt
+type knownMemory struct {
+	Number  int
+	Kind    string
+	Content string
+}
+
+// ExtractMemories extracts durable facts from a finished session. known
+// lets the model recognize facts it already remembers; those come back with
+// SameAs set. Invalid entries are dropped.
+func (p *PujanggaService) ExtractMemories(ctx context.Context, sessionMessages []Message, known []Memory) ([]ExtractedMemory, error) {
+	ctx = withFeature(ctx, FeatureMemory)
+
+	numbered := make([]knownMemory, len(known))
+	for i, memory := range known {
+		numbered[i] = knownMemory{Number: i + 1, Kind: memory.Kind, Content: memory.Content}
+	}
+
+	prompt, _, err := p.prompts.Render(ctx, PromptMemories, map[string]interface{}{
+		"Messages": sessionMessages,
+		"Known":    numbered,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"memories": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"kind": map[string]interface{}{
+							"type": "string",
+							"enum": MemoryKinds,
+						},
+						"content": map[string]interface{}{
+							"type":        "string",
+							"description": "The fact as one short Indonesian sentence",
+						},
+						"importance": map[string]interface{}{
+							"type":        "integer",
+							"description": "1 (minor detail) to 5 (central to the user's life)",
+						},
+						"same_as": map[string]interface{}{
+							"type":        "integer",
+							"description": "Number of the matching known memory, or 0 for a new fact",
+						},
+					},
+					"required":             []string{"kind", "content", "importance", "same_as"},
+					"additionalProperties": false,
+				},
+			},
+		},
+		"required": []string{"memories"},
+	}
+
+	responseText, err := p.client.GenerateContentWithSchema(ctx, prompt, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract memories: %w", err)
+	}
+
+	var result struct {
+		Memories []ExtractedMemory `json:"memories"`
+	}
+	if err := json.Unmarshal([]byte(responseText), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	memories := make([]ExtractedMemory, 0, len(result.Memories))
+	for _, memory := range result.Memories {
+		memory.Content = strings.TrimSpace(memory.Content)
+		if memory.Content == "" || !ValidMemoryKind(memory.Kind) {
+			continue
+		}
+		memory.Importance = min(max(memory.Importance, 1), 5)
+		if memory.SameAs < 0 || memory.SameAs > len(known) {
+			memory.SameAs = 0
+		}
+		memories = append(memories, memory)
+	}
+
+	return memories, nil
+}
@@ -0,0 +1,263 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	openRouterBaseURL = "https://openrouter.ai/api/v1"
+	appReferer        = "https://catetin.aidityas.me"
+	appTitle          = "Catetin Aidityas"
+)
+
+// OpenAICompatibleProvider talks to any server implementing the OpenAI
+// chat completions API (OpenRouter, Ollama, llama.cpp server, vLLM)
+type OpenAICompatibleProvider struct {
+	name       string
+	endpoint   string
+	apiKey     string
+	headers    map[string]string
+	openRouter bool // Whether OpenRouter-only request fields such as "route" are supported
+	httpClient *http.Client
+	// streamHTTPClient has no overall timeout since streams are bounded by the request context
+	streamHTTPClient *http.Client
+}
+
+// NewOpenRouterProvider creates a provider for the OpenRouter API
+func NewOpenRouterProvider(apiKey string) *OpenAICompatibleProvider {
+	p := NewOpenAICompatibleProvider(openRouterBaseURL, apiKey)
+	p.name = ProviderOpenRouter
+	p.openRouter = true
+	p.headers = map[string]string{
+		"HTTP-Referer": appReferer,
+		"X-Title":      appTitle,
+	}
+	return p
+}
+
+// NewOpenAICompatibleProvider creates a provider for an OpenAI-compatible base URL,
+// e.g. "http://localhost:11434/v1" for Ollama. apiKey may be empty for local servers.
+func NewOpenAICompatibleProvider(baseURL, apiKey string) *OpenAICompatibleProvider {
+	return &OpenAICompatibleProvider{
+		name:     ProviderOpenAICompatible,
+		endpoint: strings.TrimRight(baseURL, "/") + "/chat/completions",
+		apiKey:   apiKey,
+		headers:  map[string]string{},
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+		streamHTTPClient: &http.Client{},
+	}
+}
+
+// WithTransport makes the provider send requests through transport.
+// A nil transport keeps the default.
+func (p *OpenAICompatibleProvider) WithTransport(transport http.RoundTripper) *OpenAICompatibleProvider {
+	if transport != nil {
+		p.httpClient.Transport = transport
+		p.streamHTTPClient.Transport = transport
+	}
+	return p
+}
+
+// Name identifies the provider in logs
+func (p *OpenAICompatibleProvider) Name() string {
+	return p.name
+}
+
+// newHTTPRequest builds an authenticated chat completion request
+func (p *OpenAICompatibleProvider) newHTTPRequest(ctx context.Context, req *ChatCompletionRequest) (*http.Request, error) {
+	wireReq := *req
+	if !p.openRouter {
+		wireReq.Route = ""
+	}
+
+	body, err := json.Marshal(&wireReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	for key, value := range p.headers {
+		httpReq.Header.Set(key, value)
+	}
+	if req.Stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	return httpReq, nil
+}
+
+// ChatCompletion performs a single blocking chat completion
+func (p *OpenAICompatibleProvider) ChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	httpReq, err := p.newHTTPRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var result ChatCompletionResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, newAPIError(resp, string(respBody))
+		}
+		return nil, fmt.Errorf("failed to unmarshal response: %w (body: %s)", err, string(respBody))
+	}
+
+	if result.Error != nil {
+		apiErr := newAPIError(resp, fmt.Sprintf("%s (type: %s, code: %v)", result.Error.Message, result.Error.Type, result.Error.Code))
+		// OpenRouter may report upstream errors with a 200 status and a numeric code
+		if code, ok := result.Error.Code.(float64); ok && code >= 400 {
+			apiErr.StatusCode = int(code)
+		}
+		return nil, apiErr
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp, string(respBody))
+	}
+
+	return &result, nil
+}
+
+// ChatCompletionStream performs a streaming chat completion.
+// onDelta is called for every content delta in arrival order; the full
+// accumulated content is returned once the stream reports [DONE].
+func (p *OpenAICompatibleProvider) ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest, onDelta func(string) error) (*ChatCompletionResponse, error) {
+	streamReq := *req
+	streamReq.Stream = true
+	streamReq.StreamOptions = &StreamOptions{IncludeUsage: true}
+
+	httpReq, err := p.newHTTPRequest(ctx, &streamReq)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.streamHTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp, string(respBody))
+	}
+
+	var content strings.Builder
+	result := &ChatCompletionResponse{
+		Object:  "chat.completion",
+		Model:   req.Model,
+		Choices: []ChatCompletionChoice{{Index: 0}},
+	}
+	// finish fills the accumulated content into the result
+	finish := func() *ChatCompletionResponse {
+		result.Choices[0].Message.Role = "assistant"
+		result.Choices[0].Message.Content = content.String()
+		return result
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Skip blank separators and SSE comments (OpenRouter sends ": OPENROUTER PROCESSING" keep-alives)
+		if line == "" || strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+
+		if data == "[DONE]" {
+			return finish(), nil
+		}
+
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return finish(), streamError(content.Len(), fmt.Errorf("failed to unmarshal chunk: %w (data: %s)", err, data))
+		}
+
+		if chunk.Error != nil {
+			return finish(), streamError(content.Len(), fmt.Errorf("API error: %s (code: %v)", chunk.Error.Message, chunk.Error.Code))
+		}
+
+		if chunk.ID != "" {
+			result.ID = chunk.ID
+		}
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			result.Usage = *chunk.Usage
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil {
+				result.Choices[0].FinishReason = *choice.FinishReason
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return finish(), fmt.Errorf("%w: %w", ErrStreamStarted, err)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return finish(), streamError(content.Len(), fmt.Errorf("failed to read stream: %w", err))
+	}
+
+	return finish(), streamError(content.Len(), fmt.Errorf("stream closed before [DONE]"))
+}
+
+// newAPIError builds an APIError from a provider response
+func newAPIError(resp *http.Response, message string) *APIError {
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    message,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// streamError wraps err with ErrStreamStarted when output was already delivered
+func streamError(delivered int, err error) error {
+	if delivered > 0 {
+		return fmt.Errorf("%w: %w", ErrStreamStarted, err)
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"fmt"
+	"time"
+)
+
+// OpeningContext is what Sang Pujangga knows about the user when opening a
+// session. The zero value opens without any history.
+type OpeningContext struct {
+	Now            time.Time // Current time in the user's timezone; zero when unknown
+	Streak         int       // Consecutive days journaled, 0 when broken
+	HasHistory     bool      // Whether the user has an earlier session
+	DaysSinceLast  int       // Calendar days since the earlier session started
+	LastTopic      []string  // Last user messages of the earlier session, oldest first
+	Worries        []string  // Recurring worries Sang Pujangga remembers
+	RecentOpenings []string  // Openings of recent sessions, to avoid repeating them
+}
+
+// dayNames are the Indonesian names of the days of the week
+var dayNames = map[time.Weekday]string{
+	time.Sunday:    "Minggu",
+	time.Monday:    "Senin",
+	time.Tuesday:   "Selasa",
+	time.Wednesday: "Rabu",
+	time.Thursday:  "Kamis",
+	time.Friday:    "Jumat",
+	time.Saturday:  "Sabtu",
+}
+
+// DayName returns the Indonesian name of a day of the week
+func DayName(day time.Weekday) string {
+	return dayNames[day]
+}
+
+// openingPrompt is the template data for an opening message
+type openingPrompt struct {
+	OpeningContext
+	DayName string
+	Persona *Persona
+}
+
+// weekdayOpenings are offline openings for particular days of the week
+var weekdayOpenings = map[time.Weekday][]string{
+	time.Monday:   {"Senin lagi. Awal minggunya gimana?"},
+	time.Friday:   {"Akhirnya Jumat. Minggu ini gimana?"},
+	time.Saturday: {"Sabtu nih. Lagi santai atau sibuk?"},
+	time.Sunday:   {"Hari Minggu. Lagi ngapain?"},
+}
+
+// genericOpenings are offline openings for any day
+var genericOpenings = []string{
+	OfflineOpeningMessage,
+	"Mood-nya apa hari ini?",
+	"Lagi sibuk nggak?",
+	"Satu kata buat hari ini?",
+}
+
+// OfflineOpening returns a curated opening for the context that doesn't
+// repeat a recent one, for when the model can't or shouldn't be used
+func OfflineOpening(opening OpeningContext) string {
+	var candidates []string
+	if opening.Streak >= 3 {
+		candidates = append(candidates, fmt.Sprintf("Hari ke-%d berturut-turut. Hari ini gimana?", opening.Streak))
+	}
+	if !opening.Now.IsZero() {
+		candidates = append(candidates, weekdayOpenings[opening.Now.Weekday()]...)
+	}
+	if opening.HasHistory && opening.DaysSinceLast >= 7 {
+		candidates = append(candidates, "Lama nggak ketemu. Apa kabar?")
+	}
+	candidates = append(candidates, genericOpenings...)
+
+	for _, candidate := range candidates {
+		if !repeatsOpening(candidate, opening.RecentOpenings) {
+			return candidate
+		}
+	}
+	return OfflineOpeningMessage
+}
+
+// repeatsOpening reports whether message is the same question as one of the
+// recent openings, ignoring case and punctuation
+func repeatsOpening(message string, recent []string) bool {
+	normalized := normalizeForSafety(message)
+	for _, opening := range recent {
+		if normalizeForSafety(opening) == normalized {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,353 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// Prompt names rendered by PujanggaService
+const (
+	PromptOpening        = "opening"
+	PromptRespond        = "respond"
+	PromptRespondStream  = "respond_stream"
+	PromptEmotions       = "emotions"
+	PromptWeeklySummary  = "weekly_summary"
+	PromptRepair         = "repair"
+	PromptSafety         = "safety"
+	PromptMemories       = "memories"
+	PromptSessionSummary = "session_summary"
+	PromptClosing        = "closing"
+	PromptDepth          = "depth"
+	PromptTemplateOutput = "template_output"
+)
+
+//go:embed prompts/*.tmpl
+var embeddedPrompts embed.FS
+
+// promptFuncs are available to every prompt template
+var promptFuncs = template.FuncMap{
+	"join":      strings.Join,
+	"topicName": TopicName,
+}
+
+// PromptInfo describes one loaded prompt template
+type PromptInfo struct {
+	Name     string   `json:"name"`
+	Version  string   `json:"version"`  // Default version
+	Versions []string `json:"versions"` // Every loaded version, oldest first
+	Source   string   `json:"source"`   // "embedded" or "override", for the default version
+}
+
+// promptSource is one version of a template
+type promptSource struct {
+	content string
+	source  string
+}
+
+// promptSet is an immutable snapshot of loaded templates
+type promptSet struct {
+	sources  map[string]map[string]promptSource // name -> version -> template
+	defaults map[string]string                  // name -> default version
+
+	mu       sync.Mutex
+	compiled map[string]*template.Template // Keyed by version selection
+}
+
+// PromptRegistry renders named, versioned prompt templates.
+//
+// Templates are files named <name>.v<N>.tmpl. Defaults are embedded in the
+// binary; files in the override directory add versions or replace embedded
+// ones, so prompts can be tuned without a redeploy. The default version of a
+// prompt is its highest override version, or its highest embedded version
+// when there is no override. Templates may include each other with
+// {{template "name" .}}; the included version follows the same selection.
+type PromptRegistry struct {
+	overrideDir string
+
+	mu  sync.RWMutex
+	set *promptSet
+}
+
+// NewPromptRegistry loads the embedded prompts plus overrides from overrideDir,
+// which may be empty
+func NewPromptRegistry(overrideDir string) (*PromptRegistry, error) {
+	r := &PromptRegistry{overrideDir: overrideDir}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the override directory. On error the previous prompts stay active.
+func (r *PromptRegistry) Reload() error {
+	set := &promptSet{
+		sources:  map[string]map[string]promptSource{},
+		defaults: map[string]string{},
+		compiled: map[string]*template.Template{},
+	}
+
+	embedded, err := fs.Glob(embeddedPrompts, "prompts/*.tmpl")
+	if err != nil {
+		return fmt.Errorf("failed to list embedded prompts: %w", err)
+	}
+	for _, path := range embedded {
+		data, err := embeddedPrompts.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read embedded prompt: %w", err)
+		}
+		set.add(path, string(data), "embedded")
+	}
+
+	if r.overrideDir != "" {
+		overrides, err := filepath.Glob(filepath.Join(r.overrideDir, "*.tmpl"))
+		if err != nil {
+			return fmt.Errorf("failed to list prompt overrides: %w", err)
+		}
+		for _, path := range overrides {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read prompt override: %w", err)
+			}
+			set.add(path, string(data), "override")
+			log.Printf("[Prompts] loaded override %s", path)
+		}
+	}
+
+	// Compile the defaults up front so broken overrides are rejected here
+	if _, err := set.compile(nil); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.set = set
+	r.mu.Unlock()
+
+	return nil
+}
+
+// add registers a template file and updates the default version of its name
+func (s *promptSet) add(path, content, source string) {
+	name, version, ok := parsePromptFilename(filepath.Base(path))
+	if !ok {
+		log.Printf("[Prompts] ignoring %s: expected <name>.v<N>.tmpl", path)
+		return
+	}
+
+	if s.sources[name] == nil {
+		s.sources[name] = map[string]promptSource{}
+	}
+	s.sources[name][version] = promptSource{content: strings.TrimRight(content, "\r\n"), source: source}
+
+	current, exists := s.defaults[name]
+	switch {
+	case !exists:
+		s.defaults[name] = version
+	case source == "override" && s.sources[name][current].source != "override":
+		s.defaults[name] = version
+	case source == s.sources[name][current].source && compareVersions(version, current) > 0:
+		s.defaults[name] = version
+	}
+}
+
+// resolve returns the version of every prompt for a selection overriding the defaults
+func (s *promptSet) resolve(selection map[string]string) (map[string]string, error) {
+	versions := make(map[string]string, len(s.defaults))
+	for name, version := range s.defaults {
+		versions[name] = version
+	}
+	for name, version := range selection {
+		if _, ok := s.sources[name][version]; !ok {
+			return nil, fmt.Errorf("unknown prompt version: %s.%s", name, version)
+		}
+		versions[name] = version
+	}
+	return versions, nil
+}
+
+// compile parses the templates for a version selection, caching the result
+func (s *promptSet) compile(selection map[string]string) (*template.Template, error) {
+	versions, err := s.resolve(selection)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(versions))
+	for name, version := range versions {
+		keys = append(keys, name+"."+version)
+	}
+	sort.Strings(keys)
+	key := strings.Join(keys, ",")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tmpl, ok := s.compiled[key]; ok {
+		return tmpl, nil
+	}
+
+	root := template.New("").Funcs(promptFuncs).Option("missingkey=error")
+	for name, version := range versions {
+		if _, err := root.New(name).Parse(s.sources[name][version].content); err != nil {
+			return nil, fmt.Errorf("failed to parse prompt %s.%s: %w", name, version, err)
+		}
+	}
+	s.compiled[key] = root
+
+	return root, nil
+}
+
+// parsePromptFilename splits "respond.v2.tmpl" into "respond" and "v2"
+func parsePromptFilename(filename string) (name, version string, ok bool) {
+	base, found := strings.CutSuffix(filename, ".tmpl")
+	if !found {
+		return "", "", false
+	}
+	idx := strings.LastIndex(base, ".v")
+	if idx <= 0 {
+		return "", "", false
+	}
+	if _, err := strconv.Atoi(base[idx+2:]); err != nil {
+		return "", "", false
+	}
+	return base[:idx], base[idx+1:], true
+}
+
+// compareVersions compares "vN" versions numerically
+func compareVersions(a, b string) int {
+	na, _ := strconv.Atoi(strings.TrimPrefix(a, "v"))
+	nb, _ := strconv.Atoi(strings.TrimPrefix(b, "v"))
+	return na - nb
+}
+
+// Render executes the named prompt with data, using the prompt versions
+// selected by the Treatment in ctx and the defaults otherwise. The returned
+// version identifies the prompt and every template it includes,
+// e.g. "respond.v2+conversation.v1+system.v3".
+func (r *PromptRegistry) Render(ctx context.Context, name string, data interface{}) (string, string, error) {
+	r.mu.RLock()
+	set := r.set
+	r.mu.RUnlock()
+
+	selection := TreatmentFromContext(ctx).Prompts
+	versions, err := set.resolve(selection)
+	if err != nil {
+		return "", "", err
+	}
+	if _, ok := versions[name]; !ok {
+		return "", "", fmt.Errorf("unknown prompt: %q", name)
+	}
+
+	root, err := set.compile(selection)
+	if err != nil {
+		return "", "", err
+	}
+
+	var buf bytes.Buffer
+	if err := root.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", "", fmt.Errorf("failed to render prompt %s: %w", name, err)
+	}
+
+	version := name + "." + versions[name]
+	for _, include := range promptIncludes(root, name) {
+		version += "+" + include + "." + versions[include]
+	}
+
+	return buf.String(), version, nil
+}
+
+// HasVersion reports whether the given version of a prompt is loaded
+func (r *PromptRegistry) HasVersion(name, version string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.set.sources[name][version]
+	return ok
+}
+
+// Prompts lists the loaded prompts sorted by name
+func (r *PromptRegistry) Prompts() []PromptInfo {
+	r.mu.RLock()
+	set := r.set
+	r.mu.RUnlock()
+
+	result := make([]PromptInfo, 0, len(set.defaults))
+	for name, version := range set.defaults {
+		versions := make([]string, 0, len(set.sources[name]))
+		for v := range set.sources[name] {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool { return compareVersions(versions[i], versions[j]) < 0 })
+
+		result = append(result, PromptInfo{
+			Name:     name,
+			Version:  version,
+			Versions: versions,
+			Source:   set.sources[name][version].source,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// promptIncludes returns the sorted names of all templates name includes, transitively
+func promptIncludes(root *template.Template, name string) []string {
+	seen := map[string]bool{}
+	var visit func(string)
+	visit = func(current string) {
+		tmpl := root.Lookup(current)
+		if tmpl == nil || tmpl.Tree == nil {
+			return
+		}
+		walkTemplateNodes(tmpl.Tree.Root, func(include string) {
+			if !seen[include] && include != name {
+				seen[include] = true
+				visit(include)
+			}
+		})
+	}
+	visit(name)
+
+	includes := make([]string, 0, len(seen))
+	for include := range seen {
+		includes = append(includes, include)
+	}
+	sort.Strings(includes)
+	return includes
+}
+
+// walkTemplateNodes calls fn with the name of every {{template}} action under node
+func walkTemplateNodes(node parse.Node, fn func(string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplateNodes(child, fn)
+		}
+	case *parse.TemplateNode:
+		fn(n.Name)
+	case *parse.IfNode:
+		walkTemplateNodes(n.List, fn)
+		walkTemplateNodes(n.ElseList, fn)
+	case *parse.RangeNode:
+		walkTemplateNodes(n.List, fn)
+		walkTemplateNodes(n.ElseList, fn)
+	case *parse.WithNode:
+		walkTemplateNodes(n.List, fn)
+		walkTemplateNodes(n.ElseList, fn)
+	}
+}
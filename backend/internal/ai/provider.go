@@ -0,0 +1,69 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Provider kinds selectable through ProviderConfig.Kind
+const (
+	ProviderOpenRouter       = "openrouter"
+	ProviderOpenAICompatible = "openai"
+	ProviderScripted         = "scripted"
+)
+
+// ErrStreamStarted marks a streaming failure after deltas were already delivered,
+// in which case retrying with another model would duplicate output
+var ErrStreamStarted = errors.New("stream interrupted after output started")
+
+// Provider sends chat completion requests to an LLM backend
+type Provider interface {
+	// Name identifies the provider in logs
+	Name() string
+
+	// ChatCompletion performs a single blocking chat completion
+	ChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error)
+
+	// ChatCompletionStream performs a streaming chat completion, calling onDelta
+	// for every content delta in arrival order. The returned response carries
+	// the full content as its single choice, plus usage when the server reports it.
+	// Errors after the first delta must wrap ErrStreamStarted.
+	ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest, onDelta func(string) error) (*ChatCompletionResponse, error)
+}
+
+// ProviderConfig holds configuration for building a Provider
+type ProviderConfig struct {
+	Kind       string // "openrouter" (default), "openai" or "scripted"
+	APIKey     string // Required for openrouter, optional for openai
+	BaseURL    string // Required for openai, e.g. "http://localhost:11434/v1"
+	ScriptFile string // Optional JSON script for the scripted provider
+
+	// Transport overrides the HTTP transport of network providers, e.g. with a Cassette
+	Transport http.RoundTripper
+}
+
+// NewProvider creates the Provider described by cfg
+func NewProvider(cfg ProviderConfig) (Provider, error) {
+	switch cfg.Kind {
+	case "", ProviderOpenRouter:
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("API key is required for the %s provider", ProviderOpenRouter)
+		}
+		return NewOpenRouterProvider(cfg.APIKey).WithTransport(cfg.Transport), nil
+	case ProviderOpenAICompatible:
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("base URL is required for the %s provider", ProviderOpenAICompatible)
+		}
+		return NewOpenAICompatibleProvider(cfg.BaseURL, cfg.APIKey).WithTransport(cfg.Transport), nil
+	case ProviderScripted:
+		if cfg.ScriptFile == "" {
+			return NewScriptedProvider(nil), nil
+		}
+		return LoadScriptedProvider(cfg.ScriptFile)
+	default:
+		return nil, fmt.Errorf("unknown AI provider: %q", cfg.Kind)
+	}
+}
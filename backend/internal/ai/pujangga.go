@@ -4,90 +4,65 @@ package ai
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 )
 
 // PujanggaService handles conversations with Sang Pujangga AI companion
 type PujanggaService struct {
-	client *Client
+	client     *Client
+	prompts    *PromptRegistry
+	guardrails *Guardrails
 }
 
-// NewPujanggaService creates a new Pujangga service
-func NewPujanggaService(client *Client) *PujanggaService {
+// NewPujanggaService creates a new Pujangga service. A nil guardrails sends
+// replies to users unchecked.
+func NewPujanggaService(client *Client, prompts *PromptRegistry, guardrails *Guardrails) *PujanggaService {
 	return &PujanggaService{
-		client: client,
+		client:     client,
+		prompts:    prompts,
+		guardrails: guardrails,
 	}
 }
 
+// Guarded reports whether replies are checked against guardrails, i.e.
+// whether a streamed reply can still be replaced once it is complete
+func (p *PujanggaService) Guarded() bool {
+	return p.guardrails != nil
+}
+
 // Message represents a conversation message
 type Message struct {
 	Role    string `json:"role"` // "user" or "assistant"
 	Content string `json:"content"`
 }
 
+// OfflineOpeningMessage opens a session without calling the model
+const OfflineOpeningMessage = "Hari ini gimana?"
+
 // PujanggaResponse represents the AI's response
 type PujanggaResponse struct {
 	Message        string   `json:"message"`
 	Emotions       []string `json:"emotions,omitempty"`
 	ConversationID string   `json:"conversation_id,omitempty"`
+	PromptVersion  string   `json:"-"` // Prompt templates that produced the message
 }
 
-// SystemPrompt is the core personality configuration for Sang Pujangga
-const SystemPrompt = `You are Sang Pujangga - a writing prompt generator for a journaling app.
-Your goal is to help users reflect on their day through simple, thoughtful writing prompts.
-
-STYLE:
-- DO NOT be conversational. You are NOT a chat bot.
-- Your response must strictly follow this format: "Brief Acknowledgment. Question/Prompt?"
-- Example: "Aku dengar. Apa yang membuatmu merasa begitu?"
-- Example: "Berat juga ya. Bagian mana yang paling mengganggu pikiranmu?"
-- Keep it short. Max 2 sentences total.
-
-LANGUAGE:
-- Natural Indonesian (id-ID).
-- Warm but concise.
-- No slang, no poetic flowery language, no corporate speak.
-
-DEPTH RULES:
-The conversation has depth levels. Adjust your prompts based on the current level.
-
-LEVEL 1 - SURFACE (messages 1-2):
-- Very simple prompts answering "What/How".
-- Focus on facts/events.
-
-LEVEL 2 - LIGHT (messages 3-5):
-- Follow-up prompts answering "Why".
-- Focus on feelings/reactions.
-
-LEVEL 3 - DEEP (messages 6+):
-- Reflective prompts answering "Meaning/Impact".
-- Focus on insights/values.
-
-TOPIC RULES:
-- Check the last 3 messages.
-- If the SAME specific topic/aspect of life has been discussed 3 times in a row, SWITCH to a new topic.
-- New topic examples: health, relationships, work, self-care, dreams.
-- Transition naturally: "Ngomong-ngomong, gimana soal kesehatanmu hari ini?"`
-
 // DepthLevel represents the conversation depth
 type DepthLevel int
 
 const (
-	DepthSurface DepthLevel = 1 // Messages 1-2
-	DepthLight   DepthLevel = 2 // Messages 3-5
-	DepthDeep    DepthLevel = 3 // Messages 6+
+	DepthSurface DepthLevel = 1 // Facts and events
+	DepthLight   DepthLevel = 2 // Feelings and reactions
+	DepthDeep    DepthLevel = 3 // Meaning and values
 )
 
-// CalculateDepth determines conversation depth based on message count
+// CalculateDepth determines conversation depth based on message count,
+// using the default thresholds
 func CalculateDepth(userMessageCount int) DepthLevel {
-	switch {
-	case userMessageCount <= 2:
-		return DepthSurface
-	case userMessageCount <= 5:
-		return DepthLight
-	default:
-		return DepthDeep
-	}
+	return DefaultDepthThresholds.Depth(userMessageCount)
 }
 
 // DepthName returns the Indonesian name for a depth level
@@ -104,22 +79,20 @@ func DepthName(depth DepthLevel) string {
 	}
 }
 
-// GenerateOpeningMessage generates the first message to start a conversation
-func (p *PujanggaService) GenerateOpeningMessage(ctx context.Context) (*PujanggaResponse, error) {
-	prompt := fmt.Sprintf(`%s
-
-Ini adalah awal percakapan baru (LEVEL 1 - PERMUKAAN).
-Berikan SATU pertanyaan pembuka yang SANGAT SEDERHANA - bisa dijawab dengan 1 kata saja.
+// GenerateOpeningMessage generates the first message to start a conversation,
+// conditioned on what is known about the user
+func (p *PujanggaService) GenerateOpeningMessage(ctx context.Context, opening OpeningContext) (*PujanggaResponse, error) {
+	ctx = withFeature(ctx, FeatureOpening)
 
-Contoh pertanyaan yang bagus:
-- "Hari ini gimana?"
-- "Mood-nya apa?"
-- "Lagi sibuk nggak?"
-
-Jangan terlalu formal, bayangkan kamu mengirim chat ke teman dekat.
+	data := openingPrompt{OpeningContext: opening, Persona: PersonaFromContext(ctx)}
+	if !opening.Now.IsZero() {
+		data.DayName = DayName(opening.Now.Weekday())
+	}
 
-Respond in JSON format:
-{"message": "your simple opening question in Indonesian"}`, SystemPrompt)
+	prompt, version, err := p.prompts.Render(ctx, PromptOpening, data)
+	if err != nil {
+		return nil, err
+	}
 
 	schema := map[string]interface{}{
 		"type": "object",
@@ -133,6 +106,10 @@ Respond in JSON format:
 	}
 
 	responseText, err := p.client.GenerateContentWithSchema(ctx, prompt, schema)
+	if errors.Is(err, ErrBudgetExceeded) {
+		// Still greet users who ran out of tokens so the session opens normally
+		return &PujanggaResponse{Message: OfflineOpening(opening)}, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate opening message: %w", err)
 	}
@@ -141,52 +118,75 @@ Respond in JSON format:
 	if err := json.Unmarshal([]byte(responseText), &response); err != nil {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
+	response.Message, response.PromptVersion = p.guard(ctx, prompt, response.Message, version, OfflineOpening(opening))
 
-	return &response, nil
-}
-
-// GenerateResponse generates a response based on recent conversation context
-// recentMessages should contain only the last 3 messages for context efficiency
-// userMessageCount is the total number of user messages in the session (for depth calculation)
-func (p *PujanggaService) GenerateResponse(ctx context.Context, recentMessages []Message, userMessageCount int) (*PujanggaResponse, error) {
-	// Calculate depth based on total user messages
-	depth := CalculateDepth(userMessageCount)
-	depthName := DepthName(depth)
-
-	// Build conversation history from recent messages only
-	conversationHistory := ""
-	for _, msg := range recentMessages {
-		role := "User"
-		if msg.Role == "assistant" {
-			role = "Pujangga"
-		}
-		conversationHistory += fmt.Sprintf("%s: %s\n", role, msg.Content)
+	// Users notice the same greeting two days in a row
+	if repeatsOpening(response.Message, opening.RecentOpenings) {
+		log.Printf("[Guardrails] opening repeats a recent one (%s): %q", response.PromptVersion, response.Message)
+		response.Message, response.PromptVersion = OfflineOpening(opening), GuardrailsFallbackVersion
 	}
 
-	// Get depth-specific instruction
-	depthInstruction := getDepthInstruction(depth)
-
-	prompt := fmt.Sprintf(`%s
+	return &response, nil
+}
 
-KONTEKS PERCAKAPAN (3 pesan terakhir):
-%s
+// Conversation is the context of a conversational turn
+type Conversation struct {
+	Recent           []Message  // Last few messages, oldest first
+	UserMessageCount int        // Total user messages in the session
+	Depth            DepthLevel // Depth to converse at; zero uses the treatment's message-count thresholds
+	Memories         []Memory   // Relevant facts from earlier sessions
+	Summary          string     // Running summary of the session's messages before Recent
+	Topic            TopicGuidance
+	Guide            *GuideTurn // Set in guided sessions until the template is completed
+}
 
-INFO SESI:
-- Total pesan user: %d
-- Level kedalaman: %d (%s)
+// conversationPrompt is the template data for a conversational turn
+type conversationPrompt struct {
+	History          []Message
+	UserMessageCount int
+	Depth            DepthLevel
+	DepthName        string
+	EmotionLabels    []string
+	Memories         []Memory
+	Summary          string
+	Topic            TopicGuidance
+	Guide            *guidePrompt
+	Persona          *Persona
+}
 
-%s
+// newConversationPrompt builds the template data for a conversational turn
+func newConversationPrompt(ctx context.Context, conv Conversation) conversationPrompt {
+	depth := conv.Depth
+	if depth == 0 {
+		depth = TreatmentFromContext(ctx).Depth(conv.UserMessageCount)
+	}
+	persona := PersonaFromContext(ctx)
+	depth = min(depth, persona.MaxDepth)
+
+	return conversationPrompt{
+		History:          conv.Recent,
+		UserMessageCount: conv.UserMessageCount,
+		Depth:            depth,
+		DepthName:        DepthName(depth),
+		EmotionLabels:    EmotionLabels,
+		Memories:         conv.Memories,
+		Summary:          conv.Summary,
+		Topic:            conv.Topic,
+		Guide:            newGuidePrompt(conv.Guide),
+		Persona:          persona,
+	}
+}
 
-Analisis juga emosi yang terdeteksi dari user (pilih dari: senang, sedih, cemas, marah, kelelahan, harapan, cinta, ambisi, kesepian, syukur).
+// GenerateResponse generates a response based on the conversation context.
+// conv.Recent should contain only the messages after conv.Summary for context efficiency.
+func (p *PujanggaService) GenerateResponse(ctx context.Context, conv Conversation) (*PujanggaResponse, error) {
+	ctx = withFeature(ctx, FeatureRespond)
 
-Respond in JSON format:
-{"message": "your response in Indonesian", "emotions": ["detected", "emotions"]}`,
-		SystemPrompt,
-		conversationHistory,
-		userMessageCount,
-		depth,
-		depthName,
-		depthInstruction)
+	data := newConversationPrompt(ctx, conv)
+	prompt, version, err := p.prompts.Render(ctx, PromptRespond, data)
+	if err != nil {
+		return nil, err
+	}
 
 	schema := map[string]interface{}{
 		"type": "object",
@@ -215,34 +215,216 @@ Respond in JSON format:
 	if err := json.Unmarshal([]byte(responseText), &response); err != nil {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
+	response.Emotions = NormalizeEmotions(response.Emotions)
+	response.Message, response.PromptVersion = p.guard(ctx, prompt, response.Message, version, SafePrompt(data.Depth, conv.UserMessageCount))
 
 	return &response, nil
 }
 
-// getDepthInstruction returns the instruction for a specific depth level
-func getDepthInstruction(depth DepthLevel) string {
-	switch depth {
-	case DepthSurface:
-		return `INSTRUKSI (LEVEL 1 - SURFACE):
-- Ini awal sesi menulis.
-- Berikan prompt SEDERHANA tentang fakta/kejadian.
-- Format: "Acknowledgment singkat. Pertanyaan apa/gimana?"
-- Contoh: "Oke. Apa satu hal yang paling kamu ingat hari ini?"`
-	case DepthLight:
-		return `INSTRUKSI (LEVEL 2 - LIGHT):
-- User mulai menulis.
-- Berikan prompt tentang PERASAAN/REAKSI.
-- Format: "Acknowledgment singkat. Kenapa begitu/apa rasanya?"
-- Contoh: "Paham. Kenapa hal itu bikin kamu merasa begitu?"`
-	case DepthDeep:
-		return `INSTRUKSI (LEVEL 3 - DEEP):
-- User sudah menulis banyak.
-- Berikan prompt REFLEKTIF tentang MAKNA/VALUE.
-- Format: "Acknowledgment singkat. Apa maknanya/pelajarannya?"
-- Contoh: "Menarik. Kalau dipikir lagi, apa yang situasi ini ajarkan ke kamu?"`
-	default:
-		return ""
+// StreamResponse generates a response like GenerateResponse, but streams the
+// message text to onToken as it is produced. Emotions are extracted with a
+// separate call once the stream has closed, since they cannot be streamed as
+// part of a plain-text reply. A failed emotion extraction is not fatal.
+// Guardrails run on the complete reply, so the returned message may differ
+// from the streamed tokens; callers showing the tokens should hold them back
+// when Guarded.
+func (p *PujanggaService) StreamResponse(ctx context.Context, conv Conversation, onToken func(string) error) (*PujanggaResponse, error) {
+	ctx = withFeature(ctx, FeatureRespond)
+
+	data := newConversationPrompt(ctx, conv)
+	prompt, version, err := p.prompts.Render(ctx, PromptRespondStream, data)
+	if err != nil {
+		return nil, err
+	}
+
+	messageText, err := p.client.StreamContentWithMessages(ctx, []ChatMessage{
+		{Role: "user", Content: prompt},
+	}, onToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stream response: %w", err)
+	}
+
+	message, version := p.guard(ctx, prompt, strings.TrimSpace(messageText), version, SafePrompt(data.Depth, conv.UserMessageCount))
+
+	response := &PujanggaResponse{
+		Message:       message,
+		Emotions:      []string{},
+		PromptVersion: version,
+	}
+
+	emotions, err := p.ExtractEmotions(ctx, conv.Recent)
+	if err != nil {
+		log.Printf("[Pujangga] failed to extract emotions after stream: %v", err)
+	} else {
+		response.Emotions = emotions
+	}
+
+	return response, nil
+}
+
+// guard checks a reply against the guardrails. A violating reply gets up to
+// MaxRepairs corrective retries, then is replaced by fallback. Returns the
+// message to send and the prompt version that produced it.
+func (p *PujanggaService) guard(ctx context.Context, prompt, message, version, fallback string) (string, string) {
+	if p.guardrails == nil {
+		return message, version
+	}
+
+	violations := p.guardrails.Check(message)
+	if len(violations) == 0 {
+		return message, version
+	}
+	p.logViolations(ctx, version, violations)
+
+	repairCtx := withFeature(ctx, FeatureGuardrails)
+	for attempt := 0; attempt < p.guardrails.MaxRepairs; attempt++ {
+		repairPrompt, repairVersion, err := p.prompts.Render(repairCtx, PromptRepair, map[string]interface{}{
+			"Violations": violations,
+		})
+		if err != nil {
+			log.Printf("[Guardrails] failed to render repair prompt: %v", err)
+			break
+		}
+
+		repaired, err := p.client.GenerateContentWithMessages(repairCtx, []ChatMessage{
+			{Role: "user", Content: prompt},
+			{Role: "assistant", Content: message},
+			{Role: "user", Content: repairPrompt},
+		}, nil)
+		if err != nil {
+			log.Printf("[Guardrails] repair attempt %d failed: %v", attempt+1, err)
+			break
+		}
+
+		message = strings.Trim(strings.TrimSpace(repaired), `"`)
+		version = version + "+" + repairVersion
+		violations = p.guardrails.Check(message)
+		if len(violations) == 0 {
+			return message, version
+		}
+		p.logViolations(ctx, version, violations)
+	}
+
+	log.Printf("[Guardrails] falling back to a safe prompt (%s)", version)
+	return fallback, GuardrailsFallbackVersion
+}
+
+// logViolations logs each broken rule with the call that produced it
+func (p *PujanggaService) logViolations(ctx context.Context, version string, violations []Violation) {
+	info := CallInfoFromContext(ctx)
+	for _, v := range violations {
+		log.Printf("[Guardrails] %s violation in %s reply (user=%s, prompt=%s): %s",
+			v.Check, info.Feature, info.UserID, version, v.Detail)
+	}
+}
+
+// ExtractEmotions detects emotions from the user messages in the given conversation
+func (p *PujanggaService) ExtractEmotions(ctx context.Context, recentMessages []Message) ([]string, error) {
+	ctx = withFeature(ctx, FeatureEmotions)
+
+	userMessages := ""
+	for _, msg := range recentMessages {
+		if msg.Role == "user" {
+			userMessages += msg.Content + "\n---\n"
+		}
+	}
+	if userMessages == "" {
+		return []string{}, nil
+	}
+
+	prompt, _, err := p.prompts.Render(ctx, PromptEmotions, map[string]interface{}{
+		"EmotionLabels": EmotionLabels,
+		"UserMessages":  userMessages,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"emotions": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "string",
+				},
+				"description": "Detected emotions from user's messages",
+			},
+		},
+		"required": []string{"emotions"},
+	}
+
+	responseText, err := p.client.GenerateContentWithSchema(ctx, prompt, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract emotions: %w", err)
+	}
+
+	var result struct {
+		Emotions []string `json:"emotions"`
+	}
+	if err := json.Unmarshal([]byte(responseText), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return NormalizeEmotions(result.Emotions), nil
+}
+
+// AssessRisk asks the model whether the user messages in the given
+// conversation show a risk of suicide or self-harm. It complements the local
+// SafetyClassifier, which misses phrasings outside its lexicon.
+func (p *PujanggaService) AssessRisk(ctx context.Context, recentMessages []Message) (RiskAssessment, error) {
+	ctx = withFeature(ctx, FeatureSafety)
+
+	userMessages := ""
+	for _, msg := range recentMessages {
+		if msg.Role == "user" {
+			userMessages += msg.Content + "\n---\n"
+		}
+	}
+	if userMessages == "" {
+		return RiskAssessment{Level: RiskNone}, nil
+	}
+
+	prompt, _, err := p.prompts.Render(ctx, PromptSafety, map[string]interface{}{
+		"UserMessages": userMessages,
+	})
+	if err != nil {
+		return RiskAssessment{}, err
+	}
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"risk_level": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{string(RiskNone), string(RiskElevated), string(RiskHigh)},
+				"description": "Risk of suicide or self-harm",
+			},
+			"reason": map[string]interface{}{
+				"type":        "string",
+				"description": "Short reason for the assessment",
+			},
+		},
+		"required": []string{"risk_level", "reason"},
+	}
+
+	responseText, err := p.client.GenerateContentWithSchema(ctx, prompt, schema)
+	if err != nil {
+		return RiskAssessment{}, fmt.Errorf("failed to assess risk: %w", err)
+	}
+
+	var result struct {
+		RiskLevel RiskLevel `json:"risk_level"`
+		Reason    string    `json:"reason"`
 	}
+	if err := json.Unmarshal([]byte(responseText), &result); err != nil {
+		return RiskAssessment{}, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if !result.RiskLevel.Valid() {
+		return RiskAssessment{}, fmt.Errorf("unknown risk level %q", result.RiskLevel)
+	}
+
+	return RiskAssessment{Level: result.RiskLevel, Source: RiskSourceModel, Reason: result.Reason}, nil
 }
 
 // WeeklySummaryResult contains the full weekly summary with emotions analysis
@@ -253,10 +435,13 @@ type WeeklySummaryResult struct {
 	Trend             string   `json:"trend"` // "improving", "stable", or "challenging"
 	Insights          []string `json:"insights"`
 	Encouragement     string   `json:"encouragement"`
+	PromptVersion     string   `json:"-"` // Prompt templates that produced the summary
 }
 
 // GenerateWeeklySummary generates a weekly emotional summary (Risalah Mingguan)
 func (p *PujanggaService) GenerateWeeklySummary(ctx context.Context, weekMessages []Message, sessionCount, messageCount int) (*WeeklySummaryResult, error) {
+	ctx = withFeature(ctx, FeatureWeeklySummary)
+
 	// Compile all user messages from the week
 	userMessages := ""
 	for _, msg := range weekMessages {
@@ -277,31 +462,15 @@ func (p *PujanggaService) GenerateWeeklySummary(ctx context.Context, weekMessage
 		}, nil
 	}
 
-	prompt := fmt.Sprintf(`%s
-
-Kamu diminta membuat "Risalah Mingguan" - ringkasan emosional dari jurnal user selama seminggu.
-Ini bukan analisis psikologis formal, tapi lebih seperti surat dari teman yang sudah mendengarkan cerita-cerita mereka.
-
-CATATAN USER MINGGU INI:
-%s
-
-Total sesi: %d
-Total pesan: %d
-
-Buat "Surat Masa Lalu" dengan analisis emosional. Berikan output dalam format JSON dengan struktur berikut:
-
-1. "summary": Ringkasan 2-3 kalimat tentang minggu ini dalam bahasa Indonesia yang hangat
-2. "dominant_emotion": Emosi utama minggu ini (satu kata, lowercase)
-3. "secondary_emotions": Array emosi lain yang muncul (maksimal 3, lowercase)
-4. "trend": Salah satu dari "improving", "stable", atau "challenging"
-5. "insights": Array 2-3 insight spesifik berdasarkan konten jurnal
-6. "encouragement": Kata penyemangat singkat 1 kalimat
-
-Aturan:
-- Gunakan bahasa Indonesia yang santai tapi bermakna
-- Hindari klise dan bahasa yang terlalu puitis
-- Insights harus spesifik berdasarkan konten jurnal yang ditulis
-- Emotions dalam bahasa Indonesia atau English yang umum dipahami`, SystemPrompt, userMessages, sessionCount, messageCount)
+	prompt, version, err := p.prompts.Render(ctx, PromptWeeklySummary, map[string]interface{}{
+		"UserMessages": userMessages,
+		"SessionCount": sessionCount,
+		"MessageCount": messageCount,
+		"Persona":      DefaultPersona(), // The weekly letter always comes from Sang Pujangga
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	schema := map[string]interface{}{
 		"type": "object",
@@ -349,6 +518,7 @@ Aturan:
 	if err := json.Unmarshal([]byte(responseText), &result); err != nil {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
+	result.PromptVersion = version
 
 	return &result, nil
 }
@@ -0,0 +1,91 @@
+package ai
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// The flow tests replay recorded OpenRouter exchanges from testdata/cassettes,
+// so they run offline and fail when a prompt change alters a request. They
+// check what any good recording satisfies, so re-recording keeps them green.
+
+func TestStartSessionFlow(t *testing.T) {
+	pujangga := newCassettePujangga(t)
+	wib := time.FixedZone("WIB", 7*60*60)
+
+	response, err := pujangga.GenerateOpeningMessage(context.Background(), OpeningContext{
+		Now:           time.Date(2026, 3, 2, 20, 15, 0, 0, wib),
+		Streak:        3,
+		HasHistory:    true,
+		DaysSinceLast: 1,
+		LastTopic:     []string{"Tadi presentasi di kantor, deg-degan banget."},
+	})
+	if err != nil {
+		t.Fatalf("GenerateOpeningMessage: %v", err)
+	}
+
+	if response.Message == "" {
+		t.Error("Message is empty")
+	}
+	if response.PromptVersion == GuardrailsFallbackVersion {
+		t.Errorf("PromptVersion = %q, want the recorded opening to pass the guardrails", response.PromptVersion)
+	}
+}
+
+func TestRespondFlow(t *testing.T) {
+	pujangga := newCassettePujangga(t)
+
+	response, err := pujangga.GenerateResponse(context.Background(), Conversation{
+		Recent: []Message{
+			{Role: "assistant", Content: "Hari ini terasa seperti apa?"},
+			{Role: "user", Content: "Capek banget, kerjaan numpuk dan atasan terus nanya progres."},
+		},
+		UserMessageCount: 1,
+	})
+	if err != nil {
+		t.Fatalf("GenerateResponse: %v", err)
+	}
+
+	if response.Message == "" {
+		t.Error("Message is empty")
+	}
+	if len(response.Emotions) == 0 {
+		t.Error("Emotions is empty, want the tiredness of the message detected")
+	}
+	for _, emotion := range response.Emotions {
+		if !slices.Contains(EmotionLabels, emotion) {
+			t.Errorf("Emotions = %v, want only labels from EmotionLabels", response.Emotions)
+		}
+	}
+	if response.PromptVersion == GuardrailsFallbackVersion {
+		t.Errorf("PromptVersion = %q, want the recorded reply to pass the guardrails", response.PromptVersion)
+	}
+}
+
+func TestGenerateWeeklySummaryFlow(t *testing.T) {
+	pujangga := newCassettePujangga(t)
+
+	result, err := pujangga.GenerateWeeklySummary(context.Background(), []Message{
+		{Role: "user", Content: "Capek banget, kerjaan numpuk dan atasan terus nanya progres."},
+		{Role: "assistant", Content: "Bagian mana yang paling menguras tenagamu?"},
+		{Role: "user", Content: "Akhirnya presentasi selesai, ternyata lancar!"},
+	}, 2, 2)
+	if err != nil {
+		t.Fatalf("GenerateWeeklySummary: %v", err)
+	}
+
+	if result.DominantEmotion == "" {
+		t.Error("DominantEmotion is empty")
+	}
+	if !slices.Contains([]string{"improving", "stable", "challenging"}, result.Trend) {
+		t.Errorf("Trend = %q, want improving, stable or challenging", result.Trend)
+	}
+	if len(result.Insights) == 0 || result.Summary == "" || result.Encouragement == "" {
+		t.Errorf("result = %+v, want a summary, insights and encouragement", result)
+	}
+	if result.PromptVersion == "" {
+		t.Error("PromptVersion is empty")
+	}
+}
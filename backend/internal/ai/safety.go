@@ -0,0 +1,127 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"bufio"
+	_ "embed"
+	"strings"
+	"unicode"
+)
+
+// RiskLevel is the assessed risk of suicide or self-harm in a message
+type RiskLevel string
+
+const (
+	RiskNone     RiskLevel = "none"
+	RiskElevated RiskLevel = "elevated" // Hopelessness or passive thoughts; flagged for review
+	RiskHigh     RiskLevel = "high"     // Switches the reply to the crisis response
+)
+
+// CrisisPromptVersion is recorded on replies replaced by the crisis response
+const CrisisPromptVersion = "safety.crisis"
+
+// Risk assessment sources
+const (
+	RiskSourceKeyword = "keyword"
+	RiskSourceModel   = "model"
+)
+
+// rank orders risk levels from none to high
+func (l RiskLevel) rank() int {
+	switch l {
+	case RiskHigh:
+		return 2
+	case RiskElevated:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Valid reports whether l is a known risk level
+func (l RiskLevel) Valid() bool {
+	return l == RiskNone || l == RiskElevated || l == RiskHigh
+}
+
+// RiskAssessment is the outcome of a safety screen
+type RiskAssessment struct {
+	Level   RiskLevel `json:"level"`
+	Source  string    `json:"source,omitempty"`  // RiskSourceKeyword or RiskSourceModel
+	Matches []string  `json:"matches,omitempty"` // Matched phrases, for keyword assessments
+	Reason  string    `json:"reason,omitempty"`  // Model explanation, for model assessments
+}
+
+// Higher returns whichever assessment has the higher risk, preferring a
+// when both are equal
+func (a RiskAssessment) Higher(b RiskAssessment) RiskAssessment {
+	if b.Level.rank() > a.Level.rank() {
+		return b
+	}
+	return a
+}
+
+//go:embed lexicon/crisis_high.txt
+var crisisHighLexicon string
+
+//go:embed lexicon/crisis_elevated.txt
+var crisisElevatedLexicon string
+
+// SafetyClassifier screens messages locally for Indonesian crisis phrases,
+// so every message is checked without a model call
+type SafetyClassifier struct {
+	high     []string
+	elevated []string
+}
+
+// NewSafetyClassifier creates a classifier from the embedded crisis lexicons
+func NewSafetyClassifier() *SafetyClassifier {
+	return &SafetyClassifier{
+		high:     parseLexicon(crisisHighLexicon),
+		elevated: parseLexicon(crisisElevatedLexicon),
+	}
+}
+
+// Classify returns the highest risk level whose phrases appear in text
+func (s *SafetyClassifier) Classify(text string) RiskAssessment {
+	normalized := " " + normalizeForSafety(text) + " "
+
+	for _, level := range []struct {
+		level   RiskLevel
+		phrases []string
+	}{{RiskHigh, s.high}, {RiskElevated, s.elevated}} {
+		var matches []string
+		for _, phrase := range level.phrases {
+			if strings.Contains(normalized, " "+phrase+" ") {
+				matches = append(matches, phrase)
+			}
+		}
+		if len(matches) > 0 {
+			return RiskAssessment{Level: level.level, Source: RiskSourceKeyword, Matches: matches}
+		}
+	}
+
+	return RiskAssessment{Level: RiskNone}
+}
+
+// normalizeForSafety lowercases text and turns everything but letters and
+// digits into single spaces, so "Self-harm!!" matches "self harm"
+func normalizeForSafety(text string) string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+// parseLexicon returns the normalized non-comment lines of a lexicon file
+func parseLexicon(content string) []string {
+	var phrases []string
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		phrases = append(phrases, normalizeForSafety(line))
+	}
+	return phrases
+}
@@ -0,0 +1,59 @@
+package ai
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSafetyClassifierClassify(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		wantLevel   RiskLevel
+		wantMatches []string
+	}{
+		{"ordinary entry", "Hari ini capek banget di kantor, tapi senang bisa pulang cepat.", RiskNone, nil},
+		{"empty", "", RiskNone, nil},
+		{"high risk phrase", "Aku pengen mati aja rasanya.", RiskHigh, []string{"pengen mati"}},
+		{"case and punctuation ignored", "BUNUH-DIRI!!", RiskHigh, []string{"bunuh diri"}},
+		{"elevated phrase", "Aku capek hidup kayak gini.", RiskElevated, []string{"capek hidup"}},
+		{"high wins over elevated", "Aku putus asa dan ingin mati.", RiskHigh, []string{"ingin mati"}},
+		{"every matching phrase reported", "Aku ingin mati, mau mengakhiri hidupku.", RiskHigh, []string{"ingin mati", "mengakhiri hidupku"}},
+		{"whole words only", "Film tentang pembunuh diriku itu seram.", RiskNone, nil},
+		{"phrase as part of a longer word", "Ingin matikan lampu dulu.", RiskNone, nil},
+	}
+
+	c := NewSafetyClassifier()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.Classify(tt.text)
+			if got.Level != tt.wantLevel {
+				t.Fatalf("Classify(%q) level = %s, want %s", tt.text, got.Level, tt.wantLevel)
+			}
+			if !slices.Equal(got.Matches, tt.wantMatches) {
+				t.Errorf("Classify(%q) matches = %v, want %v", tt.text, got.Matches, tt.wantMatches)
+			}
+			if tt.wantLevel != RiskNone && got.Source != RiskSourceKeyword {
+				t.Errorf("Classify(%q) source = %q, want %q", tt.text, got.Source, RiskSourceKeyword)
+			}
+		})
+	}
+}
+
+func TestNormalizeForSafety(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Self-harm!!", "self harm"},
+		{"  Bunuh   diri ", "bunuh diri"},
+		{"pgn_mati2", "pgn mati2"},
+		{"...", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeForSafety(tt.text); got != tt.want {
+			t.Errorf("normalizeForSafety(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
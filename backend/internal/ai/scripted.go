@@ -0,0 +1,201 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// scriptedFallbackText is returned for plain-text requests no rule matches
+const scriptedFallbackText = "Aku dengar. Apa satu hal yang paling kamu ingat hari ini?"
+
+// ScriptRule maps requests to a canned response
+type ScriptRule struct {
+	// Match is a substring searched for in the request's message contents.
+	// An empty Match matches every request.
+	Match string `json:"match"`
+
+	// Response is returned verbatim as the completion content
+	Response string `json:"response"`
+}
+
+// ScriptedProvider is a deterministic, offline Provider for CI and self-hosters.
+// Requests are answered by the first matching ScriptRule; when none matches,
+// a response is synthesized from the request's JSON schema so structured
+// calls still parse.
+type ScriptedProvider struct {
+	rules []ScriptRule
+}
+
+// NewScriptedProvider creates a scripted provider with the given rules
+func NewScriptedProvider(rules []ScriptRule) *ScriptedProvider {
+	return &ScriptedProvider{rules: rules}
+}
+
+// LoadScriptedProvider creates a scripted provider from a JSON file
+// containing an array of ScriptRule
+func LoadScriptedProvider(path string) (*ScriptedProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script file: %w", err)
+	}
+
+	var rules []ScriptRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse script file: %w", err)
+	}
+
+	return NewScriptedProvider(rules), nil
+}
+
+// Name identifies the provider in logs
+func (p *ScriptedProvider) Name() string {
+	return ProviderScripted
+}
+
+// ChatCompletion answers req from the script without any network access
+func (p *ScriptedProvider) ChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return scriptedResponse(req, p.respond(req)), nil
+}
+
+// ChatCompletionStream answers req from the script, delivering it word by word
+func (p *ScriptedProvider) ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest, onDelta func(string) error) (*ChatCompletionResponse, error) {
+	content := p.respond(req)
+
+	delivered := 0
+	for _, word := range strings.SplitAfter(content, " ") {
+		if err := ctx.Err(); err != nil {
+			return scriptedResponse(req, content[:delivered]), streamError(delivered, err)
+		}
+		if word == "" {
+			continue
+		}
+		if err := onDelta(word); err != nil {
+			return scriptedResponse(req, content[:delivered]), fmt.Errorf("%w: %w", ErrStreamStarted, err)
+		}
+		delivered += len(word)
+	}
+
+	return scriptedResponse(req, content), nil
+}
+
+// scriptedResponse wraps content in a completion response with estimated usage
+func scriptedResponse(req *ChatCompletionRequest, content string) *ChatCompletionResponse {
+	resp := &ChatCompletionResponse{
+		ID:      "scripted",
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: []ChatCompletionChoice{{Index: 0, FinishReason: "stop"}},
+	}
+	resp.Choices[0].Message.Role = "assistant"
+	resp.Choices[0].Message.Content = content
+	resp.Usage.PromptTokens = estimateTokens(requestText(req))
+	resp.Usage.CompletionTokens = estimateTokens(content)
+	resp.Usage.TotalTokens = resp.Usage.PromptTokens + resp.Usage.CompletionTokens
+
+	return resp
+}
+
+// respond picks the scripted content for req
+func (p *ScriptedProvider) respond(req *ChatCompletionRequest) string {
+	text := requestText(req)
+	for _, rule := range p.rules {
+		if strings.Contains(text, rule.Match) {
+			return rule.Response
+		}
+	}
+
+	if req.ResponseFormat != nil && req.ResponseFormat.JSONSchema != nil {
+		data, err := json.Marshal(synthesizeFromSchema("", req.ResponseFormat.JSONSchema.Schema))
+		if err == nil {
+			return string(data)
+		}
+	}
+
+	return scriptedFallbackText
+}
+
+// requestText concatenates the message contents of req
+func requestText(req *ChatCompletionRequest) string {
+	var b strings.Builder
+	for _, msg := range req.Messages {
+		b.WriteString(msg.Content)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// estimateTokens roughly approximates token count at 4 characters per token
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// synthesizeFromSchema builds a deterministic value satisfying a JSON schema.
+// name is the property the schema describes, used to pick sensible strings.
+func synthesizeFromSchema(name string, schema map[string]interface{}) interface{} {
+	if enum, ok := schema["enum"].([]string); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	switch schema["type"] {
+	case "object":
+		result := map[string]interface{}{}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for key, value := range properties {
+			if propSchema, ok := value.(map[string]interface{}); ok {
+				result[key] = synthesizeFromSchema(key, propSchema)
+			}
+		}
+		return result
+	case "array":
+		items := []interface{}{}
+		itemSchema, _ := schema["items"].(map[string]interface{})
+		minItems := 1
+		switch v := schema["minItems"].(type) {
+		case int:
+			minItems = max(v, 1)
+		case float64:
+			minItems = max(int(v), 1)
+		}
+		for i := 0; i < minItems && itemSchema != nil; i++ {
+			items = append(items, synthesizeFromSchema(name, itemSchema))
+		}
+		return items
+	case "integer", "number":
+		return 0
+	case "boolean":
+		return false
+	default:
+		return scriptedString(name)
+	}
+}
+
+// scriptedString returns canned Indonesian text for common property names
+func scriptedString(name string) string {
+	switch name {
+	case "message":
+		return scriptedFallbackText
+	case "emotions", "secondary_emotions", "dominant_emotion":
+		return "syukur"
+	case "summary":
+		return "Minggu ini kamu meluangkan waktu untuk menulis dan merenung. Itu langkah kecil yang berarti."
+	case "insights":
+		return "Kamu konsisten meluangkan waktu untuk menulis"
+	case "encouragement":
+		return "Terus menulis, sedikit demi sedikit."
+	default:
+		return "ok"
+	}
+}
@@ -0,0 +1,44 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MaxSessionSummaryWords bounds the running session summary, keeping the
+// conversation prompt from growing with the session
+const MaxSessionSummaryWords = 200
+
+// SummarizeSession folds newMessages into a session's running summary and
+// returns the updated summary. summary is empty for the first fold.
+func (p *PujanggaService) SummarizeSession(ctx context.Context, summary string, newMessages []Message) (string, error) {
+	ctx = withFeature(ctx, FeatureSessionSummary)
+
+	prompt, _, err := p.prompts.Render(ctx, PromptSessionSummary, map[string]interface{}{
+		"Summary":  summary,
+		"Messages": newMessages,
+		"MaxWords": MaxSessionSummaryWords,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	updated, err := p.client.GenerateContent(ctx, prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize session: %w", err)
+	}
+
+	updated = strings.TrimSpace(updated)
+	if updated == "" {
+		return "", fmt.Errorf("%w: empty session summary", ErrInvalidOutput)
+	}
+
+	// Models overshoot word limits; cut runaway summaries so they can't snowball
+	if words := strings.Fields(updated); len(words) > 2*MaxSessionSummaryWords {
+		updated = strings.Join(words[:2*MaxSessionSummaryWords], " ") + "..."
+	}
+
+	return updated, nil
+}
@@ -0,0 +1,92 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"bufio"
+	_ "embed"
+	"sort"
+	"strings"
+)
+
+// TopicLabels is the taxonomy of conversation topics, in suggestion order
+var TopicLabels = []string{
+	"work", "study", "relationships", "family", "friends",
+	"health", "self_care", "money", "dreams", "hobbies",
+}
+
+// topicNames are the Indonesian names of the topics, used in prompts
+var topicNames = map[string]string{
+	"work":          "pekerjaan",
+	"study":         "sekolah atau kuliah",
+	"relationships": "hubungan asmara",
+	"family":        "keluarga",
+	"friends":       "pertemanan",
+	"health":        "kesehatan",
+	"self_care":     "merawat diri",
+	"money":         "keuangan",
+	"dreams":        "impian dan rencana",
+	"hobbies":       "hobi",
+}
+
+// TopicName returns the Indonesian name of a topic
+func TopicName(topic string) string {
+	if name, ok := topicNames[topic]; ok {
+		return name
+	}
+	return topic
+}
+
+// maxMessageTopics caps how many topics a message is labeled with
+const maxMessageTopics = 3
+
+//go:embed lexicon/topics.txt
+var topicsLexicon string
+
+// TopicGuidance tells the reply prompt which topic to stay on or steer to
+type TopicGuidance struct {
+	Current  string `json:"current,omitempty"`   // Main topic of the user's message, empty when unclassified
+	Streak   int    `json:"streak,omitempty"`    // Consecutive user messages on Current, including this one
+	SwitchTo string `json:"switch_to,omitempty"` // Topic to steer to, empty to stay
+}
+
+// TopicClassifier labels messages with topics from keyword lexicons, so every
+// message is classified without a model call
+type TopicClassifier struct {
+	keywords map[string][]string // Topic -> normalized keywords
+}
+
+// NewTopicClassifier creates a classifier from the embedded topic lexicon
+func NewTopicClassifier() *TopicClassifier {
+	keywords := map[string][]string{}
+	topic := ""
+	scanner := bufio.NewScanner(strings.NewReader(topicsLexicon))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			topic = strings.Trim(line, "[]")
+		case topic != "":
+			keywords[topic] = append(keywords[topic], normalizeForSafety(line))
+		}
+	}
+	return &TopicClassifier{keywords: keywords}
+}
+
+// Classify returns up to three topics of a message, most matched first. Ties
+// keep the order of TopicLabels.
+func (c *TopicClassifier) Classify(text string) []string {
+	normalized := normalizeForSafety(text)
+
+	matches := map[string]int{}
+	var topics []string
+	for _, topic := range TopicLabels {
+		if count := countPhrases(normalized, c.keywords[topic]); count > 0 {
+			matches[topic] = count
+			topics = append(topics, topic)
+		}
+	}
+	sort.SliceStable(topics, func(i, j int) bool { return matches[topics[i]] > matches[topics[j]] })
+
+	return topics[:min(len(topics), maxMessageTopics)]
+}
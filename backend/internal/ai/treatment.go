@@ -0,0 +1,74 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// DepthThresholds are the user message counts at which deeper levels start.
+// A treatment that sets them converses by message count instead of the
+// content-aware DepthEngine.
+type DepthThresholds struct {
+	Light int `json:"light"` // First user message count at DepthLight
+	Deep  int `json:"deep"`  // First user message count at DepthDeep
+}
+
+// DefaultDepthThresholds match the depth rules described in the system prompt,
+// for conversations without a depth from the DepthEngine
+var DefaultDepthThresholds = DepthThresholds{Light: 3, Deep: 6}
+
+// Depth returns the depth level for a user message count
+func (t DepthThresholds) Depth(userMessageCount int) DepthLevel {
+	switch {
+	case userMessageCount < t.Light:
+		return DepthSurface
+	case userMessageCount < t.Deep:
+		return DepthLight
+	default:
+		return DepthDeep
+	}
+}
+
+// treatmentKey is the context key for Treatment
+type treatmentKey struct{}
+
+// Treatment customizes AI behaviour for one user, typically the combined
+// variants of every experiment the user is enrolled in. Zero values keep
+// the defaults.
+type Treatment struct {
+	Prompts         map[string]string // Prompt name -> version, e.g. {"respond": "v2"}
+	Models          []string          // Replaces the client's model chain
+	DepthThresholds *DepthThresholds  // Replaces the DepthEngine with message-count thresholds
+	Variants        map[string]string // Experiment ID -> variant name, for logs
+}
+
+// WithTreatment attaches a treatment to ctx
+func WithTreatment(ctx context.Context, treatment Treatment) context.Context {
+	return context.WithValue(ctx, treatmentKey{}, treatment)
+}
+
+// TreatmentFromContext returns the treatment attached to ctx, if any
+func TreatmentFromContext(ctx context.Context) Treatment {
+	treatment, _ := ctx.Value(treatmentKey{}).(Treatment)
+	return treatment
+}
+
+// Depth returns the depth level for a user message count under this treatment
+func (t Treatment) Depth(userMessageCount int) DepthLevel {
+	if t.DepthThresholds != nil {
+		return t.DepthThresholds.Depth(userMessageCount)
+	}
+	return DefaultDepthThresholds.Depth(userMessageCount)
+}
+
+// String lists the experiment variants, e.g. "tone=warm,models=control"
+func (t Treatment) String() string {
+	parts := make([]string, 0, len(t.Variants))
+	for experiment, variant := range t.Variants {
+		parts = append(parts, experiment+"="+variant)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,97 @@
+// Package ai provides AI integration for the application
+package ai
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Features identify which product flow an AI call belongs to
+const (
+	FeatureOpening        = "opening"
+	FeatureRespond        = "respond"
+	FeatureEmotions       = "emotions"
+	FeatureWeeklySummary  = "weekly_summary"
+	FeatureGuardrails     = "guardrails"
+	FeatureSafety         = "safety"
+	FeatureMemory         = "memory"
+	FeatureSessionSummary = "session_summary"
+	FeatureClosing        = "closing"
+	FeatureDepth          = "depth"
+	FeatureTemplate       = "template"
+)
+
+// callInfoKey is the context key for CallInfo
+type callInfoKey struct{}
+
+// CallInfo identifies who an AI call is made for and why
+type CallInfo struct {
+	UserID    string
+	SessionID string // Empty when the call isn't tied to a session
+	Feature   string
+}
+
+// WithCaller attaches the user and session an AI call is made for to ctx
+func WithCaller(ctx context.Context, userID, sessionID string) context.Context {
+	info := CallInfoFromContext(ctx)
+	info.UserID = userID
+	info.SessionID = sessionID
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+// withFeature attaches the feature an AI call belongs to to ctx
+func withFeature(ctx context.Context, feature string) context.Context {
+	info := CallInfoFromContext(ctx)
+	info.Feature = feature
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+// CallInfoFromContext returns the CallInfo attached to ctx, if any
+func CallInfoFromContext(ctx context.Context) CallInfo {
+	info, _ := ctx.Value(callInfoKey{}).(CallInfo)
+	return info
+}
+
+// Usage describes the resources consumed by a single provider call
+type Usage struct {
+	CallInfo
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Latency          time.Duration
+	CostMicros       int64 // Estimated cost in millionths of a US dollar
+}
+
+// TotalTokens returns prompt plus completion tokens
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// UsageRecorder persists usage for every provider call that returned a response
+type UsageRecorder interface {
+	RecordUsage(ctx context.Context, usage Usage)
+}
+
+// ModelPrice is the price of a model in US dollars per million tokens
+type ModelPrice struct {
+	Prompt     float64
+	Completion float64
+}
+
+// ModelPricing lists known model prices used for cost estimates.
+// Models missing from the list (local or scripted models) are treated as free.
+var ModelPricing = map[string]ModelPrice{
+	"google/gemini-2.5-flash-lite": {Prompt: 0.10, Completion: 0.40},
+	"google/gemini-2.5-flash":      {Prompt: 0.30, Completion: 2.50},
+}
+
+// EstimateCostMicros estimates the cost of a call in millionths of a US dollar.
+// A price per million tokens is exactly the price per token in micro-dollars.
+func EstimateCostMicros(model string, promptTokens, completionTokens int) int64 {
+	price, ok := ModelPricing[model]
+	if !ok {
+		return 0
+	}
+	return int64(math.Round(float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion))
+}
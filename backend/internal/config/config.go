@@ -3,6 +3,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 )
 
 // Config holds all configuration for the application
@@ -12,6 +14,29 @@ type Config struct {
 	BackendHost          string
 	ClerkSecretKey       string
 	OpenRouterAPIKey     string
+	AIProvider           string // "openrouter", "openai" (any OpenAI-compatible server) or "scripted"
+	AIBaseURL            string // Base URL for the "openai" provider, e.g. http://localhost:11434/v1
+	AIAPIKey             string // Optional API key for the "openai" provider
+	AIModel              string
+	AIFallbackModel      string
+	AIModels             []string // Ordered model chain, overrides AIModel/AIFallbackModel when set
+	AIMaxAttempts        int      // Attempts per model for retryable errors
+	AIBreakerThreshold   int      // Consecutive failures before a model is skipped
+	AIBreakerCooldown    int      // Seconds a failing model is skipped
+	AIScriptFile         string   // Optional JSON script for the "scripted" provider
+	AIPromptDir          string   // Optional directory of prompt template overrides (<name>.v<N>.tmpl)
+	ExperimentsFile      string   // Optional JSON file of A/B experiments over prompts, models and depth
+	AICassetteMode       string   // Optional "record" or "replay" to record/replay AI HTTP traffic
+	AICassetteDir        string   // Directory holding cassette recordings
+	AIBudgetFreeDaily    int      // Daily token budget for free users, 0 for unlimited
+	AIBudgetFreeMonthly  int      // Monthly token budget for free users, 0 for unlimited
+	AIBudgetPaidDaily    int      // Daily token budget for paid users, 0 for unlimited
+	AIBudgetPaidMonthly  int      // Monthly token budget for paid users, 0 for unlimited
+	AISafetyModelCheck   bool     // Whether the model double-checks messages for crisis signals after each reply
+	AIDepthModelCheck    bool     // Whether the model's judgment is blended into the depth score of each message
+	ArtworkImageDir      string   // Base images of the Galeri's artworks, named like the last segment of their image_url
+	ArtworkCacheDir      string   // Directory caching rendered artwork reveals
+	InternalAPIToken     string   // Token for internal operations endpoints
 	TrakteerWebhookToken string
 	SupportEmail         string
 }
@@ -24,6 +49,29 @@ func Load() *Config {
 		BackendHost:          getEnv("BACKEND_HOST", "0.0.0.0"),
 		ClerkSecretKey:       getEnv("CLERK_SECRET_KEY", ""),
 		OpenRouterAPIKey:     getEnv("OPENROUTER_API_KEY", ""),
+		AIProvider:           getEnv("AI_PROVIDER", "openrouter"),
+		AIBaseURL:            getEnv("AI_BASE_URL", ""),
+		AIAPIKey:             getEnv("AI_API_KEY", ""),
+		AIModel:              getEnv("AI_MODEL", ""),
+		AIFallbackModel:      getEnv("AI_FALLBACK_MODEL", ""),
+		AIModels:             getEnvList("AI_MODELS"),
+		AIMaxAttempts:        getEnvInt("AI_MAX_ATTEMPTS", 2),
+		AIBreakerThreshold:   getEnvInt("AI_BREAKER_THRESHOLD", 5),
+		AIBreakerCooldown:    getEnvInt("AI_BREAKER_COOLDOWN_SECONDS", 60),
+		AIScriptFile:         getEnv("AI_SCRIPT_FILE", ""),
+		AIPromptDir:          getEnv("AI_PROMPT_DIR", ""),
+		ExperimentsFile:      getEnv("EXPERIMENTS_FILE", ""),
+		AICassetteMode:       getEnv("AI_CASSETTE_MODE", ""),
+		AICassetteDir:        getEnv("AI_CASSETTE_DIR", "testdata/cassettes"),
+		AIBudgetFreeDaily:    getEnvInt("AI_BUDGET_FREE_DAILY_TOKENS", 50000),
+		AIBudgetFreeMonthly:  getEnvInt("AI_BUDGET_FREE_MONTHLY_TOKENS", 600000),
+		AIBudgetPaidDaily:    getEnvInt("AI_BUDGET_PAID_DAILY_TOKENS", 250000),
+		AIBudgetPaidMonthly:  getEnvInt("AI_BUDGET_PAID_MONTHLY_TOKENS", 3000000),
+		AISafetyModelCheck:   getEnvBool("AI_SAFETY_MODEL_CHECK", false),
+		AIDepthModelCheck:    getEnvBool("AI_DEPTH_MODEL_CHECK", false),
+		ArtworkImageDir:      getEnv("ARTWORK_IMAGE_DIR", "assets/artworks"),
+		ArtworkCacheDir:      getEnv("ARTWORK_CACHE_DIR", "cache/artworks"),
+		InternalAPIToken:     getEnv("INTERNAL_API_TOKEN", ""),
 		TrakteerWebhookToken: getEnv("TRAKTEER_WEBHOOK_TOKEN", ""),
 		SupportEmail:         getEnv("SUPPORT_EMAIL", "support@catetin.app"),
 	}
@@ -36,3 +84,39 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt returns the integer value of an environment variable or a default value
+func getEnvInt(key string, defaultValue int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvBool returns the boolean value of an environment variable or a default value
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList returns the comma-separated values of an environment variable
+func getEnvList(key string) []string {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return nil
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
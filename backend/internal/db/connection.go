@@ -5,12 +5,25 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // Pool wraps a pgxpool.Pool for database connections
 type Pool struct {
-	Pool *pgxpool.Pool
+	Pool  *pgxpool.Pool
+	begin Beginner // Starts transactions in place of Pool when set
+}
+
+// Beginner starts database transactions, like a pgxpool.Pool
+type Beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// NewPoolWith creates a Pool that runs its transactions on b instead of a
+// connection pool, such as an in-memory database in tests
+func NewPoolWith(b Beginner) *Pool {
+	return &Pool{begin: b}
 }
 
 // NewPool creates a new database connection pool
@@ -43,3 +56,25 @@ func (p *Pool) Close() {
 		p.Pool.Close()
 	}
 }
+
+// InTx runs fn in a transaction, committing if fn succeeds and rolling back otherwise
+func (p *Pool) InTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	var b Beginner = p.Pool
+	if p.begin != nil {
+		b = p.begin
+	}
+
+	tx, err := b.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }() // No-op after commit
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -5,12 +5,44 @@
 package db
 
 import (
+	"encoding/json"
+
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AiUsage struct {
+	ID                  pgtype.UUID        `json:"id"`
+	UserID              pgtype.Text        `json:"user_id"`
+	SessionID           pgtype.UUID        `json:"session_id"`
+	Feature             string             `json:"feature"`
+	Model               string             `json:"model"`
+	PromptTokens        int32              `json:"prompt_tokens"`
+	CompletionTokens    int32              `json:"completion_tokens"`
+	LatencyMs           int32              `json:"latency_ms"`
+	EstimatedCostMicros int64              `json:"estimated_cost_micros"`
+	CreatedAt           pgtype.Timestamptz `json:"created_at"`
+}
+
 type Artwork struct {
-	ID          pgtype.UUID        `json:"id"`
-	Name        string             `json:"name"`
+	ID             pgtype.UUID        `json:"id"`
+	Name           string             `json:"name"`
+	DisplayName    string             `json:"display_name"`
+	Description    string             `json:"description"`
+	ImageUrl       string             `json:"image_url"`
+	UnlockCost     int32              `json:"unlock_cost"`
+	RevealCost     int32              `json:"reveal_cost"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	SortOrder      int32              `json:"sort_order"`
+	AvailableFrom  pgtype.Timestamptz `json:"available_from"`
+	AvailableUntil pgtype.Timestamptz `json:"available_until"`
+	RetiredAt      pgtype.Timestamptz `json:"retired_at"`
+	Version        int32              `json:"version"`
+	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+}
+
+type ArtworkVersion struct {
+	ArtworkID   pgtype.UUID        `json:"artwork_id"`
+	Version     int32              `json:"version"`
 	DisplayName string             `json:"display_name"`
 	Description string             `json:"description"`
 	ImageUrl    string             `json:"image_url"`
@@ -19,11 +51,52 @@ type Artwork struct {
 	CreatedAt   pgtype.Timestamptz `json:"created_at"`
 }
 
+type CurrencyLedger struct {
+	ID             pgtype.UUID        `json:"id"`
+	UserID         string             `json:"user_id"`
+	Currency       string             `json:"currency"`
+	Delta          int32              `json:"delta"`
+	Reason         string             `json:"reason"`
+	Counterparty   string             `json:"counterparty"`
+	MessageID      pgtype.UUID        `json:"message_id"`
+	SessionID      pgtype.UUID        `json:"session_id"`
+	IdempotencyKey string             `json:"idempotency_key"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
+type ExperimentAssignment struct {
+	UserID     string             `json:"user_id"`
+	Experiment string             `json:"experiment"`
+	Variant    string             `json:"variant"`
+	AssignedAt pgtype.Timestamptz `json:"assigned_at"`
+}
+
 type Message struct {
-	ID        pgtype.UUID        `json:"id"`
-	SessionID pgtype.UUID        `json:"session_id"`
-	Role      string             `json:"role"`
-	Content   string             `json:"content"`
+	ID            pgtype.UUID        `json:"id"`
+	SessionID     pgtype.UUID        `json:"session_id"`
+	Role          string             `json:"role"`
+	Content       string             `json:"content"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	PromptVersion pgtype.Text        `json:"prompt_version"`
+	RiskLevel     pgtype.Text        `json:"risk_level"`
+	RiskSource    pgtype.Text        `json:"risk_source"`
+	FlaggedAt     pgtype.Timestamptz `json:"flagged_at"`
+	PersonaID     pgtype.Text        `json:"persona_id"`
+	QuoteID       pgtype.UUID        `json:"quote_id"`
+	ReplyStatus   pgtype.Text        `json:"reply_status"`
+}
+
+type MessageEmotion struct {
+	MessageID pgtype.UUID        `json:"message_id"`
+	UserID    string             `json:"user_id"`
+	Emotion   string             `json:"emotion"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type MessageTopic struct {
+	MessageID pgtype.UUID        `json:"message_id"`
+	UserID    string             `json:"user_id"`
+	Topic     string             `json:"topic"`
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
 }
 
@@ -41,28 +114,94 @@ type PendingUpgrade struct {
 	CreatedAt             pgtype.Timestamptz `json:"created_at"`
 }
 
+type Quote struct {
+	ID           pgtype.UUID        `json:"id"`
+	CollectionID pgtype.UUID        `json:"collection_id"`
+	Text         string             `json:"text"`
+	Author       string             `json:"author"`
+	Source       string             `json:"source"`
+	Language     string             `json:"language"`
+	Emotions     []string           `json:"emotions"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+}
+
+type QuoteCollection struct {
+	ID             pgtype.UUID        `json:"id"`
+	Name           string             `json:"name"`
+	DisplayName    string             `json:"display_name"`
+	Description    string             `json:"description"`
+	UnlockCurrency string             `json:"unlock_currency"`
+	UnlockCost     int32              `json:"unlock_cost"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
 type Session struct {
+	ID                   pgtype.UUID        `json:"id"`
+	UserID               string             `json:"user_id"`
+	Status               string             `json:"status"`
+	TotalMessages        int32              `json:"total_messages"`
+	GoldenInkEarned      int32              `json:"golden_ink_earned"`
+	StartedAt            pgtype.Timestamptz `json:"started_at"`
+	EndedAt              pgtype.Timestamptz `json:"ended_at"`
+	CreatedAt            pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt            pgtype.Timestamptz `json:"updated_at"`
+	MemoriesExtractedAt  pgtype.Timestamptz `json:"memories_extracted_at"`
+	RunningSummary       string             `json:"running_summary"`
+	RunningSummaryUntil  pgtype.Timestamptz `json:"running_summary_until"`
+	Title                pgtype.Text        `json:"title"`
+	Summary              pgtype.Text        `json:"summary"`
+	ClosingMessage       pgtype.Text        `json:"closing_message"`
+	ClosingPromptVersion pgtype.Text        `json:"closing_prompt_version"`
+	DepthLevel           int16              `json:"depth_level"`
+	DepthProgress        float32            `json:"depth_progress"`
+	TemplateID           pgtype.Text        `json:"template_id"`
+	TemplateStep         int16              `json:"template_step"`
+	TemplateStepMessages int16              `json:"template_step_messages"`
+	TemplateStepWords    int32              `json:"template_step_words"`
+	TemplateCompletedAt  pgtype.Timestamptz `json:"template_completed_at"`
+	TemplateOutput       json.RawMessage    `json:"template_output"`
+	PersonaID            pgtype.Text        `json:"persona_id"`
+	QuoteID              pgtype.UUID        `json:"quote_id"`
+}
+
+type UserArtwork struct {
+	ID             pgtype.UUID        `json:"id"`
+	UserID         string             `json:"user_id"`
+	ArtworkID      pgtype.UUID        `json:"artwork_id"`
+	Progress       int32              `json:"progress"`
+	Status         string             `json:"status"`
+	UnlockedAt     pgtype.Timestamptz `json:"unlocked_at"`
+	CompletedAt    pgtype.Timestamptz `json:"completed_at"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+	ArtworkVersion int32              `json:"artwork_version"`
+}
+
+type UserMemory struct {
 	ID              pgtype.UUID        `json:"id"`
 	UserID          string             `json:"user_id"`
-	Status          string             `json:"status"`
-	TotalMessages   int32              `json:"total_messages"`
-	GoldenInkEarned int32              `json:"golden_ink_earned"`
-	StartedAt       pgtype.Timestamptz `json:"started_at"`
-	EndedAt         pgtype.Timestamptz `json:"ended_at"`
+	Kind            string             `json:"kind"`
+	Content         string             `json:"content"`
+	Importance      int16              `json:"importance"`
+	Mentions        int32              `json:"mentions"`
+	SourceSessionID pgtype.UUID        `json:"source_session_id"`
+	UserEdited      bool               `json:"user_edited"`
+	LastSeenAt      pgtype.Timestamptz `json:"last_seen_at"`
 	CreatedAt       pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt       pgtype.Timestamptz `json:"updated_at"`
 }
 
-type UserArtwork struct {
-	ID          pgtype.UUID        `json:"id"`
-	UserID      string             `json:"user_id"`
-	ArtworkID   pgtype.UUID        `json:"artwork_id"`
-	Progress    int32              `json:"progress"`
-	Status      string             `json:"status"`
-	UnlockedAt  pgtype.Timestamptz `json:"unlocked_at"`
-	CompletedAt pgtype.Timestamptz `json:"completed_at"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+type UserPreference struct {
+	UserID    string             `json:"user_id"`
+	PersonaID string             `json:"persona_id"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+}
+
+type UserQuoteCollection struct {
+	UserID       string             `json:"user_id"`
+	CollectionID pgtype.UUID        `json:"collection_id"`
+	UnlockedAt   pgtype.Timestamptz `json:"unlocked_at"`
 }
 
 type UserStat struct {
@@ -91,13 +230,14 @@ type UserSubscription struct {
 }
 
 type WeeklySummary struct {
-	ID           pgtype.UUID        `json:"id"`
-	UserID       string             `json:"user_id"`
-	WeekStart    pgtype.Date        `json:"week_start"`
-	WeekEnd      pgtype.Date        `json:"week_end"`
-	Summary      string             `json:"summary"`
-	SessionCount int32              `json:"session_count"`
-	MessageCount int32              `json:"message_count"`
-	Emotions     []byte             `json:"emotions"`
-	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	ID            pgtype.UUID        `json:"id"`
+	UserID        string             `json:"user_id"`
+	WeekStart     pgtype.Date        `json:"week_start"`
+	WeekEnd       pgtype.Date        `json:"week_end"`
+	Summary       string             `json:"summary"`
+	SessionCount  int32              `json:"session_count"`
+	MessageCount  int32              `json:"message_count"`
+	Emotions      []byte             `json:"emotions"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	PromptVersion pgtype.Text        `json:"prompt_version"`
 }
@@ -7,6 +7,7 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
@@ -79,7 +80,7 @@ SET
     golden_ink_earned = golden_ink_earned + $2,
     updated_at = NOW()
 WHERE id = $1
-RETURNING id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at
+RETURNING id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id
 `
 
 type AddSessionGoldenInkParams struct {
@@ -100,6 +101,23 @@ func (q *Queries) AddSessionGoldenInk(ctx context.Context, arg AddSessionGoldenI
 		&i.EndedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.MemoriesExtractedAt,
+		&i.RunningSummary,
+		&i.RunningSummaryUntil,
+		&i.Title,
+		&i.Summary,
+		&i.ClosingMessage,
+		&i.ClosingPromptVersion,
+		&i.DepthLevel,
+		&i.DepthProgress,
+		&i.TemplateID,
+		&i.TemplateStep,
+		&i.TemplateStepMessages,
+		&i.TemplateStepWords,
+		&i.TemplateCompletedAt,
+		&i.TemplateOutput,
+		&i.PersonaID,
+		&i.QuoteID,
 	)
 	return i, err
 }
@@ -138,6 +156,189 @@ func (q *Queries) AddXP(ctx context.Context, arg AddXPParams) (UserStat, error)
 	return i, err
 }
 
+const aggregateAIUsageByDay = `-- name: AggregateAIUsageByDay :many
+SELECT
+    (u.created_at AT TIME ZONE 'Asia/Jakarta')::date AS day,
+    (CASE WHEN u.user_id IS NULL THEN 'none' ELSE COALESCE(us.plan, 'free') END)::text AS plan,
+    COUNT(*)::integer AS calls,
+    COUNT(DISTINCT u.user_id)::integer AS active_users,
+    COALESCE(SUM(u.prompt_tokens), 0)::bigint AS prompt_tokens,
+    COALESCE(SUM(u.completion_tokens), 0)::bigint AS completion_tokens,
+    COALESCE(SUM(u.estimated_cost_micros), 0)::bigint AS cost_micros
+FROM ai_usage u
+LEFT JOIN user_subscriptions us ON us.user_id = u.user_id
+WHERE u.created_at >= $1 AND u.created_at < $2
+GROUP BY day, plan
+ORDER BY day ASC, plan ASC
+`
+
+type AggregateAIUsageByDayParams struct {
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	CreatedAt_2 pgtype.Timestamptz `json:"created_at_2"`
+}
+
+type AggregateAIUsageByDayRow struct {
+	Day              pgtype.Date `json:"day"`
+	Plan             string      `json:"plan"`
+	Calls            int32       `json:"calls"`
+	ActiveUsers      int32       `json:"active_users"`
+	PromptTokens     int64       `json:"prompt_tokens"`
+	CompletionTokens int64       `json:"completion_tokens"`
+	CostMicros       int64       `json:"cost_micros"`
+}
+
+// Days are WIB days; calls without a user are reported under the 'none' plan
+func (q *Queries) AggregateAIUsageByDay(ctx context.Context, arg AggregateAIUsageByDayParams) ([]AggregateAIUsageByDayRow, error) {
+	rows, err := q.db.Query(ctx, aggregateAIUsageByDay, arg.CreatedAt, arg.CreatedAt_2)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AggregateAIUsageByDayRow{}
+	for rows.Next() {
+		var i AggregateAIUsageByDayRow
+		if err := rows.Scan(
+			&i.Day,
+			&i.Plan,
+			&i.Calls,
+			&i.ActiveUsers,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.CostMicros,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const aggregateAIUsageByPlan = `-- name: AggregateAIUsageByPlan :many
+SELECT
+    (CASE WHEN u.user_id IS NULL THEN 'none' ELSE COALESCE(us.plan, 'free') END)::text AS plan,
+    u.feature,
+    COUNT(*)::integer AS calls,
+    COUNT(DISTINCT u.user_id)::integer AS active_users,
+    COALESCE(SUM(u.prompt_tokens), 0)::bigint AS prompt_tokens,
+    COALESCE(SUM(u.completion_tokens), 0)::bigint AS completion_tokens,
+    COALESCE(SUM(u.estimated_cost_micros), 0)::bigint AS cost_micros,
+    COALESCE(AVG(u.latency_ms), 0)::integer AS avg_latency_ms
+FROM ai_usage u
+LEFT JOIN user_subscriptions us ON us.user_id = u.user_id
+WHERE u.created_at >= $1 AND u.created_at < $2
+GROUP BY plan, u.feature
+ORDER BY plan ASC, u.feature ASC
+`
+
+type AggregateAIUsageByPlanParams struct {
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	CreatedAt_2 pgtype.Timestamptz `json:"created_at_2"`
+}
+
+type AggregateAIUsageByPlanRow struct {
+	Plan             string `json:"plan"`
+	Feature          string `json:"feature"`
+	Calls            int32  `json:"calls"`
+	ActiveUsers      int32  `json:"active_users"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	CostMicros       int64  `json:"cost_micros"`
+	AvgLatencyMs     int32  `json:"avg_latency_ms"`
+}
+
+// Calls without a user are reported under the 'none' plan
+func (q *Queries) AggregateAIUsageByPlan(ctx context.Context, arg AggregateAIUsageByPlanParams) ([]AggregateAIUsageByPlanRow, error) {
+	rows, err := q.db.Query(ctx, aggregateAIUsageByPlan, arg.CreatedAt, arg.CreatedAt_2)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AggregateAIUsageByPlanRow{}
+	for rows.Next() {
+		var i AggregateAIUsageByPlanRow
+		if err := rows.Scan(
+			&i.Plan,
+			&i.Feature,
+			&i.Calls,
+			&i.ActiveUsers,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.CostMicros,
+			&i.AvgLatencyMs,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const aggregatePromptVersions = `-- name: AggregatePromptVersions :many
+SELECT
+    m.prompt_version::text AS prompt_version,
+    COUNT(*)::integer AS messages,
+    COUNT(DISTINCT m.session_id)::integer AS sessions,
+    COALESCE(AVG(LENGTH(r.content)), 0)::integer AS avg_reply_length,
+    COUNT(r.id)::integer AS replies
+FROM messages m
+LEFT JOIN LATERAL (
+    SELECT n.id, n.content FROM messages n
+    WHERE n.session_id = m.session_id AND n.role = 'user' AND n.created_at > m.created_at
+    ORDER BY n.created_at ASC
+    LIMIT 1
+) r ON TRUE
+WHERE m.role = 'assistant' AND m.prompt_version IS NOT NULL
+  AND m.created_at >= $1 AND m.created_at < $2
+GROUP BY m.prompt_version
+ORDER BY messages DESC
+`
+
+type AggregatePromptVersionsParams struct {
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	CreatedAt_2 pgtype.Timestamptz `json:"created_at_2"`
+}
+
+type AggregatePromptVersionsRow struct {
+	PromptVersion  string `json:"prompt_version"`
+	Messages       int32  `json:"messages"`
+	Sessions       int32  `json:"sessions"`
+	AvgReplyLength int32  `json:"avg_reply_length"`
+	Replies        int32  `json:"replies"`
+}
+
+// Compares prompt versions by how users engage with the messages they produced
+func (q *Queries) AggregatePromptVersions(ctx context.Context, arg AggregatePromptVersionsParams) ([]AggregatePromptVersionsRow, error) {
+	rows, err := q.db.Query(ctx, aggregatePromptVersions, arg.CreatedAt, arg.CreatedAt_2)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AggregatePromptVersionsRow{}
+	for rows.Next() {
+		var i AggregatePromptVersionsRow
+		if err := rows.Scan(
+			&i.PromptVersion,
+			&i.Messages,
+			&i.Sessions,
+			&i.AvgReplyLength,
+			&i.Replies,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const checkTransactionProcessed = `-- name: CheckTransactionProcessed :one
 SELECT EXISTS(
     SELECT 1 FROM user_subscriptions us WHERE us.trakteer_transaction_id = $1
@@ -153,6 +354,21 @@ func (q *Queries) CheckTransactionProcessed(ctx context.Context, trakteerTransac
 	return processed, err
 }
 
+const claimSessionMemoryExtraction = `-- name: ClaimSessionMemoryExtraction :execrows
+UPDATE sessions
+SET memories_extracted_at = NOW()
+WHERE id = $1 AND memories_extracted_at IS NULL
+`
+
+// Claims a session so concurrent requests extract its memories only once
+func (q *Queries) ClaimSessionMemoryExtraction(ctx context.Context, id pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, claimSessionMemoryExtraction, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const countMessagesBySession = `-- name: CountMessagesBySession :one
 SELECT COUNT(*) FROM messages
 WHERE session_id = $1
@@ -165,6 +381,40 @@ func (q *Queries) CountMessagesBySession(ctx context.Context, sessionID pgtype.U
 	return count, err
 }
 
+const countSessionEmotions = `-- name: CountSessionEmotions :many
+SELECT me.emotion, COUNT(*)::integer AS count
+FROM message_emotions me
+JOIN messages m ON m.id = me.message_id
+WHERE m.session_id = $1
+GROUP BY me.emotion
+ORDER BY count DESC, me.emotion
+`
+
+type CountSessionEmotionsRow struct {
+	Emotion string `json:"emotion"`
+	Count   int32  `json:"count"`
+}
+
+func (q *Queries) CountSessionEmotions(ctx context.Context, sessionID pgtype.UUID) ([]CountSessionEmotionsRow, error) {
+	rows, err := q.db.Query(ctx, countSessionEmotions, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountSessionEmotionsRow{}
+	for rows.Next() {
+		var i CountSessionEmotionsRow
+		if err := rows.Scan(&i.Emotion, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const countTodayUserMessages = `-- name: CountTodayUserMessages :one
 SELECT COUNT(*)::integer FROM messages m
 JOIN sessions s ON m.session_id = s.id
@@ -180,6 +430,52 @@ func (q *Queries) CountTodayUserMessages(ctx context.Context, userID string) (in
 	return column_1, err
 }
 
+const countUserEmotionsByDay = `-- name: CountUserEmotionsByDay :many
+SELECT
+    (created_at AT TIME ZONE 'Asia/Jakarta')::date AS day,
+    emotion,
+    COUNT(*)::integer AS count
+FROM message_emotions
+WHERE user_id = $1
+  AND created_at >= $2
+  AND created_at < $3
+GROUP BY day, emotion
+ORDER BY day, emotion
+`
+
+type CountUserEmotionsByDayParams struct {
+	UserID   string             `json:"user_id"`
+	FromTime pgtype.Timestamptz `json:"from_time"`
+	ToTime   pgtype.Timestamptz `json:"to_time"`
+}
+
+type CountUserEmotionsByDayRow struct {
+	Day     pgtype.Date `json:"day"`
+	Emotion string      `json:"emotion"`
+	Count   int32       `json:"count"`
+}
+
+// Days are calendar days in WIB
+func (q *Queries) CountUserEmotionsByDay(ctx context.Context, arg CountUserEmotionsByDayParams) ([]CountUserEmotionsByDayRow, error) {
+	rows, err := q.db.Query(ctx, countUserEmotionsByDay, arg.UserID, arg.FromTime, arg.ToTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountUserEmotionsByDayRow{}
+	for rows.Next() {
+		var i CountUserEmotionsByDayRow
+		if err := rows.Scan(&i.Day, &i.Emotion, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const countUserMessagesBySession = `-- name: CountUserMessagesBySession :one
 SELECT COUNT(*) FROM messages
 WHERE session_id = $1 AND role = 'user'
@@ -192,6 +488,90 @@ func (q *Queries) CountUserMessagesBySession(ctx context.Context, sessionID pgty
 	return count, err
 }
 
+const countUserTopics = `-- name: CountUserTopics :many
+SELECT topic, COUNT(*)::integer AS count
+FROM message_topics
+WHERE user_id = $1
+  AND created_at >= $2
+GROUP BY topic
+`
+
+type CountUserTopicsParams struct {
+	UserID   string             `json:"user_id"`
+	FromTime pgtype.Timestamptz `json:"from_time"`
+}
+
+type CountUserTopicsRow struct {
+	Topic string `json:"topic"`
+	Count int32  `json:"count"`
+}
+
+func (q *Queries) CountUserTopics(ctx context.Context, arg CountUserTopicsParams) ([]CountUserTopicsRow, error) {
+	rows, err := q.db.Query(ctx, countUserTopics, arg.UserID, arg.FromTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountUserTopicsRow{}
+	for rows.Next() {
+		var i CountUserTopicsRow
+		if err := rows.Scan(&i.Topic, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countUserTopicsByDay = `-- name: CountUserTopicsByDay :many
+SELECT
+    (created_at AT TIME ZONE 'Asia/Jakarta')::date AS day,
+    topic,
+    COUNT(*)::integer AS count
+FROM message_topics
+WHERE user_id = $1
+  AND created_at >= $2
+  AND created_at < $3
+GROUP BY day, topic
+ORDER BY day, topic
+`
+
+type CountUserTopicsByDayParams struct {
+	UserID   string             `json:"user_id"`
+	FromTime pgtype.Timestamptz `json:"from_time"`
+	ToTime   pgtype.Timestamptz `json:"to_time"`
+}
+
+type CountUserTopicsByDayRow struct {
+	Day   pgtype.Date `json:"day"`
+	Topic string      `json:"topic"`
+	Count int32       `json:"count"`
+}
+
+// Days are calendar days in WIB
+func (q *Queries) CountUserTopicsByDay(ctx context.Context, arg CountUserTopicsByDayParams) ([]CountUserTopicsByDayRow, error) {
+	rows, err := q.db.Query(ctx, countUserTopicsByDay, arg.UserID, arg.FromTime, arg.ToTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountUserTopicsByDayRow{}
+	for rows.Next() {
+		var i CountUserTopicsByDayRow
+		if err := rows.Scan(&i.Day, &i.Topic, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const countWeekSessions = `-- name: CountWeekSessions :one
 SELECT 
     COUNT(DISTINCT s.id)::integer as session_count, 
@@ -221,19 +601,77 @@ func (q *Queries) CountWeekSessions(ctx context.Context, arg CountWeekSessionsPa
 	return i, err
 }
 
+const createAIUsage = `-- name: CreateAIUsage :one
+
+INSERT INTO ai_usage (user_id, session_id, feature, model, prompt_tokens, completion_tokens, latency_ms, estimated_cost_micros)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, user_id, session_id, feature, model, prompt_tokens, completion_tokens, latency_ms, estimated_cost_micros, created_at
+`
+
+type CreateAIUsageParams struct {
+	UserID              pgtype.Text `json:"user_id"`
+	SessionID           pgtype.UUID `json:"session_id"`
+	Feature             string      `json:"feature"`
+	Model               string      `json:"model"`
+	PromptTokens        int32       `json:"prompt_tokens"`
+	CompletionTokens    int32       `json:"completion_tokens"`
+	LatencyMs           int32       `json:"latency_ms"`
+	EstimatedCostMicros int64       `json:"estimated_cost_micros"`
+}
+
+// ==================== AI USAGE ====================
+func (q *Queries) CreateAIUsage(ctx context.Context, arg CreateAIUsageParams) (AiUsage, error) {
+	row := q.db.QueryRow(ctx, createAIUsage,
+		arg.UserID,
+		arg.SessionID,
+		arg.Feature,
+		arg.Model,
+		arg.PromptTokens,
+		arg.CompletionTokens,
+		arg.LatencyMs,
+		arg.EstimatedCostMicros,
+	)
+	var i AiUsage
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.SessionID,
+		&i.Feature,
+		&i.Model,
+		&i.PromptTokens,
+		&i.CompletionTokens,
+		&i.LatencyMs,
+		&i.EstimatedCostMicros,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const createArtwork = `-- name: CreateArtwork :one
-INSERT INTO artworks (name, display_name, description, image_url, unlock_cost, reveal_cost)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, name, display_name, description, image_url, unlock_cost, reveal_cost, created_at
+INSERT INTO artworks (
+    name, display_name, description, image_url, unlock_cost, reveal_cost,
+    sort_order, available_from, available_until, retired_at
+)
+VALUES (
+    $1, $2, $3, $4,
+    $5, $6, $7,
+    $8, $9,
+    CASE WHEN $10::boolean THEN NOW() END
+)
+RETURNING id, name, display_name, description, image_url, unlock_cost, reveal_cost, created_at, sort_order, available_from, available_until, retired_at, version, updated_at
 `
 
 type CreateArtworkParams struct {
-	Name        string `json:"name"`
-	DisplayName string `json:"display_name"`
-	Description string `json:"description"`
-	ImageUrl    string `json:"image_url"`
-	UnlockCost  int32  `json:"unlock_cost"`
-	RevealCost  int32  `json:"reveal_cost"`
+	Name           string             `json:"name"`
+	DisplayName    string             `json:"display_name"`
+	Description    string             `json:"description"`
+	ImageUrl       string             `json:"image_url"`
+	UnlockCost     int32              `json:"unlock_cost"`
+	RevealCost     int32              `json:"reveal_cost"`
+	SortOrder      int32              `json:"sort_order"`
+	AvailableFrom  pgtype.Timestamptz `json:"available_from"`
+	AvailableUntil pgtype.Timestamptz `json:"available_until"`
+	Retired        bool               `json:"retired"`
 }
 
 func (q *Queries) CreateArtwork(ctx context.Context, arg CreateArtworkParams) (Artwork, error) {
@@ -244,6 +682,10 @@ func (q *Queries) CreateArtwork(ctx context.Context, arg CreateArtworkParams) (A
 		arg.ImageUrl,
 		arg.UnlockCost,
 		arg.RevealCost,
+		arg.SortOrder,
+		arg.AvailableFrom,
+		arg.AvailableUntil,
+		arg.Retired,
 	)
 	var i Artwork
 	err := row.Scan(
@@ -255,26 +697,119 @@ func (q *Queries) CreateArtwork(ctx context.Context, arg CreateArtworkParams) (A
 		&i.UnlockCost,
 		&i.RevealCost,
 		&i.CreatedAt,
+		&i.SortOrder,
+		&i.AvailableFrom,
+		&i.AvailableUntil,
+		&i.RetiredAt,
+		&i.Version,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
 
-const createMessage = `-- name: CreateMessage :one
+const createArtworkVersion = `-- name: CreateArtworkVersion :exec
+INSERT INTO artwork_versions (artwork_id, version, display_name, description, image_url, unlock_cost, reveal_cost)
+SELECT id, version, display_name, description, image_url, unlock_cost, reveal_cost
+FROM artworks
+WHERE id = $1
+ON CONFLICT (artwork_id, version) DO NOTHING
+`
+
+// Snapshots an artwork's current content; a no-op if the version exists
+func (q *Queries) CreateArtworkVersion(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, createArtworkVersion, id)
+	return err
+}
 
-INSERT INTO messages (session_id, role, content)
+const createExperimentAssignment = `-- name: CreateExperimentAssignment :one
+INSERT INTO experiment_assignments (user_id, experiment, variant)
 VALUES ($1, $2, $3)
-RETURNING id, session_id, role, content, created_at
+ON CONFLICT (user_id, experiment) DO UPDATE SET variant = experiment_assignments.variant
+RETURNING user_id, experiment, variant, assigned_at
+`
+
+type CreateExperimentAssignmentParams struct {
+	UserID     string `json:"user_id"`
+	Experiment string `json:"experiment"`
+	Variant    string `json:"variant"`
+}
+
+// Returns the existing assignment when the user is already enrolled
+func (q *Queries) CreateExperimentAssignment(ctx context.Context, arg CreateExperimentAssignmentParams) (ExperimentAssignment, error) {
+	row := q.db.QueryRow(ctx, createExperimentAssignment, arg.UserID, arg.Experiment, arg.Variant)
+	var i ExperimentAssignment
+	err := row.Scan(
+		&i.UserID,
+		&i.Experiment,
+		&i.Variant,
+		&i.AssignedAt,
+	)
+	return i, err
+}
+
+const createLedgerEntry = `-- name: CreateLedgerEntry :execrows
+
+INSERT INTO currency_ledger (user_id, currency, delta, reason, counterparty, message_id, session_id, idempotency_key)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (user_id, idempotency_key) DO NOTHING
+`
+
+type CreateLedgerEntryParams struct {
+	UserID         string      `json:"user_id"`
+	Currency       string      `json:"currency"`
+	Delta          int32       `json:"delta"`
+	Reason         string      `json:"reason"`
+	Counterparty   string      `json:"counterparty"`
+	MessageID      pgtype.UUID `json:"message_id"`
+	SessionID      pgtype.UUID `json:"session_id"`
+	IdempotencyKey string      `json:"idempotency_key"`
+}
+
+// ==================== CURRENCY LEDGER ====================
+// A no-op when the user already has an entry with the idempotency key
+func (q *Queries) CreateLedgerEntry(ctx context.Context, arg CreateLedgerEntryParams) (int64, error) {
+	result, err := q.db.Exec(ctx, createLedgerEntry,
+		arg.UserID,
+		arg.Currency,
+		arg.Delta,
+		arg.Reason,
+		arg.Counterparty,
+		arg.MessageID,
+		arg.SessionID,
+		arg.IdempotencyKey,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const createMessage = `-- name: CreateMessage :one
+
+INSERT INTO messages (session_id, role, content, prompt_version, persona_id, quote_id)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, session_id, role, content, created_at, prompt_version, risk_level, risk_source, flagged_at, persona_id, quote_id, reply_status
 `
 
 type CreateMessageParams struct {
-	SessionID pgtype.UUID `json:"session_id"`
-	Role      string      `json:"role"`
-	Content   string      `json:"content"`
+	SessionID     pgtype.UUID `json:"session_id"`
+	Role          string      `json:"role"`
+	Content       string      `json:"content"`
+	PromptVersion pgtype.Text `json:"prompt_version"`
+	PersonaID     pgtype.Text `json:"persona_id"`
+	QuoteID       pgtype.UUID `json:"quote_id"`
 }
 
 // ==================== MESSAGES ====================
 func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (Message, error) {
-	row := q.db.QueryRow(ctx, createMessage, arg.SessionID, arg.Role, arg.Content)
+	row := q.db.QueryRow(ctx, createMessage,
+		arg.SessionID,
+		arg.Role,
+		arg.Content,
+		arg.PromptVersion,
+		arg.PersonaID,
+		arg.QuoteID,
+	)
 	var i Message
 	err := row.Scan(
 		&i.ID,
@@ -282,6 +817,83 @@ func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (M
 		&i.Role,
 		&i.Content,
 		&i.CreatedAt,
+		&i.PromptVersion,
+		&i.RiskLevel,
+		&i.RiskSource,
+		&i.FlaggedAt,
+		&i.PersonaID,
+		&i.QuoteID,
+		&i.ReplyStatus,
+	)
+	return i, err
+}
+
+const createMessageEmotions = `-- name: CreateMessageEmotions :exec
+
+INSERT INTO message_emotions (message_id, user_id, emotion)
+SELECT $1, $2, unnest($3::text[])
+ON CONFLICT (message_id, emotion) DO NOTHING
+`
+
+type CreateMessageEmotionsParams struct {
+	MessageID pgtype.UUID `json:"message_id"`
+	UserID    string      `json:"user_id"`
+	Emotions  []string    `json:"emotions"`
+}
+
+// ==================== MESSAGE EMOTIONS ====================
+func (q *Queries) CreateMessageEmotions(ctx context.Context, arg CreateMessageEmotionsParams) error {
+	_, err := q.db.Exec(ctx, createMessageEmotions, arg.MessageID, arg.UserID, arg.Emotions)
+	return err
+}
+
+const createMessageTopics = `-- name: CreateMessageTopics :exec
+
+INSERT INTO message_topics (message_id, user_id, topic)
+SELECT $1, $2, unnest($3::text[])
+ON CONFLICT (message_id, topic) DO NOTHING
+`
+
+type CreateMessageTopicsParams struct {
+	MessageID pgtype.UUID `json:"message_id"`
+	UserID    string      `json:"user_id"`
+	Topics    []string    `json:"topics"`
+}
+
+// ==================== MESSAGE TOPICS ====================
+func (q *Queries) CreateMessageTopics(ctx context.Context, arg CreateMessageTopicsParams) error {
+	_, err := q.db.Exec(ctx, createMessageTopics, arg.MessageID, arg.UserID, arg.Topics)
+	return err
+}
+
+const createPendingMessage = `-- name: CreatePendingMessage :one
+INSERT INTO messages (session_id, role, content, reply_status)
+VALUES ($1, 'user', $2, 'pending')
+RETURNING id, session_id, role, content, created_at, prompt_version, risk_level, risk_source, flagged_at, persona_id, quote_id, reply_status
+`
+
+type CreatePendingMessageParams struct {
+	SessionID pgtype.UUID `json:"session_id"`
+	Content   string      `json:"content"`
+}
+
+// A user message waiting for its reply
+func (q *Queries) CreatePendingMessage(ctx context.Context, arg CreatePendingMessageParams) (Message, error) {
+	row := q.db.QueryRow(ctx, createPendingMessage, arg.SessionID, arg.Content)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.Role,
+		&i.Content,
+		&i.CreatedAt,
+		&i.PromptVersion,
+		&i.RiskLevel,
+		&i.RiskSource,
+		&i.FlaggedAt,
+		&i.PersonaID,
+		&i.QuoteID,
+		&i.ReplyStatus,
 	)
 	return i, err
 }
@@ -334,7 +946,7 @@ const createSession = `-- name: CreateSession :one
 
 INSERT INTO sessions (user_id)
 VALUES ($1)
-RETURNING id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at
+RETURNING id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id
 `
 
 // ==================== SESSIONS ====================
@@ -351,6 +963,107 @@ func (q *Queries) CreateSession(ctx context.Context, userID string) (Session, er
 		&i.EndedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.MemoriesExtractedAt,
+		&i.RunningSummary,
+		&i.RunningSummaryUntil,
+		&i.Title,
+		&i.Summary,
+		&i.ClosingMessage,
+		&i.ClosingPromptVersion,
+		&i.DepthLevel,
+		&i.DepthProgress,
+		&i.TemplateID,
+		&i.TemplateStep,
+		&i.TemplateStepMessages,
+		&i.TemplateStepWords,
+		&i.TemplateCompletedAt,
+		&i.TemplateOutput,
+		&i.PersonaID,
+		&i.QuoteID,
+	)
+	return i, err
+}
+
+const createTemplateSession = `-- name: CreateTemplateSession :one
+INSERT INTO sessions (user_id, template_id)
+VALUES ($1, $2)
+RETURNING id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id
+`
+
+type CreateTemplateSessionParams struct {
+	UserID     string      `json:"user_id"`
+	TemplateID pgtype.Text `json:"template_id"`
+}
+
+func (q *Queries) CreateTemplateSession(ctx context.Context, arg CreateTemplateSessionParams) (Session, error) {
+	row := q.db.QueryRow(ctx, createTemplateSession, arg.UserID, arg.TemplateID)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.TotalMessages,
+		&i.GoldenInkEarned,
+		&i.StartedAt,
+		&i.EndedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.MemoriesExtractedAt,
+		&i.RunningSummary,
+		&i.RunningSummaryUntil,
+		&i.Title,
+		&i.Summary,
+		&i.ClosingMessage,
+		&i.ClosingPromptVersion,
+		&i.DepthLevel,
+		&i.DepthProgress,
+		&i.TemplateID,
+		&i.TemplateStep,
+		&i.TemplateStepMessages,
+		&i.TemplateStepWords,
+		&i.TemplateCompletedAt,
+		&i.TemplateOutput,
+		&i.PersonaID,
+		&i.QuoteID,
+	)
+	return i, err
+}
+
+const createUserMemory = `-- name: CreateUserMemory :one
+INSERT INTO user_memories (user_id, kind, content, importance, source_session_id)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, user_id, kind, content, importance, mentions, source_session_id, user_edited, last_seen_at, created_at, updated_at
+`
+
+type CreateUserMemoryParams struct {
+	UserID          string      `json:"user_id"`
+	Kind            string      `json:"kind"`
+	Content         string      `json:"content"`
+	Importance      int16       `json:"importance"`
+	SourceSessionID pgtype.UUID `json:"source_session_id"`
+}
+
+func (q *Queries) CreateUserMemory(ctx context.Context, arg CreateUserMemoryParams) (UserMemory, error) {
+	row := q.db.QueryRow(ctx, createUserMemory,
+		arg.UserID,
+		arg.Kind,
+		arg.Content,
+		arg.Importance,
+		arg.SourceSessionID,
+	)
+	var i UserMemory
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Kind,
+		&i.Content,
+		&i.Importance,
+		&i.Mentions,
+		&i.SourceSessionID,
+		&i.UserEdited,
+		&i.LastSeenAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
@@ -423,19 +1136,20 @@ func (q *Queries) CreateUserSubscriptionAsPaid(ctx context.Context, arg CreateUs
 
 const createWeeklySummary = `-- name: CreateWeeklySummary :one
 
-INSERT INTO weekly_summaries (user_id, week_start, week_end, summary, session_count, message_count, emotions)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
-RETURNING id, user_id, week_start, week_end, summary, session_count, message_count, emotions, created_at
+INSERT INTO weekly_summaries (user_id, week_start, week_end, summary, session_count, message_count, emotions, prompt_version)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, user_id, week_start, week_end, summary, session_count, message_count, emotions, created_at, prompt_version
 `
 
 type CreateWeeklySummaryParams struct {
-	UserID       string      `json:"user_id"`
-	WeekStart    pgtype.Date `json:"week_start"`
-	WeekEnd      pgtype.Date `json:"week_end"`
-	Summary      string      `json:"summary"`
-	SessionCount int32       `json:"session_count"`
-	MessageCount int32       `json:"message_count"`
-	Emotions     []byte      `json:"emotions"`
+	UserID        string      `json:"user_id"`
+	WeekStart     pgtype.Date `json:"week_start"`
+	WeekEnd       pgtype.Date `json:"week_end"`
+	Summary       string      `json:"summary"`
+	SessionCount  int32       `json:"session_count"`
+	MessageCount  int32       `json:"message_count"`
+	Emotions      []byte      `json:"emotions"`
+	PromptVersion pgtype.Text `json:"prompt_version"`
 }
 
 // ==================== WEEKLY SUMMARIES ====================
@@ -448,6 +1162,7 @@ func (q *Queries) CreateWeeklySummary(ctx context.Context, arg CreateWeeklySumma
 		arg.SessionCount,
 		arg.MessageCount,
 		arg.Emotions,
+		arg.PromptVersion,
 	)
 	var i WeeklySummary
 	err := row.Scan(
@@ -460,10 +1175,29 @@ func (q *Queries) CreateWeeklySummary(ctx context.Context, arg CreateWeeklySumma
 		&i.MessageCount,
 		&i.Emotions,
 		&i.CreatedAt,
+		&i.PromptVersion,
 	)
 	return i, err
 }
 
+const deleteUserMemory = `-- name: DeleteUserMemory :execrows
+DELETE FROM user_memories
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteUserMemoryParams struct {
+	ID     pgtype.UUID `json:"id"`
+	UserID string      `json:"user_id"`
+}
+
+func (q *Queries) DeleteUserMemory(ctx context.Context, arg DeleteUserMemoryParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserMemory, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const endSession = `-- name: EndSession :one
 UPDATE sessions
 SET 
@@ -471,7 +1205,7 @@ SET
     ended_at = NOW(),
     updated_at = NOW()
 WHERE id = $1 AND user_id = $3
-RETURNING id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at
+RETURNING id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id
 `
 
 type EndSessionParams struct {
@@ -493,12 +1227,65 @@ func (q *Queries) EndSession(ctx context.Context, arg EndSessionParams) (Session
 		&i.EndedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.MemoriesExtractedAt,
+		&i.RunningSummary,
+		&i.RunningSummaryUntil,
+		&i.Title,
+		&i.Summary,
+		&i.ClosingMessage,
+		&i.ClosingPromptVersion,
+		&i.DepthLevel,
+		&i.DepthProgress,
+		&i.TemplateID,
+		&i.TemplateStep,
+		&i.TemplateStepMessages,
+		&i.TemplateStepWords,
+		&i.TemplateCompletedAt,
+		&i.TemplateOutput,
+		&i.PersonaID,
+		&i.QuoteID,
+	)
+	return i, err
+}
+
+const flagMessage = `-- name: FlagMessage :one
+UPDATE messages
+SET risk_level = CASE WHEN risk_level = 'high' THEN risk_level ELSE $2 END,
+    risk_source = CASE WHEN risk_level = 'high' THEN risk_source ELSE $3 END,
+    flagged_at = COALESCE(flagged_at, NOW())
+WHERE id = $1
+RETURNING id, session_id, role, content, created_at, prompt_version, risk_level, risk_source, flagged_at, persona_id, quote_id, reply_status
+`
+
+type FlagMessageParams struct {
+	ID         pgtype.UUID `json:"id"`
+	RiskLevel  pgtype.Text `json:"risk_level"`
+	RiskSource pgtype.Text `json:"risk_source"`
+}
+
+// Keeps the highest risk level when a message is flagged more than once
+func (q *Queries) FlagMessage(ctx context.Context, arg FlagMessageParams) (Message, error) {
+	row := q.db.QueryRow(ctx, flagMessage, arg.ID, arg.RiskLevel, arg.RiskSource)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.Role,
+		&i.Content,
+		&i.CreatedAt,
+		&i.PromptVersion,
+		&i.RiskLevel,
+		&i.RiskSource,
+		&i.FlaggedAt,
+		&i.PersonaID,
+		&i.QuoteID,
+		&i.ReplyStatus,
 	)
 	return i, err
 }
 
 const getActiveSession = `-- name: GetActiveSession :one
-SELECT id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at FROM sessions
+SELECT id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id FROM sessions
 WHERE user_id = $1 AND status = 'active'
 ORDER BY started_at DESC
 LIMIT 1
@@ -517,12 +1304,29 @@ func (q *Queries) GetActiveSession(ctx context.Context, userID string) (Session,
 		&i.EndedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.MemoriesExtractedAt,
+		&i.RunningSummary,
+		&i.RunningSummaryUntil,
+		&i.Title,
+		&i.Summary,
+		&i.ClosingMessage,
+		&i.ClosingPromptVersion,
+		&i.DepthLevel,
+		&i.DepthProgress,
+		&i.TemplateID,
+		&i.TemplateStep,
+		&i.TemplateStepMessages,
+		&i.TemplateStepWords,
+		&i.TemplateCompletedAt,
+		&i.TemplateOutput,
+		&i.PersonaID,
+		&i.QuoteID,
 	)
 	return i, err
 }
 
 const getArtworkByID = `-- name: GetArtworkByID :one
-SELECT id, name, display_name, description, image_url, unlock_cost, reveal_cost, created_at FROM artworks
+SELECT id, name, display_name, description, image_url, unlock_cost, reveal_cost, created_at, sort_order, available_from, available_until, retired_at, version, updated_at FROM artworks
 WHERE id = $1
 `
 
@@ -538,12 +1342,18 @@ func (q *Queries) GetArtworkByID(ctx context.Context, id pgtype.UUID) (Artwork,
 		&i.UnlockCost,
 		&i.RevealCost,
 		&i.CreatedAt,
+		&i.SortOrder,
+		&i.AvailableFrom,
+		&i.AvailableUntil,
+		&i.RetiredAt,
+		&i.Version,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
 
 const getArtworkByName = `-- name: GetArtworkByName :one
-SELECT id, name, display_name, description, image_url, unlock_cost, reveal_cost, created_at FROM artworks
+SELECT id, name, display_name, description, image_url, unlock_cost, reveal_cost, created_at, sort_order, available_from, available_until, retired_at, version, updated_at FROM artworks
 WHERE name = $1
 `
 
@@ -559,42 +1369,76 @@ func (q *Queries) GetArtworkByName(ctx context.Context, name string) (Artwork, e
 		&i.UnlockCost,
 		&i.RevealCost,
 		&i.CreatedAt,
+		&i.SortOrder,
+		&i.AvailableFrom,
+		&i.AvailableUntil,
+		&i.RetiredAt,
+		&i.Version,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getArtworkVersion = `-- name: GetArtworkVersion :one
+SELECT artwork_id, version, display_name, description, image_url, unlock_cost, reveal_cost, created_at FROM artwork_versions
+WHERE artwork_id = $1 AND version = $2
+`
+
+type GetArtworkVersionParams struct {
+	ArtworkID pgtype.UUID `json:"artwork_id"`
+	Version   int32       `json:"version"`
+}
+
+func (q *Queries) GetArtworkVersion(ctx context.Context, arg GetArtworkVersionParams) (ArtworkVersion, error) {
+	row := q.db.QueryRow(ctx, getArtworkVersion, arg.ArtworkID, arg.Version)
+	var i ArtworkVersion
+	err := row.Scan(
+		&i.ArtworkID,
+		&i.Version,
+		&i.DisplayName,
+		&i.Description,
+		&i.ImageUrl,
+		&i.UnlockCost,
+		&i.RevealCost,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
 const getCurrentArtwork = `-- name: GetCurrentArtwork :one
 SELECT 
-    ua.id, ua.user_id, ua.artwork_id, ua.progress, ua.status, ua.unlocked_at, ua.completed_at, ua.created_at, ua.updated_at,
+    ua.id, ua.user_id, ua.artwork_id, ua.progress, ua.status, ua.unlocked_at, ua.completed_at, ua.created_at, ua.updated_at, ua.artwork_version,
     a.name,
-    a.display_name,
-    a.description,
-    a.image_url,
-    a.unlock_cost,
-    a.reveal_cost
+    av.display_name,
+    av.description,
+    av.image_url,
+    av.unlock_cost,
+    av.reveal_cost
 FROM user_artworks ua
 JOIN artworks a ON ua.artwork_id = a.id
+JOIN artwork_versions av ON av.artwork_id = ua.artwork_id AND av.version = ua.artwork_version
 WHERE ua.user_id = $1 AND ua.status = 'in_progress'
 ORDER BY ua.unlocked_at DESC
 LIMIT 1
 `
 
 type GetCurrentArtworkRow struct {
-	ID          pgtype.UUID        `json:"id"`
-	UserID      string             `json:"user_id"`
-	ArtworkID   pgtype.UUID        `json:"artwork_id"`
-	Progress    int32              `json:"progress"`
-	Status      string             `json:"status"`
-	UnlockedAt  pgtype.Timestamptz `json:"unlocked_at"`
-	CompletedAt pgtype.Timestamptz `json:"completed_at"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
-	Name        string             `json:"name"`
-	DisplayName string             `json:"display_name"`
-	Description string             `json:"description"`
-	ImageUrl    string             `json:"image_url"`
-	UnlockCost  int32              `json:"unlock_cost"`
-	RevealCost  int32              `json:"reveal_cost"`
+	ID             pgtype.UUID        `json:"id"`
+	UserID         string             `json:"user_id"`
+	ArtworkID      pgtype.UUID        `json:"artwork_id"`
+	Progress       int32              `json:"progress"`
+	Status         string             `json:"status"`
+	UnlockedAt     pgtype.Timestamptz `json:"unlocked_at"`
+	CompletedAt    pgtype.Timestamptz `json:"completed_at"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+	ArtworkVersion int32              `json:"artwork_version"`
+	Name           string             `json:"name"`
+	DisplayName    string             `json:"display_name"`
+	Description    string             `json:"description"`
+	ImageUrl       string             `json:"image_url"`
+	UnlockCost     int32              `json:"unlock_cost"`
+	RevealCost     int32              `json:"reveal_cost"`
 }
 
 func (q *Queries) GetCurrentArtwork(ctx context.Context, userID string) (GetCurrentArtworkRow, error) {
@@ -610,6 +1454,7 @@ func (q *Queries) GetCurrentArtwork(ctx context.Context, userID string) (GetCurr
 		&i.CompletedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ArtworkVersion,
 		&i.Name,
 		&i.DisplayName,
 		&i.Description,
@@ -620,8 +1465,100 @@ func (q *Queries) GetCurrentArtwork(ctx context.Context, userID string) (GetCurr
 	return i, err
 }
 
+const getExperimentOutcomes = `-- name: GetExperimentOutcomes :many
+WITH assigned AS (
+    SELECT ea.user_id, ea.variant, ea.assigned_at
+    FROM experiment_assignments ea
+    WHERE ea.experiment = $1
+),
+variant_sessions AS (
+    SELECT a.variant, s.user_id, s.id, (s.started_at AT TIME ZONE 'Asia/Jakarta')::date AS day
+    FROM assigned a
+    JOIN sessions s ON s.user_id = a.user_id AND s.started_at >= a.assigned_at
+),
+session_lengths AS (
+    SELECT vs.variant, vs.id, COUNT(m.id) AS user_messages
+    FROM variant_sessions vs
+    LEFT JOIN messages m ON m.session_id = vs.id AND m.role = 'user'
+    GROUP BY vs.variant, vs.id
+),
+message_words AS (
+    SELECT vs.variant, COALESCE(array_length(regexp_split_to_array(btrim(m.content), '\s+'), 1), 0) AS words
+    FROM variant_sessions vs
+    JOIN messages m ON m.session_id = vs.id AND m.role = 'user'
+),
+active_days AS (
+    SELECT DISTINCT vs.variant, vs.user_id, vs.day
+    FROM variant_sessions vs
+),
+day_outcomes AS (
+    SELECT d.variant, d.user_id, d.day,
+        EXISTS (
+            SELECT 1 FROM active_days n
+            WHERE n.user_id = d.user_id AND n.variant = d.variant AND n.day = d.day + 1
+        ) AS returned_next_day,
+        d.day = MIN(d.day) OVER (PARTITION BY d.variant, d.user_id) AS is_first_day
+    FROM active_days d
+    WHERE d.day < (NOW() AT TIME ZONE 'Asia/Jakarta')::date
+)
+SELECT
+    a.variant,
+    COUNT(*)::integer AS users,
+    (SELECT COUNT(DISTINCT ad.user_id) FROM active_days ad WHERE ad.variant = a.variant)::integer AS active_users,
+    (SELECT COUNT(*) FROM session_lengths sl WHERE sl.variant = a.variant)::integer AS sessions,
+    (SELECT COALESCE(AVG(mw.words), 0) FROM message_words mw WHERE mw.variant = a.variant)::float8 AS avg_words_per_message,
+    (SELECT COALESCE(AVG(sl.user_messages), 0) FROM session_lengths sl WHERE sl.variant = a.variant)::float8 AS avg_session_length,
+    (SELECT COALESCE(AVG(CASE WHEN o.returned_next_day THEN 1 ELSE 0 END), 0) FROM day_outcomes o WHERE o.variant = a.variant AND o.is_first_day)::float8 AS next_day_return_rate,
+    (SELECT COALESCE(AVG(CASE WHEN o.returned_next_day THEN 1 ELSE 0 END), 0) FROM day_outcomes o WHERE o.variant = a.variant)::float8 AS streak_continuation_rate
+FROM assigned a
+GROUP BY a.variant
+ORDER BY a.variant
+`
+
+type GetExperimentOutcomesRow struct {
+	Variant                string  `json:"variant"`
+	Users                  int32   `json:"users"`
+	ActiveUsers            int32   `json:"active_users"`
+	Sessions               int32   `json:"sessions"`
+	AvgWordsPerMessage     float64 `json:"avg_words_per_message"`
+	AvgSessionLength       float64 `json:"avg_session_length"`
+	NextDayReturnRate      float64 `json:"next_day_return_rate"`
+	StreakContinuationRate float64 `json:"streak_continuation_rate"`
+}
+
+// Outcome metrics per variant, counting only activity after each user's assignment.
+// Days are WIB calendar days; today is excluded from return rates since it isn't over.
+func (q *Queries) GetExperimentOutcomes(ctx context.Context, experiment string) ([]GetExperimentOutcomesRow, error) {
+	rows, err := q.db.Query(ctx, getExperimentOutcomes, experiment)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetExperimentOutcomesRow{}
+	for rows.Next() {
+		var i GetExperimentOutcomesRow
+		if err := rows.Scan(
+			&i.Variant,
+			&i.Users,
+			&i.ActiveUsers,
+			&i.Sessions,
+			&i.AvgWordsPerMessage,
+			&i.AvgSessionLength,
+			&i.NextDayReturnRate,
+			&i.StreakContinuationRate,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getLatestWeeklySummary = `-- name: GetLatestWeeklySummary :one
-SELECT id, user_id, week_start, week_end, summary, session_count, message_count, emotions, created_at FROM weekly_summaries
+SELECT id, user_id, week_start, week_end, summary, session_count, message_count, emotions, created_at, prompt_version FROM weekly_summaries
 WHERE user_id = $1
 ORDER BY week_start DESC
 LIMIT 1
@@ -640,35 +1577,145 @@ func (q *Queries) GetLatestWeeklySummary(ctx context.Context, userID string) (We
 		&i.MessageCount,
 		&i.Emotions,
 		&i.CreatedAt,
+		&i.PromptVersion,
+	)
+	return i, err
+}
+
+const getPendingUpgrade = `-- name: GetPendingUpgrade :one
+SELECT id, trakteer_transaction_id, supporter_email, supporter_name, payment_amount, status, resolved_at, resolved_user_id, error_message, raw_payload, created_at FROM pending_upgrades WHERE id = $1
+`
+
+func (q *Queries) GetPendingUpgrade(ctx context.Context, id pgtype.UUID) (PendingUpgrade, error) {
+	row := q.db.QueryRow(ctx, getPendingUpgrade, id)
+	var i PendingUpgrade
+	err := row.Scan(
+		&i.ID,
+		&i.TrakteerTransactionID,
+		&i.SupporterEmail,
+		&i.SupporterName,
+		&i.PaymentAmount,
+		&i.Status,
+		&i.ResolvedAt,
+		&i.ResolvedUserID,
+		&i.ErrorMessage,
+		&i.RawPayload,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getPreviousSession = `-- name: GetPreviousSession :one
+SELECT id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id FROM sessions
+WHERE user_id = $1 AND id <> $2
+ORDER BY started_at DESC
+LIMIT 1
+`
+
+type GetPreviousSessionParams struct {
+	UserID string      `json:"user_id"`
+	ID     pgtype.UUID `json:"id"`
+}
+
+// The user's most recent session other than the given one
+func (q *Queries) GetPreviousSession(ctx context.Context, arg GetPreviousSessionParams) (Session, error) {
+	row := q.db.QueryRow(ctx, getPreviousSession, arg.UserID, arg.ID)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.TotalMessages,
+		&i.GoldenInkEarned,
+		&i.StartedAt,
+		&i.EndedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.MemoriesExtractedAt,
+		&i.RunningSummary,
+		&i.RunningSummaryUntil,
+		&i.Title,
+		&i.Summary,
+		&i.ClosingMessage,
+		&i.ClosingPromptVersion,
+		&i.DepthLevel,
+		&i.DepthProgress,
+		&i.TemplateID,
+		&i.TemplateStep,
+		&i.TemplateStepMessages,
+		&i.TemplateStepWords,
+		&i.TemplateCompletedAt,
+		&i.TemplateOutput,
+		&i.PersonaID,
+		&i.QuoteID,
+	)
+	return i, err
+}
+
+const getQuoteByID = `-- name: GetQuoteByID :one
+SELECT id, collection_id, text, author, source, language, emotions, created_at FROM quotes
+WHERE id = $1
+`
+
+func (q *Queries) GetQuoteByID(ctx context.Context, id pgtype.UUID) (Quote, error) {
+	row := q.db.QueryRow(ctx, getQuoteByID, id)
+	var i Quote
+	err := row.Scan(
+		&i.ID,
+		&i.CollectionID,
+		&i.Text,
+		&i.Author,
+		&i.Source,
+		&i.Language,
+		&i.Emotions,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
-const getPendingUpgrade = `-- name: GetPendingUpgrade :one
-SELECT id, trakteer_transaction_id, supporter_email, supporter_name, payment_amount, status, resolved_at, resolved_user_id, error_message, raw_payload, created_at FROM pending_upgrades WHERE id = $1
+const getQuoteCollection = `-- name: GetQuoteCollection :one
+SELECT
+    c.id, c.name, c.display_name, c.description, c.unlock_currency, c.unlock_cost, c.created_at,
+    (c.unlock_cost = 0 OR u.user_id IS NOT NULL)::boolean AS unlocked
+FROM quote_collections c
+LEFT JOIN user_quote_collections u ON u.collection_id = c.id AND u.user_id = $2
+WHERE c.id = $1
 `
 
-func (q *Queries) GetPendingUpgrade(ctx context.Context, id pgtype.UUID) (PendingUpgrade, error) {
-	row := q.db.QueryRow(ctx, getPendingUpgrade, id)
-	var i PendingUpgrade
+type GetQuoteCollectionParams struct {
+	ID     pgtype.UUID `json:"id"`
+	UserID string      `json:"user_id"`
+}
+
+type GetQuoteCollectionRow struct {
+	ID             pgtype.UUID        `json:"id"`
+	Name           string             `json:"name"`
+	DisplayName    string             `json:"display_name"`
+	Description    string             `json:"description"`
+	UnlockCurrency string             `json:"unlock_currency"`
+	UnlockCost     int32              `json:"unlock_cost"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	Unlocked       bool               `json:"unlocked"`
+}
+
+func (q *Queries) GetQuoteCollection(ctx context.Context, arg GetQuoteCollectionParams) (GetQuoteCollectionRow, error) {
+	row := q.db.QueryRow(ctx, getQuoteCollection, arg.ID, arg.UserID)
+	var i GetQuoteCollectionRow
 	err := row.Scan(
 		&i.ID,
-		&i.TrakteerTransactionID,
-		&i.SupporterEmail,
-		&i.SupporterName,
-		&i.PaymentAmount,
-		&i.Status,
-		&i.ResolvedAt,
-		&i.ResolvedUserID,
-		&i.ErrorMessage,
-		&i.RawPayload,
+		&i.Name,
+		&i.DisplayName,
+		&i.Description,
+		&i.UnlockCurrency,
+		&i.UnlockCost,
 		&i.CreatedAt,
+		&i.Unlocked,
 	)
 	return i, err
 }
 
 const getRecentMessages = `-- name: GetRecentMessages :many
-SELECT id, session_id, role, content, created_at FROM messages
+SELECT id, session_id, role, content, created_at, prompt_version, risk_level, risk_source, flagged_at, persona_id, quote_id, reply_status FROM messages
 WHERE session_id = $1
 ORDER BY created_at DESC
 LIMIT $2
@@ -694,6 +1741,13 @@ func (q *Queries) GetRecentMessages(ctx context.Context, arg GetRecentMessagesPa
 			&i.Role,
 			&i.Content,
 			&i.CreatedAt,
+			&i.PromptVersion,
+			&i.RiskLevel,
+			&i.RiskSource,
+			&i.FlaggedAt,
+			&i.PersonaID,
+			&i.QuoteID,
+			&i.ReplyStatus,
 		); err != nil {
 			return nil, err
 		}
@@ -706,7 +1760,7 @@ func (q *Queries) GetRecentMessages(ctx context.Context, arg GetRecentMessagesPa
 }
 
 const getSessionByID = `-- name: GetSessionByID :one
-SELECT id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at FROM sessions
+SELECT id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id FROM sessions
 WHERE id = $1 AND user_id = $2
 `
 
@@ -728,12 +1782,59 @@ func (q *Queries) GetSessionByID(ctx context.Context, arg GetSessionByIDParams)
 		&i.EndedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.MemoriesExtractedAt,
+		&i.RunningSummary,
+		&i.RunningSummaryUntil,
+		&i.Title,
+		&i.Summary,
+		&i.ClosingMessage,
+		&i.ClosingPromptVersion,
+		&i.DepthLevel,
+		&i.DepthProgress,
+		&i.TemplateID,
+		&i.TemplateStep,
+		&i.TemplateStepMessages,
+		&i.TemplateStepWords,
+		&i.TemplateCompletedAt,
+		&i.TemplateOutput,
+		&i.PersonaID,
+		&i.QuoteID,
+	)
+	return i, err
+}
+
+const getSessionMessage = `-- name: GetSessionMessage :one
+SELECT id, session_id, role, content, created_at, prompt_version, risk_level, risk_source, flagged_at, persona_id, quote_id, reply_status FROM messages
+WHERE id = $1 AND session_id = $2
+`
+
+type GetSessionMessageParams struct {
+	ID        pgtype.UUID `json:"id"`
+	SessionID pgtype.UUID `json:"session_id"`
+}
+
+func (q *Queries) GetSessionMessage(ctx context.Context, arg GetSessionMessageParams) (Message, error) {
+	row := q.db.QueryRow(ctx, getSessionMessage, arg.ID, arg.SessionID)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.Role,
+		&i.Content,
+		&i.CreatedAt,
+		&i.PromptVersion,
+		&i.RiskLevel,
+		&i.RiskSource,
+		&i.FlaggedAt,
+		&i.PersonaID,
+		&i.QuoteID,
+		&i.ReplyStatus,
 	)
 	return i, err
 }
 
 const getTodayActiveSession = `-- name: GetTodayActiveSession :one
-SELECT id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at FROM sessions
+SELECT id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id FROM sessions
 WHERE user_id = $1 
   AND status = 'active' 
   AND started_at::date = CURRENT_DATE
@@ -754,13 +1855,29 @@ func (q *Queries) GetTodayActiveSession(ctx context.Context, userID string) (Ses
 		&i.EndedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.MemoriesExtractedAt,
+		&i.RunningSummary,
+		&i.RunningSummaryUntil,
+		&i.Title,
+		&i.Summary,
+		&i.ClosingMessage,
+		&i.ClosingPromptVersion,
+		&i.DepthLevel,
+		&i.DepthProgress,
+		&i.TemplateID,
+		&i.TemplateStep,
+		&i.TemplateStepMessages,
+		&i.TemplateStepWords,
+		&i.TemplateCompletedAt,
+		&i.TemplateOutput,
+		&i.PersonaID,
+		&i.QuoteID,
 	)
 	return i, err
 }
 
 const getUserArtwork = `-- name: GetUserArtwork :one
-
-SELECT id, user_id, artwork_id, progress, status, unlocked_at, completed_at, created_at, updated_at FROM user_artworks
+SELECT id, user_id, artwork_id, progress, status, unlocked_at, completed_at, created_at, updated_at, artwork_version FROM user_artworks
 WHERE user_id = $1 AND artwork_id = $2
 `
 
@@ -769,7 +1886,6 @@ type GetUserArtworkParams struct {
 	ArtworkID pgtype.UUID `json:"artwork_id"`
 }
 
-// ==================== USER ARTWORKS ====================
 func (q *Queries) GetUserArtwork(ctx context.Context, arg GetUserArtworkParams) (UserArtwork, error) {
 	row := q.db.QueryRow(ctx, getUserArtwork, arg.UserID, arg.ArtworkID)
 	var i UserArtwork
@@ -783,6 +1899,7 @@ func (q *Queries) GetUserArtwork(ctx context.Context, arg GetUserArtworkParams)
 		&i.CompletedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ArtworkVersion,
 	)
 	return i, err
 }
@@ -805,6 +1922,54 @@ func (q *Queries) GetUserLevel(ctx context.Context, userID string) (GetUserLevel
 	return i, err
 }
 
+const getUserMemory = `-- name: GetUserMemory :one
+SELECT id, user_id, kind, content, importance, mentions, source_session_id, user_edited, last_seen_at, created_at, updated_at FROM user_memories
+WHERE id = $1 AND user_id = $2
+`
+
+type GetUserMemoryParams struct {
+	ID     pgtype.UUID `json:"id"`
+	UserID string      `json:"user_id"`
+}
+
+func (q *Queries) GetUserMemory(ctx context.Context, arg GetUserMemoryParams) (UserMemory, error) {
+	row := q.db.QueryRow(ctx, getUserMemory, arg.ID, arg.UserID)
+	var i UserMemory
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Kind,
+		&i.Content,
+		&i.Importance,
+		&i.Mentions,
+		&i.SourceSessionID,
+		&i.UserEdited,
+		&i.LastSeenAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getUserPreferences = `-- name: GetUserPreferences :one
+
+SELECT user_id, persona_id, created_at, updated_at FROM user_preferences
+WHERE user_id = $1
+`
+
+// ==================== USER PREFERENCES ====================
+func (q *Queries) GetUserPreferences(ctx context.Context, userID string) (UserPreference, error) {
+	row := q.db.QueryRow(ctx, getUserPreferences, userID)
+	var i UserPreference
+	err := row.Scan(
+		&i.UserID,
+		&i.PersonaID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const getUserStats = `-- name: GetUserStats :one
 
 SELECT user_id, golden_ink, marble, current_streak, longest_streak, last_active_date, created_at, updated_at, level, current_xp, total_xp FROM user_stats WHERE user_id = $1
@@ -852,6 +2017,34 @@ func (q *Queries) GetUserSubscription(ctx context.Context, userID string) (UserS
 	return i, err
 }
 
+const getUserTokenUsage = `-- name: GetUserTokenUsage :one
+SELECT
+    COALESCE((SELECT us.plan FROM user_subscriptions us WHERE us.user_id = $1), 'free')::text AS plan,
+    COALESCE(SUM(u.prompt_tokens + u.completion_tokens) FILTER (WHERE u.created_at >= $2::timestamptz), 0)::bigint AS daily_tokens,
+    COALESCE(SUM(u.prompt_tokens + u.completion_tokens), 0)::bigint AS monthly_tokens
+FROM ai_usage u
+WHERE u.user_id = $1 AND u.created_at >= $3::timestamptz
+`
+
+type GetUserTokenUsageParams struct {
+	UserID     string             `json:"user_id"`
+	DayStart   pgtype.Timestamptz `json:"day_start"`
+	MonthStart pgtype.Timestamptz `json:"month_start"`
+}
+
+type GetUserTokenUsageRow struct {
+	Plan          string `json:"plan"`
+	DailyTokens   int64  `json:"daily_tokens"`
+	MonthlyTokens int64  `json:"monthly_tokens"`
+}
+
+func (q *Queries) GetUserTokenUsage(ctx context.Context, arg GetUserTokenUsageParams) (GetUserTokenUsageRow, error) {
+	row := q.db.QueryRow(ctx, getUserTokenUsage, arg.UserID, arg.DayStart, arg.MonthStart)
+	var i GetUserTokenUsageRow
+	err := row.Scan(&i.Plan, &i.DailyTokens, &i.MonthlyTokens)
+	return i, err
+}
+
 const getWeekMessages = `-- name: GetWeekMessages :many
 SELECT m.content, m.created_at, s.started_at
 FROM messages m
@@ -896,7 +2089,7 @@ func (q *Queries) GetWeekMessages(ctx context.Context, arg GetWeekMessagesParams
 }
 
 const getWeeklySummary = `-- name: GetWeeklySummary :one
-SELECT id, user_id, week_start, week_end, summary, session_count, message_count, emotions, created_at FROM weekly_summaries
+SELECT id, user_id, week_start, week_end, summary, session_count, message_count, emotions, created_at, prompt_version FROM weekly_summaries
 WHERE user_id = $1 AND week_start = $2
 `
 
@@ -918,6 +2111,7 @@ func (q *Queries) GetWeeklySummary(ctx context.Context, arg GetWeeklySummaryPara
 		&i.MessageCount,
 		&i.Emotions,
 		&i.CreatedAt,
+		&i.PromptVersion,
 	)
 	return i, err
 }
@@ -928,51 +2122,434 @@ SET
     total_messages = total_messages + 1,
     updated_at = NOW()
 WHERE id = $1
-RETURNING id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at
+RETURNING id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id
+`
+
+func (q *Queries) IncrementSessionMessages(ctx context.Context, id pgtype.UUID) (Session, error) {
+	row := q.db.QueryRow(ctx, incrementSessionMessages, id)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.TotalMessages,
+		&i.GoldenInkEarned,
+		&i.StartedAt,
+		&i.EndedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.MemoriesExtractedAt,
+		&i.RunningSummary,
+		&i.RunningSummaryUntil,
+		&i.Title,
+		&i.Summary,
+		&i.ClosingMessage,
+		&i.ClosingPromptVersion,
+		&i.DepthLevel,
+		&i.DepthProgress,
+		&i.TemplateID,
+		&i.TemplateStep,
+		&i.TemplateStepMessages,
+		&i.TemplateStepWords,
+		&i.TemplateCompletedAt,
+		&i.TemplateOutput,
+		&i.PersonaID,
+		&i.QuoteID,
+	)
+	return i, err
+}
+
+const listArtworkVersions = `-- name: ListArtworkVersions :many
+SELECT artwork_id, version, display_name, description, image_url, unlock_cost, reveal_cost, created_at FROM artwork_versions
+WHERE artwork_id = $1
+ORDER BY version DESC
+`
+
+func (q *Queries) ListArtworkVersions(ctx context.Context, artworkID pgtype.UUID) ([]ArtworkVersion, error) {
+	rows, err := q.db.Query(ctx, listArtworkVersions, artworkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ArtworkVersion{}
+	for rows.Next() {
+		var i ArtworkVersion
+		if err := rows.Scan(
+			&i.ArtworkID,
+			&i.Version,
+			&i.DisplayName,
+			&i.Description,
+			&i.ImageUrl,
+			&i.UnlockCost,
+			&i.RevealCost,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listArtworks = `-- name: ListArtworks :many
+
+SELECT id, name, display_name, description, image_url, unlock_cost, reveal_cost, created_at, sort_order, available_from, available_until, retired_at, version, updated_at FROM artworks
+ORDER BY sort_order ASC, unlock_cost ASC, display_name ASC
+`
+
+// ==================== ARTWORKS ====================
+// The whole catalog, including retired and scheduled artworks
+func (q *Queries) ListArtworks(ctx context.Context) ([]Artwork, error) {
+	rows, err := q.db.Query(ctx, listArtworks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Artwork{}
+	for rows.Next() {
+		var i Artwork
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.DisplayName,
+			&i.Description,
+			&i.ImageUrl,
+			&i.UnlockCost,
+			&i.RevealCost,
+			&i.CreatedAt,
+			&i.SortOrder,
+			&i.AvailableFrom,
+			&i.AvailableUntil,
+			&i.RetiredAt,
+			&i.Version,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFlaggedMessages = `-- name: ListFlaggedMessages :many
+SELECT m.id, m.session_id, m.role, m.content, m.created_at, m.prompt_version, m.risk_level, m.risk_source, m.flagged_at, m.persona_id, m.quote_id, m.reply_status, s.user_id
+FROM messages m
+JOIN sessions s ON s.id = m.session_id
+WHERE m.flagged_at IS NOT NULL
+ORDER BY m.flagged_at DESC
+LIMIT $1
+`
+
+type ListFlaggedMessagesRow struct {
+	ID            pgtype.UUID        `json:"id"`
+	SessionID     pgtype.UUID        `json:"session_id"`
+	Role          string             `json:"role"`
+	Content       string             `json:"content"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	PromptVersion pgtype.Text        `json:"prompt_version"`
+	RiskLevel     pgtype.Text        `json:"risk_level"`
+	RiskSource    pgtype.Text        `json:"risk_source"`
+	FlaggedAt     pgtype.Timestamptz `json:"flagged_at"`
+	PersonaID     pgtype.Text        `json:"persona_id"`
+	QuoteID       pgtype.UUID        `json:"quote_id"`
+	ReplyStatus   pgtype.Text        `json:"reply_status"`
+	UserID        string             `json:"user_id"`
+}
+
+func (q *Queries) ListFlaggedMessages(ctx context.Context, limit int32) ([]ListFlaggedMessagesRow, error) {
+	rows, err := q.db.Query(ctx, listFlaggedMessages, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListFlaggedMessagesRow{}
+	for rows.Next() {
+		var i ListFlaggedMessagesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Role,
+			&i.Content,
+			&i.CreatedAt,
+			&i.PromptVersion,
+			&i.RiskLevel,
+			&i.RiskSource,
+			&i.FlaggedAt,
+			&i.PersonaID,
+			&i.QuoteID,
+			&i.ReplyStatus,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listGallery = `-- name: ListGallery :many
+
+SELECT
+    a.id,
+    a.name,
+    av.version,
+    av.display_name,
+    av.description,
+    av.image_url,
+    av.unlock_cost,
+    av.reveal_cost,
+    a.sort_order,
+    a.available_until,
+    COALESCE(ua.status, 'locked')::text AS status,
+    COALESCE(ua.progress, 0)::integer AS progress,
+    ua.unlocked_at,
+    ua.completed_at
+FROM artworks a
+LEFT JOIN user_artworks ua ON ua.artwork_id = a.id AND ua.user_id = $1
+JOIN artwork_versions av ON av.artwork_id = a.id AND av.version = COALESCE(ua.artwork_version, a.version)
+WHERE ua.id IS NOT NULL OR (
+    a.retired_at IS NULL
+    AND (a.available_from IS NULL OR a.available_from <= NOW())
+    AND (a.available_until IS NULL OR a.available_until > NOW())
+)
+ORDER BY a.sort_order ASC, av.unlock_cost ASC, av.display_name ASC
+`
+
+type ListGalleryRow struct {
+	ID             pgtype.UUID        `json:"id"`
+	Name           string             `json:"name"`
+	Version        int32              `json:"version"`
+	DisplayName    string             `json:"display_name"`
+	Description    string             `json:"description"`
+	ImageUrl       string             `json:"image_url"`
+	UnlockCost     int32              `json:"unlock_cost"`
+	RevealCost     int32              `json:"reveal_cost"`
+	SortOrder      int32              `json:"sort_order"`
+	AvailableUntil pgtype.Timestamptz `json:"available_until"`
+	Status         string             `json:"status"`
+	Progress       int32              `json:"progress"`
+	UnlockedAt     pgtype.Timestamptz `json:"unlocked_at"`
+	CompletedAt    pgtype.Timestamptz `json:"completed_at"`
+}
+
+// ==================== USER ARTWORKS ====================
+// The available catalog with the user's state of each artwork. Artworks
+// the user unlocked show the version they unlocked, even once retired or
+// out of season; the rest are 'locked' at 0%.
+func (q *Queries) ListGallery(ctx context.Context, userID string) ([]ListGalleryRow, error) {
+	rows, err := q.db.Query(ctx, listGallery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListGalleryRow{}
+	for rows.Next() {
+		var i ListGalleryRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Version,
+			&i.DisplayName,
+			&i.Description,
+			&i.ImageUrl,
+			&i.UnlockCost,
+			&i.RevealCost,
+			&i.SortOrder,
+			&i.AvailableUntil,
+			&i.Status,
+			&i.Progress,
+			&i.UnlockedAt,
+			&i.CompletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLedgerEntries = `-- name: ListLedgerEntries :many
+SELECT
+    e.id,
+    e.currency,
+    e.delta,
+    e.reason,
+    e.message_id,
+    e.session_id,
+    e.created_at,
+    e.balance_after
+FROM (
+    SELECT
+        l.id, l.user_id, l.currency, l.delta, l.reason, l.counterparty, l.message_id, l.session_id, l.idempotency_key, l.created_at,
+        (SUM(l.delta) OVER (PARTITION BY l.currency ORDER BY l.created_at, l.id))::integer AS balance_after
+    FROM currency_ledger l
+    WHERE l.user_id = $1
+) e
+ORDER BY e.created_at DESC, e.id DESC
+LIMIT $2 OFFSET $3
+`
+
+type ListLedgerEntriesParams struct {
+	UserID string `json:"user_id"`
+	Limit  int32  `json:"limit"`
+	Offset int32  `json:"offset"`
+}
+
+type ListLedgerEntriesRow struct {
+	ID           pgtype.UUID        `json:"id"`
+	Currency     string             `json:"currency"`
+	Delta        int32              `json:"delta"`
+	Reason       string             `json:"reason"`
+	MessageID    pgtype.UUID        `json:"message_id"`
+	SessionID    pgtype.UUID        `json:"session_id"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	BalanceAfter int32              `json:"balance_after"`
+}
+
+// A user's entries newest first, each with its currency's balance after it
+func (q *Queries) ListLedgerEntries(ctx context.Context, arg ListLedgerEntriesParams) ([]ListLedgerEntriesRow, error) {
+	rows, err := q.db.Query(ctx, listLedgerEntries, arg.UserID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListLedgerEntriesRow{}
+	for rows.Next() {
+		var i ListLedgerEntriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Currency,
+			&i.Delta,
+			&i.Reason,
+			&i.MessageID,
+			&i.SessionID,
+			&i.CreatedAt,
+			&i.BalanceAfter,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLedgerMismatches = `-- name: ListLedgerMismatches :many
+SELECT
+    s.user_id,
+    s.golden_ink,
+    s.marble,
+    s.total_xp,
+    COALESCE(l.golden_ink, 0)::integer AS ledger_golden_ink,
+    COALESCE(l.marble, 0)::integer AS ledger_marble,
+    COALESCE(l.xp, 0)::integer AS ledger_xp
+FROM user_stats s
+LEFT JOIN (
+    SELECT
+        user_id,
+        SUM(delta) FILTER (WHERE currency = 'golden_ink') AS golden_ink,
+        SUM(delta) FILTER (WHERE currency = 'marble') AS marble,
+        SUM(delta) FILTER (WHERE currency = 'xp') AS xp
+    FROM currency_ledger
+    GROUP BY user_id
+) l ON l.user_id = s.user_id
+WHERE s.golden_ink <> COALESCE(l.golden_ink, 0)
+    OR s.marble <> COALESCE(l.marble, 0)
+    OR s.total_xp <> COALESCE(l.xp, 0)
+ORDER BY s.user_id
+LIMIT $1
 `
 
-func (q *Queries) IncrementSessionMessages(ctx context.Context, id pgtype.UUID) (Session, error) {
-	row := q.db.QueryRow(ctx, incrementSessionMessages, id)
-	var i Session
-	err := row.Scan(
-		&i.ID,
-		&i.UserID,
-		&i.Status,
-		&i.TotalMessages,
-		&i.GoldenInkEarned,
-		&i.StartedAt,
-		&i.EndedAt,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-	)
-	return i, err
+type ListLedgerMismatchesRow struct {
+	UserID          string `json:"user_id"`
+	GoldenInk       int32  `json:"golden_ink"`
+	Marble          int32  `json:"marble"`
+	TotalXp         int32  `json:"total_xp"`
+	LedgerGoldenInk int32  `json:"ledger_golden_ink"`
+	LedgerMarble    int32  `json:"ledger_marble"`
+	LedgerXp        int32  `json:"ledger_xp"`
 }
 
-const listArtworks = `-- name: ListArtworks :many
+// Users whose balances differ from the sum of their ledger entries
+func (q *Queries) ListLedgerMismatches(ctx context.Context, limit int32) ([]ListLedgerMismatchesRow, error) {
+	rows, err := q.db.Query(ctx, listLedgerMismatches, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListLedgerMismatchesRow{}
+	for rows.Next() {
+		var i ListLedgerMismatchesRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.GoldenInk,
+			&i.Marble,
+			&i.TotalXp,
+			&i.LedgerGoldenInk,
+			&i.LedgerMarble,
+			&i.LedgerXp,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
 
-SELECT id, name, display_name, description, image_url, unlock_cost, reveal_cost, created_at FROM artworks
-ORDER BY unlock_cost ASC
+const listMessagesAfter = `-- name: ListMessagesAfter :many
+SELECT id, session_id, role, content, created_at, prompt_version, risk_level, risk_source, flagged_at, persona_id, quote_id, reply_status FROM messages
+WHERE session_id = $1
+  AND ($2::timestamptz IS NULL OR created_at > $2::timestamptz)
+ORDER BY created_at ASC
+LIMIT $3
 `
 
-// ==================== ARTWORKS ====================
-func (q *Queries) ListArtworks(ctx context.Context) ([]Artwork, error) {
-	rows, err := q.db.Query(ctx, listArtworks)
+type ListMessagesAfterParams struct {
+	SessionID pgtype.UUID        `json:"session_id"`
+	After     pgtype.Timestamptz `json:"after"`
+	RowLimit  int32              `json:"row_limit"`
+}
+
+// Oldest messages created after a point in time, or from the start when after is NULL
+func (q *Queries) ListMessagesAfter(ctx context.Context, arg ListMessagesAfterParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, listMessagesAfter, arg.SessionID, arg.After, arg.RowLimit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Artwork{}
+	items := []Message{}
 	for rows.Next() {
-		var i Artwork
+		var i Message
 		if err := rows.Scan(
 			&i.ID,
-			&i.Name,
-			&i.DisplayName,
-			&i.Description,
-			&i.ImageUrl,
-			&i.UnlockCost,
-			&i.RevealCost,
+			&i.SessionID,
+			&i.Role,
+			&i.Content,
 			&i.CreatedAt,
+			&i.PromptVersion,
+			&i.RiskLevel,
+			&i.RiskSource,
+			&i.FlaggedAt,
+			&i.PersonaID,
+			&i.QuoteID,
+			&i.ReplyStatus,
 		); err != nil {
 			return nil, err
 		}
@@ -985,7 +2562,7 @@ func (q *Queries) ListArtworks(ctx context.Context) ([]Artwork, error) {
 }
 
 const listMessagesBySession = `-- name: ListMessagesBySession :many
-SELECT id, session_id, role, content, created_at FROM messages
+SELECT id, session_id, role, content, created_at, prompt_version, risk_level, risk_source, flagged_at, persona_id, quote_id, reply_status FROM messages
 WHERE session_id = $1
 ORDER BY created_at ASC
 `
@@ -1005,6 +2582,13 @@ func (q *Queries) ListMessagesBySession(ctx context.Context, sessionID pgtype.UU
 			&i.Role,
 			&i.Content,
 			&i.CreatedAt,
+			&i.PromptVersion,
+			&i.RiskLevel,
+			&i.RiskSource,
+			&i.FlaggedAt,
+			&i.PersonaID,
+			&i.QuoteID,
+			&i.ReplyStatus,
 		); err != nil {
 			return nil, err
 		}
@@ -1054,8 +2638,183 @@ func (q *Queries) ListPendingUpgrades(ctx context.Context) ([]PendingUpgrade, er
 	return items, nil
 }
 
+const listQuoteCollections = `-- name: ListQuoteCollections :many
+
+SELECT
+    c.id, c.name, c.display_name, c.description, c.unlock_currency, c.unlock_cost, c.created_at,
+    COUNT(q.id)::integer AS quote_count,
+    (c.unlock_cost = 0 OR u.user_id IS NOT NULL)::boolean AS unlocked
+FROM quote_collections c
+LEFT JOIN quotes q ON q.collection_id = c.id
+LEFT JOIN user_quote_collections u ON u.collection_id = c.id AND u.user_id = $1
+GROUP BY c.id, u.user_id
+ORDER BY c.unlock_cost, c.display_name
+`
+
+type ListQuoteCollectionsRow struct {
+	ID             pgtype.UUID        `json:"id"`
+	Name           string             `json:"name"`
+	DisplayName    string             `json:"display_name"`
+	Description    string             `json:"description"`
+	UnlockCurrency string             `json:"unlock_currency"`
+	UnlockCost     int32              `json:"unlock_cost"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	QuoteCount     int32              `json:"quote_count"`
+	Unlocked       bool               `json:"unlocked"`
+}
+
+// ==================== QUOTES ====================
+// Free collections count as unlocked for everyone
+func (q *Queries) ListQuoteCollections(ctx context.Context, userID string) ([]ListQuoteCollectionsRow, error) {
+	rows, err := q.db.Query(ctx, listQuoteCollections, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListQuoteCollectionsRow{}
+	for rows.Next() {
+		var i ListQuoteCollectionsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.DisplayName,
+			&i.Description,
+			&i.UnlockCurrency,
+			&i.UnlockCost,
+			&i.CreatedAt,
+			&i.QuoteCount,
+			&i.Unlocked,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listQuotesByCollection = `-- name: ListQuotesByCollection :many
+SELECT id, collection_id, text, author, source, language, emotions, created_at FROM quotes
+WHERE collection_id = $1
+ORDER BY author, created_at
+`
+
+func (q *Queries) ListQuotesByCollection(ctx context.Context, collectionID pgtype.UUID) ([]Quote, error) {
+	rows, err := q.db.Query(ctx, listQuotesByCollection, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Quote{}
+	for rows.Next() {
+		var i Quote
+		if err := rows.Scan(
+			&i.ID,
+			&i.CollectionID,
+			&i.Text,
+			&i.Author,
+			&i.Source,
+			&i.Language,
+			&i.Emotions,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRecentOpenings = `-- name: ListRecentOpenings :many
+SELECT o.content FROM (
+    SELECT DISTINCT ON (m.session_id) m.session_id, m.content, m.created_at
+    FROM messages m
+    JOIN sessions s ON s.id = m.session_id
+    WHERE s.user_id = $1
+      AND s.started_at > NOW() - INTERVAL '30 days'
+      AND m.role = 'assistant'
+    ORDER BY m.session_id, m.created_at ASC
+) o
+ORDER BY o.created_at DESC
+LIMIT $2
+`
+
+type ListRecentOpeningsParams struct {
+	UserID string `json:"user_id"`
+	Limit  int32  `json:"limit"`
+}
+
+// First assistant message of each of the user's sessions from the last 30 days, newest first
+func (q *Queries) ListRecentOpenings(ctx context.Context, arg ListRecentOpeningsParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, listRecentOpenings, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			return nil, err
+		}
+		items = append(items, content)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSessionTopicHistory = `-- name: ListSessionTopicHistory :many
+SELECT
+    m.id,
+    COALESCE(array_agg(t.topic) FILTER (WHERE t.topic IS NOT NULL), '{}')::text[] AS topics
+FROM messages m
+LEFT JOIN message_topics t ON t.message_id = m.id
+WHERE m.session_id = $1 AND m.role = 'user'
+GROUP BY m.id, m.created_at
+ORDER BY m.created_at DESC
+LIMIT $2
+`
+
+type ListSessionTopicHistoryParams struct {
+	SessionID pgtype.UUID `json:"session_id"`
+	Limit     int32       `json:"limit"`
+}
+
+type ListSessionTopicHistoryRow struct {
+	ID     pgtype.UUID `json:"id"`
+	Topics []string    `json:"topics"`
+}
+
+// Topics of the session's latest user messages, newest first
+func (q *Queries) ListSessionTopicHistory(ctx context.Context, arg ListSessionTopicHistoryParams) ([]ListSessionTopicHistoryRow, error) {
+	rows, err := q.db.Query(ctx, listSessionTopicHistory, arg.SessionID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListSessionTopicHistoryRow{}
+	for rows.Next() {
+		var i ListSessionTopicHistoryRow
+		if err := rows.Scan(&i.ID, &i.Topics); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listSessionsByUser = `-- name: ListSessionsByUser :many
-SELECT id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at FROM sessions
+SELECT id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id FROM sessions
 WHERE user_id = $1
 ORDER BY started_at DESC
 LIMIT $2 OFFSET $3
@@ -1086,6 +2845,23 @@ func (q *Queries) ListSessionsByUser(ctx context.Context, arg ListSessionsByUser
 			&i.EndedAt,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.MemoriesExtractedAt,
+			&i.RunningSummary,
+			&i.RunningSummaryUntil,
+			&i.Title,
+			&i.Summary,
+			&i.ClosingMessage,
+			&i.ClosingPromptVersion,
+			&i.DepthLevel,
+			&i.DepthProgress,
+			&i.TemplateID,
+			&i.TemplateStep,
+			&i.TemplateStepMessages,
+			&i.TemplateStepWords,
+			&i.TemplateCompletedAt,
+			&i.TemplateOutput,
+			&i.PersonaID,
+			&i.QuoteID,
 		); err != nil {
 			return nil, err
 		}
@@ -1097,9 +2873,46 @@ func (q *Queries) ListSessionsByUser(ctx context.Context, arg ListSessionsByUser
 	return items, nil
 }
 
+const listSessionsPendingMemoryExtraction = `-- name: ListSessionsPendingMemoryExtraction :many
+SELECT s.id FROM sessions s
+WHERE s.user_id = $1
+  AND s.memories_extracted_at IS NULL
+  AND (s.status <> 'active' OR s.started_at::date < CURRENT_DATE)
+  AND s.started_at > NOW() - INTERVAL '14 days'
+  AND EXISTS (SELECT 1 FROM messages m WHERE m.session_id = s.id AND m.role = 'user')
+ORDER BY s.started_at DESC
+LIMIT $2
+`
+
+type ListSessionsPendingMemoryExtractionParams struct {
+	UserID string `json:"user_id"`
+	Limit  int32  `json:"limit"`
+}
+
+// Ended or past sessions from the last two weeks with at least one user message
+func (q *Queries) ListSessionsPendingMemoryExtraction(ctx context.Context, arg ListSessionsPendingMemoryExtractionParams) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, listSessionsPendingMemoryExtraction, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []pgtype.UUID{}
+	for rows.Next() {
+		var id pgtype.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listSessionsWithPreview = `-- name: ListSessionsWithPreview :many
 SELECT 
-    s.id, s.user_id, s.status, s.total_messages, s.golden_ink_earned, s.started_at, s.ended_at, s.created_at, s.updated_at,
+    s.id, s.user_id, s.status, s.total_messages, s.golden_ink_earned, s.started_at, s.ended_at, s.created_at, s.updated_at, s.memories_extracted_at, s.running_summary, s.running_summary_until, s.title, s.summary, s.closing_message, s.closing_prompt_version, s.depth_level, s.depth_progress, s.template_id, s.template_step, s.template_step_messages, s.template_step_words, s.template_completed_at, s.template_output, s.persona_id, s.quote_id,
     COALESCE(
         (SELECT LEFT(m.content, 150)
          FROM messages m 
@@ -1121,16 +2934,33 @@ type ListSessionsWithPreviewParams struct {
 }
 
 type ListSessionsWithPreviewRow struct {
-	ID               pgtype.UUID        `json:"id"`
-	UserID           string             `json:"user_id"`
-	Status           string             `json:"status"`
-	TotalMessages    int32              `json:"total_messages"`
-	GoldenInkEarned  int32              `json:"golden_ink_earned"`
-	StartedAt        pgtype.Timestamptz `json:"started_at"`
-	EndedAt          pgtype.Timestamptz `json:"ended_at"`
-	CreatedAt        pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt        pgtype.Timestamptz `json:"updated_at"`
-	FirstUserMessage interface{}        `json:"first_user_message"`
+	ID                   pgtype.UUID        `json:"id"`
+	UserID               string             `json:"user_id"`
+	Status               string             `json:"status"`
+	TotalMessages        int32              `json:"total_messages"`
+	GoldenInkEarned      int32              `json:"golden_ink_earned"`
+	StartedAt            pgtype.Timestamptz `json:"started_at"`
+	EndedAt              pgtype.Timestamptz `json:"ended_at"`
+	CreatedAt            pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt            pgtype.Timestamptz `json:"updated_at"`
+	MemoriesExtractedAt  pgtype.Timestamptz `json:"memories_extracted_at"`
+	RunningSummary       string             `json:"running_summary"`
+	RunningSummaryUntil  pgtype.Timestamptz `json:"running_summary_until"`
+	Title                pgtype.Text        `json:"title"`
+	Summary              pgtype.Text        `json:"summary"`
+	ClosingMessage       pgtype.Text        `json:"closing_message"`
+	ClosingPromptVersion pgtype.Text        `json:"closing_prompt_version"`
+	DepthLevel           int16              `json:"depth_level"`
+	DepthProgress        float32            `json:"depth_progress"`
+	TemplateID           pgtype.Text        `json:"template_id"`
+	TemplateStep         int16              `json:"template_step"`
+	TemplateStepMessages int16              `json:"template_step_messages"`
+	TemplateStepWords    int32              `json:"template_step_words"`
+	TemplateCompletedAt  pgtype.Timestamptz `json:"template_completed_at"`
+	TemplateOutput       json.RawMessage    `json:"template_output"`
+	PersonaID            pgtype.Text        `json:"persona_id"`
+	QuoteID              pgtype.UUID        `json:"quote_id"`
+	FirstUserMessage     interface{}        `json:"first_user_message"`
 }
 
 func (q *Queries) ListSessionsWithPreview(ctx context.Context, arg ListSessionsWithPreviewParams) ([]ListSessionsWithPreviewRow, error) {
@@ -1152,6 +2982,23 @@ func (q *Queries) ListSessionsWithPreview(ctx context.Context, arg ListSessionsW
 			&i.EndedAt,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.MemoriesExtractedAt,
+			&i.RunningSummary,
+			&i.RunningSummaryUntil,
+			&i.Title,
+			&i.Summary,
+			&i.ClosingMessage,
+			&i.ClosingPromptVersion,
+			&i.DepthLevel,
+			&i.DepthProgress,
+			&i.TemplateID,
+			&i.TemplateStep,
+			&i.TemplateStepMessages,
+			&i.TemplateStepWords,
+			&i.TemplateCompletedAt,
+			&i.TemplateOutput,
+			&i.PersonaID,
+			&i.QuoteID,
 			&i.FirstUserMessage,
 		); err != nil {
 			return nil, err
@@ -1166,35 +3013,37 @@ func (q *Queries) ListSessionsWithPreview(ctx context.Context, arg ListSessionsW
 
 const listUserArtworks = `-- name: ListUserArtworks :many
 SELECT 
-    ua.id, ua.user_id, ua.artwork_id, ua.progress, ua.status, ua.unlocked_at, ua.completed_at, ua.created_at, ua.updated_at,
+    ua.id, ua.user_id, ua.artwork_id, ua.progress, ua.status, ua.unlocked_at, ua.completed_at, ua.created_at, ua.updated_at, ua.artwork_version,
     a.name,
-    a.display_name,
-    a.description,
-    a.image_url,
-    a.unlock_cost,
-    a.reveal_cost
+    av.display_name,
+    av.description,
+    av.image_url,
+    av.unlock_cost,
+    av.reveal_cost
 FROM user_artworks ua
 JOIN artworks a ON ua.artwork_id = a.id
+JOIN artwork_versions av ON av.artwork_id = ua.artwork_id AND av.version = ua.artwork_version
 WHERE ua.user_id = $1
 ORDER BY ua.created_at DESC
 `
 
 type ListUserArtworksRow struct {
-	ID          pgtype.UUID        `json:"id"`
-	UserID      string             `json:"user_id"`
-	ArtworkID   pgtype.UUID        `json:"artwork_id"`
-	Progress    int32              `json:"progress"`
-	Status      string             `json:"status"`
-	UnlockedAt  pgtype.Timestamptz `json:"unlocked_at"`
-	CompletedAt pgtype.Timestamptz `json:"completed_at"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
-	Name        string             `json:"name"`
-	DisplayName string             `json:"display_name"`
-	Description string             `json:"description"`
-	ImageUrl    string             `json:"image_url"`
-	UnlockCost  int32              `json:"unlock_cost"`
-	RevealCost  int32              `json:"reveal_cost"`
+	ID             pgtype.UUID        `json:"id"`
+	UserID         string             `json:"user_id"`
+	ArtworkID      pgtype.UUID        `json:"artwork_id"`
+	Progress       int32              `json:"progress"`
+	Status         string             `json:"status"`
+	UnlockedAt     pgtype.Timestamptz `json:"unlocked_at"`
+	CompletedAt    pgtype.Timestamptz `json:"completed_at"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+	ArtworkVersion int32              `json:"artwork_version"`
+	Name           string             `json:"name"`
+	DisplayName    string             `json:"display_name"`
+	Description    string             `json:"description"`
+	ImageUrl       string             `json:"image_url"`
+	UnlockCost     int32              `json:"unlock_cost"`
+	RevealCost     int32              `json:"reveal_cost"`
 }
 
 func (q *Queries) ListUserArtworks(ctx context.Context, userID string) ([]ListUserArtworksRow, error) {
@@ -1216,6 +3065,7 @@ func (q *Queries) ListUserArtworks(ctx context.Context, userID string) ([]ListUs
 			&i.CompletedAt,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.ArtworkVersion,
 			&i.Name,
 			&i.DisplayName,
 			&i.Description,
@@ -1233,8 +3083,86 @@ func (q *Queries) ListUserArtworks(ctx context.Context, userID string) ([]ListUs
 	return items, nil
 }
 
+const listUserExperimentAssignments = `-- name: ListUserExperimentAssignments :many
+
+SELECT user_id, experiment, variant, assigned_at FROM experiment_assignments
+WHERE user_id = $1
+`
+
+// ==================== EXPERIMENTS ====================
+func (q *Queries) ListUserExperimentAssignments(ctx context.Context, userID string) ([]ExperimentAssignment, error) {
+	rows, err := q.db.Query(ctx, listUserExperimentAssignments, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ExperimentAssignment{}
+	for rows.Next() {
+		var i ExperimentAssignment
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Experiment,
+			&i.Variant,
+			&i.AssignedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserMemories = `-- name: ListUserMemories :many
+
+SELECT id, user_id, kind, content, importance, mentions, source_session_id, user_edited, last_seen_at, created_at, updated_at FROM user_memories
+WHERE user_id = $1
+ORDER BY importance DESC, last_seen_at DESC
+LIMIT $2
+`
+
+type ListUserMemoriesParams struct {
+	UserID string `json:"user_id"`
+	Limit  int32  `json:"limit"`
+}
+
+// ==================== MEMORIES ====================
+func (q *Queries) ListUserMemories(ctx context.Context, arg ListUserMemoriesParams) ([]UserMemory, error) {
+	rows, err := q.db.Query(ctx, listUserMemories, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []UserMemory{}
+	for rows.Next() {
+		var i UserMemory
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Kind,
+			&i.Content,
+			&i.Importance,
+			&i.Mentions,
+			&i.SourceSessionID,
+			&i.UserEdited,
+			&i.LastSeenAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listWeeklySummaries = `-- name: ListWeeklySummaries :many
-SELECT id, user_id, week_start, week_end, summary, session_count, message_count, emotions, created_at FROM weekly_summaries
+SELECT id, user_id, week_start, week_end, summary, session_count, message_count, emotions, created_at, prompt_version FROM weekly_summaries
 WHERE user_id = $1
 ORDER BY week_start DESC
 LIMIT $2 OFFSET $3
@@ -1265,6 +3193,7 @@ func (q *Queries) ListWeeklySummaries(ctx context.Context, arg ListWeeklySummari
 			&i.MessageCount,
 			&i.Emotions,
 			&i.CreatedAt,
+			&i.PromptVersion,
 		); err != nil {
 			return nil, err
 		}
@@ -1273,7 +3202,120 @@ func (q *Queries) ListWeeklySummaries(ctx context.Context, arg ListWeeklySummari
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return items, nil
+	return items, nil
+}
+
+const lockUserStats = `-- name: LockUserStats :one
+SELECT user_id, golden_ink, marble, current_streak, longest_streak, last_active_date, created_at, updated_at, level, current_xp, total_xp FROM user_stats
+WHERE user_id = $1
+FOR UPDATE
+`
+
+// Serializes a user's purchases for the rest of the transaction
+func (q *Queries) LockUserStats(ctx context.Context, userID string) (UserStat, error) {
+	row := q.db.QueryRow(ctx, lockUserStats, userID)
+	var i UserStat
+	err := row.Scan(
+		&i.UserID,
+		&i.GoldenInk,
+		&i.Marble,
+		&i.CurrentStreak,
+		&i.LongestStreak,
+		&i.LastActiveDate,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Level,
+		&i.CurrentXp,
+		&i.TotalXp,
+	)
+	return i, err
+}
+
+const markMessageReplied = `-- name: MarkMessageReplied :execrows
+UPDATE messages
+SET reply_status = 'replied'
+WHERE id = $1 AND reply_status IN ('pending', 'failed')
+`
+
+// Claims the reply to a message; no rows means another attempt already replied
+func (q *Queries) MarkMessageReplied(ctx context.Context, id pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, markMessageReplied, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const markMessageReplyFailed = `-- name: MarkMessageReplyFailed :exec
+UPDATE messages
+SET reply_status = 'failed'
+WHERE id = $1 AND reply_status = 'pending'
+`
+
+// Makes a message whose reply couldn't be saved retryable
+func (q *Queries) MarkMessageReplyFailed(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, markMessageReplyFailed, id)
+	return err
+}
+
+const matchQuote = `-- name: MatchQuote :one
+SELECT q.id, q.collection_id, q.text, q.author, q.source, q.language, q.emotions, q.created_at
+FROM quotes q
+JOIN quote_collections c ON c.id = q.collection_id
+LEFT JOIN user_quote_collections u ON u.collection_id = c.id AND u.user_id = $1
+WHERE q.emotions && $2::TEXT[]
+  AND (c.unlock_cost = 0 OR u.user_id IS NOT NULL)
+ORDER BY
+    (
+        EXISTS (
+            SELECT 1 FROM messages m
+            JOIN sessions s ON s.id = m.session_id
+            WHERE s.user_id = $1 AND m.quote_id = q.id
+              AND m.created_at > NOW() - INTERVAL '30 days'
+        ) OR EXISTS (
+            SELECT 1 FROM sessions s
+            WHERE s.user_id = $1 AND s.quote_id = q.id
+              AND s.updated_at > NOW() - INTERVAL '30 days'
+        )
+    ),
+    cardinality(ARRAY(SELECT unnest(q.emotions) INTERSECT SELECT unnest($2::TEXT[]))) DESC,
+    random()
+LIMIT 1
+`
+
+type MatchQuoteParams struct {
+	UserID   string   `json:"user_id"`
+	Emotions []string `json:"emotions"`
+}
+
+// A quote from the user's unlocked collections sharing the given emotions.
+// Quotes the user saw in the last 30 days go last, then the ones sharing the
+// most emotions go first.
+func (q *Queries) MatchQuote(ctx context.Context, arg MatchQuoteParams) (Quote, error) {
+	row := q.db.QueryRow(ctx, matchQuote, arg.UserID, arg.Emotions)
+	var i Quote
+	err := row.Scan(
+		&i.ID,
+		&i.CollectionID,
+		&i.Text,
+		&i.Author,
+		&i.Source,
+		&i.Language,
+		&i.Emotions,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const releaseSessionMemoryExtraction = `-- name: ReleaseSessionMemoryExtraction :exec
+UPDATE sessions
+SET memories_extracted_at = NULL
+WHERE id = $1
+`
+
+func (q *Queries) ReleaseSessionMemoryExtraction(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, releaseSessionMemoryExtraction, id)
+	return err
 }
 
 const resolvePendingUpgrade = `-- name: ResolvePendingUpgrade :one
@@ -1307,6 +3349,189 @@ func (q *Queries) ResolvePendingUpgrade(ctx context.Context, arg ResolvePendingU
 	return i, err
 }
 
+const sessionHasQuotedMessage = `-- name: SessionHasQuotedMessage :one
+SELECT EXISTS (
+    SELECT 1 FROM messages
+    WHERE session_id = $1 AND quote_id IS NOT NULL
+)::boolean AS quoted
+`
+
+func (q *Queries) SessionHasQuotedMessage(ctx context.Context, sessionID pgtype.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, sessionHasQuotedMessage, sessionID)
+	var quoted bool
+	err := row.Scan(&quoted)
+	return quoted, err
+}
+
+const setSessionClosing = `-- name: SetSessionClosing :one
+UPDATE sessions
+SET 
+    title = $2,
+    summary = $3,
+    closing_message = $4,
+    closing_prompt_version = $5,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id
+`
+
+type SetSessionClosingParams struct {
+	ID                   pgtype.UUID `json:"id"`
+	Title                pgtype.Text `json:"title"`
+	Summary              pgtype.Text `json:"summary"`
+	ClosingMessage       pgtype.Text `json:"closing_message"`
+	ClosingPromptVersion pgtype.Text `json:"closing_prompt_version"`
+}
+
+func (q *Queries) SetSessionClosing(ctx context.Context, arg SetSessionClosingParams) (Session, error) {
+	row := q.db.QueryRow(ctx, setSessionClosing,
+		arg.ID,
+		arg.Title,
+		arg.Summary,
+		arg.ClosingMessage,
+		arg.ClosingPromptVersion,
+	)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.TotalMessages,
+		&i.GoldenInkEarned,
+		&i.StartedAt,
+		&i.EndedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.MemoriesExtractedAt,
+		&i.RunningSummary,
+		&i.RunningSummaryUntil,
+		&i.Title,
+		&i.Summary,
+		&i.ClosingMessage,
+		&i.ClosingPromptVersion,
+		&i.DepthLevel,
+		&i.DepthProgress,
+		&i.TemplateID,
+		&i.TemplateStep,
+		&i.TemplateStepMessages,
+		&i.TemplateStepWords,
+		&i.TemplateCompletedAt,
+		&i.TemplateOutput,
+		&i.PersonaID,
+		&i.QuoteID,
+	)
+	return i, err
+}
+
+const setSessionPersona = `-- name: SetSessionPersona :one
+UPDATE sessions
+SET persona_id = $3, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id
+`
+
+type SetSessionPersonaParams struct {
+	ID        pgtype.UUID `json:"id"`
+	UserID    string      `json:"user_id"`
+	PersonaID pgtype.Text `json:"persona_id"`
+}
+
+func (q *Queries) SetSessionPersona(ctx context.Context, arg SetSessionPersonaParams) (Session, error) {
+	row := q.db.QueryRow(ctx, setSessionPersona, arg.ID, arg.UserID, arg.PersonaID)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.TotalMessages,
+		&i.GoldenInkEarned,
+		&i.StartedAt,
+		&i.EndedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.MemoriesExtractedAt,
+		&i.RunningSummary,
+		&i.RunningSummaryUntil,
+		&i.Title,
+		&i.Summary,
+		&i.ClosingMessage,
+		&i.ClosingPromptVersion,
+		&i.DepthLevel,
+		&i.DepthProgress,
+		&i.TemplateID,
+		&i.TemplateStep,
+		&i.TemplateStepMessages,
+		&i.TemplateStepWords,
+		&i.TemplateCompletedAt,
+		&i.TemplateOutput,
+		&i.PersonaID,
+		&i.QuoteID,
+	)
+	return i, err
+}
+
+const setSessionQuote = `-- name: SetSessionQuote :one
+UPDATE sessions
+SET quote_id = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id
+`
+
+type SetSessionQuoteParams struct {
+	ID      pgtype.UUID `json:"id"`
+	QuoteID pgtype.UUID `json:"quote_id"`
+}
+
+func (q *Queries) SetSessionQuote(ctx context.Context, arg SetSessionQuoteParams) (Session, error) {
+	row := q.db.QueryRow(ctx, setSessionQuote, arg.ID, arg.QuoteID)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.TotalMessages,
+		&i.GoldenInkEarned,
+		&i.StartedAt,
+		&i.EndedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.MemoriesExtractedAt,
+		&i.RunningSummary,
+		&i.RunningSummaryUntil,
+		&i.Title,
+		&i.Summary,
+		&i.ClosingMessage,
+		&i.ClosingPromptVersion,
+		&i.DepthLevel,
+		&i.DepthProgress,
+		&i.TemplateID,
+		&i.TemplateStep,
+		&i.TemplateStepMessages,
+		&i.TemplateStepWords,
+		&i.TemplateCompletedAt,
+		&i.TemplateOutput,
+		&i.PersonaID,
+		&i.QuoteID,
+	)
+	return i, err
+}
+
+const setSessionTemplateOutput = `-- name: SetSessionTemplateOutput :exec
+UPDATE sessions
+SET template_output = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetSessionTemplateOutputParams struct {
+	ID             pgtype.UUID     `json:"id"`
+	TemplateOutput json.RawMessage `json:"template_output"`
+}
+
+func (q *Queries) SetSessionTemplateOutput(ctx context.Context, arg SetSessionTemplateOutputParams) error {
+	_, err := q.db.Exec(ctx, setSessionTemplateOutput, arg.ID, arg.TemplateOutput)
+	return err
+}
+
 const spendGoldenInk = `-- name: SpendGoldenInk :one
 UPDATE user_stats
 SET golden_ink = golden_ink - $2, updated_at = NOW()
@@ -1369,19 +3594,67 @@ func (q *Queries) SpendMarble(ctx context.Context, arg SpendMarbleParams) (UserS
 	return i, err
 }
 
+const touchUserMemory = `-- name: TouchUserMemory :one
+UPDATE user_memories
+SET
+    content = CASE WHEN user_edited THEN content ELSE $1 END,
+    importance = GREATEST(importance, $2),
+    mentions = mentions + 1,
+    source_session_id = $3,
+    last_seen_at = NOW(),
+    updated_at = NOW()
+WHERE id = $4 AND user_id = $5
+RETURNING id, user_id, kind, content, importance, mentions, source_session_id, user_edited, last_seen_at, created_at, updated_at
+`
+
+type TouchUserMemoryParams struct {
+	Content         string      `json:"content"`
+	Importance      int16       `json:"importance"`
+	SourceSessionID pgtype.UUID `json:"source_session_id"`
+	ID              pgtype.UUID `json:"id"`
+	UserID          string      `json:"user_id"`
+}
+
+// Records that an extracted fact came up again; content edited by the user is kept
+func (q *Queries) TouchUserMemory(ctx context.Context, arg TouchUserMemoryParams) (UserMemory, error) {
+	row := q.db.QueryRow(ctx, touchUserMemory,
+		arg.Content,
+		arg.Importance,
+		arg.SourceSessionID,
+		arg.ID,
+		arg.UserID,
+	)
+	var i UserMemory
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Kind,
+		&i.Content,
+		&i.Importance,
+		&i.Mentions,
+		&i.SourceSessionID,
+		&i.UserEdited,
+		&i.LastSeenAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const unlockArtwork = `-- name: UnlockArtwork :one
-INSERT INTO user_artworks (user_id, artwork_id, status, unlocked_at)
-VALUES ($1, $2, 'in_progress', NOW())
-RETURNING id, user_id, artwork_id, progress, status, unlocked_at, completed_at, created_at, updated_at
+INSERT INTO user_artworks (user_id, artwork_id, artwork_version, status, unlocked_at)
+VALUES ($1, $2, $3, 'in_progress', NOW())
+RETURNING id, user_id, artwork_id, progress, status, unlocked_at, completed_at, created_at, updated_at, artwork_version
 `
 
 type UnlockArtworkParams struct {
-	UserID    string      `json:"user_id"`
-	ArtworkID pgtype.UUID `json:"artwork_id"`
+	UserID         string      `json:"user_id"`
+	ArtworkID      pgtype.UUID `json:"artwork_id"`
+	ArtworkVersion int32       `json:"artwork_version"`
 }
 
 func (q *Queries) UnlockArtwork(ctx context.Context, arg UnlockArtworkParams) (UserArtwork, error) {
-	row := q.db.QueryRow(ctx, unlockArtwork, arg.UserID, arg.ArtworkID)
+	row := q.db.QueryRow(ctx, unlockArtwork, arg.UserID, arg.ArtworkID, arg.ArtworkVersion)
 	var i UserArtwork
 	err := row.Scan(
 		&i.ID,
@@ -1393,6 +3666,96 @@ func (q *Queries) UnlockArtwork(ctx context.Context, arg UnlockArtworkParams) (U
 		&i.CompletedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ArtworkVersion,
+	)
+	return i, err
+}
+
+const unlockQuoteCollection = `-- name: UnlockQuoteCollection :execrows
+INSERT INTO user_quote_collections (user_id, collection_id)
+VALUES ($1, $2)
+ON CONFLICT (user_id, collection_id) DO NOTHING
+`
+
+type UnlockQuoteCollectionParams struct {
+	UserID       string      `json:"user_id"`
+	CollectionID pgtype.UUID `json:"collection_id"`
+}
+
+func (q *Queries) UnlockQuoteCollection(ctx context.Context, arg UnlockQuoteCollectionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, unlockQuoteCollection, arg.UserID, arg.CollectionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateArtwork = `-- name: UpdateArtwork :one
+UPDATE artworks
+SET
+    display_name = $1,
+    description = $2,
+    image_url = $3,
+    unlock_cost = $4,
+    reveal_cost = $5,
+    sort_order = $6,
+    available_from = $7,
+    available_until = $8,
+    retired_at = CASE WHEN $9::boolean THEN COALESCE(retired_at, NOW()) END,
+    version = version + CASE
+        WHEN (display_name, description, image_url, unlock_cost, reveal_cost)
+            IS DISTINCT FROM ($1::text, $2::text, $3::text, $4::integer, $5::integer)
+        THEN 1 ELSE 0
+    END,
+    updated_at = NOW()
+WHERE id = $10
+RETURNING id, name, display_name, description, image_url, unlock_cost, reveal_cost, created_at, sort_order, available_from, available_until, retired_at, version, updated_at
+`
+
+type UpdateArtworkParams struct {
+	DisplayName    string             `json:"display_name"`
+	Description    string             `json:"description"`
+	ImageUrl       string             `json:"image_url"`
+	UnlockCost     int32              `json:"unlock_cost"`
+	RevealCost     int32              `json:"reveal_cost"`
+	SortOrder      int32              `json:"sort_order"`
+	AvailableFrom  pgtype.Timestamptz `json:"available_from"`
+	AvailableUntil pgtype.Timestamptz `json:"available_until"`
+	Retired        bool               `json:"retired"`
+	ID             pgtype.UUID        `json:"id"`
+}
+
+// Bumps the version when the content users see changes; placement edits
+// (order, schedule, retirement) keep it
+func (q *Queries) UpdateArtwork(ctx context.Context, arg UpdateArtworkParams) (Artwork, error) {
+	row := q.db.QueryRow(ctx, updateArtwork,
+		arg.DisplayName,
+		arg.Description,
+		arg.ImageUrl,
+		arg.UnlockCost,
+		arg.RevealCost,
+		arg.SortOrder,
+		arg.AvailableFrom,
+		arg.AvailableUntil,
+		arg.Retired,
+		arg.ID,
+	)
+	var i Artwork
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DisplayName,
+		&i.Description,
+		&i.ImageUrl,
+		&i.UnlockCost,
+		&i.RevealCost,
+		&i.CreatedAt,
+		&i.SortOrder,
+		&i.AvailableFrom,
+		&i.AvailableUntil,
+		&i.RetiredAt,
+		&i.Version,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
@@ -1405,7 +3768,7 @@ SET
     completed_at = CASE WHEN $3 >= 100 THEN NOW() ELSE completed_at END,
     updated_at = NOW()
 WHERE user_id = $1 AND artwork_id = $2
-RETURNING id, user_id, artwork_id, progress, status, unlocked_at, completed_at, created_at, updated_at
+RETURNING id, user_id, artwork_id, progress, status, unlocked_at, completed_at, created_at, updated_at, artwork_version
 `
 
 type UpdateArtworkProgressParams struct {
@@ -1427,6 +3790,7 @@ func (q *Queries) UpdateArtworkProgress(ctx context.Context, arg UpdateArtworkPr
 		&i.CompletedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ArtworkVersion,
 	)
 	return i, err
 }
@@ -1466,6 +3830,150 @@ func (q *Queries) UpdateLevel(ctx context.Context, arg UpdateLevelParams) (UserS
 	return i, err
 }
 
+const updateSessionDepth = `-- name: UpdateSessionDepth :one
+UPDATE sessions
+SET 
+    depth_level = GREATEST(depth_level, $2),
+    depth_progress = CASE WHEN depth_level > $2 THEN depth_progress ELSE $3 END,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id
+`
+
+type UpdateSessionDepthParams struct {
+	ID            pgtype.UUID `json:"id"`
+	DepthLevel    int16       `json:"depth_level"`
+	DepthProgress float32     `json:"depth_progress"`
+}
+
+// Depth never goes back, even when turns of the same session race
+func (q *Queries) UpdateSessionDepth(ctx context.Context, arg UpdateSessionDepthParams) (Session, error) {
+	row := q.db.QueryRow(ctx, updateSessionDepth, arg.ID, arg.DepthLevel, arg.DepthProgress)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.TotalMessages,
+		&i.GoldenInkEarned,
+		&i.StartedAt,
+		&i.EndedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.MemoriesExtractedAt,
+		&i.RunningSummary,
+		&i.RunningSummaryUntil,
+		&i.Title,
+		&i.Summary,
+		&i.ClosingMessage,
+		&i.ClosingPromptVersion,
+		&i.DepthLevel,
+		&i.DepthProgress,
+		&i.TemplateID,
+		&i.TemplateStep,
+		&i.TemplateStepMessages,
+		&i.TemplateStepWords,
+		&i.TemplateCompletedAt,
+		&i.TemplateOutput,
+		&i.PersonaID,
+		&i.QuoteID,
+	)
+	return i, err
+}
+
+const updateSessionRunningSummary = `-- name: UpdateSessionRunningSummary :execrows
+UPDATE sessions
+SET 
+    running_summary = $1,
+    running_summary_until = $2,
+    updated_at = NOW()
+WHERE id = $3
+  AND running_summary_until IS NOT DISTINCT FROM $4::timestamptz
+`
+
+type UpdateSessionRunningSummaryParams struct {
+	RunningSummary      string             `json:"running_summary"`
+	RunningSummaryUntil pgtype.Timestamptz `json:"running_summary_until"`
+	ID                  pgtype.UUID        `json:"id"`
+	PreviousUntil       pgtype.Timestamptz `json:"previous_until"`
+}
+
+// Only applies when the summary hasn't moved since it was read, so
+// concurrent refreshes can't fold the same messages twice
+func (q *Queries) UpdateSessionRunningSummary(ctx context.Context, arg UpdateSessionRunningSummaryParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateSessionRunningSummary,
+		arg.RunningSummary,
+		arg.RunningSummaryUntil,
+		arg.ID,
+		arg.PreviousUntil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateSessionTemplateProgress = `-- name: UpdateSessionTemplateProgress :one
+UPDATE sessions
+SET 
+    template_step = GREATEST(template_step, $1::SMALLINT),
+    template_step_messages = CASE WHEN template_step > $1::SMALLINT THEN template_step_messages ELSE $2::SMALLINT END,
+    template_step_words = CASE WHEN template_step > $1::SMALLINT THEN template_step_words ELSE $3::INTEGER END,
+    template_completed_at = CASE WHEN $4::BOOLEAN THEN COALESCE(template_completed_at, NOW()) ELSE template_completed_at END,
+    updated_at = NOW()
+WHERE id = $5
+RETURNING id, user_id, status, total_messages, golden_ink_earned, started_at, ended_at, created_at, updated_at, memories_extracted_at, running_summary, running_summary_until, title, summary, closing_message, closing_prompt_version, depth_level, depth_progress, template_id, template_step, template_step_messages, template_step_words, template_completed_at, template_output, persona_id, quote_id
+`
+
+type UpdateSessionTemplateProgressParams struct {
+	Step         int16       `json:"step"`
+	StepMessages int16       `json:"step_messages"`
+	StepWords    int32       `json:"step_words"`
+	Completed    bool        `json:"completed"`
+	ID           pgtype.UUID `json:"id"`
+}
+
+// Steps never go back, even when turns of the same session race
+func (q *Queries) UpdateSessionTemplateProgress(ctx context.Context, arg UpdateSessionTemplateProgressParams) (Session, error) {
+	row := q.db.QueryRow(ctx, updateSessionTemplateProgress,
+		arg.Step,
+		arg.StepMessages,
+		arg.StepWords,
+		arg.Completed,
+		arg.ID,
+	)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.TotalMessages,
+		&i.GoldenInkEarned,
+		&i.StartedAt,
+		&i.EndedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.MemoriesExtractedAt,
+		&i.RunningSummary,
+		&i.RunningSummaryUntil,
+		&i.Title,
+		&i.Summary,
+		&i.ClosingMessage,
+		&i.ClosingPromptVersion,
+		&i.DepthLevel,
+		&i.DepthProgress,
+		&i.TemplateID,
+		&i.TemplateStep,
+		&i.TemplateStepMessages,
+		&i.TemplateStepWords,
+		&i.TemplateCompletedAt,
+		&i.TemplateOutput,
+		&i.PersonaID,
+		&i.QuoteID,
+	)
+	return i, err
+}
+
 const updateStreak = `-- name: UpdateStreak :one
 UPDATE user_stats
 SET 
@@ -1502,6 +4010,51 @@ func (q *Queries) UpdateStreak(ctx context.Context, arg UpdateStreakParams) (Use
 	return i, err
 }
 
+const updateUserMemory = `-- name: UpdateUserMemory :one
+UPDATE user_memories
+SET
+    kind = $3,
+    content = $4,
+    importance = $5,
+    user_edited = true,
+    updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING id, user_id, kind, content, importance, mentions, source_session_id, user_edited, last_seen_at, created_at, updated_at
+`
+
+type UpdateUserMemoryParams struct {
+	ID         pgtype.UUID `json:"id"`
+	UserID     string      `json:"user_id"`
+	Kind       string      `json:"kind"`
+	Content    string      `json:"content"`
+	Importance int16       `json:"importance"`
+}
+
+func (q *Queries) UpdateUserMemory(ctx context.Context, arg UpdateUserMemoryParams) (UserMemory, error) {
+	row := q.db.QueryRow(ctx, updateUserMemory,
+		arg.ID,
+		arg.UserID,
+		arg.Kind,
+		arg.Content,
+		arg.Importance,
+	)
+	var i UserMemory
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Kind,
+		&i.Content,
+		&i.Importance,
+		&i.Mentions,
+		&i.SourceSessionID,
+		&i.UserEdited,
+		&i.LastSeenAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const upgradeUserToPaid = `-- name: UpgradeUserToPaid :one
 UPDATE user_subscriptions
 SET 
@@ -1543,6 +4096,31 @@ func (q *Queries) UpgradeUserToPaid(ctx context.Context, arg UpgradeUserToPaidPa
 	return i, err
 }
 
+const upsertUserPersona = `-- name: UpsertUserPersona :one
+INSERT INTO user_preferences (user_id, persona_id)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET persona_id = EXCLUDED.persona_id, updated_at = NOW()
+RETURNING user_id, persona_id, created_at, updated_at
+`
+
+type UpsertUserPersonaParams struct {
+	UserID    string `json:"user_id"`
+	PersonaID string `json:"persona_id"`
+}
+
+func (q *Queries) UpsertUserPersona(ctx context.Context, arg UpsertUserPersonaParams) (UserPreference, error) {
+	row := q.db.QueryRow(ctx, upsertUserPersona, arg.UserID, arg.PersonaID)
+	var i UserPreference
+	err := row.Scan(
+		&i.UserID,
+		&i.PersonaID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const upsertUserStats = `-- name: UpsertUserStats :one
 INSERT INTO user_stats (user_id)
 VALUES ($1)
@@ -6,3 +6,13 @@ const MaxMessageLength = 1000
 
 // FreePlanMessageLimit is the max messages per day for free users
 const FreePlanMessageLimit = 8
+
+// maxPromptMemories is how many memories are recalled into each reply prompt
+const maxPromptMemories = 5
+
+// Reply statuses of user messages sent for a reply
+const (
+	replyStatusPending = "pending" // Reply being generated
+	replyStatusFailed  = "failed"  // Reply couldn't be generated or saved; retryable
+	replyStatusReplied = "replied"
+)
@@ -0,0 +1,40 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+)
+
+// advanceTurnDepth scores the user's message and advances the session's
+// depth, which is saved with the reply. Crisis turns hold the depth without
+// scoring.
+func (h *Handler) advanceTurnDepth(ctx context.Context, turn *respondTurn, session db.Session) {
+	if h.depth == nil {
+		turn.depthLevel = int(sessionDepth(session, turn.treatment, turn.userMessageCount))
+		return
+	}
+
+	update := h.depth.Hold(session)
+	if !turn.crisis() {
+		update = h.depth.Advance(turn.aiContext(ctx), session, turn.content, turn.aiMessages)
+	}
+
+	turn.depth = &update
+	turn.depthLevel = int(update.Level)
+	if turn.treatment.DepthThresholds != nil {
+		turn.depthLevel = int(turn.treatment.Depth(turn.userMessageCount))
+	}
+}
+
+// sessionDepth returns the depth to converse at in a session: the depth the
+// session reached, or the message-count depth when the user's experiment
+// treatment sets thresholds
+func sessionDepth(session db.Session, treatment ai.Treatment, userMessageCount int) ai.DepthLevel {
+	if treatment.DepthThresholds != nil || session.DepthLevel == 0 {
+		return treatment.Depth(userMessageCount)
+	}
+	return ai.DepthLevel(session.DepthLevel)
+}
@@ -0,0 +1,84 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"net/http"
+
+	"catetin/backend/internal/middleware"
+	"catetin/backend/internal/services"
+	"catetin/backend/internal/types"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultEmotionDays is the range emotion endpoints cover when no dates are given
+const defaultEmotionDays = 30
+
+// GetEmotionDistribution returns the user's detected emotions per day or week
+// GET /api/emotions?period=daily|weekly&from=YYYY-MM-DD&to=YYYY-MM-DD
+func (h *Handler) GetEmotionDistribution(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.emotions == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	period := c.QueryParam("period")
+	if period == "" {
+		period = services.EmotionPeriodDaily
+	}
+	if period != services.EmotionPeriodDaily && period != services.EmotionPeriodWeekly {
+		return echo.NewHTTPError(http.StatusBadRequest, "period must be 'daily' or 'weekly'")
+	}
+
+	from, to, err := h.emotions.ParseRange(c.QueryParam("from"), c.QueryParam("to"), defaultEmotionDays)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	buckets, err := h.emotions.Distribution(c.Request().Context(), userID, period, from, to)
+	if err != nil {
+		c.Logger().Errorf("failed to get emotion distribution: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get emotions")
+	}
+
+	return c.JSON(http.StatusOK, types.EmotionDistributionResponse{
+		Period:  period,
+		From:    from.Format("2006-01-02"),
+		To:      to.Format("2006-01-02"),
+		Buckets: buckets,
+	})
+}
+
+// GetMoodTimeline returns the user's daily mood for charting on the Jejak page
+// GET /api/emotions/timeline?from=YYYY-MM-DD&to=YYYY-MM-DD
+func (h *Handler) GetMoodTimeline(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.emotions == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	from, to, err := h.emotions.ParseRange(c.QueryParam("from"), c.QueryParam("to"), defaultEmotionDays)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	points, err := h.emotions.Timeline(c.Request().Context(), userID, from, to)
+	if err != nil {
+		c.Logger().Errorf("failed to get mood timeline: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get mood timeline")
+	}
+
+	return c.JSON(http.StatusOK, types.MoodTimelineResponse{
+		From:   from.Format("2006-01-02"),
+		To:     to.Format("2006-01-02"),
+		Points: points,
+	})
+}
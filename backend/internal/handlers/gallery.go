@@ -0,0 +1,181 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"catetin/backend/internal/middleware"
+	"catetin/backend/internal/services"
+	"catetin/backend/internal/types"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// GetGallery returns the Galeri's artworks with the user's status and
+// reveal progress of each
+// GET /api/gallery
+func (h *Handler) GetGallery(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.gallery == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	artworks, err := h.gallery.Catalog(c.Request().Context(), userID)
+	if err != nil {
+		c.Logger().Errorf("failed to get gallery: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get gallery")
+	}
+
+	return c.JSON(http.StatusOK, types.GalleryResponse{Artworks: artworks})
+}
+
+// GetArtworkImage returns the artwork as a PNG revealed to the user's
+// progress. Every user's artwork emerges in its own, stable pattern.
+// GET /api/gallery/artworks/:id/image
+func (h *Handler) GetArtworkImage(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.gallery == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	var artworkID pgtype.UUID
+	if err := artworkID.Scan(c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid artwork id")
+	}
+
+	image, err := h.gallery.Image(c.Request().Context(), userID, artworkID)
+	if errors.Is(err, services.ErrArtworkNotFound) || errors.Is(err, services.ErrArtworkImageNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "artwork not found")
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to render artwork: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to render artwork")
+	}
+
+	// Renders are per user and change with progress
+	c.Response().Header().Set("Cache-Control", "private, no-cache")
+	return c.File(image)
+}
+
+// UnlockArtwork pays for a canvas with Marmer and starts revealing it
+// POST /api/gallery/artworks/:id/unlock
+func (h *Handler) UnlockArtwork(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.gallery == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	var artworkID pgtype.UUID
+	if err := artworkID.Scan(c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid artwork id")
+	}
+
+	artwork, stats, err := h.gallery.Unlock(c.Request().Context(), userID, artworkID)
+	if errors.Is(err, services.ErrArtworkNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "artwork not found")
+	}
+	if errors.Is(err, services.ErrArtworkUnlocked) {
+		return echo.NewHTTPError(http.StatusConflict, "artwork is already unlocked")
+	}
+	if errors.Is(err, services.ErrArtworkUnavailable) {
+		return echo.NewHTTPError(http.StatusConflict, "artwork is not available")
+	}
+	if errors.Is(err, services.ErrArtworkInProgress) {
+		return echo.NewHTTPError(http.StatusConflict, map[string]interface{}{
+			"error":   "ARTWORK_IN_PROGRESS",
+			"message": "Selesaikan dulu lukisan yang sedang kamu buka sebelum memulai yang baru.",
+		})
+	}
+	if errors.Is(err, services.ErrInsufficientBalance) {
+		return echo.NewHTTPError(http.StatusPaymentRequired, map[string]interface{}{
+			"error":   "INSUFFICIENT_BALANCE",
+			"message": "Marmer-mu belum cukup untuk membuka kanvas ini. Terus menulis ya!",
+		})
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to unlock artwork: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to unlock artwork")
+	}
+
+	return c.JSON(http.StatusOK, types.UnlockArtworkResponse{
+		Artwork:   artwork,
+		GoldenInk: stats.GoldenInk,
+		Marble:    stats.Marble,
+	})
+}
+
+// RevealArtwork spends Tinta Emas to reveal more of an unlocked artwork
+// POST /api/gallery/artworks/:id/reveal
+func (h *Handler) RevealArtwork(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.gallery == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	var artworkID pgtype.UUID
+	if err := artworkID.Scan(c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid artwork id")
+	}
+
+	var req types.RevealArtworkRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if req.TintaEmas <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "tinta_emas must be positive")
+	}
+
+	reveal, err := h.gallery.Reveal(c.Request().Context(), userID, artworkID, req.TintaEmas)
+	if errors.Is(err, services.ErrArtworkNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "artwork not found")
+	}
+	if errors.Is(err, services.ErrArtworkNotUnlocked) {
+		return echo.NewHTTPError(http.StatusForbidden, map[string]interface{}{
+			"error":   "ARTWORK_LOCKED",
+			"message": "Buka kanvas ini dengan Marmer dulu sebelum mengungkapnya.",
+		})
+	}
+	if errors.Is(err, services.ErrArtworkCompleted) {
+		return echo.NewHTTPError(http.StatusConflict, "artwork is already completed")
+	}
+	if errors.Is(err, services.ErrRevealTooSmall) {
+		return echo.NewHTTPError(http.StatusBadRequest, "tinta_emas must cover at least one percent")
+	}
+	if errors.Is(err, services.ErrInsufficientBalance) {
+		return echo.NewHTTPError(http.StatusPaymentRequired, map[string]interface{}{
+			"error":   "INSUFFICIENT_BALANCE",
+			"message": "Tinta Emas-mu belum cukup. Terus menulis ya!",
+		})
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to reveal artwork: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to reveal artwork")
+	}
+
+	return c.JSON(http.StatusOK, types.RevealArtworkResponse{
+		Artwork:   reveal.Artwork,
+		Spent:     reveal.Spent,
+		Revealed:  reveal.Revealed,
+		Completed: reveal.Completed,
+		GoldenInk: reveal.Stats.GoldenInk,
+		Marble:    reveal.Stats.Marble,
+	})
+}
@@ -2,7 +2,9 @@
 package handlers
 
 import (
+	"context"
 	"encoding/hex"
+	"errors"
 	"net/http"
 
 	"catetin/backend/internal/ai"
@@ -17,22 +19,81 @@ import (
 // Handler holds dependencies for HTTP handlers
 type Handler struct {
 	queries       *db.Queries
+	pool          *db.Pool // Runs the transactions of respond turns
 	pujangga      *ai.PujanggaService
 	gamification  *services.GamificationService
 	leveling      *services.LevelingService
 	weeklySummary *services.WeeklySummaryService
+	budget        *services.BudgetService
+	experiments   *services.ExperimentService
+	safety        *services.SafetyService
+	emotions      *services.EmotionService
+	memories      *services.MemoryService
+	summaries     *services.SessionSummaryService
+	openings      *services.OpeningService
+	closings      *services.ClosingService
+	depth         *services.DepthService
+	topics        *services.TopicService
+	templates     *services.JournalTemplateService
+	personas      *services.PersonaService
+	quotes        *services.QuoteService
+	gallery       *services.GalleryService
+	ledger        *services.LedgerService
 	supportEmail  string
 }
 
+// Deps holds the dependencies of a Handler. Services that depend on an
+// optional feature, like the AI client, are nil when it is not configured.
+type Deps struct {
+	Queries       *db.Queries
+	Pool          *db.Pool // Runs the transactions of respond turns
+	Pujangga      *ai.PujanggaService
+	Gamification  *services.GamificationService
+	Leveling      *services.LevelingService
+	WeeklySummary *services.WeeklySummaryService
+	Budget        *services.BudgetService
+	Experiments   *services.ExperimentService
+	Safety        *services.SafetyService
+	Emotions      *services.EmotionService
+	Memories      *services.MemoryService
+	Summaries     *services.SessionSummaryService
+	Openings      *services.OpeningService
+	Closings      *services.ClosingService
+	Depth         *services.DepthService
+	Topics        *services.TopicService
+	Templates     *services.JournalTemplateService
+	Personas      *services.PersonaService
+	Quotes        *services.QuoteService
+	Gallery       *services.GalleryService
+	Ledger        *services.LedgerService
+	SupportEmail  string
+}
+
 // New creates a new Handler with the given dependencies
-func New(queries *db.Queries, pujangga *ai.PujanggaService, gamification *services.GamificationService, leveling *services.LevelingService, weeklySummary *services.WeeklySummaryService, supportEmail string) *Handler {
+func New(deps Deps) *Handler {
 	return &Handler{
-		queries:       queries,
-		pujangga:      pujangga,
-		gamification:  gamification,
-		leveling:      leveling,
-		weeklySummary: weeklySummary,
-		supportEmail:  supportEmail,
+		queries:       deps.Queries,
+		pool:          deps.Pool,
+		pujangga:      deps.Pujangga,
+		gamification:  deps.Gamification,
+		leveling:      deps.Leveling,
+		weeklySummary: deps.WeeklySummary,
+		budget:        deps.Budget,
+		experiments:   deps.Experiments,
+		safety:        deps.Safety,
+		emotions:      deps.Emotions,
+		memories:      deps.Memories,
+		summaries:     deps.Summaries,
+		openings:      deps.Openings,
+		closings:      deps.Closings,
+		depth:         deps.Depth,
+		topics:        deps.Topics,
+		templates:     deps.Templates,
+		personas:      deps.Personas,
+		quotes:        deps.Quotes,
+		gallery:       deps.Gallery,
+		ledger:        deps.Ledger,
+		supportEmail:  deps.SupportEmail,
 	}
 }
 
@@ -58,7 +119,7 @@ func (h *Handler) requirePaidPlan(c echo.Context) error {
 	}
 
 	if sub.Plan != "paid" {
-		return c.JSON(http.StatusForbidden, map[string]interface{}{
+		return echo.NewHTTPError(http.StatusForbidden, map[string]interface{}{
 			"error":       "PREMIUM_REQUIRED",
 			"message":     "Risalah Mingguan hanya tersedia untuk pengguna Premium",
 			"upgrade_url": "/pricing",
@@ -67,3 +128,33 @@ func (h *Handler) requirePaidPlan(c echo.Context) error {
 
 	return nil
 }
+
+// budgetExceededError converts an exhausted token budget into a friendly 429
+func (h *Handler) budgetExceededError(err error) *echo.HTTPError {
+	message := "Sang Pujangga perlu beristirahat sejenak. Kuota harianmu sudah habis, sampai jumpa besok ya."
+	var budgetErr *ai.BudgetExceededError
+	if errors.As(err, &budgetErr) && budgetErr.Period == ai.BudgetPeriodMonthly {
+		message = "Kuota bulanan Sang Pujangga untukmu sudah habis. Kuota akan terisi kembali di awal bulan depan."
+	}
+
+	return echo.NewHTTPError(http.StatusTooManyRequests, map[string]interface{}{
+		"error":         "TOKEN_BUDGET_EXCEEDED",
+		"message":       message,
+		"upgrade_url":   "/pricing",
+		"support_email": h.supportEmail,
+	})
+}
+
+// treatment returns the experiment treatment for a user, the defaults when
+// experiments are disabled
+func (h *Handler) treatment(ctx context.Context, userID string) ai.Treatment {
+	if h.experiments == nil {
+		return ai.Treatment{}
+	}
+	return h.experiments.Treatment(ctx, userID)
+}
+
+// aiContext attaches the caller and their experiment treatment to ctx for AI calls
+func (h *Handler) aiContext(ctx context.Context, userID string, sessionID pgtype.UUID) context.Context {
+	return ai.WithTreatment(ai.WithCaller(ctx, userID, uuidToString(sessionID)), h.treatment(ctx, userID))
+}
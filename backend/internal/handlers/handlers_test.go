@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+	"catetin/backend/internal/middleware"
+	"catetin/backend/internal/services"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// recordCassettes re-records the handler flow cassettes against OpenRouter:
+// OPENROUTER_API_KEY=... go test ./internal/handlers -run Flow -record
+var recordCassettes = flag.Bool("record", false, "record cassettes against OpenRouter instead of replaying them")
+
+// cassetteDir holds the recordings of the flow tests, shared with the ai package
+const cassetteDir = "../../testdata/cassettes"
+
+const testUserID = "user_test"
+
+// fakeDB is an in-memory db.DBTX and db.Beginner implementing the queries
+// the journaling flows run. Transactions write straight through; commits and
+// rollbacks are only counted.
+type fakeDB struct {
+	t  *testing.T
+	mu sync.Mutex
+
+	plan        string // Subscription plan of every user
+	tokensToday int64  // AI tokens used today and this month
+
+	sessions  []*db.Session
+	messages  []*db.Message
+	stats     map[string]*db.UserStat
+	ledger    map[string]int32 // Delta by user and idempotency key
+	summaries []*db.WeeklySummary
+	commits   int
+	rollbacks int
+	ids       byte
+	clock     time.Time
+}
+
+func newFakeDB(t *testing.T) *fakeDB {
+	return &fakeDB{
+		t:      t,
+		plan:   "free",
+		stats:  map[string]*db.UserStat{},
+		ledger: map[string]int32{},
+		clock:  time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+// next returns a new row ID and creation time
+func (f *fakeDB) next() (pgtype.UUID, pgtype.Timestamptz) {
+	f.ids++
+	f.clock = f.clock.Add(time.Second)
+	id := pgtype.UUID{Valid: true}
+	id.Bytes[15] = f.ids
+	return id, pgtype.Timestamptz{Time: f.clock, Valid: true}
+}
+
+// addSession stores an active session of testUserID started at startedAt
+func (f *fakeDB) addSession(startedAt time.Time) *db.Session {
+	id, now := f.next()
+	session := &db.Session{ID: id, UserID: testUserID, Status: "active", StartedAt: pgtype.Timestamptz{Time: startedAt, Valid: true}, CreatedAt: now}
+	f.sessions = append(f.sessions, session)
+	return session
+}
+
+// addMessage stores a message of session
+func (f *fakeDB) addMessage(session *db.Session, role, content string) *db.Message {
+	id, now := f.next()
+	message := &db.Message{ID: id, SessionID: session.ID, Role: role, Content: content, CreatedAt: now}
+	f.messages = append(f.messages, message)
+	session.TotalMessages++
+	return message
+}
+
+func (f *fakeDB) session(id pgtype.UUID) *db.Session {
+	for _, s := range f.sessions {
+		if s.ID == id {
+			return s
+		}
+	}
+	return nil
+}
+
+func (f *fakeDB) message(id pgtype.UUID) *db.Message {
+	for _, m := range f.messages {
+		if m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+// weekSessions returns the sessions of a user started within [from, to]
+func (f *fakeDB) weekSessions(userID string, from, to pgtype.Timestamptz) []*db.Session {
+	var sessions []*db.Session
+	for _, s := range f.sessions {
+		if s.UserID == userID && !s.StartedAt.Time.Before(from.Time) && !s.StartedAt.Time.After(to.Time) {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions
+}
+
+// userMessages returns the user messages of sessions
+func (f *fakeDB) userMessages(sessions ...*db.Session) []*db.Message {
+	var messages []*db.Message
+	for _, m := range f.messages {
+		for _, s := range sessions {
+			if m.SessionID == s.ID && m.Role == "user" {
+				messages = append(messages, m)
+			}
+		}
+	}
+	return messages
+}
+
+// queryName returns the sqlc name of a generated query
+func queryName(sql string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(sql), "-- name: "), " ")
+	return name
+}
+
+func (f *fakeDB) Begin(context.Context) (pgx.Tx, error) {
+	return &fakeTx{db: f}, nil
+}
+
+func (f *fakeDB) Exec(_ context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch queryName(sql) {
+	case "MarkMessageReplied":
+		m := f.message(args[0].(pgtype.UUID))
+		if m == nil || m.ReplyStatus.String == replyStatusReplied {
+			return pgconn.NewCommandTag("UPDATE 0"), nil
+		}
+		m.ReplyStatus = pgtype.Text{String: replyStatusReplied, Valid: true}
+		return pgconn.NewCommandTag("UPDATE 1"), nil
+	case "MarkMessageReplyFailed":
+		if m := f.message(args[0].(pgtype.UUID)); m != nil && m.ReplyStatus.String == replyStatusPending {
+			m.ReplyStatus = pgtype.Text{String: replyStatusFailed, Valid: true}
+		}
+		return pgconn.NewCommandTag("UPDATE 1"), nil
+	case "CreateLedgerEntry":
+		key := args[0].(string) + "/" + args[7].(string)
+		if _, ok := f.ledger[key]; ok {
+			return pgconn.NewCommandTag("INSERT 0 0"), nil
+		}
+		f.ledger[key] = args[2].(int32)
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	}
+
+	f.t.Errorf("unexpected exec %s", queryName(sql))
+	return pgconn.CommandTag{}, fmt.Errorf("unexpected exec %s", queryName(sql))
+}
+
+func (f *fakeDB) Query(_ context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rows := &fakeRows{}
+	switch queryName(sql) {
+	case "GetRecentMessages":
+		sessionID, limit := args[0].(pgtype.UUID), int(args[1].(int32))
+		for i := len(f.messages) - 1; i >= 0 && len(rows.rows) < limit; i-- {
+			if f.messages[i].SessionID == sessionID {
+				rows.rows = append(rows.rows, fields(*f.messages[i]))
+			}
+		}
+	case "GetWeekMessages":
+		sessions := f.weekSessions(args[0].(string), args[1].(pgtype.Timestamptz), args[2].(pgtype.Timestamptz))
+		for _, m := range f.userMessages(sessions...) {
+			rows.rows = append(rows.rows, fields(db.GetWeekMessagesRow{Content: m.Content, CreatedAt: m.CreatedAt, StartedAt: f.session(m.SessionID).StartedAt}))
+		}
+	default:
+		f.t.Errorf("unexpected query %s", queryName(sql))
+		return nil, fmt.Errorf("unexpected query %s", queryName(sql))
+	}
+	return rows, nil
+}
+
+func (f *fakeDB) QueryRow(_ context.Context, sql string, args ...interface{}) pgx.Row {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch name := queryName(sql); name {
+	case "GetSessionByID":
+		if s := f.session(args[0].(pgtype.UUID)); s != nil && s.UserID == args[1].(string) {
+			return fakeRow{values: fields(*s)}
+		}
+		return fakeRow{err: pgx.ErrNoRows}
+	case "CreateSession":
+		id, now := f.next()
+		s := &db.Session{ID: id, UserID: args[0].(string), Status: "active", StartedAt: now, CreatedAt: now, UpdatedAt: now}
+		f.sessions = append(f.sessions, s)
+		return fakeRow{values: fields(*s)}
+	case "IncrementSessionMessages", "AddSessionGoldenInk":
+		s := f.session(args[0].(pgtype.UUID))
+		if s == nil {
+			return fakeRow{err: pgx.ErrNoRows}
+		}
+		if name == "IncrementSessionMessages" {
+			s.TotalMessages++
+		} else {
+			s.GoldenInkEarned += args[1].(int32)
+		}
+		return fakeRow{values: fields(*s)}
+	case "CreatePendingMessage", "CreateMessage":
+		id, now := f.next()
+		m := &db.Message{ID: id, SessionID: args[0].(pgtype.UUID), CreatedAt: now}
+		if name == "CreatePendingMessage" {
+			m.Role, m.Content, m.ReplyStatus = "user", args[1].(string), pgtype.Text{String: replyStatusPending, Valid: true}
+		} else {
+			m.Role, m.Content, m.PromptVersion, m.PersonaID, m.QuoteID = args[1].(string), args[2].(string), args[3].(pgtype.Text), args[4].(pgtype.Text), args[5].(pgtype.UUID)
+		}
+		f.messages = append(f.messages, m)
+		return fakeRow{values: fields(*m)}
+	case "CountUserMessagesBySession":
+		return fakeRow{values: []interface{}{int64(len(f.userMessages(f.session(args[0].(pgtype.UUID)))))}}
+	case "CountTodayUserMessages":
+		var count int32
+		for _, s := range f.sessions {
+			if s.UserID == args[0].(string) {
+				count += int32(len(f.userMessages(s)))
+			}
+		}
+		return fakeRow{values: []interface{}{count}}
+	case "UpsertUserSubscription":
+		return fakeRow{values: fields(db.UserSubscription{UserID: args[0].(string), Plan: f.plan})}
+	case "GetUserTokenUsage":
+		return fakeRow{values: fields(db.GetUserTokenUsageRow{Plan: f.plan, DailyTokens: f.tokensToday, MonthlyTokens: f.tokensToday})}
+	case "GetWeeklySummary":
+		for _, s := range f.summaries {
+			if s.UserID == args[0].(string) && s.WeekStart == args[1].(pgtype.Date) {
+				return fakeRow{values: fields(*s)}
+			}
+		}
+		return fakeRow{err: pgx.ErrNoRows}
+	case "CountWeekSessions":
+		sessions := f.weekSessions(args[0].(string), args[1].(pgtype.Timestamptz), args[2].(pgtype.Timestamptz))
+		return fakeRow{values: fields(db.CountWeekSessionsRow{SessionCount: int32(len(sessions)), MessageCount: int32(len(f.userMessages(sessions...)))})}
+	case "CreateWeeklySummary":
+		id, now := f.next()
+		s := &db.WeeklySummary{
+			ID: id, UserID: args[0].(string), WeekStart: args[1].(pgtype.Date), WeekEnd: args[2].(pgtype.Date), Summary: args[3].(string),
+			SessionCount: args[4].(int32), MessageCount: args[5].(int32), Emotions: args[6].([]byte), CreatedAt: now, PromptVersion: args[7].(pgtype.Text),
+		}
+		f.summaries = append(f.summaries, s)
+		return fakeRow{values: fields(*s)}
+	}
+
+	// The rest are user_stats queries
+	userID := args[0].(string)
+	stats, ok := f.stats[userID]
+	switch name := queryName(sql); name {
+	case "GetUserStats":
+		if !ok {
+			return fakeRow{err: pgx.ErrNoRows}
+		}
+	case "CreateUserStats", "UpsertUserStats":
+		if !ok {
+			stats = &db.UserStat{UserID: userID, Level: 1}
+			f.stats[userID] = stats
+		}
+	case "AddGoldenInk":
+		stats.GoldenInk += args[1].(int32)
+	case "AddMarble":
+		stats.Marble += args[1].(int32)
+	case "AddXP":
+		stats.CurrentXp += args[1].(int32)
+		stats.TotalXp += args[1].(int32)
+	case "UpdateStreak":
+		stats.CurrentStreak = args[1].(int32)
+		stats.LongestStreak = max(stats.LongestStreak, stats.CurrentStreak)
+		stats.LastActiveDate = args[2].(pgtype.Date)
+	case "UpdateLevel":
+		stats.Level, stats.CurrentXp = args[1].(int32), args[2].(int32)
+	default:
+		f.t.Errorf("unexpected query %s", name)
+		return fakeRow{err: fmt.Errorf("unexpected query %s", name)}
+	}
+	return fakeRow{values: fields(*stats)}
+}
+
+// fakeTx runs a transaction's queries on its fakeDB
+type fakeTx struct {
+	pgx.Tx // Unimplemented methods panic
+	db     *fakeDB
+	done   bool
+}
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return tx.db.Exec(ctx, sql, args...)
+}
+
+func (tx *fakeTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return tx.db.Query(ctx, sql, args...)
+}
+
+func (tx *fakeTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return tx.db.QueryRow(ctx, sql, args...)
+}
+
+func (tx *fakeTx) Commit(context.Context) error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	tx.done = true
+	tx.db.commits++
+	return nil
+}
+
+func (tx *fakeTx) Rollback(context.Context) error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	if !tx.done {
+		tx.done = true
+		tx.db.rollbacks++
+	}
+	return nil
+}
+
+// fields returns the fields of a row struct in column order
+func fields(row interface{}) []interface{} {
+	v := reflect.ValueOf(row)
+	values := make([]interface{}, v.NumField())
+	for i := range values {
+		values[i] = v.Field(i).Interface()
+	}
+	return values
+}
+
+// fakeRow scans its values in column order
+type fakeRow struct {
+	values []interface{}
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.values[i]))
+	}
+	return nil
+}
+
+// fakeRows iterates over rows of values in column order
+type fakeRows struct {
+	pgx.Rows // Unimplemented methods panic
+	rows     [][]interface{}
+	current  int
+}
+
+func (r *fakeRows) Next() bool {
+	r.current++
+	return r.current <= len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	return fakeRow{values: r.rows[r.current-1]}.Scan(dest...)
+}
+
+func (r *fakeRows) Close()     {}
+func (r *fakeRows) Err() error { return nil }
+
+// newCassettePujangga returns a Pujangga on OpenRouter whose traffic is
+// replayed from cassetteDir, or recorded to it with -record
+func newCassettePujangga(t *testing.T) *ai.PujanggaService {
+	t.Helper()
+
+	mode, apiKey := ai.CassetteReplay, "cassette"
+	if *recordCassettes {
+		mode, apiKey = ai.CassetteRecord, os.Getenv("OPENROUTER_API_KEY")
+		if apiKey == "" {
+			t.Fatal("OPENROUTER_API_KEY is required to record cassettes")
+		}
+	}
+
+	cassette, err := ai.NewCassette(cassetteDir, mode, nil)
+	if err != nil {
+		t.Fatalf("NewCassette: %v", err)
+	}
+	client, err := ai.NewClient(context.Background(), ai.ClientConfig{
+		Provider: ai.NewOpenRouterProvider(apiKey).WithTransport(cassette),
+		Retry:    &ai.RetryConfig{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	prompts, err := ai.NewPromptRegistry("")
+	if err != nil {
+		t.Fatalf("NewPromptRegistry: %v", err)
+	}
+	return ai.NewPujanggaService(client, prompts, ai.DefaultGuardrails())
+}
+
+// testBudgets limits free users to 1000 tokens a day
+var testBudgets = map[string]services.TokenBudget{"free": {Daily: 1000}}
+
+// newTestHandler returns a Handler on fake with the services of the
+// journaling flows, replying with pujangga
+func newTestHandler(fake *fakeDB, pujangga *ai.PujanggaService) *Handler {
+	queries := db.New(fake)
+	pool := db.NewPoolWith(fake)
+	ledger := services.NewLedgerService(queries, pool)
+
+	return New(Deps{
+		Queries:       queries,
+		Pool:          pool,
+		Pujangga:      pujangga,
+		Gamification:  services.NewGamificationService(queries, ledger, nil),
+		Leveling:      services.NewLevelingService(queries, ledger, nil),
+		WeeklySummary: services.NewWeeklySummaryService(queries, pujangga),
+		Budget:        services.NewBudgetService(queries, testBudgets),
+		Ledger:        ledger,
+	})
+}
+
+// serve runs handler on a request from testUserID, with the session ID as
+// the :id path parameter when given
+func serve(t *testing.T, handler echo.HandlerFunc, method, body string, sessionID pgtype.UUID) *httptest.ResponseRecorder {
+	t.Helper()
+
+	e := echo.New()
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set(middleware.UserIDKey, testUserID)
+	if sessionID.Valid {
+		c.SetParamNames("id")
+		c.SetParamValues(uuidToString(sessionID))
+	}
+
+	if err := handler(c); err != nil {
+		e.HTTPErrorHandler(err, c)
+	}
+	return rec
+}
+
+// decode unmarshals a JSON response body into v
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body.String(), err)
+	}
+}
+
+// errorCode returns the "error" field of a JSON error response
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Error string `json:"error"`
+	}
+	decode(t, rec, &body)
+	return body.Error
+}
@@ -0,0 +1,263 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultReportDays is the range internal reports cover when no dates are given
+const defaultReportDays = 30
+
+// reportLocation is WIB, the timezone report days start and end in
+var reportLocation = func() *time.Location {
+	loc, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		// Fallback to fixed offset if timezone data not available
+		return time.FixedZone("WIB", 7*60*60)
+	}
+	return loc
+}()
+
+// InternalHandler holds dependencies for internal operations endpoints
+type InternalHandler struct {
+	aiClient     *ai.Client
+	usageService *services.UsageService
+	prompts      *ai.PromptRegistry
+	experiments  *services.ExperimentService
+	safety       *services.SafetyService
+	catalog      *services.ArtworkCatalogService
+	ledger       *services.LedgerService
+}
+
+// InternalDeps holds the dependencies of an InternalHandler. Like Deps,
+// services that depend on an optional feature are nil when it is not configured.
+type InternalDeps struct {
+	AIClient     *ai.Client
+	UsageService *services.UsageService
+	Prompts      *ai.PromptRegistry
+	Experiments  *services.ExperimentService
+	Safety       *services.SafetyService
+	Catalog      *services.ArtworkCatalogService
+	Ledger       *services.LedgerService
+}
+
+// NewInternalHandler creates a new InternalHandler with the given dependencies
+func NewInternalHandler(deps InternalDeps) *InternalHandler {
+	return &InternalHandler{
+		aiClient:     deps.AIClient,
+		usageService: deps.UsageService,
+		prompts:      deps.Prompts,
+		experiments:  deps.Experiments,
+		safety:       deps.Safety,
+		catalog:      deps.Catalog,
+		ledger:       deps.Ledger,
+	}
+}
+
+// AIMetrics returns per-model request outcomes for the AI model chain
+// GET /api/internal/ai/metrics
+func (h *InternalHandler) AIMetrics(c echo.Context) error {
+	if h.aiClient == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "AI service is not configured")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"provider": h.aiClient.Provider(),
+		"models":   h.aiClient.Metrics(),
+	})
+}
+
+// AIUsage returns AI token usage and estimated cost aggregated by day and by plan
+// GET /api/internal/ai/usage?from=YYYY-MM-DD&to=YYYY-MM-DD
+func (h *InternalHandler) AIUsage(c echo.Context) error {
+	if h.usageService == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Database not available")
+	}
+
+	from, to, err := parseReportRange(c)
+	if err != nil {
+		return err
+	}
+
+	report, err := h.usageService.Report(c.Request().Context(), from, to)
+	if err != nil {
+		c.Logger().Errorf("failed to build usage report: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to build usage report")
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// Prompts returns the active prompt templates and compares the versions that
+// produced assistant messages in the given range
+// GET /api/internal/prompts?from=YYYY-MM-DD&to=YYYY-MM-DD
+func (h *InternalHandler) Prompts(c echo.Context) error {
+	if h.prompts == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "AI service is not configured")
+	}
+
+	response := map[string]interface{}{
+		"prompts": h.prompts.Prompts(),
+	}
+
+	if h.usageService != nil {
+		from, to, err := parseReportRange(c)
+		if err != nil {
+			return err
+		}
+
+		versions, err := h.usageService.PromptVersions(c.Request().Context(), from, to)
+		if err != nil {
+			c.Logger().Errorf("failed to compare prompt versions: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to compare prompt versions")
+		}
+		response["from"] = from.Format("2006-01-02")
+		response["to"] = to.Format("2006-01-02")
+		response["versions"] = versions
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// ReloadPrompts re-reads prompt overrides from disk
+// POST /api/internal/prompts/reload
+func (h *InternalHandler) ReloadPrompts(c echo.Context) error {
+	if h.prompts == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "AI service is not configured")
+	}
+
+	if err := h.prompts.Reload(); err != nil {
+		c.Logger().Errorf("failed to reload prompts: %v", err)
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"prompts": h.prompts.Prompts(),
+	})
+}
+
+// ListExperiments returns the configured experiments
+// GET /api/internal/experiments
+func (h *InternalHandler) ListExperiments(c echo.Context) error {
+	if h.experiments == nil {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"experiments": []services.Experiment{},
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"experiments": h.experiments.Experiments(),
+	})
+}
+
+// ExperimentReport returns outcome metrics per variant of an experiment
+// GET /api/internal/experiments/:id/report
+func (h *InternalHandler) ExperimentReport(c echo.Context) error {
+	if h.experiments == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Experiments are not configured")
+	}
+
+	id := c.Param("id")
+	if _, ok := h.experiments.Get(id); !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "experiment not found")
+	}
+
+	report, err := h.experiments.Report(c.Request().Context(), id)
+	if err != nil {
+		c.Logger().Errorf("failed to build experiment report: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to build experiment report")
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// ListFlaggedMessages returns recently flagged messages for safety review
+// GET /api/internal/safety/flags?limit=50
+func (h *InternalHandler) ListFlaggedMessages(c echo.Context) error {
+	if h.safety == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Database not available")
+	}
+
+	limit := int32(50)
+	if raw := c.QueryParam("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 500 {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be between 1 and 500")
+		}
+		limit = int32(parsed)
+	}
+
+	flagged, err := h.safety.ListFlagged(c.Request().Context(), limit)
+	if err != nil {
+		c.Logger().Errorf("failed to list flagged messages: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list flagged messages")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"messages": flagged,
+	})
+}
+
+// LedgerMismatches lists users whose balances differ from their currency ledger
+// GET /api/internal/ledger/mismatches?limit=50
+func (h *InternalHandler) LedgerMismatches(c echo.Context) error {
+	if h.ledger == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Database not available")
+	}
+
+	limit := int32(50)
+	if raw := c.QueryParam("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 500 {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be between 1 and 500")
+		}
+		limit = int32(parsed)
+	}
+
+	mismatches, err := h.ledger.Mismatches(c.Request().Context(), limit)
+	if err != nil {
+		c.Logger().Errorf("failed to reconcile ledger: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to reconcile ledger")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"mismatches": mismatches,
+	})
+}
+
+// parseReportRange reads the from/to query params of internal reports as
+// WIB days, defaulting to the last defaultReportDays days
+func parseReportRange(c echo.Context) (time.Time, time.Time, error) {
+	now := time.Now().In(reportLocation)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, reportLocation)
+	to := today
+	from := today.AddDate(0, 0, -(defaultReportDays - 1))
+
+	if toParam := c.QueryParam("to"); toParam != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", toParam, reportLocation)
+		if err != nil {
+			return from, to, echo.NewHTTPError(http.StatusBadRequest, "Invalid 'to' date, expected YYYY-MM-DD")
+		}
+		to = parsed
+		from = to.AddDate(0, 0, -(defaultReportDays - 1))
+	}
+	if fromParam := c.QueryParam("from"); fromParam != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", fromParam, reportLocation)
+		if err != nil {
+			return from, to, echo.NewHTTPError(http.StatusBadRequest, "Invalid 'from' date, expected YYYY-MM-DD")
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		return from, to, echo.NewHTTPError(http.StatusBadRequest, "'from' must not be after 'to'")
+	}
+
+	return from, to, nil
+}
@@ -0,0 +1,180 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"catetin/backend/internal/services"
+	"catetin/backend/internal/types"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// ListArtworks returns the whole Galeri catalog, including retired and
+// scheduled artworks
+// GET /api/internal/artworks
+func (h *InternalHandler) ListArtworks(c echo.Context) error {
+	if h.catalog == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Database not available")
+	}
+
+	artworks, err := h.catalog.List(c.Request().Context())
+	if err != nil {
+		c.Logger().Errorf("failed to list artworks: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list artworks")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"artworks": artworks,
+	})
+}
+
+// GetArtwork returns a catalog entry and its versions
+// GET /api/internal/artworks/:id
+func (h *InternalHandler) GetArtwork(c echo.Context) error {
+	if h.catalog == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Database not available")
+	}
+
+	var id pgtype.UUID
+	if err := id.Scan(c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid artwork id")
+	}
+
+	artwork, versions, err := h.catalog.Get(c.Request().Context(), id)
+	if errors.Is(err, services.ErrArtworkNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "artwork not found")
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to get artwork: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get artwork")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"artwork":  artwork,
+		"versions": versions,
+	})
+}
+
+// CreateArtwork adds an artwork to the catalog
+// POST /api/internal/artworks
+func (h *InternalHandler) CreateArtwork(c echo.Context) error {
+	if h.catalog == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Database not available")
+	}
+
+	var req types.ArtworkRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	artwork, err := h.catalog.Create(c.Request().Context(), artworkInput(req))
+	if errors.Is(err, services.ErrInvalidArtwork) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, services.ErrArtworkNameTaken) {
+		return echo.NewHTTPError(http.StatusConflict, "artwork name is taken")
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to create artwork: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create artwork")
+	}
+
+	return c.JSON(http.StatusCreated, artwork)
+}
+
+// UpdateArtwork replaces a catalog entry's fields. Changes to its content
+// create a new version; users keep the version they unlocked.
+// PUT /api/internal/artworks/:id
+func (h *InternalHandler) UpdateArtwork(c echo.Context) error {
+	if h.catalog == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Database not available")
+	}
+
+	var id pgtype.UUID
+	if err := id.Scan(c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid artwork id")
+	}
+
+	var req types.ArtworkRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	artwork, err := h.catalog.Update(c.Request().Context(), id, artworkInput(req))
+	if errors.Is(err, services.ErrInvalidArtwork) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, services.ErrArtworkNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "artwork not found")
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to update artwork: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update artwork")
+	}
+
+	return c.JSON(http.StatusOK, artwork)
+}
+
+// UploadArtworkImage stores a PNG or JPEG sent as the "image" form file and
+// makes it the artwork's base image, creating a new version
+// POST /api/internal/artworks/:id/image
+func (h *InternalHandler) UploadArtworkImage(c echo.Context) error {
+	if h.catalog == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Database not available")
+	}
+
+	var id pgtype.UUID
+	if err := id.Scan(c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid artwork id")
+	}
+
+	file, err := c.FormFile("image")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing image file")
+	}
+	src, err := file.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid image file")
+	}
+	defer src.Close()
+
+	// One byte over the limit is enough for the service to reject it
+	data, err := io.ReadAll(io.LimitReader(src, services.MaxArtworkImageBytes+1))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid image file")
+	}
+
+	artwork, err := h.catalog.SetImage(c.Request().Context(), id, data)
+	if errors.Is(err, services.ErrInvalidArtworkImage) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, services.ErrArtworkNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "artwork not found")
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to upload artwork image: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to upload artwork image")
+	}
+
+	return c.JSON(http.StatusOK, artwork)
+}
+
+// artworkInput converts an artwork request for the catalog service
+func artworkInput(req types.ArtworkRequest) services.ArtworkInput {
+	return services.ArtworkInput{
+		Name:           req.Name,
+		DisplayName:    req.DisplayName,
+		Description:    req.Description,
+		ImageURL:       req.ImageURL,
+		UnlockCost:     req.UnlockCost,
+		RevealCost:     req.RevealCost,
+		SortOrder:      req.SortOrder,
+		AvailableFrom:  req.AvailableFrom,
+		AvailableUntil: req.AvailableUntil,
+		Retired:        req.Retired,
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseReportRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantFrom string
+		wantTo   string
+		wantErr  bool
+	}{
+		{name: "both dates", query: "from=2026-03-01&to=2026-03-07", wantFrom: "2026-03-01", wantTo: "2026-03-07"},
+		{name: "to only", query: "to=2026-03-30", wantFrom: "2026-03-01", wantTo: "2026-03-30"},
+		{name: "invalid date", query: "from=01-03-2026", wantErr: true},
+		{name: "from after to", query: "from=2026-03-08&to=2026-03-07", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			from, to, err := parseReportRange(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseReportRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// Days start at WIB midnight, 17:00 UTC the day before
+			for _, day := range []struct {
+				got  time.Time
+				want string
+			}{{from, tt.wantFrom}, {to, tt.wantTo}} {
+				want, _ := time.ParseInLocation("2006-01-02", day.want, reportLocation)
+				if !day.got.Equal(want) || day.got.UTC().Hour() != 17 {
+					t.Errorf("got %v, want %s 00:00 WIB", day.got, day.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/middleware"
+	"catetin/backend/internal/services"
+	"catetin/backend/internal/types"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// MaxMemoryLength is the maximum number of characters allowed in a memory
+const MaxMemoryLength = 300
+
+// ListMemories returns what Sang Pujangga remembers about the user
+// GET /api/memories
+func (h *Handler) ListMemories(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.memories == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	memories, err := h.memories.List(c.Request().Context(), userID)
+	if err != nil {
+		c.Logger().Errorf("failed to list memories: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list memories")
+	}
+
+	return c.JSON(http.StatusOK, types.ListMemoriesResponse{
+		Memories: memories,
+		Total:    len(memories),
+	})
+}
+
+// UpdateMemory edits a memory
+// PUT /api/memories/:id
+func (h *Handler) UpdateMemory(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.memories == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	var memoryID pgtype.UUID
+	if err := memoryID.Scan(c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid memory id")
+	}
+
+	var req types.UpdateMemoryRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	ctx := c.Request().Context()
+
+	memory, err := h.memories.Get(ctx, userID, memoryID)
+	if errors.Is(err, services.ErrMemoryNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "memory not found")
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to get memory: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get memory")
+	}
+
+	kind, content, importance := memory.Kind, memory.Content, memory.Importance
+	if req.Kind != nil {
+		if !ai.ValidMemoryKind(*req.Kind) {
+			return echo.NewHTTPError(http.StatusBadRequest, "kind must be one of: "+strings.Join(ai.MemoryKinds, ", "))
+		}
+		kind = *req.Kind
+	}
+	if req.Content != nil {
+		content = strings.TrimSpace(*req.Content)
+		if content == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "content is required")
+		}
+		if len([]rune(content)) > MaxMemoryLength {
+			return echo.NewHTTPError(http.StatusBadRequest, "content is too long")
+		}
+	}
+	if req.Importance != nil {
+		if *req.Importance < 1 || *req.Importance > 5 {
+			return echo.NewHTTPError(http.StatusBadRequest, "importance must be between 1 and 5")
+		}
+		importance = *req.Importance
+	}
+
+	updated, err := h.memories.Update(ctx, userID, memoryID, kind, content, importance)
+	if errors.Is(err, services.ErrMemoryNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "memory not found")
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to update memory: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update memory")
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+// DeleteMemory makes Sang Pujangga forget a memory
+// DELETE /api/memories/:id
+func (h *Handler) DeleteMemory(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.memories == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	var memoryID pgtype.UUID
+	if err := memoryID.Scan(c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid memory id")
+	}
+
+	err = h.memories.Delete(c.Request().Context(), userID, memoryID)
+	if errors.Is(err, services.ErrMemoryNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "memory not found")
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to delete memory: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete memory")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// extractSessionMemories extracts memories from an ended session in the background
+func (h *Handler) extractSessionMemories(ctx context.Context, c echo.Context, userID string, sessionID pgtype.UUID) {
+	if h.memories == nil {
+		return
+	}
+
+	logger := c.Logger()
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := h.memories.ExtractSession(ctx, userID, sessionID); err != nil {
+			logger.Errorf("failed to extract memories from session %s: %v", uuidToString(sessionID), err)
+		}
+	}()
+}
+
+// extractPendingMemories extracts memories from the user's earlier sessions
+// in the background, typically when a new session starts
+func (h *Handler) extractPendingMemories(ctx context.Context, userID string) {
+	if h.memories == nil {
+		return
+	}
+
+	go h.memories.ExtractPending(context.WithoutCancel(ctx), userID)
+}
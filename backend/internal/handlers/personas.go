@@ -0,0 +1,159 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+	"catetin/backend/internal/middleware"
+	"catetin/backend/internal/services"
+	"catetin/backend/internal/types"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// ListPersonas returns the companion personas and the user's default
+// GET /api/personas
+func (h *Handler) ListPersonas(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	defaultPersona := ai.DefaultPersona()
+	if h.personas != nil {
+		if defaultPersona, err = h.personas.Default(c.Request().Context(), userID); err != nil {
+			c.Logger().Errorf("failed to get default persona: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get personas")
+		}
+	}
+
+	return c.JSON(http.StatusOK, types.PersonasResponse{
+		Personas:  ai.Personas,
+		DefaultID: defaultPersona.ID,
+	})
+}
+
+// GetPreferences returns the user's preferences
+// GET /api/preferences
+func (h *Handler) GetPreferences(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.personas == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	persona, err := h.personas.Default(c.Request().Context(), userID)
+	if err != nil {
+		c.Logger().Errorf("failed to get preferences: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get preferences")
+	}
+
+	return c.JSON(http.StatusOK, types.PreferencesResponse{PersonaID: persona.ID})
+}
+
+// UpdatePreferences saves the user's default persona
+// PUT /api/preferences
+func (h *Handler) UpdatePreferences(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.personas == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	var req types.PersonaRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	persona, err := h.personas.SetDefault(c.Request().Context(), userID, req.PersonaID)
+	if errors.Is(err, services.ErrUnknownPersona) {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown persona")
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to update preferences: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update preferences")
+	}
+
+	return c.JSON(http.StatusOK, types.PreferencesResponse{PersonaID: persona.ID})
+}
+
+// UpdateSessionPersona overrides the persona of one session; an empty
+// persona_id goes back to the user's default
+// PUT /api/sessions/:id/persona
+func (h *Handler) UpdateSessionPersona(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.personas == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	var sessionID pgtype.UUID
+	if err := sessionID.Scan(c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid session id")
+	}
+
+	var req types.PersonaRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	session, err := h.personas.SetSession(c.Request().Context(), userID, sessionID, req.PersonaID)
+	if errors.Is(err, services.ErrUnknownPersona) {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown persona")
+	}
+	if errors.Is(err, services.ErrSessionNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "session not found")
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to update session persona: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update session")
+	}
+
+	return c.JSON(http.StatusOK, session)
+}
+
+// overrideSessionPersona applies the persona picked when starting a session.
+// Failures are logged and leave the session on the user's default.
+func (h *Handler) overrideSessionPersona(ctx context.Context, c echo.Context, userID string, session db.Session, personaID string) db.Session {
+	if h.personas == nil || personaID == "" {
+		return session
+	}
+
+	updated, err := h.personas.SetSession(ctx, userID, session.ID, personaID)
+	if err != nil {
+		c.Logger().Errorf("failed to set session persona: %v", err)
+		return session
+	}
+	return updated
+}
+
+// sessionPersona returns the persona a session converses as, nil for the
+// default when personas are unavailable
+func (h *Handler) sessionPersona(ctx context.Context, userID string, session db.Session) *ai.Persona {
+	if h.personas == nil {
+		return nil
+	}
+	return h.personas.Resolve(ctx, userID, session)
+}
+
+// personaID returns the ID to record on an assistant message written as persona
+func personaID(persona *ai.Persona) pgtype.Text {
+	if persona == nil {
+		persona = ai.DefaultPersona()
+	}
+	return pgtype.Text{String: persona.ID, Valid: true}
+}
@@ -0,0 +1,147 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"catetin/backend/internal/middleware"
+	"catetin/backend/internal/services"
+	"catetin/backend/internal/types"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// ListQuoteCollections returns the Perpustakaan's quote collections with
+// whether the user unlocked them
+// GET /api/quotes/collections
+func (h *Handler) ListQuoteCollections(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.quotes == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	collections, err := h.quotes.Collections(c.Request().Context(), userID)
+	if err != nil {
+		c.Logger().Errorf("failed to list quote collections: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list quote collections")
+	}
+
+	return c.JSON(http.StatusOK, types.QuoteCollectionsResponse{Collections: collections})
+}
+
+// GetQuoteCollection returns an unlocked quote collection and its quotes
+// GET /api/quotes/collections/:id
+func (h *Handler) GetQuoteCollection(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.quotes == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	var collectionID pgtype.UUID
+	if err := collectionID.Scan(c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid collection id")
+	}
+
+	collection, quotes, err := h.quotes.Collection(c.Request().Context(), userID, collectionID)
+	if errors.Is(err, services.ErrCollectionNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "collection not found")
+	}
+	if errors.Is(err, services.ErrCollectionLocked) {
+		return echo.NewHTTPError(http.StatusForbidden, map[string]interface{}{
+			"error":           "COLLECTION_LOCKED",
+			"message":         "Koleksi ini masih terkunci. Buka dulu untuk membaca kutipannya.",
+			"unlock_currency": collection.UnlockCurrency,
+			"unlock_cost":     collection.UnlockCost,
+		})
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to get quote collection: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get quote collection")
+	}
+
+	return c.JSON(http.StatusOK, types.QuoteCollectionResponse{
+		Collection: collection,
+		Quotes:     quotes,
+	})
+}
+
+// UnlockQuoteCollection pays for a quote collection with Tinta Emas or Marmer
+// POST /api/quotes/collections/:id/unlock
+func (h *Handler) UnlockQuoteCollection(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.quotes == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	var collectionID pgtype.UUID
+	if err := collectionID.Scan(c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid collection id")
+	}
+
+	stats, err := h.quotes.Unlock(c.Request().Context(), userID, collectionID)
+	if errors.Is(err, services.ErrCollectionNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "collection not found")
+	}
+	if errors.Is(err, services.ErrCollectionUnlocked) {
+		return echo.NewHTTPError(http.StatusConflict, "collection is already unlocked")
+	}
+	if errors.Is(err, services.ErrInsufficientBalance) {
+		return echo.NewHTTPError(http.StatusPaymentRequired, map[string]interface{}{
+			"error":   "INSUFFICIENT_BALANCE",
+			"message": "Tinta Emas atau Marmer-mu belum cukup untuk membuka koleksi ini. Terus menulis ya!",
+		})
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to unlock quote collection: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to unlock collection")
+	}
+
+	return c.JSON(http.StatusOK, types.UnlockQuoteCollectionResponse{
+		CollectionID: uuidToString(collectionID),
+		GoldenInk:    stats.GoldenInk,
+		Marble:       stats.Marble,
+	})
+}
+
+// GetQuote returns a quote, e.g. the one attached to a message or session
+// GET /api/quotes/:id
+func (h *Handler) GetQuote(c echo.Context) error {
+	if _, err := middleware.RequireUserID(c); err != nil {
+		return err
+	}
+
+	if h.quotes == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	var quoteID pgtype.UUID
+	if err := quoteID.Scan(c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid quote id")
+	}
+
+	quote, err := h.quotes.Get(c.Request().Context(), quoteID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusNotFound, "quote not found")
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to get quote: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get quote")
+	}
+
+	return c.JSON(http.StatusOK, quote)
+}
@@ -2,6 +2,7 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -17,27 +18,100 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// respondTurn holds the state of a single user turn shared by Respond and RespondStream
+type respondTurn struct {
+	userID           string
+	sessionID        pgtype.UUID
+	content          string
+	userMessage      db.Message
+	aiMessages       []ai.Message
+	userMessageCount int
+	depthLevel       int
+	depth            *services.DepthUpdate // How the message moved the session's depth
+	treatment        ai.Treatment
+	risk             ai.RiskAssessment          // Safety screen of the user's message
+	memories         []ai.Memory                // Relevant facts from earlier sessions
+	summary          string                     // Running summary of the messages before aiMessages
+	topic            ai.TopicGuidance           // Topic to stay on or steer to
+	guide            *ai.GuideTurn              // Template step to ask for, in guided sessions
+	template         *services.TemplateProgress // Where the message left the guided session
+	persona          *ai.Persona                // Persona the reply is written as, nil for the default
+}
+
+// aiContext attaches the turn's caller, experiment treatment and persona to ctx for AI calls
+func (t *respondTurn) aiContext(ctx context.Context) context.Context {
+	return ai.WithPersona(ai.WithTreatment(ai.WithCaller(ctx, t.userID, uuidToString(t.sessionID)), t.treatment), t.persona)
+}
+
+// conversation returns the context the AI replies to
+func (t *respondTurn) conversation() ai.Conversation {
+	return ai.Conversation{
+		Recent:           t.aiMessages,
+		UserMessageCount: t.userMessageCount,
+		Depth:            ai.DepthLevel(t.depthLevel),
+		Memories:         t.memories,
+		Summary:          t.summary,
+		Topic:            t.topic,
+		Guide:            t.guide,
+	}
+}
+
 // Respond generates an AI response for the user's message
 func (h *Handler) Respond(c echo.Context) error {
-	userID, err := middleware.RequireUserID(c)
+	turn, err := h.beginTurn(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	// High-risk messages get the crisis response instead of a generated reply
+	aiResponse := crisisReply()
+	if !turn.crisis() {
+		// Generate AI response from the running summary and the recent messages
+		aiResponse, err = h.pujangga.GenerateResponse(turn.aiContext(ctx), turn.conversation())
+		if err != nil {
+			h.failTurn(ctx, c, turn)
+			if errors.Is(err, ai.ErrBudgetExceeded) {
+				return h.budgetExceededError(err)
+			}
+			c.Logger().Errorf("AI response error: %v", err)
+			return replyFailedError(turn)
+		}
+		aiResponse = h.reviewTurn(ctx, c, turn, aiResponse)
+	}
+
+	response, err := h.completeTurn(ctx, c, turn, aiResponse)
 	if err != nil {
 		return err
 	}
 
+	return c.JSON(http.StatusOK, response)
+}
+
+// beginTurn validates a respond request, enforces plan limits, saves the user's
+// message with its reply pending and loads the conversation context for the
+// AI call. Requests with a message_id retry the reply to a saved message.
+func (h *Handler) beginTurn(c echo.Context) (*respondTurn, error) {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if AI service is available
 	if h.pujangga == nil {
-		return echo.NewHTTPError(http.StatusServiceUnavailable, "AI service is not configured")
+		return nil, echo.NewHTTPError(http.StatusServiceUnavailable, "AI service is not configured")
 	}
 
 	sessionID := c.Param("id")
 	if sessionID == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "session id is required")
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "session id is required")
 	}
 
 	// Parse session UUID
 	var sessionUUID pgtype.UUID
 	if err := sessionUUID.Scan(sessionID); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid session id")
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid session id")
 	}
 
 	// Verify session belongs to user and get session info
@@ -47,76 +121,103 @@ func (h *Handler) Respond(c echo.Context) error {
 	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return echo.NewHTTPError(http.StatusNotFound, "session not found")
+			return nil, echo.NewHTTPError(http.StatusNotFound, "session not found")
 		}
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get session")
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get session")
 	}
 
 	// Check if session is still active
 	if session.Status != "active" {
-		return echo.NewHTTPError(http.StatusBadRequest, "session is no longer active")
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "session is no longer active")
 	}
 
 	// Parse request body
 	var req types.RespondRequest
 	if err := c.Bind(&req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
-	}
-
-	if req.Content == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "content is required")
-	}
-
-	// Validate content length
-	if len([]rune(req.Content)) > MaxMessageLength {
-		return echo.NewHTTPError(http.StatusBadRequest,
-			fmt.Sprintf("Pesan terlalu panjang. Maksimal %d karakter.", MaxMessageLength))
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
 	}
 
 	ctx := c.Request().Context()
 
-	// Check subscription and message limit for free users
-	sub, err := h.queries.UpsertUserSubscription(ctx, userID)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to check subscription")
-	}
+	// A retried message was already validated and counted toward the plan's limit
+	var userMessage db.Message
+	retry := req.MessageID != ""
+	if retry {
+		userMessage, err = h.retryMessage(ctx, sessionUUID, req.MessageID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if req.Content == "" {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "content is required")
+		}
 
-	if sub.Plan == "free" {
-		messagesToday, err := h.queries.CountTodayUserMessages(ctx, userID)
+		// Validate content length
+		if len([]rune(req.Content)) > MaxMessageLength {
+			return nil, echo.NewHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("Pesan terlalu panjang. Maksimal %d karakter.", MaxMessageLength))
+		}
+
+		// Check subscription and message limit for free users
+		sub, err := h.queries.UpsertUserSubscription(ctx, userID)
 		if err != nil {
-			c.Logger().Errorf("failed to count today's messages: %v", err)
-		} else if messagesToday >= FreePlanMessageLimit {
-			return c.JSON(http.StatusForbidden, map[string]interface{}{
-				"error":          "LIMIT_REACHED",
-				"message":        fmt.Sprintf("Kamu sudah mencapai batas harian (%d pesan). Upgrade untuk melanjutkan.", FreePlanMessageLimit),
-				"upgrade_url":    "/pricing",
-				"support_email":  h.supportEmail,
-				"messages_today": messagesToday,
-				"message_limit":  FreePlanMessageLimit,
-			})
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to check subscription")
+		}
+
+		if sub.Plan == "free" {
+			messagesToday, err := h.queries.CountTodayUserMessages(ctx, userID)
+			if err != nil {
+				c.Logger().Errorf("failed to count today's messages: %v", err)
+			} else if messagesToday >= FreePlanMessageLimit {
+				return nil, echo.NewHTTPError(http.StatusForbidden, map[string]interface{}{
+					"error":          "LIMIT_REACHED",
+					"message":        fmt.Sprintf("Kamu sudah mencapai batas harian (%d pesan). Upgrade untuk melanjutkan.", FreePlanMessageLimit),
+					"upgrade_url":    "/pricing",
+					"support_email":  h.supportEmail,
+					"messages_today": messagesToday,
+					"message_limit":  FreePlanMessageLimit,
+				})
+			}
 		}
 	}
 
-	// Save the user's message first
-	userMessage, err := h.queries.CreateMessage(ctx, db.CreateMessageParams{
-		SessionID: sessionUUID,
-		Role:      "user",
-		Content:   req.Content,
-	})
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to save user message")
+	// Check the token budget before saving, so a refused turn leaves no unanswered message
+	if h.budget != nil {
+		if err := h.budget.CheckBudget(ctx, ai.CallInfo{UserID: userID, Feature: ai.FeatureRespond}); err != nil {
+			return nil, h.budgetExceededError(err)
+		}
 	}
 
-	// Increment message count
-	_, _ = h.queries.IncrementSessionMessages(ctx, sessionUUID)
+	// Save the user's message and count it together; its reply stays pending
+	// until completeTurn saves it or failTurn makes it retryable
+	if !retry {
+		err = h.pool.InTx(ctx, func(tx pgx.Tx) error {
+			q := h.queries.WithTx(tx)
+
+			var err error
+			if userMessage, err = q.CreatePendingMessage(ctx, db.CreatePendingMessageParams{
+				SessionID: sessionUUID,
+				Content:   req.Content,
+			}); err != nil {
+				return err
+			}
+			_, err = q.IncrementSessionMessages(ctx, sessionUUID)
+			return err
+		})
+		if err != nil {
+			c.Logger().Errorf("failed to save user message: %v", err)
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to save user message")
+		}
+	}
 
-	// Get only the last 6 messages for sliding context (3 exchanges = 6 messages)
+	// Get the messages not yet folded into the running summary: at least the
+	// last 6 (3 exchanges), plus those waiting for the next summary refresh
 	recentMessages, err := h.queries.GetRecentMessages(ctx, db.GetRecentMessagesParams{
 		SessionID: sessionUUID,
-		Limit:     6,
+		Limit:     services.SessionContextMessages + services.SessionSummaryBatch,
 	})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get conversation history")
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get conversation history")
 	}
 
 	// Reverse to get chronological order (query returns DESC)
@@ -124,13 +225,16 @@ func (h *Handler) Respond(c echo.Context) error {
 		recentMessages[i], recentMessages[j] = recentMessages[j], recentMessages[i]
 	}
 
-	// Convert to AI message format
-	aiMessages := make([]ai.Message, len(recentMessages))
-	for i, msg := range recentMessages {
-		aiMessages[i] = ai.Message{
+	// Convert to AI message format, skipping messages the summary already covers
+	aiMessages := make([]ai.Message, 0, len(recentMessages))
+	for _, msg := range recentMessages {
+		if session.RunningSummaryUntil.Valid && !msg.CreatedAt.Time.After(session.RunningSummaryUntil.Time) {
+			continue
+		}
+		aiMessages = append(aiMessages, ai.Message{
 			Role:    msg.Role,
 			Content: msg.Content,
-		}
+		})
 	}
 
 	// Count total user messages for depth calculation
@@ -140,31 +244,227 @@ func (h *Handler) Respond(c echo.Context) error {
 		userMessageCount = 1 // fallback
 	}
 
-	// Calculate depth level
-	depthLevel := int(ai.CalculateDepth(int(userMessageCount)))
+	treatment := h.treatment(ctx, userID)
+
+	turn := &respondTurn{
+		userID:           userID,
+		sessionID:        sessionUUID,
+		content:          userMessage.Content,
+		userMessage:      userMessage,
+		aiMessages:       aiMessages,
+		summary:          session.RunningSummary,
+		userMessageCount: int(userMessageCount),
+		treatment:        treatment,
+		persona:          h.sessionPersona(ctx, userID, session),
+	}
+
+	// Screen the message before any AI call
+	h.screenTurn(ctx, c, turn)
+
+	// Score the message's substance to advance or hold the conversation depth
+	h.advanceTurnDepth(ctx, turn, session)
+
+	// Move guided sessions through their template's steps
+	h.advanceTurnTemplate(turn, session)
+
+	// Label the message's topics and decide whether to suggest another topic
+	h.trackTurnTopics(ctx, c, turn)
+
+	// Recall what the Pujangga knows from earlier sessions
+	if h.memories != nil && !turn.crisis() {
+		turn.memories, err = h.memories.Relevant(ctx, userID, aiMessages, maxPromptMemories)
+		if err != nil {
+			c.Logger().Errorf("failed to recall memories: %v", err)
+		}
+	}
+
+	return turn, nil
+}
+
+// retryMessage loads a saved user message whose reply failed or never
+// arrived, so it can be answered again. Only the session's latest message
+// can be retried, so replies stay in order.
+func (h *Handler) retryMessage(ctx context.Context, sessionID pgtype.UUID, messageID string) (db.Message, error) {
+	var messageUUID pgtype.UUID
+	if err := messageUUID.Scan(messageID); err != nil {
+		return db.Message{}, echo.NewHTTPError(http.StatusBadRequest, "invalid message id")
+	}
+
+	message, err := h.queries.GetSessionMessage(ctx, db.GetSessionMessageParams{
+		ID:        messageUUID,
+		SessionID: sessionID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.Message{}, echo.NewHTTPError(http.StatusNotFound, "message not found")
+		}
+		return db.Message{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get message")
+	}
+
+	switch message.ReplyStatus.String {
+	case replyStatusPending, replyStatusFailed:
+	case replyStatusReplied:
+		return db.Message{}, echo.NewHTTPError(http.StatusConflict, "message has already been replied to")
+	default:
+		return db.Message{}, echo.NewHTTPError(http.StatusBadRequest, "message is not awaiting a reply")
+	}
 
-	// Generate AI response with sliding context
-	aiResponse, err := h.pujangga.GenerateResponse(ctx, aiMessages, int(userMessageCount))
+	latest, err := h.queries.GetRecentMessages(ctx, db.GetRecentMessagesParams{
+		SessionID: sessionID,
+		Limit:     1,
+	})
 	if err != nil {
-		c.Logger().Errorf("AI response error: %v", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate AI response")
+		return db.Message{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get conversation history")
+	}
+	if len(latest) == 0 || latest[0].ID != message.ID {
+		return db.Message{}, echo.NewHTTPError(http.StatusConflict, "only the latest message can be retried")
 	}
 
-	// Save the AI's response
-	aiMessage, err := h.queries.CreateMessage(ctx, db.CreateMessageParams{
-		SessionID: sessionUUID,
-		Role:      "assistant",
-		Content:   aiResponse.Message,
+	return message, nil
+}
+
+// completeTurn saves the AI's reply and applies the rewards for the user's message.
+// Everything the turn changes is saved in one transaction, so a failure leaves
+// the user's message retryable instead of a half-saved turn.
+// Crisis turns earn no rewards, so the app never celebrates a message in distress.
+func (h *Handler) completeTurn(ctx context.Context, c echo.Context, turn *respondTurn, aiResponse *ai.PujanggaResponse) (*types.RespondResponse, error) {
+	// Save the AI's response; the crisis response is the same whatever the
+	// persona, and never comes with a quote
+	var persona pgtype.Text
+	var quote *db.Quote
+	var quoteID pgtype.UUID
+	if !turn.crisis() {
+		persona = personaID(turn.persona)
+
+		// Attach a quote that fits the emotions of the message
+		if h.quotes != nil {
+			matched, err := h.quotes.ForReply(ctx, turn.userID, turn.sessionID, aiResponse.Emotions)
+			if err != nil {
+				c.Logger().Errorf("failed to match quote: %v", err)
+			} else if matched != nil {
+				quote, quoteID = matched, matched.ID
+			}
+		}
+	}
+	reply := db.CreateMessageParams{
+		SessionID:     turn.sessionID,
+		Role:          "assistant",
+		Content:       aiResponse.Message,
+		PromptVersion: pgtype.Text{String: aiResponse.PromptVersion, Valid: aiResponse.PromptVersion != ""},
+		PersonaID:     persona,
+		QuoteID:       quoteID,
+	}
+
+	var aiMessage db.Message
+	var rewards *types.Rewards
+	err := h.pool.InTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		aiMessage, rewards, err = h.saveTurn(ctx, tx, turn, reply, aiResponse.Emotions)
+		return err
 	})
+	if errors.Is(err, errReplyClaimed) {
+		return nil, echo.NewHTTPError(http.StatusConflict, map[string]interface{}{
+			"error":      "ALREADY_REPLIED",
+			"message":    "message has already been replied to",
+			"message_id": uuidToString(turn.userMessage.ID),
+		})
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to save turn: %v", err)
+		h.failTurn(ctx, c, turn)
+		return nil, replyFailedError(turn)
+	}
+	turn.userMessage.ReplyStatus = pgtype.Text{String: replyStatusReplied, Valid: true}
+
+	// Fold older messages into the running summary once enough have piled up;
+	// the reply just saved is the one message aiMessages doesn't include
+	if h.summaries != nil && len(turn.aiMessages)+1 >= services.SessionContextMessages+services.SessionSummaryBatch {
+		h.refreshSessionSummary(ctx, c, turn)
+	}
+
+	// Store the structured output once the guided session's last step is done
+	if turn.template != nil && turn.template.JustCompleted {
+		h.recordTemplateOutput(ctx, c, turn)
+	}
+
+	var safety *types.SafetyNotice
+	if turn.crisis() {
+		safety = &types.SafetyNotice{
+			RiskLevel: string(turn.risk.Level),
+			Hotlines:  crisisHotlines,
+		}
+
+		// Report the current level without awarding anything
+		if h.leveling != nil {
+			if levelInfo, err := h.leveling.GetCurrentLevel(ctx, turn.userID); err == nil {
+				rewards.Level = levelInfo.Level
+				rewards.XPToNextLevel = levelInfo.XPToNextLevel
+			}
+		}
+	}
+
+	return &types.RespondResponse{
+		Message:      aiMessage,
+		UserMessage:  turn.userMessage,
+		MessageCount: turn.userMessageCount,
+		DepthLevel:   turn.depthLevel,
+		Depth:        turn.depth,
+		Template:     turn.template,
+		Quote:        quote,
+		Rewards:      rewards,
+		Safety:       safety,
+	}, nil
+}
+
+// errReplyClaimed is returned by saveTurn when another attempt already replied to the message
+var errReplyClaimed = errors.New("message has already been replied to")
+
+// saveTurn saves the reply to the turn's message in tx together with the
+// message count, the session's depth and template progress, the detected
+// emotions and the rewards for the message
+func (h *Handler) saveTurn(ctx context.Context, tx pgx.Tx, turn *respondTurn, reply db.CreateMessageParams, emotions []string) (db.Message, *types.Rewards, error) {
+	q := h.queries.WithTx(tx)
+
+	// Claim the reply first; concurrent retries of the message wait here and
+	// find it replied
+	claimed, err := q.MarkMessageReplied(ctx, turn.userMessage.ID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to save AI response")
+		return db.Message{}, nil, fmt.Errorf("failed to mark message replied: %w", err)
+	}
+	if claimed == 0 {
+		return db.Message{}, nil, errReplyClaimed
+	}
+
+	aiMessage, err := q.CreateMessage(ctx, reply)
+	if err != nil {
+		return db.Message{}, nil, fmt.Errorf("failed to save AI response: %w", err)
 	}
 
 	// Increment message count for AI message
-	_, _ = h.queries.IncrementSessionMessages(ctx, sessionUUID)
+	if _, err := q.IncrementSessionMessages(ctx, turn.sessionID); err != nil {
+		return db.Message{}, nil, fmt.Errorf("failed to count AI response: %w", err)
+	}
+
+	if h.depth != nil && turn.depth != nil {
+		if err := h.depth.WithTx(tx).Save(ctx, *turn.depth); err != nil {
+			return db.Message{}, nil, err
+		}
+	}
+	if h.templates != nil {
+		if err := h.templates.WithTx(tx).Save(ctx, turn.template); err != nil {
+			return db.Message{}, nil, err
+		}
+	}
+
+	// Store the detected emotions against the user's message for the mood timeline
+	if h.emotions != nil {
+		if err := h.emotions.WithTx(tx).RecordEmotions(ctx, turn.userID, turn.userMessage.ID, emotions); err != nil {
+			return db.Message{}, nil, err
+		}
+	}
 
 	// Calculate rewards for THIS message (incremental rewards)
-	wordCount := services.CountWords(req.Content)
+	wordCount := services.CountWords(turn.content)
 
 	// Initialize rewards with default level info
 	rewards := &types.Rewards{
@@ -176,46 +476,73 @@ func (h *Handler) Respond(c echo.Context) error {
 		LeveledUp:     false,
 		XPToNextLevel: 100,
 	}
+	if turn.crisis() {
+		return aiMessage, rewards, nil
+	}
 
 	// Calculate gamification rewards (Tinta Emas, Marmer, Streak)
 	if h.gamification != nil {
-		messageReward, err := h.gamification.CalculateMessageReward(ctx, userID, wordCount)
+		gamification := h.gamification.WithTx(tx)
+		messageReward, err := gamification.CalculateMessageReward(ctx, turn.userID, wordCount)
 		if err != nil {
-			c.Logger().Errorf("failed to calculate message reward: %v", err)
-		} else {
-			// Apply rewards immediately
-			_, err = h.gamification.ApplyRewards(ctx, userID, messageReward)
-			if err != nil {
-				c.Logger().Errorf("failed to apply rewards: %v", err)
-			} else {
-				rewards.TintaEmas = messageReward.TintaEmas
-				rewards.Marmer = messageReward.Marmer
-				rewards.NewStreak = messageReward.NewStreak
-
-				// Add earned golden ink to session
-				_, _ = h.gamification.AddSessionReward(ctx, sessionUUID, messageReward.TintaEmas)
-			}
+			return db.Message{}, nil, fmt.Errorf("failed to calculate message reward: %w", err)
 		}
+		if _, err := gamification.ApplyRewards(ctx, turn.userID, turn.sessionID, turn.userMessage.ID, messageReward); err != nil {
+			return db.Message{}, nil, fmt.Errorf("failed to apply rewards: %w", err)
+		}
+
+		// Add earned golden ink to session
+		if _, err := gamification.AddSessionReward(ctx, turn.sessionID, messageReward.TintaEmas); err != nil {
+			return db.Message{}, nil, fmt.Errorf("failed to add session reward: %w", err)
+		}
+
+		rewards.TintaEmas = messageReward.TintaEmas
+		rewards.Marmer = messageReward.Marmer
+		rewards.NewStreak = messageReward.NewStreak
 	}
 
 	// Calculate leveling rewards (XP and Level)
 	if h.leveling != nil {
-		levelReward, err := h.leveling.AwardXP(ctx, userID, wordCount)
+		levelReward, err := h.leveling.WithTx(tx).AwardXP(ctx, turn.userID, turn.sessionID, turn.userMessage.ID, wordCount)
 		if err != nil {
-			c.Logger().Errorf("failed to award XP: %v", err)
-		} else {
-			rewards.XPEarned = levelReward.XPEarned
-			rewards.Level = levelReward.Level
-			rewards.LeveledUp = levelReward.LeveledUp
-			rewards.XPToNextLevel = levelReward.XPToNextLevel
+			return db.Message{}, nil, fmt.Errorf("failed to award XP: %w", err)
 		}
+		rewards.XPEarned = levelReward.XPEarned
+		rewards.Level = levelReward.Level
+		rewards.LeveledUp = levelReward.LeveledUp
+		rewards.XPToNextLevel = levelReward.XPToNextLevel
 	}
 
-	return c.JSON(http.StatusOK, types.RespondResponse{
-		Message:      aiMessage,
-		UserMessage:  userMessage,
-		MessageCount: int(userMessageCount),
-		DepthLevel:   depthLevel,
-		Rewards:      rewards,
+	return aiMessage, rewards, nil
+}
+
+// failTurn makes the turn's message retryable after its reply couldn't be
+// generated or saved. The reply and everything it changes are saved
+// together, so nothing else needs undoing.
+func (h *Handler) failTurn(ctx context.Context, c echo.Context, turn *respondTurn) {
+	if err := h.queries.MarkMessageReplyFailed(context.WithoutCancel(ctx), turn.userMessage.ID); err != nil {
+		c.Logger().Errorf("failed to mark reply to message %s as failed: %v", uuidToString(turn.userMessage.ID), err)
+	}
+}
+
+// replyFailedError tells the client its message was saved without a reply,
+// which it can retry by sending the message_id
+func replyFailedError(turn *respondTurn) *echo.HTTPError {
+	return echo.NewHTTPError(http.StatusInternalServerError, map[string]interface{}{
+		"error":      "REPLY_FAILED",
+		"message":    "Sang Pujangga belum bisa membalas. Pesanmu sudah tersimpan, silakan coba lagi.",
+		"message_id": uuidToString(turn.userMessage.ID),
 	})
 }
+
+// refreshSessionSummary updates the turn's session summary in the background,
+// so the reply isn't delayed by the extra model call
+func (h *Handler) refreshSessionSummary(ctx context.Context, c echo.Context, turn *respondTurn) {
+	logger := c.Logger()
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := h.summaries.Refresh(ctx, turn.userID, turn.sessionID); err != nil {
+			logger.Errorf("failed to refresh summary of session %s: %v", uuidToString(turn.sessionID), err)
+		}
+	}()
+}
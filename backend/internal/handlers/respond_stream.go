@@ -0,0 +1,212 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"catetin/backend/internal/ai"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SSE event names sent by RespondStream
+const (
+	sseEventToken = "token" // data: {"content": "..."} for each streamed chunk
+	sseEventDone  = "done"  // data: types.RespondResponse once the reply is saved
+	sseEventError = "error" // data: {"message": "..."} when the turn fails mid-stream, plus "error" code when known
+)
+
+// sseWriter writes Server-Sent Events to an Echo response
+type sseWriter struct {
+	res *echo.Response
+}
+
+// newSSEWriter prepares the response for event streaming and flushes the headers
+func newSSEWriter(c echo.Context) *sseWriter {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	return &sseWriter{res: res}
+}
+
+// send writes a single event with a JSON-encoded payload and flushes it to the client
+func (w *sseWriter) send(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(w.res, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	w.res.Flush()
+
+	return nil
+}
+
+// heldTokens sends streamed reply tokens to the client, holding them back
+// while the model safety review of the turn is still running, and until the
+// reply is complete when guardrails may replace it
+type heldTokens struct {
+	stream   *sseWriter
+	turn     *respondTurn
+	cancel   context.CancelFunc // Stops generation once the review finds a crisis
+	reviewed chan struct{}      // Closed when the review is done, nil without a review
+	guarded  bool               // Whether guardrails check the complete reply
+	held     []string
+}
+
+// send streams a token, or holds it until the review is done or, with
+// guardrails, the reply is complete. A crisis found by the review stops the
+// stream.
+func (t *heldTokens) send(token string) error {
+	if t.reviewed != nil {
+		select {
+		case <-t.reviewed:
+		default:
+			t.held = append(t.held, token)
+			return nil
+		}
+	}
+	if t.turn.crisis() {
+		// Cancelling rather than failing keeps the model's health untouched
+		t.cancel()
+		return context.Canceled
+	}
+	if t.guarded {
+		t.held = append(t.held, token)
+		return nil
+	}
+
+	if err := t.flush(); err != nil {
+		return err
+	}
+	return t.stream.send(sseEventToken, map[string]string{"content": token})
+}
+
+// finish sends the held tokens of a complete reply once the review has
+// passed. Tokens that don't add up to message, the reply the guardrails
+// passed, are replaced by it.
+func (t *heldTokens) finish(message string) error {
+	if t.guarded && strings.TrimSpace(strings.Join(t.held, "")) != message {
+		t.held = []string{message}
+	}
+	return t.flush()
+}
+
+// flush sends the held tokens; only call it once the review has passed
+func (t *heldTokens) flush() error {
+	for _, token := range t.held {
+		if err := t.stream.send(sseEventToken, map[string]string{"content": token}); err != nil {
+			return err
+		}
+	}
+	t.held = nil
+	return nil
+}
+
+// wait blocks until the review is done
+func (t *heldTokens) wait() {
+	if t.reviewed != nil {
+		<-t.reviewed
+	}
+}
+
+// RespondStream generates an AI response like Respond, but streams the reply
+// tokens to the client over Server-Sent Events as they arrive.
+// The final "done" event carries the saved message, depth level and rewards.
+// High-risk messages get the crisis response with no tokens streamed at all.
+// With the model safety review on, tokens are held back until it passes, so
+// a reply it turns into the crisis response is never shown; with it off,
+// only the lexicon screen before generation protects the stream.
+// With guardrails on, tokens are held back until the complete reply has
+// passed them, and a repaired or replaced reply is sent in place of the
+// generated tokens, so text breaking the rules never reaches the client.
+// The assistant message is only saved once the full reply has been received,
+// so a client disconnect mid-stream never leaves a partial reply behind; the
+// user's message is left for the client to retry instead.
+func (h *Handler) RespondStream(c echo.Context) error {
+	turn, err := h.beginTurn(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	stream := newSSEWriter(c)
+
+	// High-risk messages skip generation; the crisis response arrives with the "done" event
+	if turn.crisis() {
+		return h.finishStream(ctx, c, stream, turn, crisisReply())
+	}
+
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	defer cancelStream()
+
+	tokens := &heldTokens{stream: stream, turn: turn, cancel: cancelStream, guarded: h.pujangga.Guarded()}
+	if h.safety != nil && h.safety.Reviews() {
+		tokens.reviewed = make(chan struct{})
+		go func() {
+			defer close(tokens.reviewed)
+			h.reviewTurn(context.WithoutCancel(ctx), c, turn, nil)
+		}()
+	}
+
+	aiResponse, err := h.pujangga.StreamResponse(turn.aiContext(streamCtx), turn.conversation(), tokens.send)
+	tokens.wait()
+	if turn.crisis() {
+		return h.finishStream(ctx, c, stream, turn, crisisReply())
+	}
+	if err == nil {
+		err = tokens.finish(aiResponse.Message)
+	}
+	if err != nil {
+		// The message stays saved without a reply, for the client to retry
+		h.failTurn(ctx, c, turn)
+		if ctx.Err() != nil {
+			c.Logger().Warnf("client disconnected during stream for session %s: %v", uuidToString(turn.sessionID), err)
+			return nil
+		}
+		if errors.Is(err, ai.ErrBudgetExceeded) {
+			budgetErr := h.budgetExceededError(err)
+			_ = stream.send(sseEventError, budgetErr.Message)
+			return nil
+		}
+		c.Logger().Errorf("AI stream error: %v", err)
+		_ = stream.send(sseEventError, replyFailedError(turn).Message)
+		return nil
+	}
+
+	return h.finishStream(ctx, c, stream, turn, aiResponse)
+}
+
+// finishStream saves a complete, reviewed reply, then sends the "done" event.
+// The reply is persisted even if the client goes away, so the message, counts
+// and rewards are saved together.
+func (h *Handler) finishStream(ctx context.Context, c echo.Context, stream *sseWriter, turn *respondTurn, aiResponse *ai.PujanggaResponse) error {
+	ctx = context.WithoutCancel(ctx)
+
+	response, err := h.completeTurn(ctx, c, turn, aiResponse)
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			_ = stream.send(sseEventError, httpErr.Message)
+		}
+		return nil
+	}
+
+	if err := stream.send(sseEventDone, response); err != nil {
+		c.Logger().Warnf("failed to send final stream event: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/types"
+)
+
+// sseEvent is one Server-Sent Event of a recorded stream
+type sseEvent struct {
+	name string
+	data string
+}
+
+// readEvents parses the events of a Server-Sent Events body
+func readEvents(t *testing.T, body string) []sseEvent {
+	t.Helper()
+
+	var events []sseEvent
+	var event sseEvent
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		case line == "" && event.name != "":
+			events = append(events, event)
+			event = sseEvent{}
+		}
+	}
+	return events
+}
+
+func TestRespondStreamHoldsTokensUntilGuardrailsPass(t *testing.T) {
+	const (
+		valid     = "Kedengarannya hari ini berat sekali. Bagian mana yang paling menguras tenagamu?"
+		violating = "Literally capek banget ya. Slay terus bestie."
+	)
+
+	tests := []struct {
+		name     string
+		streamed string // What the model streams
+		repaired string // What the model answers to the repair prompt
+		want     string
+	}{
+		{name: "valid reply streamed", streamed: valid, repaired: valid, want: valid},
+		{name: "violating reply repaired", streamed: violating, repaired: valid, want: valid},
+		{name: "unrepairable reply replaced", streamed: violating, repaired: violating, want: ai.SafePrompt(ai.DepthSurface, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := ai.NewClient(context.Background(), ai.ClientConfig{
+				Provider: ai.NewScriptedProvider([]ai.ScriptRule{
+					{Match: "Tulis ulang balasanmu", Response: tt.repaired},
+					{Match: "Tulis HANYA teks balasanmu", Response: tt.streamed},
+				}),
+			})
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+			prompts, err := ai.NewPromptRegistry("")
+			if err != nil {
+				t.Fatalf("NewPromptRegistry: %v", err)
+			}
+
+			fake := newFakeDB(t)
+			session := fake.addSession(time.Now())
+			fake.addMessage(session, "assistant", "Hari ini terasa seperti apa?")
+			h := newTestHandler(fake, ai.NewPujanggaService(client, prompts, ai.DefaultGuardrails()))
+
+			rec := serve(t, h.RespondStream, http.MethodPost, `{"content": "`+testMessage+`"}`, session.ID)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+
+			var streamed strings.Builder
+			var done *types.RespondResponse
+			for _, event := range readEvents(t, rec.Body.String()) {
+				switch event.name {
+				case sseEventToken:
+					var token map[string]string
+					if err := json.Unmarshal([]byte(event.data), &token); err != nil {
+						t.Fatalf("token event %q: %v", event.data, err)
+					}
+					streamed.WriteString(token["content"])
+				case sseEventDone:
+					done = &types.RespondResponse{}
+					if err := json.Unmarshal([]byte(event.data), done); err != nil {
+						t.Fatalf("done event %q: %v", event.data, err)
+					}
+				default:
+					t.Fatalf("unexpected %q event: %s", event.name, event.data)
+				}
+			}
+
+			if got := strings.TrimSpace(streamed.String()); got != tt.want {
+				t.Errorf("streamed %q, want %q", got, tt.want)
+			}
+			if done == nil || done.Message.Content != tt.want {
+				t.Fatalf("done event = %+v, want the message %q", done, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"catetin/backend/internal/types"
+)
+
+const testMessage = "Capek banget, kerjaan numpuk dan atasan terus nanya progres."
+
+func TestRespondFlow(t *testing.T) {
+	fake := newFakeDB(t)
+	session := fake.addSession(time.Now())
+	fake.addMessage(session, "assistant", "Hari ini terasa seperti apa?")
+	h := newTestHandler(fake, newCassettePujangga(t))
+
+	rec := serve(t, h.Respond, http.MethodPost, `{"content": "`+testMessage+`"}`, session.ID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var response types.RespondResponse
+	decode(t, rec, &response)
+	if response.Message.Role != "assistant" || response.Message.Content == "" {
+		t.Errorf("message = %+v, want the generated reply", response.Message)
+	}
+	if response.UserMessage.Content != testMessage || response.UserMessage.ReplyStatus.String != replyStatusReplied {
+		t.Errorf("user_message = %+v, want the sent message marked replied", response.UserMessage)
+	}
+	if response.MessageCount != 1 {
+		t.Errorf("message_count = %d, want 1", response.MessageCount)
+	}
+
+	// The pending message and the reply are saved in their own transactions
+	if fake.commits != 2 || fake.rollbacks != 0 {
+		t.Errorf("%d commits and %d rollbacks, want 2 and 0", fake.commits, fake.rollbacks)
+	}
+	if len(fake.messages) != 3 || session.TotalMessages != 3 {
+		t.Fatalf("session has %d messages counted as %d, want 3", len(fake.messages), session.TotalMessages)
+	}
+	if saved := fake.messages[2]; saved.ID != response.Message.ID || saved.Content != response.Message.Content {
+		t.Errorf("saved reply = %+v, want the returned reply", saved)
+	}
+	if saved := fake.messages[1]; saved.ReplyStatus.String != replyStatusReplied {
+		t.Errorf("saved message reply_status = %q, want %q", saved.ReplyStatus.String, replyStatusReplied)
+	}
+
+	// Rewards are posted to the ledger and match the balances
+	rewards := response.Rewards
+	if rewards == nil || rewards.TintaEmas <= 0 || rewards.XPEarned <= 0 || rewards.NewStreak != 1 {
+		t.Fatalf("rewards = %+v, want Tinta Emas, XP and a new streak", rewards)
+	}
+	stats := fake.stats[testUserID]
+	if stats.GoldenInk != rewards.TintaEmas || stats.TotalXp != rewards.XPEarned || session.GoldenInkEarned != rewards.TintaEmas {
+		t.Errorf("stats = %+v and session earned %d, want the rewards %+v", stats, session.GoldenInkEarned, rewards)
+	}
+	if len(fake.ledger) == 0 {
+		t.Error("rewards were not posted to the ledger")
+	}
+}
+
+func TestRespondRefusals(t *testing.T) {
+	tests := []struct {
+		name        string
+		tokensToday int64
+		sent        int // User messages already sent today
+		wantStatus  int
+		wantError   string
+	}{
+		{
+			name:        "token budget exhausted",
+			tokensToday: testBudgets["free"].Daily,
+			wantStatus:  http.StatusTooManyRequests,
+			wantError:   "TOKEN_BUDGET_EXCEEDED",
+		},
+		{
+			name:       "free plan message limit",
+			sent:       FreePlanMessageLimit,
+			wantStatus: http.StatusForbidden,
+			wantError:  "LIMIT_REACHED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeDB(t)
+			fake.tokensToday = tt.tokensToday
+			session := fake.addSession(time.Now())
+			for i := 0; i < tt.sent; i++ {
+				fake.addMessage(session, "user", testMessage)
+			}
+			saved := len(fake.messages)
+
+			// Refused turns never reach the provider, so no cassette is needed
+			h := newTestHandler(fake, newCassettePujangga(t))
+			rec := serve(t, h.Respond, http.MethodPost, `{"content": "`+testMessage+`"}`, session.ID)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if code := errorCode(t, rec); code != tt.wantError {
+				t.Errorf("error = %q, want %q", code, tt.wantError)
+			}
+
+			// A refused turn leaves no unanswered message behind
+			if len(fake.messages) != saved || fake.commits != 0 {
+				t.Errorf("saved %d messages in %d transactions, want none", len(fake.messages)-saved, fake.commits)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/types"
+
+	"github.com/labstack/echo/v4"
+)
+
+// crisisResponse is the reviewed reply sent instead of Pujangga's when a
+// message is screened as high risk. Changes must be reviewed before release.
+const crisisResponse = "Terima kasih sudah mau cerita. Kedengarannya kamu sedang menanggung sesuatu yang sangat berat, " +
+	"dan kamu nggak harus menghadapinya sendirian. Kalau kamu sedang dalam bahaya atau berpikir untuk menyakiti diri sendiri, " +
+	"tolong hubungi Layanan SEJIWA di 119 ext. 8 atau nomor darurat 112 sekarang, atau datang ke IGD rumah sakit terdekat. " +
+	"Coba juga kabari satu orang yang kamu percaya. Aku tetap di sini kalau kamu mau lanjut menulis."
+
+// crisisHotlines are the Indonesian support contacts shown with the crisis response
+var crisisHotlines = []types.Hotline{
+	{
+		Name:        "Layanan SEJIWA (Kementerian Kesehatan)",
+		Number:      "119 ext. 8",
+		Description: "Layanan konseling kesehatan jiwa, gratis",
+	},
+	{
+		Name:        "Nomor Darurat Nasional",
+		Number:      "112",
+		Description: "Panggilan darurat 24 jam, gratis",
+	},
+}
+
+// crisisReply returns the crisis response in place of a Pujangga reply
+func crisisReply() *ai.PujanggaResponse {
+	return &ai.PujanggaResponse{
+		Message:       crisisResponse,
+		Emotions:      []string{},
+		PromptVersion: ai.CrisisPromptVersion,
+	}
+}
+
+// crisis reports whether the turn was screened as high risk
+func (t *respondTurn) crisis() bool {
+	return t.risk.Level == ai.RiskHigh
+}
+
+// screenTurn screens the user's message locally before the AI call and flags it when risky
+func (h *Handler) screenTurn(ctx context.Context, c echo.Context, turn *respondTurn) {
+	if h.safety == nil {
+		return
+	}
+
+	turn.risk = h.safety.Screen(turn.content)
+	if err := h.safety.Flag(ctx, turn.userMessage.ID, turn.risk); err != nil {
+		c.Logger().Errorf("failed to flag message: %v", err)
+	}
+}
+
+// reviewTurn runs the model risk check of the turn, after the AI call or,
+// when streaming, alongside it. A high risk replaces the generated reply
+// with the crisis response.
+func (h *Handler) reviewTurn(ctx context.Context, c echo.Context, turn *respondTurn, aiResponse *ai.PujanggaResponse) *ai.PujanggaResponse {
+	if h.safety == nil {
+		return aiResponse
+	}
+
+	review := h.safety.Review(turn.aiContext(ctx), turn.aiMessages)
+	if review.Level == ai.RiskNone {
+		return aiResponse
+	}
+
+	if err := h.safety.Flag(ctx, turn.userMessage.ID, review); err != nil {
+		c.Logger().Errorf("failed to flag message: %v", err)
+	}
+	turn.risk = turn.risk.Higher(review)
+
+	if turn.crisis() {
+		return crisisReply()
+	}
+	return aiResponse
+}
@@ -2,6 +2,7 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strconv"
@@ -63,7 +64,9 @@ func (h *Handler) ListSessions(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list sessions")
 	}
 
-	// Transform to response format with proper string handling for first_user_message
+	// Transform to response format with proper string handling for first_user_message.
+	// Title and summary are set once a session is completed; first_user_message
+	// remains the preview for other sessions.
 	type sessionWithPreview struct {
 		ID               string  `json:"id"`
 		UserID           string  `json:"user_id"`
@@ -74,6 +77,8 @@ func (h *Handler) ListSessions(c echo.Context) error {
 		EndedAt          *string `json:"ended_at"`
 		CreatedAt        string  `json:"created_at"`
 		UpdatedAt        string  `json:"updated_at"`
+		Title            *string `json:"title"`
+		Summary          *string `json:"summary"`
 		FirstUserMessage string  `json:"first_user_message"`
 	}
 
@@ -85,6 +90,14 @@ func (h *Handler) ListSessions(c echo.Context) error {
 			endedAt = &t
 		}
 
+		var title, summary *string
+		if s.Title.Valid {
+			title = &s.Title.String
+		}
+		if s.Summary.Valid {
+			summary = &s.Summary.String
+		}
+
 		firstMsg := ""
 		if s.FirstUserMessage != nil {
 			if str, ok := s.FirstUserMessage.(string); ok {
@@ -102,6 +115,8 @@ func (h *Handler) ListSessions(c echo.Context) error {
 			EndedAt:          endedAt,
 			CreatedAt:        s.CreatedAt.Time.Format(time.RFC3339),
 			UpdatedAt:        s.UpdatedAt.Time.Format(time.RFC3339),
+			Title:            title,
+			Summary:          summary,
 			FirstUserMessage: firstMsg,
 		}
 	}
@@ -155,7 +170,8 @@ func (h *Handler) GetSession(c echo.Context) error {
 	})
 }
 
-// UpdateSession updates a session (end it with a status)
+// UpdateSession updates a session (end it with a status). Completed sessions
+// get a closing reflection, title and summary.
 func (h *Handler) UpdateSession(c echo.Context) error {
 	userID, err := middleware.RequireUserID(c)
 	if err != nil {
@@ -197,6 +213,28 @@ func (h *Handler) UpdateSession(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update session")
 	}
 
+	// Close completed sessions with a reflection, a title and a summary. A
+	// failed closing still completes the session.
+	if req.Status == "completed" && h.closings != nil {
+		closed, err := h.closings.Close(c.Request().Context(), userID, session)
+		if err != nil {
+			c.Logger().Errorf("failed to close session %s: %v", uuidToString(session.ID), err)
+		}
+		session = closed
+	}
+
+	// Conclude closed sessions with a quote that fits their emotions
+	if req.Status == "completed" && h.quotes != nil && session.ClosingMessage.Valid {
+		quoted, err := h.quotes.ForSession(c.Request().Context(), userID, session)
+		if err != nil {
+			c.Logger().Errorf("failed to match quote for session %s: %v", uuidToString(session.ID), err)
+		}
+		session = quoted
+	}
+
+	// Remember what came up in the session for the next ones
+	h.extractSessionMemories(c.Request().Context(), c, userID, session.ID)
+
 	return c.JSON(http.StatusOK, session)
 }
 
@@ -212,6 +250,18 @@ func (h *Handler) StartSession(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusServiceUnavailable, "AI service is not configured")
 	}
 
+	// Parse the optional request body
+	var req types.StartSessionRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if _, ok := ai.PersonaByID(req.PersonaID); req.PersonaID != "" && !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown persona")
+	}
+	if req.TemplateID != "" {
+		return h.startTemplateSession(c, userID, req)
+	}
+
 	ctx := c.Request().Context()
 
 	// Create new session
@@ -219,9 +269,14 @@ func (h *Handler) StartSession(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create session")
 	}
+	session = h.overrideSessionPersona(ctx, c, userID, session, req.PersonaID)
+	persona := h.sessionPersona(ctx, userID, session)
+
+	// Catch up on memories from earlier sessions that were never ended
+	h.extractPendingMemories(ctx, userID)
 
-	// Generate opening message from AI
-	openingResponse, err := h.pujangga.GenerateOpeningMessage(ctx)
+	// Generate opening message from AI in the session's persona, personalized with the user's recent history
+	openingResponse, err := h.pujangga.GenerateOpeningMessage(ai.WithPersona(h.aiContext(ctx, userID, session.ID), persona), h.openingContext(ctx, c, userID, session.ID))
 	if err != nil {
 		c.Logger().Errorf("failed to generate opening message: %v", err)
 		// Still return the session, just without an opening message
@@ -233,9 +288,11 @@ func (h *Handler) StartSession(c echo.Context) error {
 
 	// Save the opening message
 	openingMessage, err := h.queries.CreateMessage(ctx, db.CreateMessageParams{
-		SessionID: session.ID,
-		Role:      "assistant",
-		Content:   openingResponse.Message,
+		SessionID:     session.ID,
+		Role:          "assistant",
+		Content:       openingResponse.Message,
+		PromptVersion: pgtype.Text{String: openingResponse.PromptVersion, Valid: openingResponse.PromptVersion != ""},
+		PersonaID:     personaID(persona),
 	})
 	if err != nil {
 		c.Logger().Errorf("failed to save opening message: %v", err)
@@ -280,7 +337,7 @@ func (h *Handler) GetOrCreateTodaySession(c echo.Context) error {
 				userMessageCount++
 			}
 		}
-		depthLevel := int(ai.CalculateDepth(userMessageCount))
+		depthLevel := int(sessionDepth(session, h.treatment(ctx, userID), userMessageCount))
 
 		return c.JSON(http.StatusOK, types.TodaySessionResponse{
 			Session:    session,
@@ -300,9 +357,13 @@ func (h *Handler) GetOrCreateTodaySession(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create session")
 	}
+	persona := h.sessionPersona(ctx, userID, session)
+
+	// Catch up on memories from earlier sessions that were never ended
+	h.extractPendingMemories(ctx, userID)
 
-	// Generate opening message from AI
-	openingResponse, err := h.pujangga.GenerateOpeningMessage(ctx)
+	// Generate opening message from AI in the session's persona, personalized with the user's recent history
+	openingResponse, err := h.pujangga.GenerateOpeningMessage(ai.WithPersona(h.aiContext(ctx, userID, session.ID), persona), h.openingContext(ctx, c, userID, session.ID))
 	if err != nil {
 		c.Logger().Errorf("failed to generate opening message: %v", err)
 		// Return session without opening message
@@ -316,9 +377,11 @@ func (h *Handler) GetOrCreateTodaySession(c echo.Context) error {
 
 	// Save the opening message
 	openingMessage, err := h.queries.CreateMessage(ctx, db.CreateMessageParams{
-		SessionID: session.ID,
-		Role:      "assistant",
-		Content:   openingResponse.Message,
+		SessionID:     session.ID,
+		Role:          "assistant",
+		Content:       openingResponse.Message,
+		PromptVersion: pgtype.Text{String: openingResponse.PromptVersion, Valid: openingResponse.PromptVersion != ""},
+		PersonaID:     personaID(persona),
 	})
 	if err != nil {
 		c.Logger().Errorf("failed to save opening message: %v", err)
@@ -340,3 +403,17 @@ func (h *Handler) GetOrCreateTodaySession(c echo.Context) error {
 		DepthLevel: 1,
 	})
 }
+
+// openingContext gathers the user's recent history for the opening message.
+// Without history the opening falls back to a general question.
+func (h *Handler) openingContext(ctx context.Context, c echo.Context, userID string, sessionID pgtype.UUID) ai.OpeningContext {
+	if h.openings == nil {
+		return ai.OpeningContext{}
+	}
+
+	opening, err := h.openings.Context(ctx, userID, sessionID)
+	if err != nil {
+		c.Logger().Errorf("failed to load opening context: %v", err)
+	}
+	return opening
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestStartSessionFlow(t *testing.T) {
+	fake := newFakeDB(t)
+	h := newTestHandler(fake, newCassettePujangga(t))
+
+	rec := serve(t, h.StartSession, http.MethodPost, `{}`, pgtype.UUID{})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+
+	var body struct {
+		Session        db.Session  `json:"session"`
+		OpeningMessage *db.Message `json:"opening_message"`
+	}
+	decode(t, rec, &body)
+	if body.OpeningMessage == nil || body.OpeningMessage.Content == "" {
+		t.Fatalf("opening_message = %+v, want the generated opening", body.OpeningMessage)
+	}
+	if body.OpeningMessage.Role != "assistant" || !body.OpeningMessage.PromptVersion.Valid {
+		t.Errorf("opening_message = %+v, want an assistant message with its prompt version", body.OpeningMessage)
+	}
+
+	if len(fake.sessions) != 1 || len(fake.messages) != 1 {
+		t.Fatalf("saved %d sessions and %d messages, want 1 and 1", len(fake.sessions), len(fake.messages))
+	}
+	if session := fake.sessions[0]; session.ID != body.Session.ID || session.TotalMessages != 1 {
+		t.Errorf("session = %+v, want the returned session counting the opening", session)
+	}
+	if saved := fake.messages[0]; saved.SessionID != body.Session.ID || saved.Content != body.OpeningMessage.Content {
+		t.Errorf("saved message = %+v, want the returned opening", saved)
+	}
+}
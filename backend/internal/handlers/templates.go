@@ -0,0 +1,104 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+	"catetin/backend/internal/types"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// ListTemplates returns the guided journaling templates
+// GET /api/templates
+func (h *Handler) ListTemplates(c echo.Context) error {
+	templates := make([]types.JournalTemplate, 0, len(ai.JournalTemplates))
+	for _, template := range ai.JournalTemplates {
+		templates = append(templates, types.JournalTemplate{
+			ID:          template.ID,
+			Name:        template.Name,
+			Description: template.Description,
+			Steps:       template.Steps,
+			HasOutput:   template.HasOutput(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, types.TemplatesResponse{Templates: templates})
+}
+
+// startTemplateSession creates a session guided by a journal template. The
+// opening is the template's first question, so no AI call is needed.
+func (h *Handler) startTemplateSession(c echo.Context, userID string, req types.StartSessionRequest) error {
+	if h.templates == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+	if _, ok := ai.JournalTemplateByID(req.TemplateID); !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown template")
+	}
+
+	ctx := c.Request().Context()
+
+	session, template, err := h.templates.Create(ctx, userID, req.TemplateID)
+	if err != nil {
+		c.Logger().Errorf("failed to create template session: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create session")
+	}
+	session = h.overrideSessionPersona(ctx, c, userID, session, req.PersonaID)
+
+	// Catch up on memories from earlier sessions that were never ended
+	h.extractPendingMemories(ctx, userID)
+
+	openingMessage, err := h.queries.CreateMessage(ctx, db.CreateMessageParams{
+		SessionID:     session.ID,
+		Role:          "assistant",
+		Content:       template.Opening,
+		PromptVersion: pgtype.Text{String: ai.TemplatePromptVersion(template.ID), Valid: true},
+	})
+	if err != nil {
+		c.Logger().Errorf("failed to save opening message: %v", err)
+		return c.JSON(http.StatusCreated, map[string]interface{}{
+			"session":         session,
+			"opening_message": nil,
+		})
+	}
+
+	// Increment message count
+	_, _ = h.queries.IncrementSessionMessages(ctx, session.ID)
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"session":         session,
+		"opening_message": openingMessage,
+	})
+}
+
+// advanceTurnTemplate moves a guided session through its template's steps,
+// which are saved with the reply. Crisis turns hold the progress and drop
+// the guide, so the crisis response isn't steered back to the template.
+func (h *Handler) advanceTurnTemplate(turn *respondTurn, session db.Session) {
+	if h.templates == nil || !session.TemplateID.Valid {
+		return
+	}
+
+	if turn.crisis() {
+		turn.template = h.templates.Hold(session)
+		return
+	}
+
+	turn.guide, turn.template = h.templates.Advance(session, turn.content)
+}
+
+// recordTemplateOutput stores a completed guided session's structured output
+// in the background, so the reply isn't delayed by the extra model call
+func (h *Handler) recordTemplateOutput(ctx context.Context, c echo.Context, turn *respondTurn) {
+	logger := c.Logger()
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := h.templates.RecordOutput(ctx, turn.userID, turn.sessionID, turn.template.TemplateID); err != nil {
+			logger.Errorf("failed to record template output of session %s: %v", uuidToString(turn.sessionID), err)
+		}
+	}()
+}
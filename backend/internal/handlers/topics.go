@@ -0,0 +1,70 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"catetin/backend/internal/middleware"
+	"catetin/backend/internal/services"
+	"catetin/backend/internal/types"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultTopicDays is the range topic stats cover when no dates are given
+const defaultTopicDays = 30
+
+// GetTopicStats returns what the user wrote about per day or week, with totals
+// GET /api/topics?period=daily|weekly&from=YYYY-MM-DD&to=YYYY-MM-DD
+func (h *Handler) GetTopicStats(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.topics == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database not available")
+	}
+
+	period := c.QueryParam("period")
+	if period == "" {
+		period = services.EmotionPeriodWeekly
+	}
+	if period != services.EmotionPeriodDaily && period != services.EmotionPeriodWeekly {
+		return echo.NewHTTPError(http.StatusBadRequest, "period must be 'daily' or 'weekly'")
+	}
+
+	from, to, err := h.topics.ParseRange(c.QueryParam("from"), c.QueryParam("to"), defaultTopicDays)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	buckets, totals, err := h.topics.Stats(c.Request().Context(), userID, period, from, to)
+	if err != nil {
+		c.Logger().Errorf("failed to get topic stats: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get topics")
+	}
+
+	return c.JSON(http.StatusOK, types.TopicStatsResponse{
+		Period:  period,
+		From:    from.Format("2006-01-02"),
+		To:      to.Format("2006-01-02"),
+		Totals:  totals,
+		Buckets: buckets,
+	})
+}
+
+// trackTurnTopics labels the user's message with topics and decides whether
+// the reply should steer to another topic
+func (h *Handler) trackTurnTopics(ctx context.Context, c echo.Context, turn *respondTurn) {
+	if h.topics == nil {
+		return
+	}
+
+	guidance, err := h.topics.Track(ctx, turn.userID, turn.sessionID, turn.userMessage.ID, turn.content)
+	if err != nil {
+		c.Logger().Errorf("failed to track message topics: %v", err)
+	}
+	turn.topic = guidance
+}
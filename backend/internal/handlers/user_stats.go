@@ -3,6 +3,7 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 
 	"catetin/backend/internal/middleware"
 	"catetin/backend/internal/types"
@@ -44,3 +45,43 @@ func (h *Handler) GetUserStats(c echo.Context) error {
 		LevelProgress: levelProgress,
 	})
 }
+
+// GetRewardHistory returns the user's ledger of Tinta Emas, Marmer and XP
+// changes, newest first, with each currency's balance after every entry
+func (h *Handler) GetRewardHistory(c echo.Context) error {
+	userID, err := middleware.RequireUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if h.ledger == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "reward history is not available")
+	}
+
+	// Parse pagination params
+	limit := int32(20)
+	offset := int32(0)
+
+	if l := c.QueryParam("limit"); l != "" {
+		if parsed, err := strconv.ParseInt(l, 10, 32); err == nil && parsed > 0 && parsed <= 100 {
+			limit = int32(parsed)
+		}
+	}
+	if o := c.QueryParam("offset"); o != "" {
+		if parsed, err := strconv.ParseInt(o, 10, 32); err == nil && parsed >= 0 {
+			offset = int32(parsed)
+		}
+	}
+
+	entries, err := h.ledger.History(c.Request().Context(), userID, limit, offset)
+	if err != nil {
+		c.Logger().Errorf("failed to get reward history: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get reward history")
+	}
+
+	return c.JSON(http.StatusOK, types.RewardHistoryResponse{
+		Entries: entries,
+		Limit:   limit,
+		Offset:  offset,
+	})
+}
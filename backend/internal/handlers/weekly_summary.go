@@ -3,10 +3,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
+	"catetin/backend/internal/ai"
 	"catetin/backend/internal/db"
 	"catetin/backend/internal/middleware"
 	"catetin/backend/internal/types"
@@ -89,6 +91,9 @@ func (h *Handler) GetLatestSummary(c echo.Context) error {
 
 	// Generate or get summary for last completed week
 	summary, err := h.weeklySummary.GenerateOrGetSummary(ctx, userID)
+	if errors.Is(err, ai.ErrBudgetExceeded) {
+		return h.budgetExceededError(err)
+	}
 	if err != nil {
 		c.Logger().Errorf("failed to generate/get summary: %v", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate summary")
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"catetin/backend/internal/types"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestGetLatestSummaryFlow(t *testing.T) {
+	fake := newFakeDB(t)
+	fake.plan = "paid"
+	h := newTestHandler(fake, newCassettePujangga(t))
+
+	// One session in the last completed week, one from before it
+	week := h.weeklySummary.GetLastCompletedWeek(time.Now())
+	session := fake.addSession(week.Start.Add(20 * time.Hour))
+	fake.addMessage(session, "user", testMessage)
+	fake.addMessage(session, "user", "Tapi presentasi tadi lancar, lega banget.")
+	fake.addMessage(fake.addSession(week.Start.Add(-24*time.Hour)), "user", "Minggu lalu biasa saja.")
+
+	rec := serve(t, h.GetLatestSummary, http.MethodGet, "", pgtype.UUID{})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var summary types.WeeklySummaryResponse
+	decode(t, rec, &summary)
+	if summary.Summary == "" || summary.SessionCount != 1 || summary.MessageCount != 2 {
+		t.Errorf("summary = %+v, want a summary of 1 session and 2 messages", summary)
+	}
+	if summary.WeekStart != week.Start.Format("2006-01-02") {
+		t.Errorf("week_start = %q, want %q", summary.WeekStart, week.Start.Format("2006-01-02"))
+	}
+	if summary.Emotions["dominant_emotion"] == nil || summary.Emotions["trend"] == nil {
+		t.Errorf("emotions = %v, want the dominant emotion and trend", summary.Emotions)
+	}
+	if len(fake.summaries) != 1 || uuidToString(fake.summaries[0].ID) != summary.ID {
+		t.Fatalf("saved %d summaries, want the returned one", len(fake.summaries))
+	}
+
+	// The saved summary is returned without generating it again
+	again := serve(t, h.GetLatestSummary, http.MethodGet, "", pgtype.UUID{})
+	var cached types.WeeklySummaryResponse
+	decode(t, again, &cached)
+	if cached.ID != summary.ID || len(fake.summaries) != 1 {
+		t.Errorf("second request returned %q with %d summaries saved, want the first summary", cached.ID, len(fake.summaries))
+	}
+}
+
+func TestGetLatestSummaryRequiresPaidPlan(t *testing.T) {
+	fake := newFakeDB(t)
+	h := newTestHandler(fake, newCassettePujangga(t))
+
+	rec := serve(t, h.GetLatestSummary, http.MethodGet, "", pgtype.UUID{})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body)
+	}
+	if code := errorCode(t, rec); code != "PREMIUM_REQUIRED" {
+		t.Errorf("error = %q, want PREMIUM_REQUIRED", code)
+	}
+}
@@ -2,6 +2,7 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"net/http"
 	"strings"
 
@@ -71,3 +72,18 @@ func RequireUserID(c echo.Context) (string, error) {
 func InitClerk(secretKey string) {
 	clerk.SetKey(secretKey)
 }
+
+// InternalToken returns an Echo middleware that guards internal operations
+// endpoints with a shared token sent in the X-Internal-Token header.
+// An empty token rejects every request.
+func InternalToken(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			provided := c.Request().Header.Get("X-Internal-Token")
+			if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				return echo.NewHTTPError(http.StatusForbidden, "invalid or missing internal token")
+			}
+			return next(c)
+		}
+	}
+}
@@ -9,7 +9,7 @@ import (
 )
 
 // Register sets up all routes for the application
-func Register(e *echo.Echo, h *handlers.Handler, wh *handlers.WebhookHandler) {
+func Register(e *echo.Echo, h *handlers.Handler, wh *handlers.WebhookHandler, ih *handlers.InternalHandler, internalToken string) {
 	// Health check (public)
 	e.GET("/api/health", h.Health)
 
@@ -18,23 +18,47 @@ func Register(e *echo.Echo, h *handlers.Handler, wh *handlers.WebhookHandler) {
 		e.POST("/api/webhooks/trakteer", wh.TrakteerWebhook)
 	}
 
+	// Internal operations (no user auth - validated by internal token)
+	internal := e.Group("/api/internal")
+	internal.Use(appMiddleware.InternalToken(internalToken))
+	internal.GET("/ai/metrics", ih.AIMetrics)
+	internal.GET("/ai/usage", ih.AIUsage)
+	internal.GET("/prompts", ih.Prompts)
+	internal.POST("/prompts/reload", ih.ReloadPrompts)
+	internal.GET("/experiments", ih.ListExperiments)
+	internal.GET("/experiments/:id/report", ih.ExperimentReport)
+	internal.GET("/safety/flags", ih.ListFlaggedMessages)
+	internal.GET("/ledger/mismatches", ih.LedgerMismatches)
+	internal.GET("/artworks", ih.ListArtworks)
+	internal.POST("/artworks", ih.CreateArtwork)
+	internal.GET("/artworks/:id", ih.GetArtwork)
+	internal.PUT("/artworks/:id", ih.UpdateArtwork)
+	internal.POST("/artworks/:id/image", ih.UploadArtworkImage)
+
 	// Protected routes (require authentication)
 	api := e.Group("/api")
 	api.Use(appMiddleware.ClerkAuth())
 
 	// User stats
 	api.GET("/stats", h.GetUserStats)
+	api.GET("/stats/history", h.GetRewardHistory) // Ledger of Tinta Emas, Marmer and XP changes
+
+	// Preferences and companion personas
+	api.GET("/preferences", h.GetPreferences)
+	api.PUT("/preferences", h.UpdatePreferences)
+	api.GET("/personas", h.ListPersonas)
 
 	// Subscription
 	api.GET("/subscription", h.GetSubscription)
 
 	// Sessions
 	api.POST("/sessions", h.CreateSession)
-	api.POST("/sessions/start", h.StartSession)           // Creates session with AI opening
+	api.POST("/sessions/start", h.StartSession)           // Creates session with AI opening, or a guided one with template_id
 	api.GET("/sessions/today", h.GetOrCreateTodaySession) // Get or create today's session
 	api.GET("/sessions", h.ListSessions)
 	api.GET("/sessions/:id", h.GetSession)
 	api.PUT("/sessions/:id", h.UpdateSession)
+	api.PUT("/sessions/:id/persona", h.UpdateSessionPersona) // Overrides the user's default persona
 
 	// Messages
 	api.POST("/sessions/:id/messages", h.CreateMessage)
@@ -42,8 +66,36 @@ func Register(e *echo.Echo, h *handlers.Handler, wh *handlers.WebhookHandler) {
 
 	// AI Response
 	api.POST("/sessions/:id/respond", h.Respond)
+	api.POST("/sessions/:id/respond/stream", h.RespondStream) // Server-Sent Events variant
 
 	// Weekly Summaries (Risalah Mingguan - premium only)
 	api.GET("/summaries", h.ListSummaries)
 	api.GET("/summaries/latest", h.GetLatestSummary)
+
+	// Emotions (Jejak page)
+	api.GET("/emotions", h.GetEmotionDistribution)
+	api.GET("/emotions/timeline", h.GetMoodTimeline)
+
+	// Journal templates (guided sessions)
+	api.GET("/templates", h.ListTemplates)
+
+	// Topics (what the user writes about over time)
+	api.GET("/topics", h.GetTopicStats)
+
+	// Perpustakaan (quote library)
+	api.GET("/quotes/collections", h.ListQuoteCollections)
+	api.GET("/quotes/collections/:id", h.GetQuoteCollection)
+	api.POST("/quotes/collections/:id/unlock", h.UnlockQuoteCollection)
+	api.GET("/quotes/:id", h.GetQuote)
+
+	// Galeri (Mahakarya artworks)
+	api.GET("/gallery", h.GetGallery)
+	api.GET("/gallery/artworks/:id/image", h.GetArtworkImage)
+	api.POST("/gallery/artworks/:id/unlock", h.UnlockArtwork)
+	api.POST("/gallery/artworks/:id/reveal", h.RevealArtwork)
+
+	// Memories (what Sang Pujangga remembers across sessions)
+	api.GET("/memories", h.ListMemories)
+	api.PUT("/memories/:id", h.UpdateMemory)
+	api.DELETE("/memories/:id", h.DeleteMemory)
 }
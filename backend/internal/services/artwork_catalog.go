@@ -0,0 +1,325 @@
+// Package services provides business logic services
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// MaxArtworkImageBytes caps uploaded artwork images
+const MaxArtworkImageBytes = 10 << 20
+
+var (
+	// ErrInvalidArtwork is returned for catalog entries that fail validation
+	ErrInvalidArtwork = errors.New("invalid artwork")
+	// ErrArtworkNameTaken is returned when creating an artwork with an existing name
+	ErrArtworkNameTaken = errors.New("artwork name is taken")
+	// ErrInvalidArtworkImage is returned for uploads that aren't PNG or JPEG images
+	ErrInvalidArtworkImage = errors.New("artwork image must be a PNG or JPEG")
+)
+
+// artworkNamePattern is the format of artwork names, which identify entries across seeds
+var artworkNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// ArtworkInput is the editable part of a catalog entry
+type ArtworkInput struct {
+	Name           string // Only used when creating
+	DisplayName    string
+	Description    string
+	ImageURL       string // Base image, resolved by its last path segment in the image directory
+	UnlockCost     int32  // Marmer
+	RevealCost     int32  // Tinta Emas per percentage point
+	SortOrder      int32
+	AvailableFrom  *time.Time // Seasonal release window; nil for no bound
+	AvailableUntil *time.Time
+	Retired        bool // Retired artworks can't be unlocked but stay with users who have them
+}
+
+// ArtworkInputFrom returns the input that recreates an artwork as it is
+func ArtworkInputFrom(artwork db.Artwork) ArtworkInput {
+	input := ArtworkInput{
+		Name:        artwork.Name,
+		DisplayName: artwork.DisplayName,
+		Description: artwork.Description,
+		ImageURL:    artwork.ImageUrl,
+		UnlockCost:  artwork.UnlockCost,
+		RevealCost:  artwork.RevealCost,
+		SortOrder:   artwork.SortOrder,
+		Retired:     artwork.RetiredAt.Valid,
+	}
+	if artwork.AvailableFrom.Valid {
+		input.AvailableFrom = &artwork.AvailableFrom.Time
+	}
+	if artwork.AvailableUntil.Valid {
+		input.AvailableUntil = &artwork.AvailableUntil.Time
+	}
+	return input
+}
+
+// validate checks an input, including its name when creating
+func (in ArtworkInput) validate(creating bool) error {
+	switch {
+	case creating && !artworkNamePattern.MatchString(in.Name):
+		return fmt.Errorf("%w: name must be lowercase letters, digits and underscores", ErrInvalidArtwork)
+	case strings.TrimSpace(in.DisplayName) == "":
+		return fmt.Errorf("%w: display_name is required", ErrInvalidArtwork)
+	case in.UnlockCost < 0:
+		return fmt.Errorf("%w: unlock_cost must not be negative", ErrInvalidArtwork)
+	case in.RevealCost < 1:
+		return fmt.Errorf("%w: reveal_cost must be at least 1", ErrInvalidArtwork)
+	case in.AvailableFrom != nil && in.AvailableUntil != nil && !in.AvailableUntil.After(*in.AvailableFrom):
+		return fmt.Errorf("%w: available_until must be after available_from", ErrInvalidArtwork)
+	}
+	return nil
+}
+
+// ArtworkCatalogService manages the Galeri's catalog. Edits to what users
+// see bump the artwork's version and snapshot it in artwork_versions, so
+// users keep revealing the version they unlocked.
+type ArtworkCatalogService struct {
+	queries  *db.Queries
+	pool     *db.Pool
+	imageDir string // Local file store of base images, shared with the reveal renderer
+}
+
+// NewArtworkCatalogService creates a new artwork catalog service
+func NewArtworkCatalogService(queries *db.Queries, pool *db.Pool, imageDir string) *ArtworkCatalogService {
+	return &ArtworkCatalogService{
+		queries:  queries,
+		pool:     pool,
+		imageDir: imageDir,
+	}
+}
+
+// List returns the whole catalog, including retired and scheduled artworks
+func (s *ArtworkCatalogService) List(ctx context.Context) ([]db.Artwork, error) {
+	artworks, err := s.queries.ListArtworks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artworks: %w", err)
+	}
+	return artworks, nil
+}
+
+// Get returns an artwork and its versions, newest first
+func (s *ArtworkCatalogService) Get(ctx context.Context, id pgtype.UUID) (db.Artwork, []db.ArtworkVersion, error) {
+	artwork, err := s.queries.GetArtworkByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.Artwork{}, nil, ErrArtworkNotFound
+	}
+	if err != nil {
+		return db.Artwork{}, nil, fmt.Errorf("failed to get artwork: %w", err)
+	}
+
+	versions, err := s.queries.ListArtworkVersions(ctx, id)
+	if err != nil {
+		return db.Artwork{}, nil, fmt.Errorf("failed to list artwork versions: %w", err)
+	}
+	return artwork, versions, nil
+}
+
+// Create adds an artwork to the catalog as version 1
+func (s *ArtworkCatalogService) Create(ctx context.Context, input ArtworkInput) (db.Artwork, error) {
+	if err := input.validate(true); err != nil {
+		return db.Artwork{}, err
+	}
+
+	var artwork db.Artwork
+	err := s.pool.InTx(ctx, func(tx pgx.Tx) error {
+		q := s.queries.WithTx(tx)
+
+		if _, err := q.GetArtworkByName(ctx, input.Name); err == nil {
+			return ErrArtworkNameTaken
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to get artwork: %w", err)
+		}
+
+		var err error
+		artwork, err = q.CreateArtwork(ctx, db.CreateArtworkParams{
+			Name:           input.Name,
+			DisplayName:    strings.TrimSpace(input.DisplayName),
+			Description:    strings.TrimSpace(input.Description),
+			ImageUrl:       input.ImageURL,
+			UnlockCost:     input.UnlockCost,
+			RevealCost:     input.RevealCost,
+			SortOrder:      input.SortOrder,
+			AvailableFrom:  optionalTimestamp(input.AvailableFrom),
+			AvailableUntil: optionalTimestamp(input.AvailableUntil),
+			Retired:        input.Retired,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create artwork: %w", err)
+		}
+
+		if err := q.CreateArtworkVersion(ctx, artwork.ID); err != nil {
+			return fmt.Errorf("failed to save artwork version: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return db.Artwork{}, err
+	}
+
+	log.Printf("[ArtworkCatalogService] created artwork %s", artwork.Name)
+	return artwork, nil
+}
+
+// Update replaces an artwork's editable fields. The name can't change.
+func (s *ArtworkCatalogService) Update(ctx context.Context, id pgtype.UUID, input ArtworkInput) (db.Artwork, error) {
+	if err := input.validate(false); err != nil {
+		return db.Artwork{}, err
+	}
+
+	var artwork db.Artwork
+	err := s.pool.InTx(ctx, func(tx pgx.Tx) error {
+		q := s.queries.WithTx(tx)
+
+		var err error
+		artwork, err = q.UpdateArtwork(ctx, db.UpdateArtworkParams{
+			ID:             id,
+			DisplayName:    strings.TrimSpace(input.DisplayName),
+			Description:    strings.TrimSpace(input.Description),
+			ImageUrl:       input.ImageURL,
+			UnlockCost:     input.UnlockCost,
+			RevealCost:     input.RevealCost,
+			SortOrder:      input.SortOrder,
+			AvailableFrom:  optionalTimestamp(input.AvailableFrom),
+			AvailableUntil: optionalTimestamp(input.AvailableUntil),
+			Retired:        input.Retired,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrArtworkNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update artwork: %w", err)
+		}
+
+		// A no-op unless the update bumped the version
+		if err := q.CreateArtworkVersion(ctx, artwork.ID); err != nil {
+			return fmt.Errorf("failed to save artwork version: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return db.Artwork{}, err
+	}
+
+	return artwork, nil
+}
+
+// SetImage stores an uploaded PNG or JPEG in the image directory and makes
+// it the artwork's base image. Files are named by content and never
+// overwritten, so earlier versions keep their images.
+func (s *ArtworkCatalogService) SetImage(ctx context.Context, id pgtype.UUID, data []byte) (db.Artwork, error) {
+	artwork, err := s.queries.GetArtworkByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.Artwork{}, ErrArtworkNotFound
+	}
+	if err != nil {
+		return db.Artwork{}, fmt.Errorf("failed to get artwork: %w", err)
+	}
+
+	name, err := s.StoreImage(artwork.Name, data)
+	if err != nil {
+		return db.Artwork{}, err
+	}
+
+	input := ArtworkInputFrom(artwork)
+	input.ImageURL = name
+	return s.Update(ctx, id, input)
+}
+
+// StoreImage saves a PNG or JPEG for the named artwork in the image
+// directory and returns its file name
+func (s *ArtworkCatalogService) StoreImage(artworkName string, data []byte) (string, error) {
+	if len(data) > MaxArtworkImageBytes {
+		return "", fmt.Errorf("%w: images must not exceed %d MB", ErrInvalidArtworkImage, MaxArtworkImageBytes>>20)
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "png" && format != "jpeg") {
+		return "", ErrInvalidArtworkImage
+	}
+
+	sum := sha256.Sum256(data)
+	name := fmt.Sprintf("%s-%s.%s", artworkName, hex.EncodeToString(sum[:6]), strings.Replace(format, "jpeg", "jpg", 1))
+	path := filepath.Join(s.imageDir, name)
+	if _, err := os.Stat(path); err == nil {
+		return name, nil // Same content uploaded before
+	}
+
+	if err := os.MkdirAll(s.imageDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create image directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.imageDir, "upload-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create image file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after the rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write image: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write image: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to save image: %w", err)
+	}
+
+	log.Printf("[ArtworkCatalogService] stored image %s", name)
+	return name, nil
+}
+
+// Seed creates or updates an artwork by name, returning whether it was
+// created. Unchanged entries keep their version.
+func (s *ArtworkCatalogService) Seed(ctx context.Context, input ArtworkInput) (db.Artwork, bool, error) {
+	existing, err := s.queries.GetArtworkByName(ctx, input.Name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		artwork, err := s.Create(ctx, input)
+		return artwork, err == nil, err
+	}
+	if err != nil {
+		return db.Artwork{}, false, fmt.Errorf("failed to get artwork: %w", err)
+	}
+
+	artwork, err := s.Update(ctx, existing.ID, input)
+	return artwork, false, err
+}
+
+// artworkAvailable reports whether an artwork can be unlocked at now
+func artworkAvailable(artwork db.Artwork, now time.Time) bool {
+	if artwork.RetiredAt.Valid {
+		return false
+	}
+	if artwork.AvailableFrom.Valid && now.Before(artwork.AvailableFrom.Time) {
+		return false
+	}
+	if artwork.AvailableUntil.Valid && !now.Before(artwork.AvailableUntil.Time) {
+		return false
+	}
+	return true
+}
+
+// optionalTimestamp converts an optional time to a nullable timestamp
+func optionalTimestamp(t *time.Time) pgtype.Timestamptz {
+	if t == nil {
+		return pgtype.Timestamptz{}
+	}
+	return pgtype.Timestamptz{Time: *t, Valid: true}
+}
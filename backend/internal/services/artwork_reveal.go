@@ -0,0 +1,212 @@
+// Package services provides business logic services
+package services
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg" // Base images may be JPEG
+	"image/png"
+	"math"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// revealGrid is how many tiles the longer side of an artwork is split into
+	revealGrid = 24
+	// revealJitter is how far tiles stray from revealing strictly outward from the focal point
+	revealJitter = 0.35
+	// revealSalt separates the PCG streams of the reveal mask from other seeded randomness
+	revealSalt = 0x6361746574696e // "catetin"
+)
+
+// ErrArtworkImageNotFound is returned when an artwork's base image is missing from the image directory
+var ErrArtworkImageNotFound = errors.New("artwork image not found")
+
+// veilColor is the marble covering tiles that aren't revealed yet
+var veilColor = color.NRGBA{R: 0xE8, G: 0xE4, B: 0xDC, A: 0xFF}
+
+// RevealRenderer renders artworks partially revealed. Each user gets their
+// own mask seeded by user and artwork, so an artwork emerges the same way
+// on every device. Renders are cached on disk by artwork version, mask and
+// progress.
+type RevealRenderer struct {
+	imageDir string // Base images, named like the last path segment of artworks.image_url
+	cacheDir string
+}
+
+// NewRevealRenderer creates a new reveal renderer
+func NewRevealRenderer(imageDir, cacheDir string) *RevealRenderer {
+	return &RevealRenderer{
+		imageDir: imageDir,
+		cacheDir: cacheDir,
+	}
+}
+
+// Render returns the path of a PNG of an artwork version revealed to
+// progress percent for the user, rendering it on a cache miss
+func (r *RevealRenderer) Render(userID string, artwork db.ArtworkVersion, progress int32) (string, error) {
+	progress = min(max(progress, 0), 100)
+	seed := revealSeed(userID, artwork.ArtworkID)
+
+	// Fully veiled and fully revealed artworks look the same for everyone
+	name := fmt.Sprintf("%016x-%03d.png", seed, progress)
+	if progress == 0 || progress == 100 {
+		name = fmt.Sprintf("%03d.png", progress)
+	}
+	cached := filepath.Join(r.cacheDir, artwork.ArtworkID.String(), fmt.Sprintf("v%d", artwork.Version), name)
+	if _, err := os.Stat(cached); err == nil {
+		return cached, nil
+	}
+
+	base, err := r.loadBase(artwork.ImageUrl)
+	if err != nil {
+		return "", err
+	}
+
+	if err := writePNG(cached, revealImage(base, seed, progress)); err != nil {
+		return "", err
+	}
+	return cached, nil
+}
+
+// loadBase decodes an artwork's base image from the image directory
+func (r *RevealRenderer) loadBase(imageURL string) (image.Image, error) {
+	parsed, err := url.Parse(imageURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image url %q: %w", imageURL, err)
+	}
+	name := path.Base(parsed.Path)
+	if name == "." || name == "/" {
+		return nil, ErrArtworkImageNotFound
+	}
+
+	file, err := os.Open(filepath.Join(r.imageDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrArtworkImageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open artwork image: %w", err)
+	}
+	defer file.Close()
+
+	base, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode artwork image %s: %w", name, err)
+	}
+	return base, nil
+}
+
+// revealSeed derives the mask seed of a user's artwork
+func revealSeed(userID string, artworkID pgtype.UUID) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(userID))
+	h.Write([]byte{0})
+	h.Write(artworkID.Bytes[:])
+	return h.Sum64()
+}
+
+// revealImage covers the tiles of base that aren't revealed at progress
+// with marble, keeping the base's alpha so the silhouette shows through
+func revealImage(base image.Image, seed uint64, progress int32) *image.NRGBA {
+	bounds := base.Bounds()
+	out := image.NewNRGBA(bounds)
+	draw.Draw(out, bounds, base, bounds.Min, draw.Src)
+	if progress >= 100 {
+		return out
+	}
+
+	width, height := bounds.Dx(), bounds.Dy()
+	tileSize := max((max(width, height)+revealGrid-1)/revealGrid, 1)
+	cols := (width + tileSize - 1) / tileSize
+	rows := (height + tileSize - 1) / tileSize
+
+	order, shades := revealMask(cols, rows, seed)
+	veiled := order[len(order)*int(progress)/100:]
+
+	for _, tile := range veiled {
+		x0 := bounds.Min.X + (tile%cols)*tileSize
+		y0 := bounds.Min.Y + (tile/cols)*tileSize
+		veil := veilColor
+		veil.R -= shades[tile]
+		veil.G -= shades[tile]
+		veil.B -= shades[tile]
+
+		for y := y0; y < min(y0+tileSize, bounds.Max.Y); y++ {
+			for x := x0; x < min(x0+tileSize, bounds.Max.X); x++ {
+				if veil.A = out.NRGBAAt(x, y).A; veil.A > 0 {
+					out.SetNRGBA(x, y, veil)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// revealMask returns the order tiles are revealed in, spreading outward
+// from a seeded focal point near the middle, and a seeded shade per tile
+// so the veil looks like chiselled stone. It draws from the PCG source
+// directly because its output is fixed, unlike the helpers of rand.Rand,
+// so masks never change across Go releases.
+func revealMask(cols, rows int, seed uint64) ([]int, []uint8) {
+	src := rand.NewPCG(seed, revealSalt)
+	unit := func() float64 { return float64(src.Uint64()>>11) / (1 << 53) }
+
+	focusX := float64(cols) * (0.25 + 0.5*unit())
+	focusY := float64(rows) * (0.25 + 0.5*unit())
+	diagonal := math.Hypot(float64(cols), float64(rows))
+
+	count := cols * rows
+	order := make([]int, count)
+	priorities := make([]float64, count)
+	shades := make([]uint8, count)
+	for i := range order {
+		dx := float64(i%cols) + 0.5 - focusX
+		dy := float64(i/cols) + 0.5 - focusY
+		order[i] = i
+		priorities[i] = math.Hypot(dx, dy)/diagonal + revealJitter*unit()
+		shades[i] = uint8(src.Uint64() % 16)
+	}
+	sort.SliceStable(order, func(a, b int) bool { return priorities[order[a]] < priorities[order[b]] })
+
+	return order, shades
+}
+
+// writePNG encodes img to path through a temporary file, so concurrent
+// requests never serve a half-written render
+func writePNG(path string, img image.Image) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "render-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create render file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after the rename
+
+	if err := png.Encode(tmp, img); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode render: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write render: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save render: %w", err)
+	}
+	return nil
+}
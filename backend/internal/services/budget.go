@@ -0,0 +1,80 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// TokenBudget is the number of AI tokens a user may spend per period.
+// A zero limit means the period is unlimited.
+type TokenBudget struct {
+	Daily   int64
+	Monthly int64
+}
+
+// BudgetService enforces per-plan AI token budgets. Usage is debited by
+// UsageService as ai_usage rows, which this service sums per day and month.
+type BudgetService struct {
+	queries  *db.Queries
+	budgets  map[string]TokenBudget // Keyed by subscription plan
+	location *time.Location         // WIB timezone, days and months roll over at local midnight
+}
+
+// NewBudgetService creates a new budget service with a budget per plan
+func NewBudgetService(queries *db.Queries, budgets map[string]TokenBudget) *BudgetService {
+	// Load WIB timezone (UTC+7)
+	loc, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		// Fallback to fixed offset if timezone data not available
+		loc = time.FixedZone("WIB", 7*60*60)
+	}
+
+	return &BudgetService{
+		queries:  queries,
+		budgets:  budgets,
+		location: loc,
+	}
+}
+
+// CheckBudget returns an *ai.BudgetExceededError when the user has used up
+// their daily or monthly budget. It implements ai.BudgetGuard.
+// Lookup failures are logged and the call is allowed, so an accounting
+// outage never takes the journal down with it.
+func (s *BudgetService) CheckBudget(ctx context.Context, info ai.CallInfo) error {
+	now := time.Now().In(s.location)
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, s.location)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, s.location)
+
+	usage, err := s.queries.GetUserTokenUsage(ctx, db.GetUserTokenUsageParams{
+		UserID:     info.UserID,
+		DayStart:   pgtype.Timestamptz{Time: dayStart, Valid: true},
+		MonthStart: pgtype.Timestamptz{Time: monthStart, Valid: true},
+	})
+	if err != nil {
+		log.Printf("[BudgetService] failed to load token usage for user %s: %v", info.UserID, err)
+		return nil
+	}
+
+	budget, ok := s.budgets[usage.Plan]
+	if !ok {
+		return nil
+	}
+
+	if budget.Daily > 0 && usage.DailyTokens >= budget.Daily {
+		log.Printf("[BudgetService] user %s (%s) hit daily budget for %s: %d/%d", info.UserID, usage.Plan, info.Feature, usage.DailyTokens, budget.Daily)
+		return &ai.BudgetExceededError{Period: ai.BudgetPeriodDaily, Used: usage.DailyTokens, Limit: budget.Daily}
+	}
+	if budget.Monthly > 0 && usage.MonthlyTokens >= budget.Monthly {
+		log.Printf("[BudgetService] user %s (%s) hit monthly budget for %s: %d/%d", info.UserID, usage.Plan, info.Feature, usage.MonthlyTokens, budget.Monthly)
+		return &ai.BudgetExceededError{Period: ai.BudgetPeriodMonthly, Used: usage.MonthlyTokens, Limit: budget.Monthly}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// maxClosingMessages caps how many of the session's latest messages the
+// closing sees besides its running summary
+const maxClosingMessages = SessionContextMessages + SessionSummaryBatch
+
+// ClosingService performs the closing ritual of completed sessions: a
+// closing reflection, a title and a summary stored on the session
+type ClosingService struct {
+	queries  *db.Queries
+	pujangga *ai.PujanggaService
+	personas *PersonaService
+}
+
+// NewClosingService creates a new closing service
+func NewClosingService(queries *db.Queries, pujangga *ai.PujanggaService, personas *PersonaService) *ClosingService {
+	return &ClosingService{
+		queries:  queries,
+		pujangga: pujangga,
+		personas: personas,
+	}
+}
+
+// Close generates and stores the closing of a completed session and returns
+// the updated session. Sessions without user messages, and sessions where the
+// safety screen stepped in, are returned unchanged.
+func (s *ClosingService) Close(ctx context.Context, userID string, session db.Session) (db.Session, error) {
+	messages, err := s.queries.ListMessagesBySession(ctx, session.ID)
+	if err != nil {
+		return session, fmt.Errorf("failed to get session messages: %w", err)
+	}
+
+	history := make([]ai.Message, 0, maxClosingMessages)
+	hasUserMessage := false
+	for _, msg := range messages {
+		// A cheerful wrap-up doesn't fit a session in crisis
+		if msg.RiskLevel.String == string(ai.RiskHigh) || msg.PromptVersion.String == ai.CrisisPromptVersion {
+			log.Printf("[ClosingService] skipping closing of session %s after a crisis response", session.ID)
+			return session, nil
+		}
+		hasUserMessage = hasUserMessage || msg.Role == "user"
+
+		// The running summary covers the older messages
+		if session.RunningSummaryUntil.Valid && !msg.CreatedAt.Time.After(session.RunningSummaryUntil.Time) {
+			continue
+		}
+		history = append(history, ai.Message{Role: msg.Role, Content: msg.Content})
+	}
+	history = history[max(len(history)-maxClosingMessages, 0):]
+	if !hasUserMessage {
+		return session, nil
+	}
+
+	// The closing is written in the voice the session was held in
+	persona := s.personas.Resolve(ctx, userID, session)
+	closing, err := s.pujangga.GenerateClosing(ai.WithPersona(ai.WithCaller(ctx, userID, session.ID.String()), persona), session.RunningSummary, history)
+	if err != nil {
+		return session, err
+	}
+
+	closed, err := s.queries.SetSessionClosing(ctx, db.SetSessionClosingParams{
+		ID:                   session.ID,
+		Title:                pgtype.Text{String: closing.Title, Valid: true},
+		Summary:              pgtype.Text{String: closing.Summary, Valid: true},
+		ClosingMessage:       pgtype.Text{String: closing.Message, Valid: true},
+		ClosingPromptVersion: pgtype.Text{String: closing.PromptVersion, Valid: closing.PromptVersion != ""},
+	})
+	if err != nil {
+		return session, fmt.Errorf("failed to save session closing: %w", err)
+	}
+	return closed, nil
+}
@@ -0,0 +1,105 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DepthUpdate is how a user turn moved its session's conversation depth
+type DepthUpdate struct {
+	Level    ai.DepthLevel `json:"level"`
+	Score    ai.DepthScore `json:"score"`
+	Progress float64       `json:"progress"` // Progress toward the next level, 0 to 1
+	Advanced bool          `json:"advanced"` // Whether this turn reached a deeper level
+
+	save *db.UpdateSessionDepthParams // What Save writes; nil for holds
+}
+
+// DepthService scores user turns and keeps the depth each session reached.
+// Turns are scored locally; when the model check is enabled, the model's
+// judgment is blended in.
+type DepthService struct {
+	queries    *db.Queries
+	engine     *ai.DepthEngine
+	pujangga   *ai.PujanggaService
+	modelCheck bool
+}
+
+// NewDepthService creates a new depth service. pujangga may be nil, which
+// disables the model check.
+func NewDepthService(queries *db.Queries, engine *ai.DepthEngine, pujangga *ai.PujanggaService, modelCheck bool) *DepthService {
+	return &DepthService{
+		queries:    queries,
+		engine:     engine,
+		pujangga:   pujangga,
+		modelCheck: modelCheck && pujangga != nil,
+	}
+}
+
+// WithTx returns a copy of the service that runs its queries in tx
+func (s *DepthService) WithTx(tx pgx.Tx) *DepthService {
+	return &DepthService{
+		queries:    s.queries.WithTx(tx),
+		engine:     s.engine,
+		pujangga:   s.pujangga,
+		modelCheck: s.modelCheck,
+	}
+}
+
+// Advance scores the user's message and advances or holds the session's
+// depth; Save stores it with the rest of the turn. recentMessages end with
+// the message and give the model check its context.
+func (s *DepthService) Advance(ctx context.Context, session db.Session, content string, recentMessages []ai.Message) DepthUpdate {
+	score := s.engine.Score(content)
+	if s.modelCheck {
+		judgment, err := s.pujangga.JudgeDepth(ctx, recentMessages)
+		if err != nil {
+			log.Printf("[DepthService] model depth check failed, using the local score: %v", err)
+		} else {
+			score = s.engine.WithModel(score, judgment)
+		}
+	}
+
+	current := ai.DepthLevel(session.DepthLevel)
+	level, progress := s.engine.Advance(current, float64(session.DepthProgress), score)
+
+	return DepthUpdate{
+		Level:    level,
+		Score:    score,
+		Progress: s.engine.Progress(level, progress),
+		Advanced: level > current,
+		save: &db.UpdateSessionDepthParams{
+			ID:            session.ID,
+			DepthLevel:    int16(level),
+			DepthProgress: float32(progress),
+		},
+	}
+}
+
+// Save stores the depth a turn advanced its session to. Holds save nothing.
+func (s *DepthService) Save(ctx context.Context, update DepthUpdate) error {
+	if update.save == nil {
+		return nil
+	}
+	if _, err := s.queries.UpdateSessionDepth(ctx, *update.save); err != nil {
+		return fmt.Errorf("failed to save session depth: %w", err)
+	}
+	return nil
+}
+
+// Hold reports the session's depth without scoring a turn, e.g. for turns
+// answered with the crisis response
+func (s *DepthService) Hold(session db.Session) DepthUpdate {
+	level := ai.DepthLevel(session.DepthLevel)
+	return DepthUpdate{
+		Level:    level,
+		Progress: s.engine.Progress(level, float64(session.DepthProgress)),
+	}
+}
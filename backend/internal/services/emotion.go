@@ -0,0 +1,276 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Emotion distribution periods
+const (
+	EmotionPeriodDaily  = "daily"
+	EmotionPeriodWeekly = "weekly" // Sunday to Saturday, like Risalah Mingguan
+)
+
+// MaxDateRangeDays caps the date range of emotion and topic queries
+const MaxDateRangeDays = 366
+
+// ErrInvalidDateRange is returned for malformed or oversized date ranges
+var ErrInvalidDateRange = errors.New("invalid date range")
+
+// emotionValence scores how pleasant each emotion label is, from -1 to 1
+var emotionValence = map[string]float64{
+	"senang":    1,
+	"syukur":    1,
+	"cinta":     1,
+	"harapan":   0.75,
+	"ambisi":    0.5,
+	"kelelahan": -0.5,
+	"cemas":     -0.75,
+	"kesepian":  -0.75,
+	"sedih":     -1,
+	"marah":     -1,
+}
+
+// EmotionBucket is the emotion distribution of one day or week
+type EmotionBucket struct {
+	Start           string           `json:"start"` // YYYY-MM-DD, WIB
+	End             string           `json:"end"`   // YYYY-MM-DD, inclusive
+	Total           int32            `json:"total"`
+	Emotions        map[string]int32 `json:"emotions"`
+	DominantEmotion string           `json:"dominant_emotion"`
+}
+
+// MoodPoint is one day of the mood timeline
+type MoodPoint struct {
+	Date            string           `json:"date"` // YYYY-MM-DD, WIB
+	Total           int32            `json:"total"`
+	Emotions        map[string]int32 `json:"emotions"`
+	DominantEmotion string           `json:"dominant_emotion"`
+	MoodScore       float64          `json:"mood_score"` // Average valence, -1 (heavy) to 1 (light)
+}
+
+// EmotionService stores emotions detected in user messages and aggregates
+// them for the Jejak page, without new AI calls
+type EmotionService struct {
+	queries  *db.Queries
+	location *time.Location // WIB timezone
+}
+
+// NewEmotionService creates a new emotion service
+func NewEmotionService(queries *db.Queries) *EmotionService {
+	// Load WIB timezone (UTC+7)
+	loc, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		// Fallback to fixed offset if timezone data not available
+		loc = time.FixedZone("WIB", 7*60*60)
+	}
+
+	return &EmotionService{
+		queries:  queries,
+		location: loc,
+	}
+}
+
+// WithTx returns a copy of the service that runs its queries in tx
+func (s *EmotionService) WithTx(tx pgx.Tx) *EmotionService {
+	return &EmotionService{
+		queries:  s.queries.WithTx(tx),
+		location: s.location,
+	}
+}
+
+// RecordEmotions stores the emotions detected in a user message. Emotions
+// outside the vocabulary are dropped.
+func (s *EmotionService) RecordEmotions(ctx context.Context, userID string, messageID pgtype.UUID, emotions []string) error {
+	emotions = ai.NormalizeEmotions(emotions)
+	if len(emotions) == 0 {
+		return nil
+	}
+
+	if err := s.queries.CreateMessageEmotions(ctx, db.CreateMessageEmotionsParams{
+		MessageID: messageID,
+		UserID:    userID,
+		Emotions:  emotions,
+	}); err != nil {
+		return fmt.Errorf("failed to save message emotions: %w", err)
+	}
+	return nil
+}
+
+// ParseRange parses YYYY-MM-DD dates in WIB. An empty to means today and an
+// empty from means defaultDays days up to and including to.
+func (s *EmotionService) ParseRange(fromParam, toParam string, defaultDays int) (time.Time, time.Time, error) {
+	return parseDateRange(s.location, fromParam, toParam, defaultDays)
+}
+
+// parseDateRange parses YYYY-MM-DD dates in location for ParseRange methods
+func parseDateRange(location *time.Location, fromParam, toParam string, defaultDays int) (time.Time, time.Time, error) {
+	now := time.Now().In(location)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+
+	if toParam != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", toParam, location)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: 'to' must be YYYY-MM-DD", ErrInvalidDateRange)
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(0, 0, -(defaultDays - 1))
+	if fromParam != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", fromParam, location)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: 'from' must be YYYY-MM-DD", ErrInvalidDateRange)
+		}
+		from = parsed
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: 'from' must not be after 'to'", ErrInvalidDateRange)
+	}
+	if to.Sub(from) >= MaxDateRangeDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: range must not exceed %d days", ErrInvalidDateRange, MaxDateRangeDays)
+	}
+
+	return from, to, nil
+}
+
+// Distribution returns emotion counts per day or per week between from and
+// to, inclusive. Periods without emotions are omitted.
+func (s *EmotionService) Distribution(ctx context.Context, userID, period string, from, to time.Time) ([]EmotionBucket, error) {
+	if period != EmotionPeriodDaily && period != EmotionPeriodWeekly {
+		return nil, fmt.Errorf("unknown emotion period %q", period)
+	}
+
+	days, err := s.countByDay(ctx, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := []EmotionBucket{}
+	index := map[string]int{}
+	for _, day := range days {
+		start, end := day.date, day.date
+		if period == EmotionPeriodWeekly {
+			start = day.date.AddDate(0, 0, -int(day.date.Weekday()))
+			end = start.AddDate(0, 0, 6)
+		}
+
+		key := start.Format("2006-01-02")
+		i, ok := index[key]
+		if !ok {
+			i = len(buckets)
+			index[key] = i
+			buckets = append(buckets, EmotionBucket{
+				Start:    key,
+				End:      end.Format("2006-01-02"),
+				Emotions: map[string]int32{},
+			})
+		}
+
+		for emotion, count := range day.emotions {
+			buckets[i].Emotions[emotion] += count
+			buckets[i].Total += count
+		}
+	}
+
+	for i := range buckets {
+		buckets[i].DominantEmotion = dominantEmotion(buckets[i].Emotions)
+	}
+
+	return buckets, nil
+}
+
+// Timeline returns the daily mood between from and to, inclusive. Days
+// without emotions are omitted.
+func (s *EmotionService) Timeline(ctx context.Context, userID string, from, to time.Time) ([]MoodPoint, error) {
+	days, err := s.countByDay(ctx, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]MoodPoint, 0, len(days))
+	for _, day := range days {
+		point := MoodPoint{
+			Date:            day.date.Format("2006-01-02"),
+			Emotions:        day.emotions,
+			DominantEmotion: dominantEmotion(day.emotions),
+		}
+
+		var valence float64
+		for emotion, count := range day.emotions {
+			point.Total += count
+			valence += emotionValence[emotion] * float64(count)
+		}
+		if point.Total > 0 {
+			point.MoodScore = valence / float64(point.Total)
+		}
+
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// dayEmotions is the emotion counts of one WIB calendar day
+type dayEmotions struct {
+	date     time.Time
+	emotions map[string]int32
+}
+
+// countByDay loads emotion counts per day between from and to, inclusive, oldest first
+func (s *EmotionService) countByDay(ctx context.Context, userID string, from, to time.Time) ([]dayEmotions, error) {
+	rows, err := s.queries.CountUserEmotionsByDay(ctx, db.CountUserEmotionsByDayParams{
+		UserID:   userID,
+		FromTime: pgtype.Timestamptz{Time: from, Valid: true},
+		ToTime:   pgtype.Timestamptz{Time: to.AddDate(0, 0, 1), Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count emotions: %w", err)
+	}
+
+	var days []dayEmotions
+	for _, row := range rows {
+		date := time.Date(row.Day.Time.Year(), row.Day.Time.Month(), row.Day.Time.Day(), 0, 0, 0, 0, s.location)
+		if len(days) == 0 || !days[len(days)-1].date.Equal(date) {
+			days = append(days, dayEmotions{date: date, emotions: map[string]int32{}})
+		}
+		days[len(days)-1].emotions[row.Emotion] += row.Count
+	}
+
+	return days, nil
+}
+
+// dominantEmotion returns the most frequent emotion, breaking ties by the
+// order of ai.EmotionLabels
+func dominantEmotion(emotions map[string]int32) string {
+	labels := make([]string, 0, len(emotions))
+	for emotion := range emotions {
+		labels = append(labels, emotion)
+	}
+	order := map[string]int{}
+	for i, label := range ai.EmotionLabels {
+		order[label] = i
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if emotions[labels[i]] != emotions[labels[j]] {
+			return emotions[labels[i]] > emotions[labels[j]]
+		}
+		return order[labels[i]] < order[labels[j]]
+	})
+
+	if len(labels) == 0 {
+		return ""
+	}
+	return labels[0]
+}
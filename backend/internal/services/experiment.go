@@ -0,0 +1,234 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+)
+
+// Experiment is an A/B test over Pujangga prompts, models and depth thresholds
+type Experiment struct {
+	ID          string              `json:"id"`
+	Description string              `json:"description"`
+	Active      bool                `json:"active"` // Inactive experiments enroll nobody and apply no treatment
+	Variants    []ExperimentVariant `json:"variants"`
+}
+
+// ExperimentVariant is one arm of an experiment
+type ExperimentVariant struct {
+	Name            string              `json:"name"`
+	Weight          int                 `json:"weight"`                     // Relative share of users, defaults to 1
+	Prompts         map[string]string   `json:"prompts,omitempty"`          // Prompt name -> version, e.g. {"respond": "v2"}
+	Models          []string            `json:"models,omitempty"`           // Replaces the model chain
+	DepthThresholds *ai.DepthThresholds `json:"depth_thresholds,omitempty"` // Replaces the depth engine with message-count thresholds
+}
+
+// ExperimentReport compares outcome metrics across an experiment's variants
+type ExperimentReport struct {
+	Experiment Experiment                    `json:"experiment"`
+	Variants   []db.GetExperimentOutcomesRow `json:"variants"`
+}
+
+// ExperimentService buckets users into experiment variants and reports outcomes
+type ExperimentService struct {
+	queries     *db.Queries
+	experiments []Experiment
+}
+
+// NewExperimentService creates a new experiment service
+func NewExperimentService(queries *db.Queries, experiments []Experiment) *ExperimentService {
+	return &ExperimentService{
+		queries:     queries,
+		experiments: experiments,
+	}
+}
+
+// LoadExperiments reads experiment definitions from a JSON file containing an
+// array of Experiment
+func LoadExperiments(path string) ([]Experiment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read experiments file: %w", err)
+	}
+
+	var experiments []Experiment
+	if err := json.Unmarshal(data, &experiments); err != nil {
+		return nil, fmt.Errorf("failed to parse experiments file: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for i := range experiments {
+		exp := &experiments[i]
+		if exp.ID == "" {
+			return nil, fmt.Errorf("experiment %d has no id", i)
+		}
+		if seen[exp.ID] {
+			return nil, fmt.Errorf("duplicate experiment id %q", exp.ID)
+		}
+		seen[exp.ID] = true
+
+		if len(exp.Variants) == 0 {
+			return nil, fmt.Errorf("experiment %q has no variants", exp.ID)
+		}
+		for j := range exp.Variants {
+			variant := &exp.Variants[j]
+			if variant.Name == "" {
+				return nil, fmt.Errorf("experiment %q has a variant without a name", exp.ID)
+			}
+			if variant.Weight <= 0 {
+				variant.Weight = 1
+			}
+			if t := variant.DepthThresholds; t != nil && (t.Light < 1 || t.Deep <= t.Light) {
+				return nil, fmt.Errorf("experiment %q variant %q has invalid depth thresholds", exp.ID, variant.Name)
+			}
+		}
+	}
+
+	return experiments, nil
+}
+
+// Experiments returns the configured experiments
+func (s *ExperimentService) Experiments() []Experiment {
+	return s.experiments
+}
+
+// Get returns the experiment with the given ID
+func (s *ExperimentService) Get(id string) (*Experiment, bool) {
+	for i := range s.experiments {
+		if s.experiments[i].ID == id {
+			return &s.experiments[i], true
+		}
+	}
+	return nil, false
+}
+
+// Treatment enrolls the user in every active experiment and returns the
+// combined treatment of their variants. Enrollment failures are logged and
+// the user gets the default behaviour for that experiment.
+func (s *ExperimentService) Treatment(ctx context.Context, userID string) ai.Treatment {
+	treatment := ai.Treatment{}
+	if len(s.experiments) == 0 {
+		return treatment
+	}
+
+	assigned := map[string]string{}
+	assignments, err := s.queries.ListUserExperimentAssignments(ctx, userID)
+	if err != nil {
+		log.Printf("[ExperimentService] failed to load assignments for user %s: %v", userID, err)
+		return treatment
+	}
+	for _, assignment := range assignments {
+		assigned[assignment.Experiment] = assignment.Variant
+	}
+
+	for i := range s.experiments {
+		exp := &s.experiments[i]
+		if !exp.Active {
+			continue
+		}
+
+		variant := exp.variant(assigned[exp.ID])
+		if variant == nil {
+			variant = exp.bucket(userID)
+			if _, exists := assigned[exp.ID]; !exists {
+				assignment, err := s.queries.CreateExperimentAssignment(ctx, db.CreateExperimentAssignmentParams{
+					UserID:     userID,
+					Experiment: exp.ID,
+					Variant:    variant.Name,
+				})
+				if err != nil {
+					log.Printf("[ExperimentService] failed to assign user %s to %s: %v", userID, exp.ID, err)
+					continue
+				}
+				// A concurrent request may have enrolled the user first
+				if stored := exp.variant(assignment.Variant); stored != nil {
+					variant = stored
+				}
+			}
+		}
+
+		applyVariant(&treatment, exp.ID, variant)
+	}
+
+	return treatment
+}
+
+// Report returns outcome metrics per variant of an experiment
+func (s *ExperimentService) Report(ctx context.Context, id string) (*ExperimentReport, error) {
+	exp, ok := s.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("unknown experiment %q", id)
+	}
+
+	outcomes, err := s.queries.GetExperimentOutcomes(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get experiment outcomes: %w", err)
+	}
+
+	return &ExperimentReport{
+		Experiment: *exp,
+		Variants:   outcomes,
+	}, nil
+}
+
+// variant returns the variant with the given name, or nil
+func (e *Experiment) variant(name string) *ExperimentVariant {
+	for i := range e.Variants {
+		if e.Variants[i].Name == name {
+			return &e.Variants[i]
+		}
+	}
+	return nil
+}
+
+// bucket deterministically picks a variant for userID by weight, so a user
+// lands in the same variant on every server even before it is stored
+func (e *Experiment) bucket(userID string) *ExperimentVariant {
+	total := 0
+	for _, variant := range e.Variants {
+		total += variant.Weight
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(e.ID + ":" + userID))
+	point := int(hash.Sum32() % uint32(total))
+
+	for i := range e.Variants {
+		point -= e.Variants[i].Weight
+		if point < 0 {
+			return &e.Variants[i]
+		}
+	}
+	return &e.Variants[len(e.Variants)-1]
+}
+
+// applyVariant merges a variant into a treatment. Experiments listed earlier
+// win when two variants set the same field.
+func applyVariant(treatment *ai.Treatment, experimentID string, variant *ExperimentVariant) {
+	if treatment.Variants == nil {
+		treatment.Variants = map[string]string{}
+	}
+	treatment.Variants[experimentID] = variant.Name
+
+	for name, version := range variant.Prompts {
+		if treatment.Prompts == nil {
+			treatment.Prompts = map[string]string{}
+		}
+		if _, set := treatment.Prompts[name]; !set {
+			treatment.Prompts[name] = version
+		}
+	}
+	if len(treatment.Models) == 0 && len(variant.Models) > 0 {
+		treatment.Models = variant.Models
+	}
+	if treatment.DepthThresholds == nil && variant.DepthThresholds != nil {
+		treatment.DepthThresholds = variant.DepthThresholds
+	}
+}
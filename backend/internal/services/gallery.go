@@ -0,0 +1,256 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Artwork statuses in the Galeri
+const (
+	ArtworkLocked     = "locked"
+	ArtworkInProgress = "in_progress"
+	ArtworkCompleted  = "completed"
+)
+
+var (
+	// ErrArtworkNotFound is returned for unknown artworks
+	ErrArtworkNotFound = errors.New("artwork not found")
+	// ErrArtworkUnlocked is returned when unlocking an artwork the user already unlocked
+	ErrArtworkUnlocked = errors.New("artwork is already unlocked")
+	// ErrArtworkUnavailable is returned when unlocking a retired or out-of-season artwork
+	ErrArtworkUnavailable = errors.New("artwork is not available")
+	// ErrArtworkInProgress is returned when unlocking a canvas while another is still being revealed
+	ErrArtworkInProgress = errors.New("another artwork is still being revealed")
+	// ErrArtworkNotUnlocked is returned when revealing an artwork the user hasn't unlocked
+	ErrArtworkNotUnlocked = errors.New("artwork is not unlocked")
+	// ErrArtworkCompleted is returned when revealing an artwork that is fully revealed
+	ErrArtworkCompleted = errors.New("artwork is already completed")
+	// ErrRevealTooSmall is returned when the Tinta Emas offered doesn't cover one percent
+	ErrRevealTooSmall = errors.New("not enough tinta emas for one percent")
+)
+
+// Reveal is the outcome of spending Tinta Emas on an artwork
+type Reveal struct {
+	Artwork   db.UserArtwork
+	Spent     int32 // Tinta Emas spent; offers are rounded down to whole percents
+	Revealed  int32 // Percentage points revealed
+	Completed bool
+	Stats     db.UserStat // Balances after paying
+}
+
+// GalleryService runs the Mahakarya loop of the Galeri: users unlock a
+// canvas with Marmer, then reveal it percent by percent with Tinta Emas
+// until it completes. Every purchase runs in one transaction that locks
+// the user's balances, so concurrent requests can't overspend.
+type GalleryService struct {
+	queries  *db.Queries
+	pool     *db.Pool
+	renderer *RevealRenderer
+}
+
+// NewGalleryService creates a new gallery service
+func NewGalleryService(queries *db.Queries, pool *db.Pool, renderer *RevealRenderer) *GalleryService {
+	return &GalleryService{
+		queries:  queries,
+		pool:     pool,
+		renderer: renderer,
+	}
+}
+
+// Catalog returns every artwork with the user's status and progress
+func (s *GalleryService) Catalog(ctx context.Context, userID string) ([]db.ListGalleryRow, error) {
+	artworks, err := s.queries.ListGallery(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list gallery: %w", err)
+	}
+	return artworks, nil
+}
+
+// Current returns the artwork the user is revealing, nil if none
+func (s *GalleryService) Current(ctx context.Context, userID string) (*db.GetCurrentArtworkRow, error) {
+	artwork, err := s.queries.GetCurrentArtwork(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current artwork: %w", err)
+	}
+	return &artwork, nil
+}
+
+// Image returns the path of a PNG of the artwork as the user sees it:
+// veiled while locked, partially revealed in progress and whole once completed
+func (s *GalleryService) Image(ctx context.Context, userID string, artworkID pgtype.UUID) (string, error) {
+	artwork, err := s.queries.GetArtworkByID(ctx, artworkID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrArtworkNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get artwork: %w", err)
+	}
+
+	// Users see the version they unlocked
+	version, progress := artwork.Version, int32(0)
+	userArtwork, err := s.queries.GetUserArtwork(ctx, db.GetUserArtworkParams{UserID: userID, ArtworkID: artworkID})
+	if err == nil {
+		version, progress = userArtwork.ArtworkVersion, userArtwork.Progress
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("failed to get user artwork: %w", err)
+	}
+
+	content, err := s.queries.GetArtworkVersion(ctx, db.GetArtworkVersionParams{ArtworkID: artworkID, Version: version})
+	if err != nil {
+		return "", fmt.Errorf("failed to get artwork version: %w", err)
+	}
+
+	return s.renderer.Render(userID, content, progress)
+}
+
+// Unlock spends the artwork's unlock_cost in Marmer and starts revealing
+// its current version. Only one canvas is revealed at a time, and only
+// artworks that are neither retired nor out of season can be unlocked.
+func (s *GalleryService) Unlock(ctx context.Context, userID string, artworkID pgtype.UUID) (db.UserArtwork, db.UserStat, error) {
+	var unlocked db.UserArtwork
+	var stats db.UserStat
+
+	err := s.purchase(ctx, userID, func(q *db.Queries) error {
+		artwork, err := q.GetArtworkByID(ctx, artworkID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrArtworkNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get artwork: %w", err)
+		}
+
+		if _, err := q.GetUserArtwork(ctx, db.GetUserArtworkParams{UserID: userID, ArtworkID: artworkID}); err == nil {
+			return ErrArtworkUnlocked
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to get user artwork: %w", err)
+		}
+		if !artworkAvailable(artwork, time.Now()) {
+			return ErrArtworkUnavailable
+		}
+
+		if _, err := q.GetCurrentArtwork(ctx, userID); err == nil {
+			return ErrArtworkInProgress
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to get current artwork: %w", err)
+		}
+
+		if stats, err = post(ctx, q, LedgerEntry{
+			UserID:         userID,
+			Currency:       CurrencyMarble,
+			Delta:          -artwork.UnlockCost,
+			Reason:         LedgerArtworkUnlock,
+			IdempotencyKey: fmt.Sprintf("%s:%s", LedgerArtworkUnlock, artworkID),
+		}); err != nil {
+			return err
+		}
+
+		if unlocked, err = q.UnlockArtwork(ctx, db.UnlockArtworkParams{
+			UserID:         userID,
+			ArtworkID:      artworkID,
+			ArtworkVersion: artwork.Version,
+		}); err != nil {
+			return fmt.Errorf("failed to unlock artwork: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return db.UserArtwork{}, db.UserStat{}, err
+	}
+
+	log.Printf("[GalleryService] user %s unlocked artwork %s", userID, artworkID)
+	return unlocked, stats, nil
+}
+
+// Reveal spends up to tintaEmas Tinta Emas on an unlocked artwork, at the
+// reveal_cost of the version the user unlocked per percentage point. Offers are rounded down to whole
+// percents and capped at what is left to reveal; the artwork completes at 100%.
+func (s *GalleryService) Reveal(ctx context.Context, userID string, artworkID pgtype.UUID, tintaEmas int32) (Reveal, error) {
+	var reveal Reveal
+
+	err := s.purchase(ctx, userID, func(q *db.Queries) error {
+		if _, err := q.GetArtworkByID(ctx, artworkID); errors.Is(err, pgx.ErrNoRows) {
+			return ErrArtworkNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to get artwork: %w", err)
+		}
+
+		userArtwork, err := q.GetUserArtwork(ctx, db.GetUserArtworkParams{UserID: userID, ArtworkID: artworkID})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrArtworkNotUnlocked
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get user artwork: %w", err)
+		}
+
+		artwork, err := q.GetArtworkVersion(ctx, db.GetArtworkVersionParams{ArtworkID: artworkID, Version: userArtwork.ArtworkVersion})
+		if err != nil {
+			return fmt.Errorf("failed to get artwork version: %w", err)
+		}
+		if userArtwork.Status == ArtworkCompleted {
+			return ErrArtworkCompleted
+		}
+
+		points := min(tintaEmas/max(artwork.RevealCost, 1), 100-userArtwork.Progress)
+		if points <= 0 {
+			return ErrRevealTooSmall
+		}
+		reveal.Spent = points * artwork.RevealCost
+		reveal.Revealed = points
+
+		if reveal.Stats, err = post(ctx, q, LedgerEntry{
+			UserID:         userID,
+			Currency:       CurrencyGoldenInk,
+			Delta:          -reveal.Spent,
+			Reason:         LedgerArtworkReveal,
+			IdempotencyKey: fmt.Sprintf("%s:%s:%d-%d", LedgerArtworkReveal, artworkID, userArtwork.Progress, userArtwork.Progress+points),
+		}); err != nil {
+			return err
+		}
+
+		if reveal.Artwork, err = q.UpdateArtworkProgress(ctx, db.UpdateArtworkProgressParams{
+			UserID:    userID,
+			ArtworkID: artworkID,
+			Progress:  userArtwork.Progress + points,
+		}); err != nil {
+			return fmt.Errorf("failed to update artwork progress: %w", err)
+		}
+		reveal.Completed = reveal.Artwork.Status == ArtworkCompleted
+		return nil
+	})
+	if err != nil {
+		return Reveal{}, err
+	}
+
+	if reveal.Completed {
+		log.Printf("[GalleryService] user %s completed artwork %s", userID, artworkID)
+	}
+	return reveal, nil
+}
+
+// purchase runs fn in a transaction holding a lock on the user's balances
+func (s *GalleryService) purchase(ctx context.Context, userID string, fn func(q *db.Queries) error) error {
+	// Users who never earned anything have no stats row to lock yet
+	if _, err := s.queries.UpsertUserStats(ctx, userID); err != nil {
+		return fmt.Errorf("failed to get user stats: %w", err)
+	}
+
+	return s.pool.InTx(ctx, func(tx pgx.Tx) error {
+		q := s.queries.WithTx(tx)
+		if _, err := q.LockUserStats(ctx, userID); err != nil {
+			return fmt.Errorf("failed to lock user stats: %w", err)
+		}
+		return fn(q)
+	})
+}
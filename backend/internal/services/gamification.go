@@ -3,16 +3,28 @@ package services
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"catetin/backend/internal/db"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+// Currencies users earn and spend
+const (
+	CurrencyGoldenInk = "golden_ink" // Tinta Emas
+	CurrencyMarble    = "marble"     // Marmer
+)
+
+// ErrInsufficientBalance is returned when a user can't afford a purchase
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
 // GamificationService handles reward calculations and gamification logic
 type GamificationService struct {
 	queries *db.Queries
+	ledger  *LedgerService
 	config  GamificationConfig
 }
 
@@ -40,17 +52,27 @@ func DefaultGamificationConfig() GamificationConfig {
 }
 
 // NewGamificationService creates a new GamificationService
-func NewGamificationService(queries *db.Queries, config *GamificationConfig) *GamificationService {
+func NewGamificationService(queries *db.Queries, ledger *LedgerService, config *GamificationConfig) *GamificationService {
 	cfg := DefaultGamificationConfig()
 	if config != nil {
 		cfg = *config
 	}
 	return &GamificationService{
 		queries: queries,
+		ledger:  ledger,
 		config:  cfg,
 	}
 }
 
+// WithTx returns a copy of the service that runs its queries and ledger posts in tx
+func (s *GamificationService) WithTx(tx pgx.Tx) *GamificationService {
+	return &GamificationService{
+		queries: s.queries.WithTx(tx),
+		ledger:  s.ledger.WithTx(tx),
+		config:  s.config,
+	}
+}
+
 // Rewards represents the calculated rewards for a session
 type Rewards struct {
 	TintaEmas     int32 `json:"tinta_emas"`
@@ -120,36 +142,44 @@ func (s *GamificationService) CalculateRewards(ctx context.Context, userID strin
 	}, nil
 }
 
-// ApplyRewards applies the calculated rewards to the user's stats
-func (s *GamificationService) ApplyRewards(ctx context.Context, userID string, rewards *Rewards) (*db.UserStat, error) {
-	var stats db.UserStat
-	var err error
+// ApplyRewards applies the calculated rewards to the user's stats, recording
+// them in the ledger. messageID is the rewarded message, or invalid for
+// session rewards. Tinta Emas is applied once per message or session and
+// streak Marmer once per day, however often the rewards are retried.
+func (s *GamificationService) ApplyRewards(ctx context.Context, userID string, sessionID, messageID pgtype.UUID, rewards *Rewards) (*db.UserStat, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
 
-	// Add Tinta Emas
-	if rewards.TintaEmas > 0 {
-		stats, err = s.queries.AddGoldenInk(ctx, db.AddGoldenInkParams{
-			UserID:    userID,
-			GoldenInk: rewards.TintaEmas,
-		})
-		if err != nil {
-			return nil, err
-		}
+	source := "session:" + sessionID.String()
+	if messageID.Valid {
+		source = "message:" + messageID.String()
 	}
 
-	// Add Marmer
-	if rewards.Marmer > 0 {
-		stats, err = s.queries.AddMarble(ctx, db.AddMarbleParams{
-			UserID: userID,
-			Marble: rewards.Marmer,
-		})
-		if err != nil {
-			return nil, err
-		}
+	stats, err := s.ledger.Post(ctx,
+		LedgerEntry{
+			UserID:         userID,
+			Currency:       CurrencyGoldenInk,
+			Delta:          rewards.TintaEmas,
+			Reason:         LedgerMessageReward,
+			MessageID:      messageID,
+			SessionID:      sessionID,
+			IdempotencyKey: LedgerMessageReward + ":" + source,
+		},
+		LedgerEntry{
+			UserID:         userID,
+			Currency:       CurrencyMarble,
+			Delta:          rewards.Marmer,
+			Reason:         LedgerStreakReward,
+			MessageID:      messageID,
+			SessionID:      sessionID,
+			IdempotencyKey: LedgerStreakReward + ":" + today.Format("2006-01-02"),
+		},
+	)
+	if err != nil {
+		return nil, err
 	}
 
 	// Update streak
 	if rewards.StreakUpdated {
-		today := time.Now().UTC().Truncate(24 * time.Hour)
 		stats, err = s.queries.UpdateStreak(ctx, db.UpdateStreakParams{
 			UserID:        userID,
 			CurrentStreak: rewards.NewStreak,
@@ -167,13 +197,13 @@ func (s *GamificationService) ApplyRewards(ctx context.Context, userID string, r
 }
 
 // CalculateAndApplyRewards is a convenience method that calculates and applies rewards
-func (s *GamificationService) CalculateAndApplyRewards(ctx context.Context, userID string, wordCount int) (*db.UserStat, *Rewards, error) {
+func (s *GamificationService) CalculateAndApplyRewards(ctx context.Context, userID string, sessionID pgtype.UUID, wordCount int) (*db.UserStat, *Rewards, error) {
 	rewards, err := s.CalculateRewards(ctx, userID, wordCount)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	stats, err := s.ApplyRewards(ctx, userID, rewards)
+	stats, err := s.ApplyRewards(ctx, userID, sessionID, pgtype.UUID{}, rewards)
 	if err != nil {
 		return nil, nil, err
 	}
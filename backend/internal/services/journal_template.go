@@ -0,0 +1,187 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ErrUnknownTemplate is returned for template IDs that aren't in ai.JournalTemplates
+var ErrUnknownTemplate = errors.New("unknown journal template")
+
+// TemplateProgress is where a user turn left its guided session
+type TemplateProgress struct {
+	TemplateID    string `json:"template_id"`
+	Step          int    `json:"step"` // 0-based index of the step the reply asks for
+	StepCount     int    `json:"step_count"`
+	StepKey       string `json:"step_key,omitempty"` // Empty once completed
+	Completed     bool   `json:"completed"`
+	JustCompleted bool   `json:"just_completed"` // Whether this turn completed the last step
+
+	save *db.UpdateSessionTemplateProgressParams // What Save writes; nil for holds
+}
+
+// JournalTemplateService runs guided journaling sessions: it moves them
+// through their template's steps and stores the structured output once
+// every step is done
+type JournalTemplateService struct {
+	queries  *db.Queries
+	pujangga *ai.PujanggaService
+}
+
+// NewJournalTemplateService creates a new journal template service. pujangga
+// may be nil, which disables the structured output.
+func NewJournalTemplateService(queries *db.Queries, pujangga *ai.PujanggaService) *JournalTemplateService {
+	return &JournalTemplateService{
+		queries:  queries,
+		pujangga: pujangga,
+	}
+}
+
+// WithTx returns a copy of the service that runs its queries in tx
+func (s *JournalTemplateService) WithTx(tx pgx.Tx) *JournalTemplateService {
+	return &JournalTemplateService{
+		queries:  s.queries.WithTx(tx),
+		pujangga: s.pujangga,
+	}
+}
+
+// Create starts a session guided by the template
+func (s *JournalTemplateService) Create(ctx context.Context, userID, templateID string) (db.Session, *ai.JournalTemplate, error) {
+	template, ok := ai.JournalTemplateByID(templateID)
+	if !ok {
+		return db.Session{}, nil, fmt.Errorf("%w: %q", ErrUnknownTemplate, templateID)
+	}
+
+	session, err := s.queries.CreateTemplateSession(ctx, db.CreateTemplateSessionParams{
+		UserID:     userID,
+		TemplateID: pgtype.Text{String: templateID, Valid: true},
+	})
+	if err != nil {
+		return db.Session{}, nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return session, template, nil
+}
+
+// Advance counts the user's message toward the session's current step and
+// moves to the next step once the step's criteria are met; Save stores the
+// progress with the rest of the turn. It returns the guide for the reply,
+// nil for free-form sessions and for guided sessions completed on an
+// earlier turn.
+func (s *JournalTemplateService) Advance(session db.Session, content string) (*ai.GuideTurn, *TemplateProgress) {
+	template, ok := ai.JournalTemplateByID(session.TemplateID.String)
+	if !ok {
+		return nil, nil
+	}
+	if session.TemplateCompletedAt.Valid {
+		return nil, s.Hold(session)
+	}
+
+	step := min(int(session.TemplateStep), len(template.Steps)-1)
+	messages := int(session.TemplateStepMessages) + 1
+	words := int(session.TemplateStepWords) + CountWords(content)
+
+	criteria := template.Steps[step]
+	if messages >= criteria.MinMessages && words >= criteria.MinWords {
+		step, messages, words = step+1, 0, 0
+	}
+	completed := step == len(template.Steps)
+
+	progress := &TemplateProgress{
+		TemplateID:    template.ID,
+		Step:          step,
+		StepCount:     len(template.Steps),
+		Completed:     completed,
+		JustCompleted: completed,
+		save: &db.UpdateSessionTemplateProgressParams{
+			ID:           session.ID,
+			Step:         int16(step),
+			StepMessages: int16(messages),
+			StepWords:    int32(words),
+			Completed:    completed,
+		},
+	}
+	if !completed {
+		progress.StepKey = template.Steps[step].Key
+	}
+	return &ai.GuideTurn{Template: template, Step: step, Completed: completed}, progress
+}
+
+// Hold reports a guided session's progress without counting a turn, e.g.
+// for turns answered with the crisis response. It returns nil for free-form
+// sessions.
+func (s *JournalTemplateService) Hold(session db.Session) *TemplateProgress {
+	template, ok := ai.JournalTemplateByID(session.TemplateID.String)
+	if !ok {
+		return nil
+	}
+
+	step := min(int(session.TemplateStep), len(template.Steps))
+	progress := &TemplateProgress{
+		TemplateID: template.ID,
+		Step:       step,
+		StepCount:  len(template.Steps),
+		Completed:  session.TemplateCompletedAt.Valid,
+	}
+	if step < len(template.Steps) {
+		progress.StepKey = template.Steps[step].Key
+	}
+	return progress
+}
+
+// Save stores the progress a turn made through its guided session. Holds
+// save nothing.
+func (s *JournalTemplateService) Save(ctx context.Context, progress *TemplateProgress) error {
+	if progress == nil || progress.save == nil {
+		return nil
+	}
+	if _, err := s.queries.UpdateSessionTemplateProgress(ctx, *progress.save); err != nil {
+		return fmt.Errorf("failed to save template progress: %w", err)
+	}
+	return nil
+}
+
+// RecordOutput extracts and stores the structured output of a completed
+// guided session. Templates without an output are skipped.
+func (s *JournalTemplateService) RecordOutput(ctx context.Context, userID string, sessionID pgtype.UUID, templateID string) error {
+	template, ok := ai.JournalTemplateByID(templateID)
+	if !ok || !template.HasOutput() || s.pujangga == nil {
+		return nil
+	}
+
+	messages, err := s.queries.ListMessagesBySession(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session messages: %w", err)
+	}
+
+	sessionMessages := make([]ai.Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role == "assistant" && msg.PromptVersion.String == ai.CrisisPromptVersion {
+			continue
+		}
+		sessionMessages = append(sessionMessages, ai.Message{Role: msg.Role, Content: msg.Content})
+	}
+
+	output, err := s.pujangga.ExtractTemplateOutput(ai.WithCaller(ctx, userID, sessionID.String()), template, sessionMessages)
+	if err != nil {
+		return err
+	}
+
+	if err := s.queries.SetSessionTemplateOutput(ctx, db.SetSessionTemplateOutputParams{
+		ID:             sessionID,
+		TemplateOutput: output,
+	}); err != nil {
+		return fmt.Errorf("failed to save template output: %w", err)
+	}
+
+	log.Printf("[JournalTemplateService] stored %s output of session %s", template.ID, sessionID)
+	return nil
+}
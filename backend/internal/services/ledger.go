@@ -0,0 +1,205 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// CurrencyXP is experience points, recorded in the ledger like currencies
+const CurrencyXP = "xp"
+
+// Ledger reasons
+const (
+	LedgerMessageReward         = "message_reward" // Tinta Emas for writing a message
+	LedgerStreakReward          = "streak_reward"  // Marmer for the first message of a day
+	LedgerMessageXP             = "message_xp"
+	LedgerArtworkUnlock         = "artwork_unlock"
+	LedgerArtworkReveal         = "artwork_reveal"
+	LedgerQuoteCollectionUnlock = "quote_collection_unlock"
+)
+
+// ledgerCounterparties names the system account on the other side of each reason
+var ledgerCounterparties = map[string]string{
+	LedgerMessageReward:         "rewards",
+	LedgerStreakReward:          "rewards",
+	LedgerMessageXP:             "rewards",
+	LedgerArtworkUnlock:         "galeri",
+	LedgerArtworkReveal:         "galeri",
+	LedgerQuoteCollectionUnlock: "perpustakaan",
+}
+
+// LedgerEntry is a change to one of a user's balances. Posting an entry
+// whose idempotency key the user already has changes nothing, so retried
+// rewards and purchases are applied once.
+type LedgerEntry struct {
+	UserID         string
+	Currency       string // CurrencyGoldenInk, CurrencyMarble or CurrencyXP
+	Delta          int32  // Negative for spending
+	Reason         string
+	MessageID      pgtype.UUID // Optional source message
+	SessionID      pgtype.UUID // Optional source session
+	IdempotencyKey string
+}
+
+// LedgerService records every change to Tinta Emas, Marmer and XP in the
+// append-only currency ledger together with the balance it changes
+type LedgerService struct {
+	queries *db.Queries
+	pool    *db.Pool
+	tx      pgx.Tx // Set on copies bound to a caller's transaction
+}
+
+// NewLedgerService creates a new ledger service
+func NewLedgerService(queries *db.Queries, pool *db.Pool) *LedgerService {
+	return &LedgerService{
+		queries: queries,
+		pool:    pool,
+	}
+}
+
+// WithTx returns a copy of the service that posts in tx instead of its own transactions
+func (s *LedgerService) WithTx(tx pgx.Tx) *LedgerService {
+	return &LedgerService{
+		queries: s.queries.WithTx(tx),
+		pool:    s.pool,
+		tx:      tx,
+	}
+}
+
+// Post records entries and applies them to the user's balances in one
+// transaction, returning the balances after the last one. Spending more
+// than a balance fails every entry with ErrInsufficientBalance.
+func (s *LedgerService) Post(ctx context.Context, entries ...LedgerEntry) (db.UserStat, error) {
+	var stats db.UserStat
+	postAll := func(q *db.Queries) error {
+		for _, entry := range entries {
+			var err error
+			if stats, err = post(ctx, q, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if s.tx != nil {
+		err = postAll(s.queries)
+	} else {
+		err = s.pool.InTx(ctx, func(tx pgx.Tx) error {
+			return postAll(s.queries.WithTx(tx))
+		})
+	}
+	if err != nil {
+		return db.UserStat{}, err
+	}
+	return stats, nil
+}
+
+// History returns the user's ledger entries, newest first
+func (s *LedgerService) History(ctx context.Context, userID string, limit, offset int32) ([]db.ListLedgerEntriesRow, error) {
+	entries, err := s.queries.ListLedgerEntries(ctx, db.ListLedgerEntriesParams{
+		UserID: userID,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ledger entries: %w", err)
+	}
+	return entries, nil
+}
+
+// Mismatches returns up to limit users whose balances differ from their
+// ledger, which means a balance changed without an entry
+func (s *LedgerService) Mismatches(ctx context.Context, limit int32) ([]db.ListLedgerMismatchesRow, error) {
+	mismatches, err := s.queries.ListLedgerMismatches(ctx, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile ledger: %w", err)
+	}
+	return mismatches, nil
+}
+
+// post records an entry and applies it to the user's balance with q, which
+// must be in a transaction so neither happens without the other. The
+// user's stats row stays locked until the transaction ends.
+func post(ctx context.Context, q *db.Queries, entry LedgerEntry) (db.UserStat, error) {
+	stats, err := q.UpsertUserStats(ctx, entry.UserID)
+	if err != nil {
+		return db.UserStat{}, fmt.Errorf("failed to get user stats: %w", err)
+	}
+	if entry.Delta == 0 {
+		return stats, nil
+	}
+
+	counterparty, ok := ledgerCounterparties[entry.Reason]
+	if !ok {
+		return db.UserStat{}, fmt.Errorf("unknown ledger reason %q", entry.Reason)
+	}
+
+	created, err := q.CreateLedgerEntry(ctx, db.CreateLedgerEntryParams{
+		UserID:         entry.UserID,
+		Currency:       entry.Currency,
+		Delta:          entry.Delta,
+		Reason:         entry.Reason,
+		Counterparty:   counterparty,
+		MessageID:      entry.MessageID,
+		SessionID:      entry.SessionID,
+		IdempotencyKey: entry.IdempotencyKey,
+	})
+	if err != nil {
+		return db.UserStat{}, fmt.Errorf("failed to record ledger entry: %w", err)
+	}
+	if created == 0 {
+		log.Printf("[LedgerService] skipped duplicate entry %s for user %s", entry.IdempotencyKey, entry.UserID)
+		return stats, nil
+	}
+
+	if entry.Delta < 0 {
+		return spend(ctx, q, entry.UserID, entry.Currency, -entry.Delta)
+	}
+
+	switch entry.Currency {
+	case CurrencyGoldenInk:
+		stats, err = q.AddGoldenInk(ctx, db.AddGoldenInkParams{UserID: entry.UserID, GoldenInk: entry.Delta})
+	case CurrencyMarble:
+		stats, err = q.AddMarble(ctx, db.AddMarbleParams{UserID: entry.UserID, Marble: entry.Delta})
+	case CurrencyXP:
+		stats, err = q.AddXP(ctx, db.AddXPParams{UserID: entry.UserID, CurrentXp: entry.Delta})
+	default:
+		return db.UserStat{}, fmt.Errorf("unknown currency %q", entry.Currency)
+	}
+	if err != nil {
+		return db.UserStat{}, fmt.Errorf("failed to add %s: %w", entry.Currency, err)
+	}
+	return stats, nil
+}
+
+// spend deducts a currency with q, failing with ErrInsufficientBalance when
+// the balance is too low
+func spend(ctx context.Context, q *db.Queries, userID, currency string, amount int32) (db.UserStat, error) {
+	var stats db.UserStat
+	var err error
+	switch currency {
+	case CurrencyGoldenInk:
+		stats, err = q.SpendGoldenInk(ctx, db.SpendGoldenInkParams{UserID: userID, GoldenInk: amount})
+	case CurrencyMarble:
+		stats, err = q.SpendMarble(ctx, db.SpendMarbleParams{UserID: userID, Marble: amount})
+	default:
+		return db.UserStat{}, fmt.Errorf("unknown currency %q", currency)
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.UserStat{}, ErrInsufficientBalance
+	}
+	if err != nil {
+		return db.UserStat{}, fmt.Errorf("failed to spend %s: %w", currency, err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeLedgerDB is an in-memory db.DBTX implementing just the queries post
+// and spend run, with the same conflict and balance rules as Postgres
+type fakeLedgerDB struct {
+	stats   map[string]*db.UserStat
+	entries map[string]int32 // Delta by user and idempotency key
+}
+
+func newFakeLedgerDB() *fakeLedgerDB {
+	return &fakeLedgerDB{
+		stats:   map[string]*db.UserStat{},
+		entries: map[string]int32{},
+	}
+}
+
+// queryName returns the sqlc name of a generated query
+func queryName(sql string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(sql, "-- name: "), " ")
+	return name
+}
+
+func (f *fakeLedgerDB) Exec(_ context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	switch queryName(sql) {
+	case "CreateLedgerEntry":
+		key := args[0].(string) + "/" + args[7].(string)
+		if _, ok := f.entries[key]; ok {
+			return pgconn.NewCommandTag("INSERT 0 0"), nil
+		}
+		f.entries[key] = args[2].(int32)
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	}
+	return pgconn.CommandTag{}, fmt.Errorf("unexpected exec %s", queryName(sql))
+}
+
+func (f *fakeLedgerDB) Query(_ context.Context, sql string, _ ...interface{}) (pgx.Rows, error) {
+	return nil, fmt.Errorf("unexpected query %s", queryName(sql))
+}
+
+func (f *fakeLedgerDB) QueryRow(_ context.Context, sql string, args ...interface{}) pgx.Row {
+	userID := args[0].(string)
+	stats, ok := f.stats[userID]
+	if !ok && queryName(sql) != "UpsertUserStats" {
+		return statsRow{err: pgx.ErrNoRows}
+	}
+
+	switch queryName(sql) {
+	case "UpsertUserStats":
+		if !ok {
+			stats = &db.UserStat{UserID: userID, Level: 1}
+			f.stats[userID] = stats
+		}
+	case "AddGoldenInk":
+		stats.GoldenInk += args[1].(int32)
+	case "AddMarble":
+		stats.Marble += args[1].(int32)
+	case "AddXP":
+		stats.CurrentXp += args[1].(int32)
+		stats.TotalXp += args[1].(int32)
+	case "SpendGoldenInk":
+		if stats.GoldenInk < args[1].(int32) {
+			return statsRow{err: pgx.ErrNoRows}
+		}
+		stats.GoldenInk -= args[1].(int32)
+	case "SpendMarble":
+		if stats.Marble < args[1].(int32) {
+			return statsRow{err: pgx.ErrNoRows}
+		}
+		stats.Marble -= args[1].(int32)
+	default:
+		return statsRow{err: fmt.Errorf("unexpected query %s", queryName(sql))}
+	}
+	return statsRow{stats: *stats}
+}
+
+// statsRow scans a user_stats row in column order
+type statsRow struct {
+	stats db.UserStat
+	err   error
+}
+
+func (r statsRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	row := reflect.ValueOf(r.stats)
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(row.Field(i))
+	}
+	return nil
+}
+
+func TestPostIsIdempotent(t *testing.T) {
+	const userID = "user-1"
+
+	tests := []struct {
+		name       string
+		entries    []LedgerEntry
+		wantErr    error
+		wantInk    int32
+		wantMarble int32
+		wantXP     int32
+		wantRows   int
+	}{
+		{
+			name: "reward applied once",
+			entries: []LedgerEntry{
+				{UserID: userID, Currency: CurrencyGoldenInk, Delta: 10, Reason: LedgerMessageReward, IdempotencyKey: "message_reward:message:1"},
+				{UserID: userID, Currency: CurrencyGoldenInk, Delta: 10, Reason: LedgerMessageReward, IdempotencyKey: "message_reward:message:1"},
+			},
+			wantInk:  10,
+			wantRows: 1,
+		},
+		{
+			name: "distinct keys both applied",
+			entries: []LedgerEntry{
+				{UserID: userID, Currency: CurrencyMarble, Delta: 1, Reason: LedgerStreakReward, IdempotencyKey: "streak_reward:2025-01-01"},
+				{UserID: userID, Currency: CurrencyMarble, Delta: 1, Reason: LedgerStreakReward, IdempotencyKey: "streak_reward:2025-01-02"},
+			},
+			wantMarble: 2,
+			wantRows:   2,
+		},
+		{
+			name: "xp applied once",
+			entries: []LedgerEntry{
+				{UserID: userID, Currency: CurrencyXP, Delta: 25, Reason: LedgerMessageXP, IdempotencyKey: "message_xp:message:1"},
+				{UserID: userID, Currency: CurrencyXP, Delta: 25, Reason: LedgerMessageXP, IdempotencyKey: "message_xp:message:1"},
+			},
+			wantXP:   25,
+			wantRows: 1,
+		},
+		{
+			name: "purchase charged once",
+			entries: []LedgerEntry{
+				{UserID: userID, Currency: CurrencyGoldenInk, Delta: 50, Reason: LedgerMessageReward, IdempotencyKey: "message_reward:message:1"},
+				{UserID: userID, Currency: CurrencyGoldenInk, Delta: -30, Reason: LedgerArtworkUnlock, IdempotencyKey: "artwork_unlock:1"},
+				{UserID: userID, Currency: CurrencyGoldenInk, Delta: -30, Reason: LedgerArtworkUnlock, IdempotencyKey: "artwork_unlock:1"},
+			},
+			wantInk:  20,
+			wantRows: 2,
+		},
+		{
+			name: "zero delta records nothing",
+			entries: []LedgerEntry{
+				{UserID: userID, Currency: CurrencyGoldenInk, Delta: 0, Reason: LedgerMessageReward, IdempotencyKey: "message_reward:message:1"},
+			},
+			wantRows: 0,
+		},
+		{
+			name: "spending past the balance fails",
+			entries: []LedgerEntry{
+				{UserID: userID, Currency: CurrencyMarble, Delta: -1, Reason: LedgerQuoteCollectionUnlock, IdempotencyKey: "quote_collection_unlock:stoik"},
+			},
+			wantErr:  ErrInsufficientBalance,
+			wantRows: 1, // Rolled back with the transaction in Postgres
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeLedgerDB()
+			q := db.New(fake)
+
+			var err error
+			for _, entry := range tt.entries {
+				if _, err = post(context.Background(), q, entry); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("post() error = %v, want %v", err, tt.wantErr)
+			}
+
+			stats := fake.stats[userID]
+			if stats.GoldenInk != tt.wantInk || stats.Marble != tt.wantMarble || stats.TotalXp != tt.wantXP {
+				t.Errorf("balances = %d ink, %d marble, %d xp, want %d, %d, %d",
+					stats.GoldenInk, stats.Marble, stats.TotalXp, tt.wantInk, tt.wantMarble, tt.wantXP)
+			}
+			if len(fake.entries) != tt.wantRows {
+				t.Errorf("ledger has %d entries, want %d", len(fake.entries), tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestPostRejectsUnknownReason(t *testing.T) {
+	fake := newFakeLedgerDB()
+	_, err := post(context.Background(), db.New(fake), LedgerEntry{
+		UserID:         "user-1",
+		Currency:       CurrencyGoldenInk,
+		Delta:          5,
+		Reason:         "gift",
+		IdempotencyKey: "gift:1",
+	})
+	if err == nil {
+		t.Fatal("post() error = nil, want an unknown reason error")
+	}
+	if len(fake.entries) != 0 || fake.stats["user-1"].GoldenInk != 0 {
+		t.Errorf("unknown reason changed the ledger or balance")
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"context"
 
 	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 // LevelingService handles XP and level calculations
 type LevelingService struct {
 	queries *db.Queries
+	ledger  *LedgerService
 	config  LevelingConfig
 }
 
@@ -34,17 +38,27 @@ func DefaultLevelingConfig() LevelingConfig {
 }
 
 // NewLevelingService creates a new LevelingService
-func NewLevelingService(queries *db.Queries, config *LevelingConfig) *LevelingService {
+func NewLevelingService(queries *db.Queries, ledger *LedgerService, config *LevelingConfig) *LevelingService {
 	cfg := DefaultLevelingConfig()
 	if config != nil {
 		cfg = *config
 	}
 	return &LevelingService{
 		queries: queries,
+		ledger:  ledger,
 		config:  cfg,
 	}
 }
 
+// WithTx returns a copy of the service that runs its queries and ledger posts in tx
+func (s *LevelingService) WithTx(tx pgx.Tx) *LevelingService {
+	return &LevelingService{
+		queries: s.queries.WithTx(tx),
+		ledger:  s.ledger.WithTx(tx),
+		config:  s.config,
+	}
+}
+
 // LevelReward represents the XP and level changes from an action
 type LevelReward struct {
 	XPEarned      int32 `json:"xp_earned"`
@@ -103,8 +117,8 @@ func (s *LevelingService) CalculateXPFromWords(wordCount int) int32 {
 	return xp
 }
 
-// AwardXP adds XP to a user and handles level ups
-func (s *LevelingService) AwardXP(ctx context.Context, userID string, wordCount int) (*LevelReward, error) {
+// AwardXP adds XP for a message to a user, once per message, and handles level ups
+func (s *LevelingService) AwardXP(ctx context.Context, userID string, sessionID, messageID pgtype.UUID, wordCount int) (*LevelReward, error) {
 	xpEarned := s.CalculateXPFromWords(wordCount)
 	if xpEarned <= 0 {
 		// No XP earned, just return current stats
@@ -124,9 +138,14 @@ func (s *LevelingService) AwardXP(ctx context.Context, userID string, wordCount
 	oldLevel := stats.Level
 
 	// Add XP (this updates both current_xp and total_xp)
-	stats, err = s.queries.AddXP(ctx, db.AddXPParams{
-		UserID:    userID,
-		CurrentXp: xpEarned,
+	stats, err = s.ledger.Post(ctx, LedgerEntry{
+		UserID:         userID,
+		Currency:       CurrencyXP,
+		Delta:          xpEarned,
+		Reason:         LedgerMessageXP,
+		MessageID:      messageID,
+		SessionID:      sessionID,
+		IdempotencyKey: LedgerMessageXP + ":" + messageID.String(),
 	})
 	if err != nil {
 		return nil, err
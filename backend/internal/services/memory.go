@@ -0,0 +1,336 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// maxUserMemories caps how many memories are listed and ranked per user
+	maxUserMemories = 200
+	// knownMemoriesForExtraction is how many existing memories the model sees when extracting
+	knownMemoriesForExtraction = 50
+	// pendingSessionsPerRun caps how many past sessions are extracted per trigger
+	pendingSessionsPerRun = 3
+	// memoryRecencyDays is the decay constant of the recency score
+	memoryRecencyDays = 30.0
+	// extractionTimeout bounds a background extraction run
+	extractionTimeout = 2 * time.Minute
+)
+
+// ErrMemoryNotFound is returned when a memory doesn't exist or belongs to another user
+var ErrMemoryNotFound = errors.New("memory not found")
+
+// memoryStopwords are frequent Indonesian words ignored when matching memories to a conversation
+var memoryStopwords = map[string]bool{
+	"yang": true, "dengan": true, "untuk": true, "tidak": true, "nggak": true, "enggak": true,
+	"sudah": true, "udah": true, "karena": true, "juga": true, "lagi": true, "akan": true,
+	"atau": true, "dari": true, "pada": true, "sama": true, "banget": true, "hari": true,
+	"tadi": true, "jadi": true, "bisa": true, "masih": true, "belum": true, "sedang": true,
+	"kalau": true, "tapi": true, "terus": true, "soal": true, "sangat": true, "ingin": true,
+}
+
+// MemoryService extracts durable facts about users from finished sessions
+// and recalls the most relevant ones into Pujangga prompts
+type MemoryService struct {
+	queries  *db.Queries
+	pujangga *ai.PujanggaService
+}
+
+// NewMemoryService creates a new memory service. pujangga may be nil, which
+// disables extraction but keeps recall and the memories API working.
+func NewMemoryService(queries *db.Queries, pujangga *ai.PujanggaService) *MemoryService {
+	return &MemoryService{
+		queries:  queries,
+		pujangga: pujangga,
+	}
+}
+
+// List returns the user's memories, most important first
+func (s *MemoryService) List(ctx context.Context, userID string) ([]db.UserMemory, error) {
+	memories, err := s.queries.ListUserMemories(ctx, db.ListUserMemoriesParams{
+		UserID: userID,
+		Limit:  maxUserMemories,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memories: %w", err)
+	}
+	return memories, nil
+}
+
+// Worries returns up to limit of the user's recurring worries, most important first
+func (s *MemoryService) Worries(ctx context.Context, userID string, limit int) ([]string, error) {
+	memories, err := s.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var worries []string
+	for _, memory := range memories {
+		if len(worries) == limit {
+			break
+		}
+		if memory.Kind == ai.MemoryWorry {
+			worries = append(worries, memory.Content)
+		}
+	}
+	return worries, nil
+}
+
+// Get returns one of the user's memories
+func (s *MemoryService) Get(ctx context.Context, userID string, id pgtype.UUID) (db.UserMemory, error) {
+	memory, err := s.queries.GetUserMemory(ctx, db.GetUserMemoryParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.UserMemory{}, ErrMemoryNotFound
+	}
+	if err != nil {
+		return db.UserMemory{}, fmt.Errorf("failed to get memory: %w", err)
+	}
+	return memory, nil
+}
+
+// Update replaces a memory's kind, content and importance. Edited memories
+// keep their content when the fact comes up again in later sessions.
+func (s *MemoryService) Update(ctx context.Context, userID string, id pgtype.UUID, kind, content string, importance int16) (db.UserMemory, error) {
+	memory, err := s.queries.UpdateUserMemory(ctx, db.UpdateUserMemoryParams{
+		ID:         id,
+		UserID:     userID,
+		Kind:       kind,
+		Content:    content,
+		Importance: importance,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.UserMemory{}, ErrMemoryNotFound
+	}
+	if err != nil {
+		return db.UserMemory{}, fmt.Errorf("failed to update memory: %w", err)
+	}
+	return memory, nil
+}
+
+// Delete removes a memory
+func (s *MemoryService) Delete(ctx context.Context, userID string, id pgtype.UUID) error {
+	deleted, err := s.queries.DeleteUserMemory(ctx, db.DeleteUserMemoryParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete memory: %w", err)
+	}
+	if deleted == 0 {
+		return ErrMemoryNotFound
+	}
+	return nil
+}
+
+// Relevant returns up to limit memories ranked by importance, recency and
+// word overlap with the recent messages
+func (s *MemoryService) Relevant(ctx context.Context, userID string, recentMessages []ai.Message, limit int) ([]ai.Memory, error) {
+	memories, err := s.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(memories) == 0 {
+		return nil, nil
+	}
+
+	conversationWords := map[string]bool{}
+	for _, msg := range recentMessages {
+		for _, word := range memoryWords(msg.Content) {
+			conversationWords[word] = true
+		}
+	}
+
+	now := time.Now()
+	scores := make(map[int]float64, len(memories))
+	order := make([]int, len(memories))
+	for i := range memories {
+		order[i] = i
+		scores[i] = memoryScore(memories[i], conversationWords, now)
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+
+	relevant := make([]ai.Memory, 0, limit)
+	for _, i := range order {
+		if len(relevant) == limit {
+			break
+		}
+		relevant = append(relevant, ai.Memory{Kind: memories[i].Kind, Content: memories[i].Content})
+	}
+	return relevant, nil
+}
+
+// memoryScore ranks a memory between 0 and 1
+func memoryScore(memory db.UserMemory, conversationWords map[string]bool, now time.Time) float64 {
+	importance := float64(memory.Importance) / 5
+	recency := math.Exp(-now.Sub(memory.LastSeenAt.Time).Hours() / 24 / memoryRecencyDays)
+
+	overlap := 0
+	for _, word := range memoryWords(memory.Content) {
+		if conversationWords[word] {
+			overlap++
+		}
+	}
+	relevance := math.Min(float64(overlap)/2, 1)
+
+	return 0.35*importance + 0.25*recency + 0.4*relevance
+}
+
+// memoryWords returns the lowercase content words of text
+func memoryWords(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	words := fields[:0]
+	for _, word := range fields {
+		if len([]rune(word)) >= 4 && !memoryStopwords[word] {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// ExtractPending extracts memories from the user's recent sessions that
+// ended without extraction, e.g. sessions left open when the day rolled over.
+// Errors are logged.
+func (s *MemoryService) ExtractPending(ctx context.Context, userID string) {
+	if s.pujangga == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, extractionTimeout)
+	defer cancel()
+
+	sessionIDs, err := s.queries.ListSessionsPendingMemoryExtraction(ctx, db.ListSessionsPendingMemoryExtractionParams{
+		UserID: userID,
+		Limit:  pendingSessionsPerRun,
+	})
+	if err != nil {
+		log.Printf("[MemoryService] failed to list pending sessions for user %s: %v", userID, err)
+		return
+	}
+
+	for _, sessionID := range sessionIDs {
+		if err := s.ExtractSession(ctx, userID, sessionID); err != nil {
+			log.Printf("[MemoryService] failed to extract memories from session %s: %v", sessionID, err)
+			if errors.Is(err, ai.ErrBudgetExceeded) {
+				return
+			}
+		}
+	}
+}
+
+// ExtractSession extracts memories from a session once. Facts the user
+// already has a memory of refresh that memory instead of adding a new one.
+// Sessions that went into crisis are never extracted.
+// On failure the session is released so a later trigger retries it.
+func (s *MemoryService) ExtractSession(ctx context.Context, userID string, sessionID pgtype.UUID) (err error) {
+	if s.pujangga == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, extractionTimeout)
+	defer cancel()
+
+	claimed, err := s.queries.ClaimSessionMemoryExtraction(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to claim session: %w", err)
+	}
+	if claimed == 0 {
+		return nil // Already extracted or being extracted
+	}
+	defer func() {
+		if err != nil {
+			if releaseErr := s.queries.ReleaseSessionMemoryExtraction(context.WithoutCancel(ctx), sessionID); releaseErr != nil {
+				log.Printf("[MemoryService] failed to release session %s: %v", sessionID, releaseErr)
+			}
+		}
+	}()
+
+	messages, err := s.queries.ListMessagesBySession(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session messages: %w", err)
+	}
+
+	sessionMessages := make([]ai.Message, 0, len(messages))
+	hasUserMessage := false
+	for _, msg := range messages {
+		// What's said in a crisis must not come back later as a memory
+		if msg.RiskLevel.String == string(ai.RiskHigh) || msg.PromptVersion.String == ai.CrisisPromptVersion {
+			log.Printf("[MemoryService] skipping extraction of session %s after a crisis response", sessionID)
+			return nil
+		}
+		hasUserMessage = hasUserMessage || msg.Role == "user"
+		sessionMessages = append(sessionMessages, ai.Message{Role: msg.Role, Content: msg.Content})
+	}
+	if !hasUserMessage {
+		return nil
+	}
+
+	existing, err := s.queries.ListUserMemories(ctx, db.ListUserMemoriesParams{
+		UserID: userID,
+		Limit:  knownMemoriesForExtraction,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list memories: %w", err)
+	}
+	known := make([]ai.Memory, len(existing))
+	for i, memory := range existing {
+		known[i] = ai.Memory{Kind: memory.Kind, Content: memory.Content}
+	}
+
+	extracted, err := s.pujangga.ExtractMemories(ai.WithCaller(ctx, userID, sessionID.String()), sessionMessages, known)
+	if err != nil {
+		return err
+	}
+
+	// The session stays claimed from here on, so a failed save is not retried
+	// and can't duplicate the memories saved before it
+	saved := 0
+	for _, memory := range extracted {
+		var saveErr error
+		if memory.SameAs > 0 {
+			_, saveErr = s.queries.TouchUserMemory(ctx, db.TouchUserMemoryParams{
+				ID:              existing[memory.SameAs-1].ID,
+				UserID:          userID,
+				Content:         memory.Content,
+				Importance:      int16(memory.Importance),
+				SourceSessionID: sessionID,
+			})
+		} else {
+			_, saveErr = s.queries.CreateUserMemory(ctx, db.CreateUserMemoryParams{
+				UserID:          userID,
+				Kind:            memory.Kind,
+				Content:         memory.Content,
+				Importance:      int16(memory.Importance),
+				SourceSessionID: sessionID,
+			})
+		}
+		if saveErr != nil {
+			log.Printf("[MemoryService] failed to save memory from session %s: %v", sessionID, saveErr)
+			continue
+		}
+		saved++
+	}
+
+	log.Printf("[MemoryService] extracted %d memories from session %s", saved, sessionID)
+	return nil
+}
@@ -0,0 +1,143 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// openingTopicMessages is how many of the previous session's last user messages are shared
+	openingTopicMessages = 2
+	// openingTopicLength truncates each shared message, in characters
+	openingTopicLength = 200
+	// openingWorries is how many remembered worries are shared
+	openingWorries = 2
+	// recentOpenings is how many recent openings the new one must not repeat
+	recentOpenings = 7
+)
+
+// OpeningService gathers the user's recent history for personalized session openings
+type OpeningService struct {
+	queries  *db.Queries
+	memories *MemoryService
+	location *time.Location // WIB timezone
+}
+
+// NewOpeningService creates a new opening service. memories may be nil,
+// which leaves worries out of openings.
+func NewOpeningService(queries *db.Queries, memories *MemoryService) *OpeningService {
+	// Load WIB timezone (UTC+7)
+	loc, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		// Fallback to fixed offset if timezone data not available
+		loc = time.FixedZone("WIB", 7*60*60)
+	}
+
+	return &OpeningService{
+		queries:  queries,
+		memories: memories,
+		location: loc,
+	}
+}
+
+// Context returns what is known about the user for opening sessionID. Parts
+// that fail to load are left out, so the returned context is always usable
+// alongside the first error.
+func (s *OpeningService) Context(ctx context.Context, userID string, sessionID pgtype.UUID) (ai.OpeningContext, error) {
+	now := time.Now().In(s.location)
+	opening := ai.OpeningContext{Now: now}
+	var errs []error
+
+	stats, err := s.queries.GetUserStats(ctx, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		errs = append(errs, fmt.Errorf("failed to get user stats: %w", err))
+	} else if err == nil && stats.LastActiveDate.Valid {
+		// Streaks follow the UTC days used by GamificationService
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		if today.Sub(stats.LastActiveDate.Time) <= 24*time.Hour {
+			opening.Streak = int(stats.CurrentStreak)
+		}
+	}
+
+	previous, err := s.queries.GetPreviousSession(ctx, db.GetPreviousSessionParams{
+		UserID: userID,
+		ID:     sessionID,
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		errs = append(errs, fmt.Errorf("failed to get previous session: %w", err))
+	} else if err == nil {
+		opening.HasHistory = true
+		opening.DaysSinceLast = calendarDaysBetween(previous.StartedAt.Time.In(s.location), now)
+
+		topic, err := s.lastTopic(ctx, previous.ID)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		opening.LastTopic = topic
+	}
+
+	if s.memories != nil {
+		worries, err := s.memories.Worries(ctx, userID, openingWorries)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		opening.Worries = worries
+	}
+
+	openings, err := s.queries.ListRecentOpenings(ctx, db.ListRecentOpeningsParams{
+		UserID: userID,
+		Limit:  recentOpenings,
+	})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to list recent openings: %w", err))
+	}
+	opening.RecentOpenings = openings
+
+	return opening, errors.Join(errs...)
+}
+
+// lastTopic returns the last user messages of a session, oldest first. It
+// returns nothing when the session ended on messages flagged by the safety
+// screen, so an opening never brings up a crisis in passing.
+func (s *OpeningService) lastTopic(ctx context.Context, sessionID pgtype.UUID) ([]string, error) {
+	messages, err := s.queries.GetRecentMessages(ctx, db.GetRecentMessagesParams{
+		SessionID: sessionID,
+		Limit:     2 * openingTopicMessages,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get previous session messages: %w", err)
+	}
+
+	var topic []string
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.RiskLevel.Valid {
+			return nil, nil
+		}
+		if msg.Role != "user" {
+			continue
+		}
+		content := []rune(msg.Content)
+		if len(content) > openingTopicLength {
+			content = append(content[:openingTopicLength], '…')
+		}
+		topic = append(topic, string(content))
+	}
+	return topic[max(len(topic)-openingTopicMessages, 0):], nil
+}
+
+// calendarDaysBetween returns the number of calendar days from a to b, both in the same location
+func calendarDaysBetween(a, b time.Time) int {
+	startA := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, a.Location())
+	startB := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, b.Location())
+	return int(startB.Sub(startA).Hours() / 24)
+}
@@ -0,0 +1,102 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ErrUnknownPersona is returned for persona IDs that aren't in ai.Personas
+var ErrUnknownPersona = errors.New("unknown persona")
+
+// ErrSessionNotFound is returned when a session doesn't exist or belongs to another user
+var ErrSessionNotFound = errors.New("session not found")
+
+// PersonaService resolves which companion persona a session converses as:
+// the session's override, else the user's default, else Sang Pujangga
+type PersonaService struct {
+	queries *db.Queries
+}
+
+// NewPersonaService creates a new persona service
+func NewPersonaService(queries *db.Queries) *PersonaService {
+	return &PersonaService{queries: queries}
+}
+
+// Default returns the user's default persona
+func (s *PersonaService) Default(ctx context.Context, userID string) (*ai.Persona, error) {
+	preferences, err := s.queries.GetUserPreferences(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ai.DefaultPersona(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+
+	persona, ok := ai.PersonaByID(preferences.PersonaID)
+	if !ok {
+		// A persona that was retired since the user picked it
+		return ai.DefaultPersona(), nil
+	}
+	return persona, nil
+}
+
+// SetDefault saves the user's default persona
+func (s *PersonaService) SetDefault(ctx context.Context, userID, personaID string) (*ai.Persona, error) {
+	persona, ok := ai.PersonaByID(personaID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPersona, personaID)
+	}
+
+	if _, err := s.queries.UpsertUserPersona(ctx, db.UpsertUserPersonaParams{
+		UserID:    userID,
+		PersonaID: personaID,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to save preferences: %w", err)
+	}
+	return persona, nil
+}
+
+// SetSession overrides the persona of one session. An empty personaID clears
+// the override, so the session follows the user's default again.
+func (s *PersonaService) SetSession(ctx context.Context, userID string, sessionID pgtype.UUID, personaID string) (db.Session, error) {
+	if _, ok := ai.PersonaByID(personaID); personaID != "" && !ok {
+		return db.Session{}, fmt.Errorf("%w: %q", ErrUnknownPersona, personaID)
+	}
+
+	session, err := s.queries.SetSessionPersona(ctx, db.SetSessionPersonaParams{
+		ID:        sessionID,
+		UserID:    userID,
+		PersonaID: pgtype.Text{String: personaID, Valid: personaID != ""},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.Session{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return db.Session{}, fmt.Errorf("failed to save session persona: %w", err)
+	}
+	return session, nil
+}
+
+// Resolve returns the persona a session converses as. Lookup errors are
+// logged and fall back to the default persona.
+func (s *PersonaService) Resolve(ctx context.Context, userID string, session db.Session) *ai.Persona {
+	if persona, ok := ai.PersonaByID(session.PersonaID.String); ok {
+		return persona
+	}
+
+	persona, err := s.Default(ctx, userID)
+	if err != nil {
+		log.Printf("[PersonaService] failed to resolve persona for user %s: %v", userID, err)
+		return ai.DefaultPersona()
+	}
+	return persona
+}
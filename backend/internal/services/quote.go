@@ -0,0 +1,217 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// sessionQuoteEmotions is how many of a session's most frequent emotions
+// its concluding quote is matched on
+const sessionQuoteEmotions = 3
+
+var (
+	// ErrCollectionNotFound is returned for unknown quote collections
+	ErrCollectionNotFound = errors.New("quote collection not found")
+	// ErrCollectionLocked is returned when reading a collection the user hasn't unlocked
+	ErrCollectionLocked = errors.New("quote collection is locked")
+	// ErrCollectionUnlocked is returned when unlocking a collection the user already has
+	ErrCollectionUnlocked = errors.New("quote collection is already unlocked")
+)
+
+// QuoteService runs the Perpustakaan: it matches quotes to the emotions of
+// replies and completed sessions, and unlocks quote collections for Tinta
+// Emas or Marmer
+type QuoteService struct {
+	queries *db.Queries
+	pool    *db.Pool
+	ledger  *LedgerService
+}
+
+// NewQuoteService creates a new quote service
+func NewQuoteService(queries *db.Queries, pool *db.Pool, ledger *LedgerService) *QuoteService {
+	return &QuoteService{
+		queries: queries,
+		pool:    pool,
+		ledger:  ledger,
+	}
+}
+
+// Collections returns every quote collection with whether the user unlocked it
+func (s *QuoteService) Collections(ctx context.Context, userID string) ([]db.ListQuoteCollectionsRow, error) {
+	collections, err := s.queries.ListQuoteCollections(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quote collections: %w", err)
+	}
+	return collections, nil
+}
+
+// Collection returns an unlocked collection and its quotes
+func (s *QuoteService) Collection(ctx context.Context, userID string, id pgtype.UUID) (db.GetQuoteCollectionRow, []db.Quote, error) {
+	collection, err := s.collection(ctx, userID, id)
+	if err != nil {
+		return db.GetQuoteCollectionRow{}, nil, err
+	}
+	if !collection.Unlocked {
+		return collection, nil, ErrCollectionLocked
+	}
+
+	quotes, err := s.queries.ListQuotesByCollection(ctx, id)
+	if err != nil {
+		return collection, nil, fmt.Errorf("failed to list quotes: %w", err)
+	}
+	return collection, quotes, nil
+}
+
+// Get returns a quote, e.g. one attached to a message or session
+func (s *QuoteService) Get(ctx context.Context, id pgtype.UUID) (db.Quote, error) {
+	quote, err := s.queries.GetQuoteByID(ctx, id)
+	if err != nil {
+		return db.Quote{}, fmt.Errorf("failed to get quote: %w", err)
+	}
+	return quote, nil
+}
+
+// Unlock pays for a collection with its currency and unlocks it. The
+// user's stats row is locked while the unlock is claimed and paid for in
+// one transaction, so concurrent requests can't charge twice and a failed
+// payment leaves the collection locked.
+func (s *QuoteService) Unlock(ctx context.Context, userID string, id pgtype.UUID) (db.UserStat, error) {
+	collection, err := s.collection(ctx, userID, id)
+	if err != nil {
+		return db.UserStat{}, err
+	}
+	if collection.Unlocked {
+		return db.UserStat{}, ErrCollectionUnlocked
+	}
+
+	// Users who never earned anything have no stats row to lock yet
+	if _, err := s.queries.UpsertUserStats(ctx, userID); err != nil {
+		return db.UserStat{}, fmt.Errorf("failed to get user stats: %w", err)
+	}
+
+	var stats db.UserStat
+	err = s.pool.InTx(ctx, func(tx pgx.Tx) error {
+		q := s.queries.WithTx(tx)
+		if _, err := q.LockUserStats(ctx, userID); err != nil {
+			return fmt.Errorf("failed to lock user stats: %w", err)
+		}
+
+		claimed, err := q.UnlockQuoteCollection(ctx, db.UnlockQuoteCollectionParams{
+			UserID:       userID,
+			CollectionID: id,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to unlock quote collection: %w", err)
+		}
+		if claimed == 0 {
+			return ErrCollectionUnlocked
+		}
+
+		stats, err = s.ledger.WithTx(tx).Post(ctx, LedgerEntry{
+			UserID:         userID,
+			Currency:       collection.UnlockCurrency,
+			Delta:          -collection.UnlockCost,
+			Reason:         LedgerQuoteCollectionUnlock,
+			IdempotencyKey: LedgerQuoteCollectionUnlock + ":" + collection.Name,
+		})
+		return err
+	})
+	if err != nil {
+		return db.UserStat{}, err
+	}
+
+	log.Printf("[QuoteService] user %s unlocked collection %s for %d %s", userID, collection.Name, collection.UnlockCost, collection.UnlockCurrency)
+	return stats, nil
+}
+
+// ForReply matches a quote to a reply's detected emotions. Each session
+// gets at most one quote in its replies, so they stay special; nil means
+// no quote this time.
+func (s *QuoteService) ForReply(ctx context.Context, userID string, sessionID pgtype.UUID, emotions []string) (*db.Quote, error) {
+	emotions = ai.NormalizeEmotions(emotions)
+	if len(emotions) == 0 {
+		return nil, nil
+	}
+
+	quoted, err := s.queries.SessionHasQuotedMessage(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check session quotes: %w", err)
+	}
+	if quoted {
+		return nil, nil
+	}
+
+	return s.match(ctx, userID, emotions)
+}
+
+// ForSession matches a quote to a completed session's most frequent emotions
+// and stores it as the session's conclusion. Sessions without emotions are
+// returned unchanged.
+func (s *QuoteService) ForSession(ctx context.Context, userID string, session db.Session) (db.Session, error) {
+	counts, err := s.queries.CountSessionEmotions(ctx, session.ID)
+	if err != nil {
+		return session, fmt.Errorf("failed to count session emotions: %w", err)
+	}
+
+	emotions := make([]string, 0, sessionQuoteEmotions)
+	for _, count := range counts[:min(len(counts), sessionQuoteEmotions)] {
+		emotions = append(emotions, count.Emotion)
+	}
+	if len(emotions) == 0 {
+		return session, nil
+	}
+
+	quote, err := s.match(ctx, userID, emotions)
+	if err != nil || quote == nil {
+		return session, err
+	}
+
+	quoted, err := s.queries.SetSessionQuote(ctx, db.SetSessionQuoteParams{
+		ID:      session.ID,
+		QuoteID: quote.ID,
+	})
+	if err != nil {
+		return session, fmt.Errorf("failed to save session quote: %w", err)
+	}
+	return quoted, nil
+}
+
+// match returns a quote from the user's unlocked collections sharing the
+// emotions, nil if none does
+func (s *QuoteService) match(ctx context.Context, userID string, emotions []string) (*db.Quote, error) {
+	quote, err := s.queries.MatchQuote(ctx, db.MatchQuoteParams{
+		UserID:   userID,
+		Emotions: emotions,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to match quote: %w", err)
+	}
+	return &quote, nil
+}
+
+// collection returns a collection with whether the user unlocked it
+func (s *QuoteService) collection(ctx context.Context, userID string, id pgtype.UUID) (db.GetQuoteCollectionRow, error) {
+	collection, err := s.queries.GetQuoteCollection(ctx, db.GetQuoteCollectionParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.GetQuoteCollectionRow{}, ErrCollectionNotFound
+	}
+	if err != nil {
+		return db.GetQuoteCollectionRow{}, fmt.Errorf("failed to get quote collection: %w", err)
+	}
+	return collection, nil
+}
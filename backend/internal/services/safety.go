@@ -0,0 +1,90 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// SafetyService screens journal messages for suicide and self-harm risk.
+// Every message is screened locally before the AI call; when the model check
+// is enabled, the model gives a second opinion after the reply is generated.
+type SafetyService struct {
+	queries    *db.Queries
+	classifier *ai.SafetyClassifier
+	pujangga   *ai.PujanggaService
+	modelCheck bool
+}
+
+// NewSafetyService creates a new safety service. pujangga may be nil, which
+// disables the model check.
+func NewSafetyService(queries *db.Queries, classifier *ai.SafetyClassifier, pujangga *ai.PujanggaService, modelCheck bool) *SafetyService {
+	return &SafetyService{
+		queries:    queries,
+		classifier: classifier,
+		pujangga:   pujangga,
+		modelCheck: modelCheck && pujangga != nil,
+	}
+}
+
+// Screen classifies a user message with the local phrase lexicon
+func (s *SafetyService) Screen(content string) ai.RiskAssessment {
+	return s.classifier.Classify(content)
+}
+
+// Reviews reports whether Review asks the model, i.e. whether replies can
+// still be replaced after the local screen
+func (s *SafetyService) Reviews() bool {
+	return s.modelCheck
+}
+
+// Review asks the model to assess the conversation when the model check is
+// enabled. Failures are logged and reported as no risk, since the local
+// screen has already run.
+func (s *SafetyService) Review(ctx context.Context, recentMessages []ai.Message) ai.RiskAssessment {
+	if !s.modelCheck {
+		return ai.RiskAssessment{Level: ai.RiskNone}
+	}
+
+	assessment, err := s.pujangga.AssessRisk(ctx, recentMessages)
+	if err != nil {
+		log.Printf("[SafetyService] model risk check failed: %v", err)
+		return ai.RiskAssessment{Level: ai.RiskNone}
+	}
+	return assessment
+}
+
+// Flag records a risky message for review. Assessments without risk are ignored.
+func (s *SafetyService) Flag(ctx context.Context, messageID pgtype.UUID, assessment ai.RiskAssessment) error {
+	if assessment.Level == ai.RiskNone || assessment.Level == "" {
+		return nil
+	}
+
+	log.Printf("[SafetyService] flagged message %s as %s risk (source: %s, matches: %v)",
+		messageID, assessment.Level, assessment.Source, assessment.Matches)
+
+	_, err := s.queries.FlagMessage(ctx, db.FlagMessageParams{
+		ID:         messageID,
+		RiskLevel:  pgtype.Text{String: string(assessment.Level), Valid: true},
+		RiskSource: pgtype.Text{String: assessment.Source, Valid: assessment.Source != ""},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to flag message: %w", err)
+	}
+	return nil
+}
+
+// ListFlagged returns the most recently flagged messages
+func (s *SafetyService) ListFlagged(ctx context.Context, limit int32) ([]db.ListFlaggedMessagesRow, error) {
+	flagged, err := s.queries.ListFlaggedMessages(ctx, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list flagged messages: %w", err)
+	}
+	return flagged, nil
+}
@@ -0,0 +1,93 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// SessionContextMessages is how many recent messages stay verbatim in the
+	// reply prompt instead of being folded into the running summary
+	SessionContextMessages = 6
+	// SessionSummaryBatch is how many messages beyond the verbatim tail
+	// accumulate before they are folded into the running summary
+	SessionSummaryBatch = 6
+	// maxSummaryFold caps how many messages are folded in one refresh
+	maxSummaryFold = 40
+)
+
+// SessionSummaryService keeps a running summary of each session's older
+// messages, so replies late in a long session still see its beginning
+type SessionSummaryService struct {
+	queries  *db.Queries
+	pujangga *ai.PujanggaService
+}
+
+// NewSessionSummaryService creates a new session summary service
+func NewSessionSummaryService(queries *db.Queries, pujangga *ai.PujanggaService) *SessionSummaryService {
+	return &SessionSummaryService{
+		queries:  queries,
+		pujangga: pujangga,
+	}
+}
+
+// Refresh folds the session's messages older than the verbatim tail into
+// its running summary, once at least SessionSummaryBatch of them are waiting
+func (s *SessionSummaryService) Refresh(ctx context.Context, userID string, sessionID pgtype.UUID) error {
+	session, err := s.queries.GetSessionByID(ctx, db.GetSessionByIDParams{
+		ID:     sessionID,
+		UserID: userID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+
+	pending, err := s.queries.ListMessagesAfter(ctx, db.ListMessagesAfterParams{
+		SessionID: sessionID,
+		After:     session.RunningSummaryUntil,
+		RowLimit:  maxSummaryFold + SessionContextMessages,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get unsummarized messages: %w", err)
+	}
+
+	fold := pending[:max(len(pending)-SessionContextMessages, 0)]
+	if len(fold) < SessionSummaryBatch {
+		return nil
+	}
+	fold = fold[:min(len(fold), maxSummaryFold)]
+
+	messages := make([]ai.Message, len(fold))
+	for i, msg := range fold {
+		messages[i] = ai.Message{Role: msg.Role, Content: msg.Content}
+	}
+
+	summary, err := s.pujangga.SummarizeSession(ai.WithCaller(ctx, userID, sessionID.String()), session.RunningSummary, messages)
+	if err != nil {
+		return err
+	}
+
+	updated, err := s.queries.UpdateSessionRunningSummary(ctx, db.UpdateSessionRunningSummaryParams{
+		ID:                  sessionID,
+		RunningSummary:      summary,
+		RunningSummaryUntil: fold[len(fold)-1].CreatedAt,
+		PreviousUntil:       session.RunningSummaryUntil,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save session summary: %w", err)
+	}
+	if updated == 0 {
+		log.Printf("[SessionSummary] session %s was summarized concurrently, discarding this refresh", sessionID)
+		return nil
+	}
+
+	log.Printf("[SessionSummary] folded %d messages into the summary of session %s", len(fold), sessionID)
+	return nil
+}
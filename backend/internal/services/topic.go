@@ -0,0 +1,222 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// TopicSwitchAfter is how many consecutive user messages on one topic
+	// make the Pujangga suggest another topic
+	TopicSwitchAfter = 3
+	// topicHistoryMessages bounds the session history read for topic streaks
+	topicHistoryMessages = 12
+	// topicRecencyDays is the window in which the least discussed topic is suggested next
+	topicRecencyDays = 30
+)
+
+// TopicStat is how often the user wrote about a topic in a date range
+type TopicStat struct {
+	Topic string  `json:"topic"`
+	Name  string  `json:"name"` // Indonesian display name
+	Count int32   `json:"count"`
+	Share float64 `json:"share"` // Fraction of all topic labels in the range
+}
+
+// TopicBucket is the topic distribution of one day or week
+type TopicBucket struct {
+	Start  string           `json:"start"` // YYYY-MM-DD, WIB
+	End    string           `json:"end"`   // YYYY-MM-DD, inclusive
+	Total  int32            `json:"total"`
+	Topics map[string]int32 `json:"topics"`
+}
+
+// TopicService labels user messages with topics, decides when the
+// conversation should move to another topic and reports topic stats
+type TopicService struct {
+	queries    *db.Queries
+	classifier *ai.TopicClassifier
+	location   *time.Location // WIB timezone
+}
+
+// NewTopicService creates a new topic service
+func NewTopicService(queries *db.Queries, classifier *ai.TopicClassifier) *TopicService {
+	// Load WIB timezone (UTC+7)
+	loc, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		// Fallback to fixed offset if timezone data not available
+		loc = time.FixedZone("WIB", 7*60*60)
+	}
+
+	return &TopicService{
+		queries:    queries,
+		classifier: classifier,
+		location:   loc,
+	}
+}
+
+// Track labels a saved user message with its topics and returns the topic
+// guidance for the reply. A switch is suggested every TopicSwitchAfter
+// consecutive messages on the same topic, toward the topic the user has
+// written about least lately. On error the guidance is still usable.
+func (s *TopicService) Track(ctx context.Context, userID string, sessionID, messageID pgtype.UUID, content string) (ai.TopicGuidance, error) {
+	topics := s.classifier.Classify(content)
+	if len(topics) == 0 {
+		return ai.TopicGuidance{}, nil
+	}
+
+	if err := s.queries.CreateMessageTopics(ctx, db.CreateMessageTopicsParams{
+		MessageID: messageID,
+		UserID:    userID,
+		Topics:    topics,
+	}); err != nil {
+		return ai.TopicGuidance{}, fmt.Errorf("failed to save message topics: %w", err)
+	}
+
+	guidance := ai.TopicGuidance{Current: topics[0], Streak: 1}
+
+	history, err := s.queries.ListSessionTopicHistory(ctx, db.ListSessionTopicHistoryParams{
+		SessionID: sessionID,
+		Limit:     topicHistoryMessages,
+	})
+	if err != nil {
+		return guidance, fmt.Errorf("failed to get topic history: %w", err)
+	}
+
+	// History starts with the message just labeled
+	guidance.Streak = 0
+	for _, msg := range history {
+		if !slices.Contains(msg.Topics, guidance.Current) {
+			break
+		}
+		guidance.Streak++
+	}
+
+	if guidance.Streak < TopicSwitchAfter || guidance.Streak%TopicSwitchAfter != 0 {
+		return guidance, nil
+	}
+
+	recent := map[string]bool{}
+	for _, msg := range history[:min(len(history), TopicSwitchAfter)] {
+		for _, topic := range msg.Topics {
+			recent[topic] = true
+		}
+	}
+
+	next, err := s.nextTopic(ctx, userID, recent)
+	if err != nil {
+		return guidance, err
+	}
+	guidance.SwitchTo = next
+	return guidance, nil
+}
+
+// nextTopic returns the topic the user wrote about least lately, leaving out
+// the topics of the current conversation. Ties rotate daily through
+// ai.TopicLabels, so users without history don't always get the same one.
+func (s *TopicService) nextTopic(ctx context.Context, userID string, exclude map[string]bool) (string, error) {
+	now := time.Now().In(s.location)
+	rows, err := s.queries.CountUserTopics(ctx, db.CountUserTopicsParams{
+		UserID:   userID,
+		FromTime: pgtype.Timestamptz{Time: now.AddDate(0, 0, -topicRecencyDays), Valid: true},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to count topics: %w", err)
+	}
+
+	counts := map[string]int32{}
+	for _, row := range rows {
+		counts[row.Topic] = row.Count
+	}
+
+	next := ""
+	offset := now.YearDay()
+	for i := range ai.TopicLabels {
+		topic := ai.TopicLabels[(offset+i)%len(ai.TopicLabels)]
+		if exclude[topic] {
+			continue
+		}
+		if next == "" || counts[topic] < counts[next] {
+			next = topic
+		}
+	}
+	return next, nil
+}
+
+// ParseRange parses YYYY-MM-DD dates in WIB. An empty to means today and an
+// empty from means defaultDays days up to and including to.
+func (s *TopicService) ParseRange(fromParam, toParam string, defaultDays int) (time.Time, time.Time, error) {
+	return parseDateRange(s.location, fromParam, toParam, defaultDays)
+}
+
+// Stats returns topic counts per day or per week between from and to,
+// inclusive, and the totals of the whole range, most discussed first.
+// Periods without topics are omitted.
+func (s *TopicService) Stats(ctx context.Context, userID, period string, from, to time.Time) ([]TopicBucket, []TopicStat, error) {
+	if period != EmotionPeriodDaily && period != EmotionPeriodWeekly {
+		return nil, nil, fmt.Errorf("unknown topic period %q", period)
+	}
+
+	rows, err := s.queries.CountUserTopicsByDay(ctx, db.CountUserTopicsByDayParams{
+		UserID:   userID,
+		FromTime: pgtype.Timestamptz{Time: from, Valid: true},
+		ToTime:   pgtype.Timestamptz{Time: to.AddDate(0, 0, 1), Valid: true},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count topics: %w", err)
+	}
+
+	buckets := []TopicBucket{}
+	index := map[string]int{}
+	totals := map[string]int32{}
+	var total int32
+	for _, row := range rows {
+		start := time.Date(row.Day.Time.Year(), row.Day.Time.Month(), row.Day.Time.Day(), 0, 0, 0, 0, s.location)
+		end := start
+		if period == EmotionPeriodWeekly {
+			start = start.AddDate(0, 0, -int(start.Weekday()))
+			end = start.AddDate(0, 0, 6)
+		}
+
+		key := start.Format("2006-01-02")
+		i, ok := index[key]
+		if !ok {
+			i = len(buckets)
+			index[key] = i
+			buckets = append(buckets, TopicBucket{
+				Start:  key,
+				End:    end.Format("2006-01-02"),
+				Topics: map[string]int32{},
+			})
+		}
+
+		buckets[i].Topics[row.Topic] += row.Count
+		buckets[i].Total += row.Count
+		totals[row.Topic] += row.Count
+		total += row.Count
+	}
+
+	stats := []TopicStat{}
+	for _, topic := range ai.TopicLabels {
+		if totals[topic] == 0 {
+			continue
+		}
+		stats = append(stats, TopicStat{
+			Topic: topic,
+			Name:  ai.TopicName(topic),
+			Count: totals[topic],
+			Share: float64(totals[topic]) / float64(total),
+		})
+	}
+	slices.SortStableFunc(stats, func(a, b TopicStat) int { return int(b.Count - a.Count) })
+
+	return buckets, stats, nil
+}
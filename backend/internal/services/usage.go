@@ -0,0 +1,110 @@
+// Package services provides business logic services
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"catetin/backend/internal/ai"
+	"catetin/backend/internal/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// usageWriteTimeout bounds how long recording a single usage row may take
+const usageWriteTimeout = 5 * time.Second
+
+// UsageService persists and aggregates AI token usage
+type UsageService struct {
+	queries *db.Queries
+}
+
+// NewUsageService creates a new usage service
+func NewUsageService(queries *db.Queries) *UsageService {
+	return &UsageService{
+		queries: queries,
+	}
+}
+
+// UsageReport aggregates AI usage over a date range
+type UsageReport struct {
+	From   string                         `json:"from"`
+	To     string                         `json:"to"`
+	ByDay  []db.AggregateAIUsageByDayRow  `json:"by_day"`
+	ByPlan []db.AggregateAIUsageByPlanRow `json:"by_plan"`
+}
+
+// RecordUsage stores a usage row for an AI call. It implements ai.UsageRecorder.
+// Calls made without a user are recorded with a NULL user, since they are still paid for.
+// Failures are logged rather than returned so accounting never breaks a reply.
+func (s *UsageService) RecordUsage(ctx context.Context, usage ai.Usage) {
+	var sessionID pgtype.UUID
+	if usage.SessionID != "" {
+		if err := sessionID.Scan(usage.SessionID); err != nil {
+			log.Printf("[UsageService] invalid session ID %q: %v", usage.SessionID, err)
+		}
+	}
+
+	// The request may already be cancelled (e.g. client disconnected mid-stream),
+	// but the tokens were still spent
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), usageWriteTimeout)
+	defer cancel()
+
+	_, err := s.queries.CreateAIUsage(ctx, db.CreateAIUsageParams{
+		UserID:              pgtype.Text{String: usage.UserID, Valid: usage.UserID != ""},
+		SessionID:           sessionID,
+		Feature:             usage.Feature,
+		Model:               usage.Model,
+		PromptTokens:        int32(usage.PromptTokens),
+		CompletionTokens:    int32(usage.CompletionTokens),
+		LatencyMs:           int32(usage.Latency.Milliseconds()),
+		EstimatedCostMicros: usage.CostMicros,
+	})
+	if err != nil {
+		log.Printf("[UsageService] failed to record usage for user %s: %v", usage.UserID, err)
+	}
+}
+
+// Report aggregates usage for the days from..to inclusive
+func (s *UsageService) Report(ctx context.Context, from, to time.Time) (*UsageReport, error) {
+	start := pgtype.Timestamptz{Time: from, Valid: true}
+	end := pgtype.Timestamptz{Time: to.AddDate(0, 0, 1), Valid: true}
+
+	byDay, err := s.queries.AggregateAIUsageByDay(ctx, db.AggregateAIUsageByDayParams{
+		CreatedAt:   start,
+		CreatedAt_2: end,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate usage by day: %w", err)
+	}
+
+	byPlan, err := s.queries.AggregateAIUsageByPlan(ctx, db.AggregateAIUsageByPlanParams{
+		CreatedAt:   start,
+		CreatedAt_2: end,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate usage by plan: %w", err)
+	}
+
+	return &UsageReport{
+		From:   from.Format("2006-01-02"),
+		To:     to.Format("2006-01-02"),
+		ByDay:  byDay,
+		ByPlan: byPlan,
+	}, nil
+}
+
+// PromptVersions compares prompt versions by the assistant messages they
+// produced for the days from..to inclusive
+func (s *UsageService) PromptVersions(ctx context.Context, from, to time.Time) ([]db.AggregatePromptVersionsRow, error) {
+	rows, err := s.queries.AggregatePromptVersions(ctx, db.AggregatePromptVersionsParams{
+		CreatedAt:   pgtype.Timestamptz{Time: from, Valid: true},
+		CreatedAt_2: pgtype.Timestamptz{Time: to.AddDate(0, 0, 1), Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate prompt versions: %w", err)
+	}
+	return rows, nil
+}
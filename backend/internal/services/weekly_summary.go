@@ -147,7 +147,7 @@ func (s *WeeklySummaryService) GenerateOrGetSummary(ctx context.Context, userID
 	}
 
 	// Generate summary via AI
-	result, err := s.pujangga.GenerateWeeklySummary(ctx, aiMessages, int(counts.SessionCount), int(counts.MessageCount))
+	result, err := s.pujangga.GenerateWeeklySummary(ai.WithCaller(ctx, userID, ""), aiMessages, int(counts.SessionCount), int(counts.MessageCount))
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate summary: %w", err)
 	}
@@ -171,13 +171,14 @@ func (s *WeeklySummaryService) GenerateOrGetSummary(ctx context.Context, userID
 	}
 
 	summary, err := s.queries.CreateWeeklySummary(ctx, db.CreateWeeklySummaryParams{
-		UserID:       userID,
-		WeekStart:    weekStartDate,
-		WeekEnd:      weekEndDate,
-		Summary:      result.Summary,
-		SessionCount: counts.SessionCount,
-		MessageCount: counts.MessageCount,
-		Emotions:     emotionsJSON,
+		UserID:        userID,
+		WeekStart:     weekStartDate,
+		WeekEnd:       weekEndDate,
+		Summary:       result.Summary,
+		SessionCount:  counts.SessionCount,
+		MessageCount:  counts.MessageCount,
+		Emotions:      emotionsJSON,
+		PromptVersion: pgtype.Text{String: result.PromptVersion, Valid: result.PromptVersion != ""},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to save summary: %w", err)
@@ -0,0 +1,19 @@
+// Package types provides shared request/response types for handlers
+package types
+
+import "time"
+
+// ArtworkRequest is the request body for creating or updating a catalog
+// entry. Updates replace every field but name.
+type ArtworkRequest struct {
+	Name           string     `json:"name"`
+	DisplayName    string     `json:"display_name"`
+	Description    string     `json:"description"`
+	ImageURL       string     `json:"image_url"`
+	UnlockCost     int32      `json:"unlock_cost"`     // Marmer
+	RevealCost     int32      `json:"reveal_cost"`     // Tinta Emas per percentage point
+	SortOrder      int32      `json:"sort_order"`      // Ascending
+	AvailableFrom  *time.Time `json:"available_from"`  // RFC 3339; null for no bound
+	AvailableUntil *time.Time `json:"available_until"` // RFC 3339; null for no bound
+	Retired        bool       `json:"retired"`
+}
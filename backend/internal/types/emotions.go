@@ -0,0 +1,19 @@
+// Package types provides shared request/response types for handlers
+package types
+
+import "catetin/backend/internal/services"
+
+// EmotionDistributionResponse is the response for GetEmotionDistribution
+type EmotionDistributionResponse struct {
+	Period  string                   `json:"period"` // "daily" or "weekly"
+	From    string                   `json:"from"`
+	To      string                   `json:"to"`
+	Buckets []services.EmotionBucket `json:"buckets"`
+}
+
+// MoodTimelineResponse is the response for GetMoodTimeline
+type MoodTimelineResponse struct {
+	From   string               `json:"from"`
+	To     string               `json:"to"`
+	Points []services.MoodPoint `json:"points"`
+}
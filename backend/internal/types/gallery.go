@@ -0,0 +1,31 @@
+// Package types provides shared request/response types for handlers
+package types
+
+import "catetin/backend/internal/db"
+
+// GalleryResponse is the response for GetGallery
+type GalleryResponse struct {
+	Artworks []db.ListGalleryRow `json:"artworks"`
+}
+
+// UnlockArtworkResponse is the response for UnlockArtwork
+type UnlockArtworkResponse struct {
+	Artwork   db.UserArtwork `json:"artwork"`
+	GoldenInk int32          `json:"golden_ink"` // Balance after paying
+	Marble    int32          `json:"marble"`     // Balance after paying
+}
+
+// RevealArtworkRequest is the request body for RevealArtwork
+type RevealArtworkRequest struct {
+	TintaEmas int32 `json:"tinta_emas"` // Most Tinta Emas to spend; rounded down to whole percents
+}
+
+// RevealArtworkResponse is the response for RevealArtwork
+type RevealArtworkResponse struct {
+	Artwork   db.UserArtwork `json:"artwork"`
+	Spent     int32          `json:"spent"`
+	Revealed  int32          `json:"revealed"` // Percentage points revealed
+	Completed bool           `json:"completed"`
+	GoldenInk int32          `json:"golden_ink"` // Balance after paying
+	Marble    int32          `json:"marble"`     // Balance after paying
+}
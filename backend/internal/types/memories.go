@@ -0,0 +1,18 @@
+// Package types provides shared request/response types for handlers
+package types
+
+import "catetin/backend/internal/db"
+
+// UpdateMemoryRequest is the request body for editing a memory.
+// Omitted fields keep their current value.
+type UpdateMemoryRequest struct {
+	Kind       *string `json:"kind"`       // "person", "situation", "goal" or "worry"
+	Content    *string `json:"content"`    // The fact, one short sentence
+	Importance *int16  `json:"importance"` // 1 (minor detail) to 5 (very important)
+}
+
+// ListMemoriesResponse is the response for ListMemories
+type ListMemoriesResponse struct {
+	Memories []db.UserMemory `json:"memories"`
+	Total    int             `json:"total"`
+}
@@ -0,0 +1,21 @@
+// Package types provides shared request/response types for handlers
+package types
+
+import "catetin/backend/internal/ai"
+
+// PersonaRequest is the request body for picking a persona, as the user's
+// default or for one session
+type PersonaRequest struct {
+	PersonaID string `json:"persona_id"` // Empty clears a session's override
+}
+
+// PersonasResponse is the response for ListPersonas
+type PersonasResponse struct {
+	Personas  []*ai.Persona `json:"personas"`
+	DefaultID string        `json:"default_id"` // The user's default persona
+}
+
+// PreferencesResponse is the response for the preferences endpoints
+type PreferencesResponse struct {
+	PersonaID string `json:"persona_id"`
+}
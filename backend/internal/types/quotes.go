@@ -0,0 +1,22 @@
+// Package types provides shared request/response types for handlers
+package types
+
+import "catetin/backend/internal/db"
+
+// QuoteCollectionsResponse is the response for ListQuoteCollections
+type QuoteCollectionsResponse struct {
+	Collections []db.ListQuoteCollectionsRow `json:"collections"`
+}
+
+// QuoteCollectionResponse is the response for GetQuoteCollection
+type QuoteCollectionResponse struct {
+	Collection db.GetQuoteCollectionRow `json:"collection"`
+	Quotes     []db.Quote               `json:"quotes"`
+}
+
+// UnlockQuoteCollectionResponse is the response for UnlockQuoteCollection
+type UnlockQuoteCollectionResponse struct {
+	CollectionID string `json:"collection_id"`
+	GoldenInk    int32  `json:"golden_ink"` // Balance after paying
+	Marble       int32  `json:"marble"`     // Balance after paying
+}
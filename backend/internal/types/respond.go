@@ -1,20 +1,42 @@
 // Package types provides shared request/response types for handlers
 package types
 
-import "catetin/backend/internal/db"
+import (
+	"catetin/backend/internal/db"
+	"catetin/backend/internal/services"
+)
 
 // RespondRequest is the request body for AI response
 type RespondRequest struct {
-	Content string `json:"content"` // User's message content
+	Content   string `json:"content"`              // User's message content
+	MessageID string `json:"message_id,omitempty"` // Retries the reply to this saved message instead of sending content
 }
 
 // RespondResponse is the response from AI
 type RespondResponse struct {
-	Message      db.Message `json:"message"`       // The AI's response message
-	UserMessage  db.Message `json:"user_message"`  // The saved user message
-	MessageCount int        `json:"message_count"` // Total user messages in session
-	DepthLevel   int        `json:"depth_level"`   // Conversation depth (1=surface, 2=light, 3=deep)
-	Rewards      *Rewards   `json:"rewards"`       // Rewards earned for this message
+	Message      db.Message                 `json:"message"`            // The AI's response message
+	UserMessage  db.Message                 `json:"user_message"`       // The saved user message
+	MessageCount int                        `json:"message_count"`      // Total user messages in session
+	DepthLevel   int                        `json:"depth_level"`        // Conversation depth (1=surface, 2=light, 3=deep)
+	Depth        *services.DepthUpdate      `json:"depth,omitempty"`    // Score breakdown of the message and progress toward the next level
+	Template     *services.TemplateProgress `json:"template,omitempty"` // Step progress, in guided sessions
+	Quote        *db.Quote                  `json:"quote,omitempty"`    // Quote matched to the message's emotions, at most one per session
+	Rewards      *Rewards                   `json:"rewards"`            // Rewards earned for this message
+	Safety       *SafetyNotice              `json:"safety,omitempty"`   // Set when the message was answered with the crisis response
+}
+
+// SafetyNotice tells the client a message was screened as high risk, so it
+// can show the support resources prominently
+type SafetyNotice struct {
+	RiskLevel string    `json:"risk_level"`
+	Hotlines  []Hotline `json:"hotlines"`
+}
+
+// Hotline is a crisis support contact
+type Hotline struct {
+	Name        string `json:"name"`
+	Number      string `json:"number"`
+	Description string `json:"description"`
 }
 
 // Rewards represents gamification rewards earned
@@ -0,0 +1,24 @@
+// Package types provides shared request/response types for handlers
+package types
+
+import "catetin/backend/internal/ai"
+
+// StartSessionRequest is the optional request body for StartSession
+type StartSessionRequest struct {
+	TemplateID string `json:"template_id"` // Guided journaling template, empty for a free-form session
+	PersonaID  string `json:"persona_id"`  // Persona for this session, empty for the user's default
+}
+
+// JournalTemplate is a guided journaling mode the user can start a session with
+type JournalTemplate struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Steps       []ai.TemplateStep `json:"steps"`
+	HasOutput   bool              `json:"has_output"` // Whether a structured output is stored on completion
+}
+
+// TemplatesResponse is the response for ListTemplates
+type TemplatesResponse struct {
+	Templates []JournalTemplate `json:"templates"`
+}
@@ -0,0 +1,13 @@
+// Package types provides shared request/response types for handlers
+package types
+
+import "catetin/backend/internal/services"
+
+// TopicStatsResponse is the response for GetTopicStats
+type TopicStatsResponse struct {
+	Period  string                 `json:"period"` // "daily" or "weekly"
+	From    string                 `json:"from"`
+	To      string                 `json:"to"`
+	Totals  []services.TopicStat   `json:"totals"` // Most discussed first
+	Buckets []services.TopicBucket `json:"buckets"`
+}
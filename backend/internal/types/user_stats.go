@@ -1,6 +1,8 @@
 // Package types provides shared request/response types for handlers
 package types
 
+import "catetin/backend/internal/db"
+
 // UserStatsResponse is the response for GetUserStats with level progress info
 type UserStatsResponse struct {
 	UserID        string `json:"user_id"`
@@ -14,3 +16,10 @@ type UserStatsResponse struct {
 	XPToNextLevel int32  `json:"xp_to_next_level"`
 	LevelProgress int32  `json:"level_progress"` // 0-100 percentage
 }
+
+// RewardHistoryResponse is the response for GetRewardHistory
+type RewardHistoryResponse struct {
+	Entries []db.ListLedgerEntriesRow `json:"entries"`
+	Limit   int32                     `json:"limit"`
+	Offset  int32                     `json:"offset"`
+}
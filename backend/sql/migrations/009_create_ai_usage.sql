@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- One row per AI provider call, used for cost tracking and token budgets
+CREATE TABLE IF NOT EXISTS ai_usage (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id TEXT NOT NULL,
+    session_id UUID REFERENCES sessions(id) ON DELETE SET NULL,
+    feature TEXT NOT NULL,
+    model TEXT NOT NULL,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    estimated_cost_micros BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_ai_usage_user_id_created_at ON ai_usage(user_id, created_at DESC);
+CREATE INDEX idx_ai_usage_created_at ON ai_usage(created_at);
+CREATE INDEX idx_ai_usage_session_id ON ai_usage(session_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS ai_usage;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Prompt templates that produced AI-generated content, e.g. "respond.v2+system.v1"
+ALTER TABLE messages
+ADD COLUMN prompt_version TEXT;
+
+ALTER TABLE weekly_summaries
+ADD COLUMN prompt_version TEXT;
+
+CREATE INDEX idx_messages_prompt_version ON messages(prompt_version) WHERE prompt_version IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_messages_prompt_version;
+
+ALTER TABLE weekly_summaries
+DROP COLUMN prompt_version;
+
+ALTER TABLE messages
+DROP COLUMN prompt_version;
+-- +goose StatementEnd
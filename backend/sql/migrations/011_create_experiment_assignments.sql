@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Sticky experiment variant per user; experiments themselves are defined in config
+CREATE TABLE IF NOT EXISTS experiment_assignments (
+    user_id TEXT NOT NULL,
+    experiment TEXT NOT NULL,
+    variant TEXT NOT NULL,
+    assigned_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, experiment)
+);
+
+CREATE INDEX idx_experiment_assignments_experiment ON experiment_assignments(experiment, variant);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS experiment_assignments;
+-- +goose StatementEnd
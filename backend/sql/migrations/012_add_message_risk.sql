@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Safety screening result for messages flagged as a suicide or self-harm risk
+ALTER TABLE messages
+ADD COLUMN risk_level TEXT,
+ADD COLUMN risk_source TEXT,
+ADD COLUMN flagged_at TIMESTAMPTZ,
+ADD CONSTRAINT messages_risk_level_check CHECK (risk_level IN ('elevated', 'high'));
+
+CREATE INDEX idx_messages_flagged_at ON messages(flagged_at DESC) WHERE flagged_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_messages_flagged_at;
+
+ALTER TABLE messages
+DROP CONSTRAINT IF EXISTS messages_risk_level_check,
+DROP COLUMN flagged_at,
+DROP COLUMN risk_source,
+DROP COLUMN risk_level;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Emotions detected in user messages, from the fixed vocabulary of the Pujangga prompt
+CREATE TABLE IF NOT EXISTS message_emotions (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    emotion TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, emotion),
+    CONSTRAINT message_emotions_emotion_check CHECK (emotion IN (
+        'senang', 'sedih', 'cemas', 'marah', 'kelelahan', 'harapan', 'cinta', 'ambisi', 'kesepian', 'syukur'
+    ))
+);
+
+CREATE INDEX idx_message_emotions_user_id_created_at ON message_emotions(user_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS message_emotions;
+-- +goose StatementEnd
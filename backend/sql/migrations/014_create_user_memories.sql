@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Durable facts Sang Pujangga remembers about a user across sessions
+CREATE TABLE IF NOT EXISTS user_memories (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    content TEXT NOT NULL,
+    importance SMALLINT NOT NULL DEFAULT 3,
+    mentions INTEGER NOT NULL DEFAULT 1,
+    source_session_id UUID REFERENCES sessions(id) ON DELETE SET NULL,
+    user_edited BOOLEAN NOT NULL DEFAULT false,
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT user_memories_kind_check CHECK (kind IN ('person', 'situation', 'goal', 'worry')),
+    CONSTRAINT user_memories_importance_check CHECK (importance BETWEEN 1 AND 5)
+);
+
+CREATE INDEX idx_user_memories_user_id ON user_memories(user_id);
+
+-- Sessions whose memories have been extracted (or claimed for extraction)
+ALTER TABLE sessions
+ADD COLUMN memories_extracted_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions
+DROP COLUMN memories_extracted_at;
+
+DROP TABLE IF EXISTS user_memories;
+-- +goose StatementEnd
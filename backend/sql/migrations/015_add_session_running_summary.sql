@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Running summary of a session's older messages, folded in incrementally so
+-- long sessions keep their early context without the prompt growing unbounded
+ALTER TABLE sessions
+ADD COLUMN running_summary TEXT NOT NULL DEFAULT '',
+ADD COLUMN running_summary_until TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions
+DROP COLUMN running_summary_until,
+DROP COLUMN running_summary;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Closing ritual generated when a session is completed
+ALTER TABLE sessions
+ADD COLUMN title TEXT,
+ADD COLUMN summary TEXT,
+ADD COLUMN closing_message TEXT,
+ADD COLUMN closing_prompt_version TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions
+DROP COLUMN closing_prompt_version,
+DROP COLUMN closing_message,
+DROP COLUMN summary,
+DROP COLUMN title;
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Conversation depth reached by the depth engine, and the score accumulated
+-- toward the next level
+ALTER TABLE sessions
+ADD COLUMN depth_level SMALLINT NOT NULL DEFAULT 1,
+ADD COLUMN depth_progress REAL NOT NULL DEFAULT 0,
+ADD CONSTRAINT sessions_depth_level_check CHECK (depth_level BETWEEN 1 AND 3);
+
+-- Carry active sessions over at the depth the message-count rules gave them
+UPDATE sessions s
+SET depth_level = CASE
+    WHEN c.user_messages >= 6 THEN 3
+    WHEN c.user_messages >= 3 THEN 2
+    ELSE 1
+END
+FROM (
+    SELECT session_id, COUNT(*) AS user_messages
+    FROM messages
+    WHERE role = 'user'
+    GROUP BY session_id
+) c
+WHERE c.session_id = s.id AND s.status = 'active';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions
+DROP CONSTRAINT sessions_depth_level_check,
+DROP COLUMN depth_progress,
+DROP COLUMN depth_level;
+-- +goose StatementEnd
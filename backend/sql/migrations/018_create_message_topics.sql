@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Topics of user messages, from the taxonomy of the topic classifier
+CREATE TABLE IF NOT EXISTS message_topics (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    topic TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, topic),
+    CONSTRAINT message_topics_topic_check CHECK (topic IN (
+        'work', 'study', 'relationships', 'family', 'friends',
+        'health', 'self_care', 'money', 'dreams', 'hobbies'
+    ))
+);
+
+CREATE INDEX idx_message_topics_user_id_created_at ON message_topics(user_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS message_topics;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Guided journaling template of the session, the step reached, the progress
+-- within that step, and the structured output extracted on completion
+ALTER TABLE sessions
+ADD COLUMN template_id TEXT,
+ADD COLUMN template_step SMALLINT NOT NULL DEFAULT 0,
+ADD COLUMN template_step_messages SMALLINT NOT NULL DEFAULT 0,
+ADD COLUMN template_step_words INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN template_completed_at TIMESTAMPTZ,
+ADD COLUMN template_output JSONB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions
+DROP COLUMN template_output,
+DROP COLUMN template_completed_at,
+DROP COLUMN template_step_words,
+DROP COLUMN template_step_messages,
+DROP COLUMN template_step,
+DROP COLUMN template_id;
+-- +goose StatementEnd
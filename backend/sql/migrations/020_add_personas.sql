@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Per-user preferences, starting with the default companion persona
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id TEXT PRIMARY KEY,
+    persona_id TEXT NOT NULL DEFAULT 'pujangga',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Persona chosen for one session, overriding the user's default
+ALTER TABLE sessions
+ADD COLUMN persona_id TEXT;
+
+-- Persona that produced each assistant message, for analytics
+ALTER TABLE messages
+ADD COLUMN persona_id TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE messages
+DROP COLUMN persona_id;
+
+ALTER TABLE sessions
+DROP COLUMN persona_id;
+
+DROP TABLE IF EXISTS user_preferences;
+-- +goose StatementEnd
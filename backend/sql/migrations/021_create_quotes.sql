@@ -0,0 +1,96 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Perpustakaan: quote collections, free or unlocked with Tinta Emas or Marmer
+CREATE TABLE IF NOT EXISTS quote_collections (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL UNIQUE,
+    display_name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    unlock_currency TEXT NOT NULL DEFAULT 'golden_ink',
+    unlock_cost INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT quote_collections_unlock_currency_check CHECK (unlock_currency IN ('golden_ink', 'marble')),
+    CONSTRAINT quote_collections_unlock_cost_check CHECK (unlock_cost >= 0)
+);
+
+-- Quotes in Indonesian (or the regional language they were written in),
+-- tagged with the emotions of the Pujangga vocabulary they speak to
+CREATE TABLE IF NOT EXISTS quotes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    collection_id UUID NOT NULL REFERENCES quote_collections(id) ON DELETE CASCADE,
+    text TEXT NOT NULL,
+    author TEXT NOT NULL,
+    source TEXT NOT NULL DEFAULT '',
+    language TEXT NOT NULL DEFAULT 'id',
+    emotions TEXT[] NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT quotes_text_unique UNIQUE (collection_id, text),
+    CONSTRAINT quotes_emotions_check CHECK (
+        cardinality(emotions) > 0 AND emotions <@ ARRAY[
+            'senang', 'sedih', 'cemas', 'marah', 'kelelahan', 'harapan', 'cinta', 'ambisi', 'kesepian', 'syukur'
+        ]::TEXT[]
+    )
+);
+
+CREATE INDEX idx_quotes_collection_id ON quotes(collection_id);
+CREATE INDEX idx_quotes_emotions ON quotes USING GIN (emotions);
+
+-- Collections a user has paid to unlock
+CREATE TABLE IF NOT EXISTS user_quote_collections (
+    user_id TEXT NOT NULL,
+    collection_id UUID NOT NULL REFERENCES quote_collections(id) ON DELETE CASCADE,
+    unlocked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, collection_id)
+);
+
+-- Quote attached to a reply, and to a completed session's conclusion
+ALTER TABLE messages
+ADD COLUMN quote_id UUID REFERENCES quotes(id) ON DELETE SET NULL;
+
+ALTER TABLE sessions
+ADD COLUMN quote_id UUID REFERENCES quotes(id) ON DELETE SET NULL;
+
+INSERT INTO quote_collections (name, display_name, description, unlock_currency, unlock_cost) VALUES
+    ('filsuf_klasik', 'Filsuf Klasik', 'Renungan para filsuf Yunani dan Romawi, diterjemahkan ke bahasa Indonesia.', 'golden_ink', 0),
+    ('sastrawan_nusantara', 'Sastrawan Nusantara', 'Larik dan kalimat dari para sastrawan Indonesia.', 'golden_ink', 150),
+    ('tokoh_bangsa', 'Tokoh Bangsa', 'Pemikiran para tokoh yang ikut membentuk Indonesia.', 'marble', 10)
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO quotes (collection_id, text, author, source, language, emotions)
+SELECT c.id, q.text, q.author, q.source, q.language, q.emotions
+FROM (VALUES
+    ('filsuf_klasik', 'Hidup yang tidak direnungkan tidak layak dijalani.', 'Sokrates', 'Plato, Apologia 38a', 'id', ARRAY['ambisi', 'harapan']),
+    ('filsuf_klasik', 'Manusia tidak diganggu oleh peristiwa, melainkan oleh pandangannya tentang peristiwa itu.', 'Epiktetos', 'Enchiridion 5', 'id', ARRAY['cemas', 'marah']),
+    ('filsuf_klasik', 'Ada hal yang berada dalam kendali kita, dan ada yang tidak.', 'Epiktetos', 'Enchiridion 1', 'id', ARRAY['cemas', 'kelelahan']),
+    ('filsuf_klasik', 'Kita lebih sering menderita dalam bayangan daripada dalam kenyataan.', 'Seneca', 'Surat kepada Lucilius 13', 'id', ARRAY['cemas', 'sedih']),
+    ('filsuf_klasik', 'Segala sesuatu bukan milik kita; hanya waktu yang sungguh milik kita.', 'Seneca', 'Surat kepada Lucilius 1', 'id', ARRAY['ambisi', 'kelelahan']),
+    ('filsuf_klasik', 'Semesta adalah perubahan; hidup kita adalah apa yang dibentuk oleh pikiran kita.', 'Marcus Aurelius', 'Meditasi 4.3', 'id', ARRAY['harapan', 'sedih']),
+    ('filsuf_klasik', 'Tak seorang pun melangkah ke sungai yang sama dua kali.', 'Herakleitos', 'Fragmen, dikutip Plato dalam Kratylos', 'id', ARRAY['harapan', 'kesepian']),
+    ('filsuf_klasik', 'Jangan merusak apa yang kamu miliki dengan menginginkan apa yang tidak kamu miliki; ingatlah bahwa yang kamu miliki sekarang dulu hanya kamu harapkan.', 'Epikuros', 'Vatican Sayings 35', 'id', ARRAY['syukur', 'senang']),
+    ('filsuf_klasik', 'Jangan terlalu memikirkan apa yang tidak kamu punya, pikirkanlah apa yang kamu punya.', 'Marcus Aurelius', 'Meditasi 7.27', 'id', ARRAY['syukur', 'senang']),
+    ('filsuf_klasik', 'Jika kamu ingin dicintai, cintailah.', 'Hekaton, dikutip Seneca', 'Surat kepada Lucilius 9', 'id', ARRAY['cinta', 'kesepian']),
+    ('sastrawan_nusantara', 'Aku mau hidup seribu tahun lagi.', 'Chairil Anwar', 'Aku (1943)', 'id', ARRAY['ambisi', 'harapan']),
+    ('sastrawan_nusantara', 'Sekali berarti, sudah itu mati.', 'Chairil Anwar', 'Diponegoro (1943)', 'id', ARRAY['ambisi']),
+    ('sastrawan_nusantara', 'Aku ingin mencintaimu dengan sederhana.', 'Sapardi Djoko Damono', 'Aku Ingin (1989)', 'id', ARRAY['cinta']),
+    ('sastrawan_nusantara', 'Orang boleh pandai setinggi langit, tapi selama ia tidak menulis, ia akan hilang di dalam masyarakat dan dari sejarah. Menulis adalah bekerja untuk keabadian.', 'Pramoedya Ananta Toer', 'Rumah Kaca (1988)', 'id', ARRAY['ambisi', 'syukur']),
+    ('sastrawan_nusantara', 'Seorang terpelajar harus juga berlaku adil sudah sejak dalam pikiran, apalagi dalam perbuatan.', 'Pramoedya Ananta Toer', 'Bumi Manusia (1980)', 'id', ARRAY['marah']),
+    ('tokoh_bangsa', 'Habis gelap terbitlah terang.', 'R.A. Kartini', 'Habis Gelap Terbitlah Terang', 'id', ARRAY['harapan', 'sedih', 'kelelahan']),
+    ('tokoh_bangsa', 'Ing ngarsa sung tuladha, ing madya mangun karsa, tut wuri handayani.', 'Ki Hajar Dewantara', 'Semboyan Taman Siswa', 'jv', ARRAY['ambisi', 'syukur']),
+    ('tokoh_bangsa', 'Lebih baik diasingkan daripada menyerah pada kemunafikan.', 'Soe Hok Gie', 'Catatan Seorang Demonstran', 'id', ARRAY['marah', 'kesepian'])
+) AS q(collection, text, author, source, language, emotions)
+JOIN quote_collections c ON c.name = q.collection
+ON CONFLICT (collection_id, text) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions
+DROP COLUMN quote_id;
+
+ALTER TABLE messages
+DROP COLUMN quote_id;
+
+DROP TABLE IF EXISTS user_quote_collections;
+DROP TABLE IF EXISTS quotes;
+DROP TABLE IF EXISTS quote_collections;
+-- +goose StatementEnd
@@ -0,0 +1,54 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Catalog placement: order, retirement and seasonal release windows.
+-- version counts edits of the content users see (names, image and costs).
+ALTER TABLE artworks
+ADD COLUMN sort_order INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN available_from TIMESTAMPTZ,
+ADD COLUMN available_until TIMESTAMPTZ,
+ADD COLUMN retired_at TIMESTAMPTZ,
+ADD COLUMN version INTEGER NOT NULL DEFAULT 1,
+ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+ADD CONSTRAINT artworks_costs_check CHECK (unlock_cost >= 0 AND reveal_cost >= 1),
+ADD CONSTRAINT artworks_window_check CHECK (available_until IS NULL OR available_from IS NULL OR available_until > available_from);
+
+-- Every version of each artwork's content, so users keep revealing the
+-- image and reveal cost they unlocked while the catalog is edited
+CREATE TABLE IF NOT EXISTS artwork_versions (
+    artwork_id UUID NOT NULL REFERENCES artworks(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    display_name TEXT NOT NULL,
+    description TEXT NOT NULL,
+    image_url TEXT NOT NULL,
+    unlock_cost INTEGER NOT NULL,
+    reveal_cost INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (artwork_id, version)
+);
+
+INSERT INTO artwork_versions (artwork_id, version, display_name, description, image_url, unlock_cost, reveal_cost)
+SELECT id, version, display_name, description, image_url, unlock_cost, reveal_cost
+FROM artworks;
+
+-- Version each user unlocked
+ALTER TABLE user_artworks
+ADD COLUMN artwork_version INTEGER NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_artworks
+DROP COLUMN artwork_version;
+
+DROP TABLE IF EXISTS artwork_versions;
+
+ALTER TABLE artworks
+DROP CONSTRAINT artworks_window_check,
+DROP CONSTRAINT artworks_costs_check,
+DROP COLUMN updated_at,
+DROP COLUMN version,
+DROP COLUMN retired_at,
+DROP COLUMN available_until,
+DROP COLUMN available_from,
+DROP COLUMN sort_order;
+-- +goose StatementEnd
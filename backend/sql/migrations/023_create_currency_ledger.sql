@@ -0,0 +1,59 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Append-only record of every change to a user's Tinta Emas, Marmer and
+-- XP. Each entry moves delta between the user and the system account named
+-- by counterparty, so both sides of every change are recorded.
+CREATE TABLE IF NOT EXISTS currency_ledger (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id TEXT NOT NULL,
+    currency TEXT NOT NULL,
+    delta INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    counterparty TEXT NOT NULL,
+    message_id UUID REFERENCES messages(id) ON DELETE SET NULL,
+    session_id UUID REFERENCES sessions(id) ON DELETE SET NULL,
+    idempotency_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp(), -- Orders entries within a transaction
+    CONSTRAINT currency_ledger_currency_check CHECK (currency IN ('golden_ink', 'marble', 'xp')),
+    CONSTRAINT currency_ledger_delta_check CHECK (delta <> 0),
+    CONSTRAINT currency_ledger_idempotency_unique UNIQUE (user_id, idempotency_key)
+);
+
+CREATE INDEX idx_currency_ledger_user_created ON currency_ledger(user_id, created_at DESC);
+
+CREATE OR REPLACE FUNCTION currency_ledger_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND OLD.id = NEW.id AND OLD.user_id = NEW.user_id AND OLD.currency = NEW.currency
+        AND OLD.delta = NEW.delta AND OLD.reason = NEW.reason AND OLD.counterparty = NEW.counterparty
+        AND OLD.idempotency_key = NEW.idempotency_key AND OLD.created_at = NEW.created_at
+        AND (NEW.message_id IS NULL OR NEW.message_id = OLD.message_id)
+        AND (NEW.session_id IS NULL OR NEW.session_id = OLD.session_id) THEN
+        RETURN NEW; -- Source IDs may only be cleared by ON DELETE SET NULL
+    END IF;
+    RAISE EXCEPTION 'currency_ledger is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER currency_ledger_append_only
+BEFORE UPDATE OR DELETE ON currency_ledger
+FOR EACH ROW EXECUTE FUNCTION currency_ledger_append_only();
+
+-- Balances earned before the ledger existed
+INSERT INTO currency_ledger (user_id, currency, delta, reason, counterparty, idempotency_key)
+SELECT user_id, 'golden_ink', golden_ink, 'opening_balance', 'opening', 'opening_balance:golden_ink'
+FROM user_stats WHERE golden_ink <> 0;
+
+INSERT INTO currency_ledger (user_id, currency, delta, reason, counterparty, idempotency_key)
+SELECT user_id, 'marble', marble, 'opening_balance', 'opening', 'opening_balance:marble'
+FROM user_stats WHERE marble <> 0;
+
+INSERT INTO currency_ledger (user_id, currency, delta, reason, counterparty, idempotency_key)
+SELECT user_id, 'xp', total_xp, 'opening_balance', 'opening', 'opening_balance:xp'
+FROM user_stats WHERE total_xp <> 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS currency_ledger;
+DROP FUNCTION IF EXISTS currency_ledger_append_only();
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Whether a user message sent for a reply got one: 'pending' while the reply
+-- is generated, 'failed' when it can be retried and 'replied' once the reply
+-- and its rewards are saved. NULL for assistant messages and messages saved
+-- without asking for a reply.
+ALTER TABLE messages
+ADD COLUMN reply_status TEXT,
+ADD CONSTRAINT messages_reply_status_check CHECK (reply_status IN ('pending', 'failed', 'replied'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE messages
+DROP CONSTRAINT IF EXISTS messages_reply_status_check,
+DROP COLUMN reply_status;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- AI calls made outside a user's request (e.g. background jobs) are still
+-- paid for, so they are recorded without a user
+ALTER TABLE ai_usage
+ALTER COLUMN user_id DROP NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM ai_usage WHERE user_id IS NULL;
+ALTER TABLE ai_usage
+ALTER COLUMN user_id SET NOT NULL;
+-- +goose StatementEnd
@@ -26,6 +26,12 @@ SET marble = marble + $2, updated_at = NOW()
 WHERE user_id = $1
 RETURNING *;
 
+-- name: LockUserStats :one
+-- Serializes a user's purchases for the rest of the transaction
+SELECT * FROM user_stats
+WHERE user_id = $1
+FOR UPDATE;
+
 -- name: SpendGoldenInk :one
 UPDATE user_stats
 SET golden_ink = golden_ink - $2, updated_at = NOW()
@@ -77,6 +83,11 @@ INSERT INTO sessions (user_id)
 VALUES ($1)
 RETURNING *;
 
+-- name: CreateTemplateSession :one
+INSERT INTO sessions (user_id, template_id)
+VALUES ($1, $2)
+RETURNING *;
+
 -- name: GetSessionByID :one
 SELECT * FROM sessions
 WHERE id = $1 AND user_id = $2;
@@ -117,6 +128,27 @@ WHERE s.user_id = $1
 ORDER BY s.started_at DESC
 LIMIT $2 OFFSET $3;
 
+-- name: GetPreviousSession :one
+-- The user's most recent session other than the given one
+SELECT * FROM sessions
+WHERE user_id = $1 AND id <> $2
+ORDER BY started_at DESC
+LIMIT 1;
+
+-- name: ListRecentOpenings :many
+-- First assistant message of each of the user's sessions from the last 30 days, newest first
+SELECT o.content FROM (
+    SELECT DISTINCT ON (m.session_id) m.session_id, m.content, m.created_at
+    FROM messages m
+    JOIN sessions s ON s.id = m.session_id
+    WHERE s.user_id = $1
+      AND s.started_at > NOW() - INTERVAL '30 days'
+      AND m.role = 'assistant'
+    ORDER BY m.session_id, m.created_at ASC
+) o
+ORDER BY o.created_at DESC
+LIMIT $2;
+
 -- name: EndSession :one
 UPDATE sessions
 SET 
@@ -126,6 +158,56 @@ SET
 WHERE id = $1 AND user_id = $3
 RETURNING *;
 
+-- name: UpdateSessionDepth :one
+-- Depth never goes back, even when turns of the same session race
+UPDATE sessions
+SET 
+    depth_level = GREATEST(depth_level, $2),
+    depth_progress = CASE WHEN depth_level > $2 THEN depth_progress ELSE $3 END,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateSessionTemplateProgress :one
+-- Steps never go back, even when turns of the same session race
+UPDATE sessions
+SET 
+    template_step = GREATEST(template_step, sqlc.arg(step)::SMALLINT),
+    template_step_messages = CASE WHEN template_step > sqlc.arg(step)::SMALLINT THEN template_step_messages ELSE sqlc.arg(step_messages)::SMALLINT END,
+    template_step_words = CASE WHEN template_step > sqlc.arg(step)::SMALLINT THEN template_step_words ELSE sqlc.arg(step_words)::INTEGER END,
+    template_completed_at = CASE WHEN sqlc.arg(completed)::BOOLEAN THEN COALESCE(template_completed_at, NOW()) ELSE template_completed_at END,
+    updated_at = NOW()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: SetSessionTemplateOutput :exec
+UPDATE sessions
+SET template_output = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetSessionPersona :one
+UPDATE sessions
+SET persona_id = $3, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: SetSessionQuote :one
+UPDATE sessions
+SET quote_id = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SetSessionClosing :one
+UPDATE sessions
+SET 
+    title = $2,
+    summary = $3,
+    closing_message = $4,
+    closing_prompt_version = $5,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
 -- name: IncrementSessionMessages :one
 UPDATE sessions
 SET 
@@ -142,13 +224,65 @@ SET
 WHERE id = $1
 RETURNING *;
 
+-- name: UpdateSessionRunningSummary :execrows
+-- Only applies when the summary hasn't moved since it was read, so
+-- concurrent refreshes can't fold the same messages twice
+UPDATE sessions
+SET 
+    running_summary = sqlc.arg(running_summary),
+    running_summary_until = sqlc.arg(running_summary_until),
+    updated_at = NOW()
+WHERE id = sqlc.arg(id)
+  AND running_summary_until IS NOT DISTINCT FROM sqlc.narg(previous_until)::timestamptz;
+
+-- ==================== USER PREFERENCES ====================
+
+-- name: GetUserPreferences :one
+SELECT * FROM user_preferences
+WHERE user_id = $1;
+
+-- name: UpsertUserPersona :one
+INSERT INTO user_preferences (user_id, persona_id)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET persona_id = EXCLUDED.persona_id, updated_at = NOW()
+RETURNING *;
+
 -- ==================== MESSAGES ====================
 
 -- name: CreateMessage :one
-INSERT INTO messages (session_id, role, content)
-VALUES ($1, $2, $3)
+INSERT INTO messages (session_id, role, content, prompt_version, persona_id, quote_id)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: CreatePendingMessage :one
+-- A user message waiting for its reply
+INSERT INTO messages (session_id, role, content, reply_status)
+VALUES ($1, 'user', $2, 'pending')
 RETURNING *;
 
+-- name: GetSessionMessage :one
+SELECT * FROM messages
+WHERE id = $1 AND session_id = $2;
+
+-- name: MarkMessageReplied :execrows
+-- Claims the reply to a message; no rows means another attempt already replied
+UPDATE messages
+SET reply_status = 'replied'
+WHERE id = $1 AND reply_status IN ('pending', 'failed');
+
+-- name: MarkMessageReplyFailed :exec
+-- Makes a message whose reply couldn't be saved retryable
+UPDATE messages
+SET reply_status = 'failed'
+WHERE id = $1 AND reply_status = 'pending';
+
+-- name: SessionHasQuotedMessage :one
+SELECT EXISTS (
+    SELECT 1 FROM messages
+    WHERE session_id = $1 AND quote_id IS NOT NULL
+)::boolean AS quoted;
+
 -- name: ListMessagesBySession :many
 SELECT * FROM messages
 WHERE session_id = $1
@@ -168,11 +302,226 @@ WHERE session_id = $1
 ORDER BY created_at DESC
 LIMIT $2;
 
+-- name: FlagMessage :one
+-- Keeps the highest risk level when a message is flagged more than once
+UPDATE messages
+SET risk_level = CASE WHEN risk_level = 'high' THEN risk_level ELSE $2 END,
+    risk_source = CASE WHEN risk_level = 'high' THEN risk_source ELSE $3 END,
+    flagged_at = COALESCE(flagged_at, NOW())
+WHERE id = $1
+RETURNING *;
+
+-- name: ListFlaggedMessages :many
+SELECT m.*, s.user_id
+FROM messages m
+JOIN sessions s ON s.id = m.session_id
+WHERE m.flagged_at IS NOT NULL
+ORDER BY m.flagged_at DESC
+LIMIT $1;
+
+-- name: ListMessagesAfter :many
+-- Oldest messages created after a point in time, or from the start when after is NULL
+SELECT * FROM messages
+WHERE session_id = sqlc.arg(session_id)
+  AND (sqlc.narg(after)::timestamptz IS NULL OR created_at > sqlc.narg(after)::timestamptz)
+ORDER BY created_at ASC
+LIMIT sqlc.arg(row_limit);
+
+-- ==================== MESSAGE EMOTIONS ====================
+
+-- name: CreateMessageEmotions :exec
+INSERT INTO message_emotions (message_id, user_id, emotion)
+SELECT sqlc.arg(message_id), sqlc.arg(user_id), unnest(sqlc.arg(emotions)::text[])
+ON CONFLICT (message_id, emotion) DO NOTHING;
+
+-- name: CountSessionEmotions :many
+SELECT me.emotion, COUNT(*)::integer AS count
+FROM message_emotions me
+JOIN messages m ON m.id = me.message_id
+WHERE m.session_id = $1
+GROUP BY me.emotion
+ORDER BY count DESC, me.emotion;
+
+-- name: CountUserEmotionsByDay :many
+-- Days are calendar days in WIB
+SELECT
+    (created_at AT TIME ZONE 'Asia/Jakarta')::date AS day,
+    emotion,
+    COUNT(*)::integer AS count
+FROM message_emotions
+WHERE user_id = sqlc.arg(user_id)
+  AND created_at >= sqlc.arg(from_time)
+  AND created_at < sqlc.arg(to_time)
+GROUP BY day, emotion
+ORDER BY day, emotion;
+
+-- ==================== MESSAGE TOPICS ====================
+
+-- name: CreateMessageTopics :exec
+INSERT INTO message_topics (message_id, user_id, topic)
+SELECT sqlc.arg(message_id), sqlc.arg(user_id), unnest(sqlc.arg(topics)::text[])
+ON CONFLICT (message_id, topic) DO NOTHING;
+
+-- name: ListSessionTopicHistory :many
+-- Topics of the session's latest user messages, newest first
+SELECT
+    m.id,
+    COALESCE(array_agg(t.topic) FILTER (WHERE t.topic IS NOT NULL), '{}')::text[] AS topics
+FROM messages m
+LEFT JOIN message_topics t ON t.message_id = m.id
+WHERE m.session_id = $1 AND m.role = 'user'
+GROUP BY m.id, m.created_at
+ORDER BY m.created_at DESC
+LIMIT $2;
+
+-- name: CountUserTopics :many
+SELECT topic, COUNT(*)::integer AS count
+FROM message_topics
+WHERE user_id = sqlc.arg(user_id)
+  AND created_at >= sqlc.arg(from_time)
+GROUP BY topic;
+
+-- name: CountUserTopicsByDay :many
+-- Days are calendar days in WIB
+SELECT
+    (created_at AT TIME ZONE 'Asia/Jakarta')::date AS day,
+    topic,
+    COUNT(*)::integer AS count
+FROM message_topics
+WHERE user_id = sqlc.arg(user_id)
+  AND created_at >= sqlc.arg(from_time)
+  AND created_at < sqlc.arg(to_time)
+GROUP BY day, topic
+ORDER BY day, topic;
+
+-- ==================== MEMORIES ====================
+
+-- name: ListUserMemories :many
+SELECT * FROM user_memories
+WHERE user_id = $1
+ORDER BY importance DESC, last_seen_at DESC
+LIMIT $2;
+
+-- name: GetUserMemory :one
+SELECT * FROM user_memories
+WHERE id = $1 AND user_id = $2;
+
+-- name: CreateUserMemory :one
+INSERT INTO user_memories (user_id, kind, content, importance, source_session_id)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: TouchUserMemory :one
+-- Records that an extracted fact came up again; content edited by the user is kept
+UPDATE user_memories
+SET
+    content = CASE WHEN user_edited THEN content ELSE sqlc.arg(content) END,
+    importance = GREATEST(importance, sqlc.arg(importance)),
+    mentions = mentions + 1,
+    source_session_id = sqlc.arg(source_session_id),
+    last_seen_at = NOW(),
+    updated_at = NOW()
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id)
+RETURNING *;
+
+-- name: UpdateUserMemory :one
+UPDATE user_memories
+SET
+    kind = $3,
+    content = $4,
+    importance = $5,
+    user_edited = true,
+    updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteUserMemory :execrows
+DELETE FROM user_memories
+WHERE id = $1 AND user_id = $2;
+
+-- name: ListSessionsPendingMemoryExtraction :many
+-- Ended or past sessions from the last two weeks with at least one user message
+SELECT s.id FROM sessions s
+WHERE s.user_id = $1
+  AND s.memories_extracted_at IS NULL
+  AND (s.status <> 'active' OR s.started_at::date < CURRENT_DATE)
+  AND s.started_at > NOW() - INTERVAL '14 days'
+  AND EXISTS (SELECT 1 FROM messages m WHERE m.session_id = s.id AND m.role = 'user')
+ORDER BY s.started_at DESC
+LIMIT $2;
+
+-- name: ClaimSessionMemoryExtraction :execrows
+-- Claims a session so concurrent requests extract its memories only once
+UPDATE sessions
+SET memories_extracted_at = NOW()
+WHERE id = $1 AND memories_extracted_at IS NULL;
+
+-- name: ReleaseSessionMemoryExtraction :exec
+UPDATE sessions
+SET memories_extracted_at = NULL
+WHERE id = $1;
+
+-- ==================== CURRENCY LEDGER ====================
+
+-- name: CreateLedgerEntry :execrows
+-- A no-op when the user already has an entry with the idempotency key
+INSERT INTO currency_ledger (user_id, currency, delta, reason, counterparty, message_id, session_id, idempotency_key)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (user_id, idempotency_key) DO NOTHING;
+
+-- name: ListLedgerEntries :many
+-- A user's entries newest first, each with its currency's balance after it
+SELECT
+    e.id,
+    e.currency,
+    e.delta,
+    e.reason,
+    e.message_id,
+    e.session_id,
+    e.created_at,
+    e.balance_after
+FROM (
+    SELECT
+        l.*,
+        (SUM(l.delta) OVER (PARTITION BY l.currency ORDER BY l.created_at, l.id))::integer AS balance_after
+    FROM currency_ledger l
+    WHERE l.user_id = $1
+) e
+ORDER BY e.created_at DESC, e.id DESC
+LIMIT $2 OFFSET $3;
+
+-- name: ListLedgerMismatches :many
+-- Users whose balances differ from the sum of their ledger entries
+SELECT
+    s.user_id,
+    s.golden_ink,
+    s.marble,
+    s.total_xp,
+    COALESCE(l.golden_ink, 0)::integer AS ledger_golden_ink,
+    COALESCE(l.marble, 0)::integer AS ledger_marble,
+    COALESCE(l.xp, 0)::integer AS ledger_xp
+FROM user_stats s
+LEFT JOIN (
+    SELECT
+        user_id,
+        SUM(delta) FILTER (WHERE currency = 'golden_ink') AS golden_ink,
+        SUM(delta) FILTER (WHERE currency = 'marble') AS marble,
+        SUM(delta) FILTER (WHERE currency = 'xp') AS xp
+    FROM currency_ledger
+    GROUP BY user_id
+) l ON l.user_id = s.user_id
+WHERE s.golden_ink <> COALESCE(l.golden_ink, 0)
+    OR s.marble <> COALESCE(l.marble, 0)
+    OR s.total_xp <> COALESCE(l.xp, 0)
+ORDER BY s.user_id
+LIMIT $1;
+
 -- ==================== ARTWORKS ====================
 
 -- name: ListArtworks :many
+-- The whole catalog, including retired and scheduled artworks
 SELECT * FROM artworks
-ORDER BY unlock_cost ASC;
+ORDER BY sort_order ASC, unlock_cost ASC, display_name ASC;
 
 -- name: GetArtworkByID :one
 SELECT * FROM artworks
@@ -183,12 +532,89 @@ SELECT * FROM artworks
 WHERE name = $1;
 
 -- name: CreateArtwork :one
-INSERT INTO artworks (name, display_name, description, image_url, unlock_cost, reveal_cost)
-VALUES ($1, $2, $3, $4, $5, $6)
+INSERT INTO artworks (
+    name, display_name, description, image_url, unlock_cost, reveal_cost,
+    sort_order, available_from, available_until, retired_at
+)
+VALUES (
+    sqlc.arg(name), sqlc.arg(display_name), sqlc.arg(description), sqlc.arg(image_url),
+    sqlc.arg(unlock_cost), sqlc.arg(reveal_cost), sqlc.arg(sort_order),
+    sqlc.narg(available_from), sqlc.narg(available_until),
+    CASE WHEN sqlc.arg(retired)::boolean THEN NOW() END
+)
+RETURNING *;
+
+-- name: UpdateArtwork :one
+-- Bumps the version when the content users see changes; placement edits
+-- (order, schedule, retirement) keep it
+UPDATE artworks
+SET
+    display_name = sqlc.arg(display_name),
+    description = sqlc.arg(description),
+    image_url = sqlc.arg(image_url),
+    unlock_cost = sqlc.arg(unlock_cost),
+    reveal_cost = sqlc.arg(reveal_cost),
+    sort_order = sqlc.arg(sort_order),
+    available_from = sqlc.narg(available_from),
+    available_until = sqlc.narg(available_until),
+    retired_at = CASE WHEN sqlc.arg(retired)::boolean THEN COALESCE(retired_at, NOW()) END,
+    version = version + CASE
+        WHEN (display_name, description, image_url, unlock_cost, reveal_cost)
+            IS DISTINCT FROM (sqlc.arg(display_name)::text, sqlc.arg(description)::text, sqlc.arg(image_url)::text, sqlc.arg(unlock_cost)::integer, sqlc.arg(reveal_cost)::integer)
+        THEN 1 ELSE 0
+    END,
+    updated_at = NOW()
+WHERE id = sqlc.arg(id)
 RETURNING *;
 
+-- name: CreateArtworkVersion :exec
+-- Snapshots an artwork's current content; a no-op if the version exists
+INSERT INTO artwork_versions (artwork_id, version, display_name, description, image_url, unlock_cost, reveal_cost)
+SELECT id, version, display_name, description, image_url, unlock_cost, reveal_cost
+FROM artworks
+WHERE id = $1
+ON CONFLICT (artwork_id, version) DO NOTHING;
+
+-- name: GetArtworkVersion :one
+SELECT * FROM artwork_versions
+WHERE artwork_id = $1 AND version = $2;
+
+-- name: ListArtworkVersions :many
+SELECT * FROM artwork_versions
+WHERE artwork_id = $1
+ORDER BY version DESC;
+
 -- ==================== USER ARTWORKS ====================
 
+-- name: ListGallery :many
+-- The available catalog with the user's state of each artwork. Artworks
+-- the user unlocked show the version they unlocked, even once retired or
+-- out of season; the rest are 'locked' at 0%.
+SELECT
+    a.id,
+    a.name,
+    av.version,
+    av.display_name,
+    av.description,
+    av.image_url,
+    av.unlock_cost,
+    av.reveal_cost,
+    a.sort_order,
+    a.available_until,
+    COALESCE(ua.status, 'locked')::text AS status,
+    COALESCE(ua.progress, 0)::integer AS progress,
+    ua.unlocked_at,
+    ua.completed_at
+FROM artworks a
+LEFT JOIN user_artworks ua ON ua.artwork_id = a.id AND ua.user_id = $1
+JOIN artwork_versions av ON av.artwork_id = a.id AND av.version = COALESCE(ua.artwork_version, a.version)
+WHERE ua.id IS NOT NULL OR (
+    a.retired_at IS NULL
+    AND (a.available_from IS NULL OR a.available_from <= NOW())
+    AND (a.available_until IS NULL OR a.available_until > NOW())
+)
+ORDER BY a.sort_order ASC, av.unlock_cost ASC, av.display_name ASC;
+
 -- name: GetUserArtwork :one
 SELECT * FROM user_artworks
 WHERE user_id = $1 AND artwork_id = $2;
@@ -197,19 +623,20 @@ WHERE user_id = $1 AND artwork_id = $2;
 SELECT 
     ua.*,
     a.name,
-    a.display_name,
-    a.description,
-    a.image_url,
-    a.unlock_cost,
-    a.reveal_cost
+    av.display_name,
+    av.description,
+    av.image_url,
+    av.unlock_cost,
+    av.reveal_cost
 FROM user_artworks ua
 JOIN artworks a ON ua.artwork_id = a.id
+JOIN artwork_versions av ON av.artwork_id = ua.artwork_id AND av.version = ua.artwork_version
 WHERE ua.user_id = $1
 ORDER BY ua.created_at DESC;
 
 -- name: UnlockArtwork :one
-INSERT INTO user_artworks (user_id, artwork_id, status, unlocked_at)
-VALUES ($1, $2, 'in_progress', NOW())
+INSERT INTO user_artworks (user_id, artwork_id, artwork_version, status, unlocked_at)
+VALUES ($1, $2, $3, 'in_progress', NOW())
 RETURNING *;
 
 -- name: UpdateArtworkProgress :one
@@ -226,22 +653,86 @@ RETURNING *;
 SELECT 
     ua.*,
     a.name,
-    a.display_name,
-    a.description,
-    a.image_url,
-    a.unlock_cost,
-    a.reveal_cost
+    av.display_name,
+    av.description,
+    av.image_url,
+    av.unlock_cost,
+    av.reveal_cost
 FROM user_artworks ua
 JOIN artworks a ON ua.artwork_id = a.id
+JOIN artwork_versions av ON av.artwork_id = ua.artwork_id AND av.version = ua.artwork_version
 WHERE ua.user_id = $1 AND ua.status = 'in_progress'
 ORDER BY ua.unlocked_at DESC
 LIMIT 1;
 
+-- ==================== QUOTES ====================
+
+-- name: ListQuoteCollections :many
+-- Free collections count as unlocked for everyone
+SELECT
+    c.*,
+    COUNT(q.id)::integer AS quote_count,
+    (c.unlock_cost = 0 OR u.user_id IS NOT NULL)::boolean AS unlocked
+FROM quote_collections c
+LEFT JOIN quotes q ON q.collection_id = c.id
+LEFT JOIN user_quote_collections u ON u.collection_id = c.id AND u.user_id = $1
+GROUP BY c.id, u.user_id
+ORDER BY c.unlock_cost, c.display_name;
+
+-- name: GetQuoteCollection :one
+SELECT
+    c.*,
+    (c.unlock_cost = 0 OR u.user_id IS NOT NULL)::boolean AS unlocked
+FROM quote_collections c
+LEFT JOIN user_quote_collections u ON u.collection_id = c.id AND u.user_id = $2
+WHERE c.id = $1;
+
+-- name: ListQuotesByCollection :many
+SELECT * FROM quotes
+WHERE collection_id = $1
+ORDER BY author, created_at;
+
+-- name: GetQuoteByID :one
+SELECT * FROM quotes
+WHERE id = $1;
+
+-- name: UnlockQuoteCollection :execrows
+INSERT INTO user_quote_collections (user_id, collection_id)
+VALUES ($1, $2)
+ON CONFLICT (user_id, collection_id) DO NOTHING;
+
+-- name: MatchQuote :one
+-- A quote from the user's unlocked collections sharing the given emotions.
+-- Quotes the user saw in the last 30 days go last, then the ones sharing the
+-- most emotions go first.
+SELECT q.*
+FROM quotes q
+JOIN quote_collections c ON c.id = q.collection_id
+LEFT JOIN user_quote_collections u ON u.collection_id = c.id AND u.user_id = sqlc.arg(user_id)
+WHERE q.emotions && sqlc.arg(emotions)::TEXT[]
+  AND (c.unlock_cost = 0 OR u.user_id IS NOT NULL)
+ORDER BY
+    (
+        EXISTS (
+            SELECT 1 FROM messages m
+            JOIN sessions s ON s.id = m.session_id
+            WHERE s.user_id = sqlc.arg(user_id) AND m.quote_id = q.id
+              AND m.created_at > NOW() - INTERVAL '30 days'
+        ) OR EXISTS (
+            SELECT 1 FROM sessions s
+            WHERE s.user_id = sqlc.arg(user_id) AND s.quote_id = q.id
+              AND s.updated_at > NOW() - INTERVAL '30 days'
+        )
+    ),
+    cardinality(ARRAY(SELECT unnest(q.emotions) INTERSECT SELECT unnest(sqlc.arg(emotions)::TEXT[]))) DESC,
+    random()
+LIMIT 1;
+
 -- ==================== WEEKLY SUMMARIES ====================
 
 -- name: CreateWeeklySummary :one
-INSERT INTO weekly_summaries (user_id, week_start, week_end, summary, session_count, message_count, emotions)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
+INSERT INTO weekly_summaries (user_id, week_start, week_end, summary, session_count, message_count, emotions, prompt_version)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 RETURNING *;
 
 -- name: GetWeeklySummary :one
@@ -350,3 +841,135 @@ SELECT EXISTS(
     UNION
     SELECT 1 FROM pending_upgrades pu WHERE pu.trakteer_transaction_id = $1
 ) as processed;
+
+-- ==================== AI USAGE ====================
+
+-- name: CreateAIUsage :one
+INSERT INTO ai_usage (user_id, session_id, feature, model, prompt_tokens, completion_tokens, latency_ms, estimated_cost_micros)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: AggregateAIUsageByDay :many
+-- Days are WIB days; calls without a user are reported under the 'none' plan
+SELECT
+    (u.created_at AT TIME ZONE 'Asia/Jakarta')::date AS day,
+    (CASE WHEN u.user_id IS NULL THEN 'none' ELSE COALESCE(us.plan, 'free') END)::text AS plan,
+    COUNT(*)::integer AS calls,
+    COUNT(DISTINCT u.user_id)::integer AS active_users,
+    COALESCE(SUM(u.prompt_tokens), 0)::bigint AS prompt_tokens,
+    COALESCE(SUM(u.completion_tokens), 0)::bigint AS completion_tokens,
+    COALESCE(SUM(u.estimated_cost_micros), 0)::bigint AS cost_micros
+FROM ai_usage u
+LEFT JOIN user_subscriptions us ON us.user_id = u.user_id
+WHERE u.created_at >= $1 AND u.created_at < $2
+GROUP BY day, plan
+ORDER BY day ASC, plan ASC;
+
+-- name: AggregateAIUsageByPlan :many
+-- Calls without a user are reported under the 'none' plan
+SELECT
+    (CASE WHEN u.user_id IS NULL THEN 'none' ELSE COALESCE(us.plan, 'free') END)::text AS plan,
+    u.feature,
+    COUNT(*)::integer AS calls,
+    COUNT(DISTINCT u.user_id)::integer AS active_users,
+    COALESCE(SUM(u.prompt_tokens), 0)::bigint AS prompt_tokens,
+    COALESCE(SUM(u.completion_tokens), 0)::bigint AS completion_tokens,
+    COALESCE(SUM(u.estimated_cost_micros), 0)::bigint AS cost_micros,
+    COALESCE(AVG(u.latency_ms), 0)::integer AS avg_latency_ms
+FROM ai_usage u
+LEFT JOIN user_subscriptions us ON us.user_id = u.user_id
+WHERE u.created_at >= $1 AND u.created_at < $2
+GROUP BY plan, u.feature
+ORDER BY plan ASC, u.feature ASC;
+
+-- name: GetUserTokenUsage :one
+SELECT
+    COALESCE((SELECT us.plan FROM user_subscriptions us WHERE us.user_id = sqlc.arg(user_id)), 'free')::text AS plan,
+    COALESCE(SUM(u.prompt_tokens + u.completion_tokens) FILTER (WHERE u.created_at >= sqlc.arg(day_start)::timestamptz), 0)::bigint AS daily_tokens,
+    COALESCE(SUM(u.prompt_tokens + u.completion_tokens), 0)::bigint AS monthly_tokens
+FROM ai_usage u
+WHERE u.user_id = sqlc.arg(user_id) AND u.created_at >= sqlc.arg(month_start)::timestamptz;
+
+-- name: AggregatePromptVersions :many
+-- Compares prompt versions by how users engage with the messages they produced
+SELECT
+    m.prompt_version::text AS prompt_version,
+    COUNT(*)::integer AS messages,
+    COUNT(DISTINCT m.session_id)::integer AS sessions,
+    COALESCE(AVG(LENGTH(r.content)), 0)::integer AS avg_reply_length,
+    COUNT(r.id)::integer AS replies
+FROM messages m
+LEFT JOIN LATERAL (
+    SELECT n.id, n.content FROM messages n
+    WHERE n.session_id = m.session_id AND n.role = 'user' AND n.created_at > m.created_at
+    ORDER BY n.created_at ASC
+    LIMIT 1
+) r ON TRUE
+WHERE m.role = 'assistant' AND m.prompt_version IS NOT NULL
+  AND m.created_at >= $1 AND m.created_at < $2
+GROUP BY m.prompt_version
+ORDER BY messages DESC;
+
+-- ==================== EXPERIMENTS ====================
+
+-- name: ListUserExperimentAssignments :many
+SELECT * FROM experiment_assignments
+WHERE user_id = $1;
+
+-- name: CreateExperimentAssignment :one
+-- Returns the existing assignment when the user is already enrolled
+INSERT INTO experiment_assignments (user_id, experiment, variant)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, experiment) DO UPDATE SET variant = experiment_assignments.variant
+RETURNING *;
+
+-- name: GetExperimentOutcomes :many
+-- Outcome metrics per variant, counting only activity after each user's assignment.
+-- Days are WIB calendar days; today is excluded from return rates since it isn't over.
+WITH assigned AS (
+    SELECT ea.user_id, ea.variant, ea.assigned_at
+    FROM experiment_assignments ea
+    WHERE ea.experiment = $1
+),
+variant_sessions AS (
+    SELECT a.variant, s.user_id, s.id, (s.started_at AT TIME ZONE 'Asia/Jakarta')::date AS day
+    FROM assigned a
+    JOIN sessions s ON s.user_id = a.user_id AND s.started_at >= a.assigned_at
+),
+session_lengths AS (
+    SELECT vs.variant, vs.id, COUNT(m.id) AS user_messages
+    FROM variant_sessions vs
+    LEFT JOIN messages m ON m.session_id = vs.id AND m.role = 'user'
+    GROUP BY vs.variant, vs.id
+),
+message_words AS (
+    SELECT vs.variant, COALESCE(array_length(regexp_split_to_array(btrim(m.content), '\s+'), 1), 0) AS words
+    FROM variant_sessions vs
+    JOIN messages m ON m.session_id = vs.id AND m.role = 'user'
+),
+active_days AS (
+    SELECT DISTINCT vs.variant, vs.user_id, vs.day
+    FROM variant_sessions vs
+),
+day_outcomes AS (
+    SELECT d.variant, d.user_id, d.day,
+        EXISTS (
+            SELECT 1 FROM active_days n
+            WHERE n.user_id = d.user_id AND n.variant = d.variant AND n.day = d.day + 1
+        ) AS returned_next_day,
+        d.day = MIN(d.day) OVER (PARTITION BY d.variant, d.user_id) AS is_first_day
+    FROM active_days d
+    WHERE d.day < (NOW() AT TIME ZONE 'Asia/Jakarta')::date
+)
+SELECT
+    a.variant,
+    COUNT(*)::integer AS users,
+    (SELECT COUNT(DISTINCT ad.user_id) FROM active_days ad WHERE ad.variant = a.variant)::integer AS active_users,
+    (SELECT COUNT(*) FROM session_lengths sl WHERE sl.variant = a.variant)::integer AS sessions,
+    (SELECT COALESCE(AVG(mw.words), 0) FROM message_words mw WHERE mw.variant = a.variant)::float8 AS avg_words_per_message,
+    (SELECT COALESCE(AVG(sl.user_messages), 0) FROM session_lengths sl WHERE sl.variant = a.variant)::float8 AS avg_session_length,
+    (SELECT COALESCE(AVG(CASE WHEN o.returned_next_day THEN 1 ELSE 0 END), 0) FROM day_outcomes o WHERE o.variant = a.variant AND o.is_first_day)::float8 AS next_day_return_rate,
+    (SELECT COALESCE(AVG(CASE WHEN o.returned_next_day THEN 1 ELSE 0 END), 0) FROM day_outcomes o WHERE o.variant = a.variant)::float8 AS streak_continuation_rate
+FROM assigned a
+GROUP BY a.variant
+ORDER BY a.variant;